@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rs/zerolog"
 
 	"github.com/falentio/skul/internal/app"
+	"github.com/falentio/skul/internal/pkg/logging"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
@@ -25,6 +29,14 @@ func main() {
 	if err := opts.Init(); err != nil {
 		logger.Fatal().Err(err).Msg("failed to init options")
 	}
+	// options may change log level and format of logger used until now
+	configured, err := logging.New(opts.Log, os.Stdout)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to init logger")
+	}
+	logger = configured
+	response.SetLogger(logger)
+	opts.Logger = logger
 	logger.Info().Interface("options", opts).Msg("configured options")
 
 	app := app.Application{
@@ -32,18 +44,39 @@ func main() {
 		Logger:  logger,
 	}
 
+	if err := app.InitTracing(); err != nil {
+		logger.Fatal().Err(err).Msg("failed to init tracing")
+	}
+
 	app.InitRepository()
 
+	if err := app.InitStorage(); err != nil {
+		logger.Fatal().Err(err).Msg("failed to init storage")
+	}
+
 	logger.Info().Msg("seeding repository")
 	if err := app.SeedRepository(); err != nil {
 		logger.Fatal().Err(err).Msg("failed while seeding repository")
 	}
 
+	if err := app.InitTLS(); err != nil {
+		logger.Fatal().Err(err).Msg("failed to init tls")
+	}
+
+	if err := app.InitKeys(); err != nil {
+		logger.Fatal().Err(err).Msg("failed to init session signing keys")
+	}
+
 	logger.Info().Msg("initializing handler")
 	app.InitHandler()
+	app.InitWorkers()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	logger.Info().Str("address", opts.Addr).Msg("app server started")
-	if err := app.ListenAndServe(); err != nil {
+	if err := app.ListenAndServe(ctx); err != nil {
 		logger.Fatal().Err(err).Msg("failed to run http server")
 	}
+	logger.Info().Msg("app server stopped")
 }
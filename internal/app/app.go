@@ -1,12 +1,15 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"net/http"
 	"reflect"
 	"time"
 
+	"github.com/falentio/raid-go"
 	"github.com/glebarez/sqlite"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -20,10 +23,22 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/csrf"
+	"github.com/falentio/skul/internal/pkg/idempotency"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/metrics"
+	"github.com/falentio/skul/internal/pkg/password"
 	"github.com/falentio/skul/internal/pkg/response"
 	"github.com/falentio/skul/internal/pkg/seeder"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/service/admin"
+	"github.com/falentio/skul/internal/service/api_token"
+	"github.com/falentio/skul/internal/service/audit_log"
 	"github.com/falentio/skul/internal/service/enterance_token"
 	"github.com/falentio/skul/internal/service/examination"
 	"github.com/falentio/skul/internal/service/examine_answer"
@@ -31,23 +46,47 @@ import (
 	"github.com/falentio/skul/internal/service/examine_question"
 	"github.com/falentio/skul/internal/service/examine_student"
 	"github.com/falentio/skul/internal/service/file"
+	"github.com/falentio/skul/internal/service/organization"
 	"github.com/falentio/skul/internal/service/student"
 	"github.com/falentio/skul/internal/service/student_answer"
 	"github.com/falentio/skul/web"
 )
 
 type Repository struct {
+	OrganizationRepository       domain.OrganizationRepository
 	AdminRepository              domain.AdminRepository
+	APITokenRepository           domain.APITokenRepository
+	AuditLogRepository           domain.AuditLogRepository
 	EnteranceTokenRepository     domain.EnteranceTokenRepository
 	ExaminationRepository        domain.ExaminationRepository
 	ExamineAnswerRepository      domain.ExamineAnswerRepository
 	ExamineAttatchmentRepository domain.ExamineAttatchmentRepository
-	ExamineStudentRepository     domain.ExamineStudentRepositoryRead
+	ExamineStudentRepository     domain.ExamineStudentRepository
 	ExamineQuestionRepository    domain.ExamineQuestionRepository
+	QuestionFlagRepository       domain.QuestionFlagRepository
 	StudentRepository            domain.StudentRepository
 	StudentAnswerRepository      domain.StudentAnswerRepository
 }
 
+// models are migrated by (*Application).InitRepository, readiness probe
+// checks their schema is up to date.
+var models = []any{
+	&domain.Organization{},
+	&domain.Admin{},
+	&domain.APIToken{},
+	&domain.AuditLog{},
+	&domain.EnteranceToken{},
+	&domain.Examination{},
+	&domain.ExaminationSection{},
+	&domain.ExamineAnswer{},
+	&domain.ExamineAttatchment{},
+	&domain.ExamineStudent{},
+	&domain.ExamineQuestion{},
+	&domain.QuestionFlag{},
+	&domain.Student{},
+	&domain.StudentAnswer{},
+}
+
 type Application struct {
 	Options AppOptions
 	Logger  zerolog.Logger
@@ -55,6 +94,15 @@ type Application struct {
 	router     chi.Router
 	storage    storage.Storage
 	repository Repository
+	workers    []namedWorker
+	tlsConfig  *tls.Config
+	keys       *auth.KeySet
+	metrics    *metrics.Metrics
+	tracing    *tracing.Tracing
+	db         *gorm.DB
+	// organization is seeded default organization, it is organization of
+	// logins without organization.
+	organization raid.Raid
 }
 
 func (app *Application) repositoryGuard() {
@@ -75,9 +123,13 @@ func (app *Application) Handler() http.Handler {
 	return app.router
 }
 
-func (app *Application) ListenAndServe() error {
-	app.repositoryGuard()
-	return http.ListenAndServe(app.Options.Addr, app.Handler())
+// Metrics returns collectors of app, they are shared by database, storage
+// and handler.
+func (app *Application) Metrics() *metrics.Metrics {
+	if app.metrics == nil {
+		app.metrics = metrics.New()
+	}
+	return app.metrics
 }
 
 func (app *Application) InitStorage() error {
@@ -93,6 +145,12 @@ func (app *Application) InitStorage() error {
 		}
 		app.storage = memory.New(app.Options.Storage.Memory)
 	}
+	// storage is shared by every service, auth, login guard and idempotency,
+	// each of them binds it to context of request with tracing.Bind
+	if app.storage != nil {
+		app.storage = &metrics.Storage{Storage: app.storage, Metrics: app.Metrics()}
+		app.storage = &tracing.Storage{Storage: app.storage, Tracing: app.tracing}
+	}
 	return nil
 }
 
@@ -110,9 +168,24 @@ func (app *Application) initGormRepository(dialect gorm.Dialector) error {
 	if err != nil {
 		return err
 	}
+	if err := db.Use(&metrics.GormPlugin{Metrics: app.Metrics()}); err != nil {
+		return err
+	}
+	if err := db.Use(&tracing.GormPlugin{Tracing: app.tracing}); err != nil {
+		return err
+	}
+	app.repository.OrganizationRepository = &organization.OrganizationRepositoryGorm{
+		DB: db,
+	}
 	app.repository.AdminRepository = &admin.AdminRepositoryGorm{
 		DB: db,
 	}
+	app.repository.APITokenRepository = &apitoken.APITokenRepositoryGorm{
+		DB: db,
+	}
+	app.repository.AuditLogRepository = &auditlog.AuditLogRepositoryGorm{
+		DB: db,
+	}
 	app.repository.StudentRepository = &student.StudentRepositoryGorm{
 		DB: db,
 	}
@@ -137,26 +210,27 @@ func (app *Application) initGormRepository(dialect gorm.Dialector) error {
 	app.repository.StudentAnswerRepository = &studentanswer.StudentAnswerRepositoryGorm{
 		DB: db,
 	}
-	if err := db.AutoMigrate(
-		&domain.Admin{},
-		&domain.EnteranceToken{},
-		&domain.Examination{},
-		&domain.ExamineAnswer{},
-		&domain.ExamineAttatchment{},
-		&domain.ExamineStudent{},
-		&domain.ExamineQuestion{},
-		&domain.Student{},
-	); err != nil {
+	app.repository.QuestionFlagRepository = &studentanswer.QuestionFlagRepositoryGorm{
+		DB: db,
+	}
+	if err := db.AutoMigrate(models...); err != nil {
 		return err
 	}
+	app.db = db
 	return nil
 }
 
 func (app *Application) SeedRepository() error {
-	if err := seeder.AdminRepository(app.repository.AdminRepository); err != nil {
+	org, err := seeder.OrganizationRepository(app.repository.OrganizationRepository)
+	if err != nil {
+		return err
+	}
+	app.organization = org.ID
+	ctx := tenant.WithOrganization(context.Background(), org.ID)
+	if err := seeder.AdminRepository(ctx, app.repository.AdminRepository); err != nil {
 		return err
 	}
-	if err := seeder.StudentRepository(app.repository.StudentRepository); err != nil {
+	if err := seeder.StudentRepository(ctx, app.repository.StudentRepository); err != nil {
 		return err
 	}
 	return nil
@@ -169,103 +243,244 @@ func (app *Application) InitHandler() {
 	}
 	auth := &auth.Auth{
 		Name:          "session",
-		Secure:        false,
+		Secure:        app.Options.SecureCookie || app.Options.TLSEnabled(),
 		SigningMethod: jwt.SigningMethodHS512,
 		Secret:        secret,
 		Logger:        app.Logger,
+		Keys:          app.keys,
+
+		Lifetime:         app.Options.Session.Lifetime,
+		RefreshThreshold: app.Options.Session.RefreshThreshold,
+		Storage:          app.storage,
 	}
-	adminRouter := &admin.AdminRouter{
+	resetter := &password.Resetter{
+		Storage:  app.storage,
+		Lifetime: app.Options.Password.ResetCodeLifetime,
+	}
+	guard, err := loginguard.New(app.Options.Login, app.storage, app.Logger)
+	if err != nil {
+		app.Logger.Fatal().Err(err).Msg("failed to create login guard")
+	}
+	adminProviders, err := identity.NewProviders(app.Options.Identity.Admin, app.storage)
+	if err != nil {
+		app.Logger.Fatal().Err(err).Msg("failed to create admin identity providers")
+	}
+	studentProviders, err := identity.NewProviders(app.Options.Identity.Student, app.storage)
+	if err != nil {
+		app.Logger.Fatal().Err(err).Msg("failed to create student identity providers")
+	}
+	idem := &idempotency.Idempotency{
+		Storage: app.storage,
+		Auth:    auth,
+		TTL:     app.Options.Idempotency.TTL,
+		Logger:  app.Logger,
+	}
+	recorder := &audit.Recorder{
+		Repository: app.repository.AuditLogRepository,
+		Auth:       auth,
+	}
+	auditLogRouter := &auditlog.AuditLogRouter{
 		Auth: auth,
+		AuditLogService: &auditlog.AuditLogService{
+			AuditLogRepository: app.repository.AuditLogRepository,
+			Auth:               auth,
+			Tracing:            app.tracing,
+			Logger:             app.Logger,
+		},
+	}
+	apiTokenService := &apitoken.APITokenService{
+		APITokenRepository: app.repository.APITokenRepository,
+		Auth:               auth,
+		Tracing:            app.tracing,
+		Audit:              recorder,
+		Logger:             app.Logger,
+	}
+	auth.Tokens = apiTokenService
+	apiTokenRouter := &apitoken.APITokenRouter{
+		Auth:            auth,
+		Idempotency:     idem,
+		APITokenService: apiTokenService,
+	}
+	adminRouter := &admin.AdminRouter{
+		Auth:        auth,
+		Idempotency: idem,
+		Guard:       guard,
 		AdminService: &admin.AdminService{
 			AdminRepository: app.repository.AdminRepository,
 			Auth:            auth,
+			Tracing:         app.tracing,
 			Logger:          app.Logger,
+			PasswordPolicy:  app.Options.Password.Admin,
+			Resetter:        resetter,
+			Guard:           guard,
+			Audit:           recorder,
+			Storage:         app.storage,
+			TOTPIssuer:      app.Options.TOTP.Issuer,
+			Providers:       adminProviders,
+			Organization:    app.organization,
 		},
 	}
 	studentRouter := &student.StudentRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
+		Guard:       guard,
 		StudentService: &student.StudentService{
-			StudentRepository: app.repository.StudentRepository,
-			Auth:              auth,
-			Logger:            app.Logger,
+			StudentRepository:        app.repository.StudentRepository,
+			ExamineStudentRepository: app.repository.ExamineStudentRepository,
+			EnteranceTokenRepository: app.repository.EnteranceTokenRepository,
+			Auth:                     auth,
+			Tracing:                  app.tracing,
+			Logger:                   app.Logger,
+			Storage:                  app.storage,
+			SessionPolicy:            student.SessionPolicy(app.Options.Session.StudentPolicy),
+			PasswordPolicy:           app.Options.Password.Student,
+			Resetter:                 resetter,
+			Guard:                    guard,
+			Audit:                    recorder,
+			Providers:                studentProviders,
+			Organization:             app.organization,
 		},
 	}
 	fileRouter := &file.FileRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		FileService: &file.FileService{
 			Auth:    auth,
+			Tracing: app.tracing,
 			Logger:  app.Logger,
 			Storage: app.storage,
 		},
 	}
 	examinationRouter := &examination.ExaminationRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		ExaminationService: &examination.ExaminationService{
 			ExaminationRepository: app.repository.ExaminationRepository,
+			Auth:                  auth,
+			Tracing:               app.tracing,
+			Audit:                 recorder,
+			Logger:                app.Logger,
 		},
 	}
 	examineQuestionRouter := &examinequestion.ExamineQuestionRouter{
 		Auth: auth,
 		ExamineQuestionService: &examinequestion.ExamineQuestionService{
 			Auth:                         auth,
+			Tracing:                      app.tracing,
 			Logger:                       app.Logger,
 			ExamineQuestionRepository:    app.repository.ExamineQuestionRepository,
 			ExamineAnswerRepository:      app.repository.ExamineAnswerRepository,
 			ExamineAttatchmentRepository: app.repository.ExamineAttatchmentRepository,
+			Audit:                        recorder,
 		},
 	}
 	examineAnswerRouter := &examineanswer.ExamineAnswerRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		ExamineAnswerService: &examineanswer.ExamineAnswerService{
 			Auth:                    auth,
+			Tracing:                 app.tracing,
 			ExamineAnswerRepository: app.repository.ExamineAnswerRepository,
+			Audit:                   recorder,
 		},
 	}
 	examineAttatchmentRouter := &examineattatchment.ExamineAttatchmentRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		ExamineAttatchmentService: &examineattatchment.ExamineAttatchmentService{
 			Auth:                         auth,
+			Tracing:                      app.tracing,
 			Logger:                       app.Logger,
 			ExamineAttatchmentRepository: app.repository.ExamineAttatchmentRepository,
 		},
 	}
 	enteranceTokenRouter := &enterancetoken.EnteranceTokenRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		EnteranceTokenService: &enterancetoken.EnteranceTokenService{
 			Auth:                     auth,
+			Tracing:                  app.tracing,
 			EnteranceTokenRepository: app.repository.EnteranceTokenRepository,
+			ExaminationRepository:    app.repository.ExaminationRepository,
+			ExamineStudentRepository: app.repository.ExamineStudentRepository,
+			StudentRepository:        app.repository.StudentRepository,
+			APITokenIssuer:           apiTokenService,
+			Audit:                    recorder,
+			EntryGrace:               app.Options.Exam.EntryGrace,
 		},
 	}
 	studentAnswerRouter := &studentanswer.StudentAnswerRouter{
-		Auth: auth,
+		Auth:        auth,
+		Idempotency: idem,
 		StudentAnswerService: &studentanswer.StudentAnswerService{
-			Auth:                    auth,
-			StudentAnswerRepository: app.repository.StudentAnswerRepository,
+			Auth:                      auth,
+			Tracing:                   app.tracing,
+			StudentAnswerRepository:   app.repository.StudentAnswerRepository,
+			QuestionFlagRepository:    app.repository.QuestionFlagRepository,
+			ExaminationRepository:     app.repository.ExaminationRepository,
+			EnteranceTokenRepository:  app.repository.EnteranceTokenRepository,
+			ExamineAnswerRepository:   app.repository.ExamineAnswerRepository,
+			ExamineQuestionRepository: app.repository.ExamineQuestionRepository,
+			ExamineStudentRepository:  app.repository.ExamineStudentRepository,
+			EntryGrace:                app.Options.Exam.EntryGrace,
+			SyncGrace:                 app.Options.Exam.SyncGrace,
+			Metrics:                   app.Metrics(),
 		},
 	}
+	app.Metrics().ActiveAttempts(func(ctx context.Context) (int64, error) {
+		// attempts of every organization are counted
+		return app.repository.ExamineStudentRepository.CountActiveExamineStudent(tenant.Unscoped(ctx), time.Now())
+	})
+	app.Metrics().TokenAnswers(func(ctx context.Context) (map[string]int64, error) {
+		return app.repository.StudentAnswerRepository.CountOpenStudentAnswer(tenant.Unscoped(ctx), time.Now())
+	})
 
 	r := chi.NewRouter()
 
 	// register middewares
-	r.Use(middleware.Logger)
-	r.Use(middleware.RealIP)
+	// forwarded address is only honoured from trusted proxies, since login
+	// rate limit and lockout events rely on it
+	r.Use(guard.RealIP)
 	r.Use(middleware.RequestID)
+	r.Use(logging.AccessLog(app.Logger))
+	r.Use(app.tracing.Middleware)
+	r.Use(app.Metrics().Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(time.Second * 5))
 	r.Use(middleware.AllowContentType("application/json", "multipart/form-data"))
-	r.Use(cors.Handler(cors.Options{
-		AllowCredentials: true,
-		MaxAge:           7200,
+	// cross origin requests are refused unless origin is explicitly allowed
+	if origins := app.Options.CORS.AllowedOrigins; len(origins) > 0 {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   origins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders:   []string{"Accept", "Content-Type", "X-CSRF-Token", idempotency.Header},
+			ExposedHeaders:   []string{"X-CSRF-Token"},
+			AllowCredentials: true,
+			MaxAge:           app.Options.CORS.MaxAge,
+		}))
+	}
+	r.Use(csrf.Protect(csrf.Options{
+		SessionCookie:  auth.Name,
+		Secure:         auth.Secure,
+		AllowedOrigins: app.Options.CORS.AllowedOrigins,
 	}))
 
+	health := app.health()
 	r.With(middleware.NoCache).Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		response.NewOK("ok").ServeHTTP(w, r)
 	})
-	r.With(middleware.NoCache).Get("/logout", auth.Logout)
+	r.With(middleware.NoCache).Get("/health/live", health.Live)
+	r.With(middleware.NoCache).Get("/health/ready", health.Ready)
+	// logout revokes session, so it is POST to be checked by csrf.Protect
+	r.With(middleware.NoCache).Post("/logout", auth.Logout)
+	r.Method(http.MethodGet, "/metrics", app.Metrics().Handler(app.Options.Metrics.Token))
+	r.Get("/.well-known/jwks.json", auth.JWKS)
 
 	// register service handler
-	r.Route("/api", func (r chi.Router) {
+	r.Route("/api", func(r chi.Router) {
 		r.Route("/admin", adminRouter.Route)
+		r.Route("/api-token", apiTokenRouter.Route)
+		r.Route("/audit-log", auditLogRouter.Route)
 		r.Route("/file", fileRouter.Route)
 		r.Route("/examination", examinationRouter.Route)
 		r.Route("/examine-question", examineQuestionRouter.Route)
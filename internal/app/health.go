@@ -0,0 +1,26 @@
+package app
+
+import (
+	"context"
+
+	"github.com/falentio/skul/internal/pkg/health"
+)
+
+// health returns checks of readiness probe, database is checked only when
+// app uses gorm repository and disk space only when storage is kept on disk.
+// It must be called after database was migrated, as migrations are checked
+// once when the checks are created.
+func (app *Application) health() *health.Health {
+	h := &health.Health{Timeout: app.Options.Health.Timeout, Logger: app.Logger}
+	if app.db != nil {
+		h.Add("database", health.Database(app.db))
+		h.Add("migrations", health.Migrations(context.Background(), app.db, models...))
+	}
+	if app.storage != nil {
+		h.Add("storage", health.Storage(app.storage))
+	}
+	if app.Options.Storage.Driver == "badger" {
+		h.Add("disk", health.DiskSpace(app.Options.Storage.Badger.Database, app.Options.Health.MinFreeDisk))
+	}
+	return h
+}
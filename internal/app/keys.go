@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+// keyRotationCheckInterval is how often signing key age is checked.
+const keyRotationCheckInterval = time.Hour
+
+// InitKeys loads session signing keys described by AppOptions.JWT and rotates
+// them in background, it must be called before (*Application).InitHandler.
+func (app *Application) InitKeys() error {
+	o := app.Options.JWT
+	dir := auth.KeyDir(o.KeyDir)
+	keys, err := dir.Load()
+	if err != nil {
+		return err
+	}
+	app.keys = auth.NewKeySet(keys...)
+
+	rotate := func() error {
+		// previous key must verify sessions signed right before rotation
+		// until they expire
+		retain := o.RotationInterval + app.Options.Session.Lifetime
+		if o.RotationInterval <= 0 {
+			retain = 0
+		}
+		return auth.Rotate(app.keys, dir, o.Algorithm, o.RotationInterval, retain, time.Now())
+	}
+	if err := rotate(); err != nil {
+		return err
+	}
+	app.Logger.Info().Str("algorithm", o.Algorithm).Str("kid", app.keys.Current().ID).Msg("using session signing key")
+
+	if o.RotationInterval > 0 {
+		app.AddWorker("jwt-key-rotation", func(ctx context.Context) error {
+			t := time.NewTicker(keyRotationCheckInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-t.C:
+					if err := rotate(); err != nil {
+						app.Logger.Error().Err(err).Msg("failed to rotate session signing key")
+					}
+				}
+			}
+		})
+	}
+	return nil
+}
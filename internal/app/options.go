@@ -3,26 +3,165 @@ package app
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gofiber/storage/badger"
 	"github.com/gofiber/storage/memory"
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/health"
+	"github.com/falentio/skul/internal/pkg/idempotency"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/metrics"
+	"github.com/falentio/skul/internal/pkg/password"
+	"github.com/falentio/skul/internal/pkg/tracing"
+	"github.com/falentio/skul/internal/service/student"
+)
+
+const (
+	TLSModeFile       = "file"
+	TLSModeSelfSigned = "self-signed"
+	TLSModeACME       = "acme"
 )
 
+// MaxSyncGrace bounds Exam.SyncGrace, so attempts are graded soon after
+// their enterance token closes.
+const MaxSyncGrace = time.Hour
+
 type AppOptions struct {
 	Addr         string `yaml:"addr" json:"addr"`
 	JWTSecret    string `yaml:"jwt_secret" json:"-"`
 	SecureCookie bool   `yaml:"secure_cookie" json:"secure_cookie"`
 
+	Server struct {
+		ReadTimeout       time.Duration `yaml:"read_timeout" json:"read_timeout"`
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+		WriteTimeout      time.Duration `yaml:"write_timeout" json:"write_timeout"`
+		IdleTimeout       time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+		ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+		MaxHeaderBytes    int           `yaml:"max_header_bytes" json:"max_header_bytes"`
+	} `yaml:"server" json:"server"`
+
+	TLS struct {
+		// Mode is one of "" (plain http), "file", "self-signed" or "acme"
+		Mode     string `yaml:"mode" json:"mode"`
+		CertFile string `yaml:"cert_file" json:"cert_file"`
+		KeyFile  string `yaml:"key_file" json:"key_file"`
+
+		SelfSigned struct {
+			Dir   string   `yaml:"dir" json:"dir"`
+			Hosts []string `yaml:"hosts" json:"hosts"`
+		} `yaml:"self_signed" json:"self_signed"`
+
+		ACME struct {
+			Domains      []string `yaml:"domains" json:"domains"`
+			Email        string   `yaml:"email" json:"email"`
+			CacheDir     string   `yaml:"cache_dir" json:"cache_dir"`
+			DirectoryURL string   `yaml:"directory_url" json:"directory_url"`
+			// HTTPAddr serves http-01 challenges and redirects to https, left empty
+			// only tls-alpn-01 challenges are used
+			HTTPAddr string `yaml:"http_addr" json:"http_addr"`
+		} `yaml:"acme" json:"acme"`
+	} `yaml:"tls" json:"tls"`
+
+	CORS struct {
+		// AllowedOrigins may send credentialed requests, e.g.
+		// "https://exam.example.com", left empty only same origin is allowed
+		AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+		MaxAge         int      `yaml:"max_age" json:"max_age"`
+	} `yaml:"cors" json:"cors"`
+
+	JWT struct {
+		// Algorithm is one of "HS512", "EdDSA" or "RS256", public keys of
+		// asymmetric algorithms are served at /.well-known/jwks.json
+		Algorithm string `yaml:"algorithm" json:"algorithm"`
+		KeyDir    string `yaml:"key_dir" json:"key_dir"`
+		// RotationInterval is age of signing key before new key is generated,
+		// negative disables rotation
+		RotationInterval time.Duration `yaml:"rotation_interval" json:"rotation_interval"`
+	} `yaml:"jwt" json:"jwt"`
+
+	Session struct {
+		// Lifetime is how long a session cookie is valid, zero defaults to
+		// 12 hours so sessions of server always expire
+		Lifetime time.Duration `yaml:"lifetime" json:"lifetime"`
+		// RefreshThreshold is remaining lifetime below which session is renewed
+		RefreshThreshold time.Duration `yaml:"refresh_threshold" json:"refresh_threshold"`
+		// StudentPolicy is one of "" (many sessions), "kick" (older session is
+		// logged out) or "refuse" (new login refused) while exam window is open
+		StudentPolicy string `yaml:"student_policy" json:"student_policy"`
+	} `yaml:"session" json:"session"`
+
+	Password struct {
+		Admin   password.Policy `yaml:"admin" json:"admin"`
+		Student password.Policy `yaml:"student" json:"student"`
+		// ResetCodeLifetime is how long reset code issued by admin is valid
+		ResetCodeLifetime time.Duration `yaml:"reset_code_lifetime" json:"reset_code_lifetime"`
+	} `yaml:"password" json:"password"`
+
+	TOTP struct {
+		// Issuer names this server in authenticator apps of admins
+		Issuer string `yaml:"issuer" json:"issuer"`
+	} `yaml:"totp" json:"totp"`
+
+	// Identity lists external providers tried when local password does not
+	// match, students may be provisioned by them on first login
+	Identity struct {
+		Admin   []identity.Options `yaml:"admin" json:"admin"`
+		Student []identity.Options `yaml:"student" json:"student"`
+	} `yaml:"identity" json:"identity"`
+
+	Exam struct {
+		// SyncGrace is how long after enterance token window closes answers
+		// made offline within the window are still accepted, at most
+		// MaxSyncGrace
+		SyncGrace time.Duration `yaml:"sync_grace" json:"sync_grace"`
+		// EntryGrace widens enterance token windows on both ends when
+		// students open examination, to tolerate skewed clocks
+		EntryGrace time.Duration `yaml:"entry_grace" json:"entry_grace"`
+	} `yaml:"exam" json:"exam"`
+
+	// Jobs configures background workers, zero interval disables the worker
+	Jobs struct {
+		// GradeInterval is how often attempts of closed enterance tokens
+		// are graded
+		GradeInterval time.Duration `yaml:"grade_interval" json:"grade_interval"`
+		// ExpiryInterval is how often expired api tokens are deleted
+		ExpiryInterval time.Duration `yaml:"expiry_interval" json:"expiry_interval"`
+	} `yaml:"jobs" json:"jobs"`
+
+	// Idempotency keeps responses of create requests sent with
+	// Idempotency-Key header for replay
+	Idempotency idempotency.Options `yaml:"idempotency" json:"idempotency"`
+
+	// Login locks accounts out after repeated failed logins
+	Login loginguard.Options `yaml:"login" json:"login"`
+
 	Database struct {
 		Driver string `yaml:"driver" json:"driver"`
 		Dsn    string `yaml:"dsn" json:"dsn"`
 	} `yaml:"database" json:"database"`
 
+	// Health configures readiness probe served at /health/ready
+	Health health.Options `yaml:"health" json:"health"`
+
+	// Log configures level and format of application and access logs
+	Log logging.Options `yaml:"log" json:"log"`
+
+	// Metrics configures prometheus metrics served at /metrics
+	Metrics metrics.Options `yaml:"metrics" json:"metrics"`
+
+	// Tracing exports spans of requests to OTLP collector when endpoint is set
+	Tracing tracing.Options `yaml:"tracing" json:"tracing"`
+
 	Storage struct {
 		Driver string        `yaml:"driver" json:"driver"`
 		Badger badger.Config `yaml:"badger" json:"badger"`
@@ -90,6 +229,133 @@ func (o *AppOptions) SetDefault() error {
 		}
 		o.JWTSecret = base64.RawURLEncoding.EncodeToString(b)
 	}
+	if o.Server.ReadTimeout == 0 {
+		o.Server.ReadTimeout = 15 * time.Second
+	}
+	if o.Server.ReadHeaderTimeout == 0 {
+		o.Server.ReadHeaderTimeout = 5 * time.Second
+	}
+	// must be longer than the request timeout middleware, otherwise the
+	// connection is closed before the timeout response could be written
+	if o.Server.WriteTimeout == 0 {
+		o.Server.WriteTimeout = 15 * time.Second
+	}
+	if o.Server.IdleTimeout == 0 {
+		o.Server.IdleTimeout = 2 * time.Minute
+	}
+	if o.Server.ShutdownTimeout == 0 {
+		o.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if o.Server.MaxHeaderBytes == 0 {
+		o.Server.MaxHeaderBytes = 1 << 16
+	}
+	switch o.TLS.Mode {
+	case "", TLSModeFile, TLSModeACME, TLSModeSelfSigned:
+	default:
+		return fmt.Errorf("AppOptions: unknown tls mode %q", o.TLS.Mode)
+	}
+	if o.TLS.SelfSigned.Dir == "" {
+		o.TLS.SelfSigned.Dir = filepath.Join(o.userHome(), ".config", "skul", "tls")
+	}
+	if o.TLS.ACME.CacheDir == "" {
+		o.TLS.ACME.CacheDir = filepath.Join(o.userHome(), ".config", "skul", "acme")
+	}
+	if o.CORS.MaxAge == 0 {
+		o.CORS.MaxAge = 7200
+	}
+	if o.JWT.Algorithm == "" {
+		o.JWT.Algorithm = "HS512"
+	}
+	if _, err := auth.SigningMethod(o.JWT.Algorithm); err != nil {
+		return fmt.Errorf("AppOptions: %w", err)
+	}
+	if o.JWT.KeyDir == "" {
+		o.JWT.KeyDir = filepath.Join(o.userHome(), ".config", "skul", "keys")
+	}
+	if o.JWT.RotationInterval == 0 {
+		o.JWT.RotationInterval = 30 * 24 * time.Hour
+	}
+	if o.Session.Lifetime == 0 {
+		o.Session.Lifetime = 12 * time.Hour
+	}
+	if o.Session.RefreshThreshold == 0 {
+		o.Session.RefreshThreshold = o.Session.Lifetime / 2
+	}
+	switch student.SessionPolicy(o.Session.StudentPolicy) {
+	case student.SessionPolicyNone, student.SessionPolicyKick, student.SessionPolicyRefuse:
+	default:
+		return fmt.Errorf("AppOptions: unknown student session policy %q", o.Session.StudentPolicy)
+	}
+	if o.Password.Admin.MinLength == 0 {
+		o.Password.Admin.MinLength = 8
+	}
+	if o.Password.Student.MinLength == 0 {
+		o.Password.Student.MinLength = 8
+	}
+	if o.Password.ResetCodeLifetime == 0 {
+		o.Password.ResetCodeLifetime = 30 * time.Minute
+	}
+	if o.Health.Timeout == 0 {
+		o.Health.Timeout = 2 * time.Second
+	}
+	if o.Health.MinFreeDisk == 0 {
+		o.Health.MinFreeDisk = 100 << 20
+	}
+	if o.Log.Level == "" {
+		o.Log.Level = "info"
+	}
+	if o.Log.Format == "" {
+		o.Log.Format = logging.FormatJSON
+	}
+	if _, err := logging.New(o.Log, io.Discard); err != nil {
+		return fmt.Errorf("AppOptions: %w", err)
+	}
+	if o.Tracing.ServiceName == "" {
+		o.Tracing.ServiceName = "skul"
+	}
+	if o.Tracing.SampleRatio == 0 {
+		o.Tracing.SampleRatio = 1
+	}
+	if o.Tracing.SampleRatio < 0 || o.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("AppOptions: tracing sample ratio must be between 0 and 1, got %v", o.Tracing.SampleRatio)
+	}
+	if o.TOTP.Issuer == "" {
+		o.TOTP.Issuer = "skul"
+	}
+	if o.Exam.EntryGrace == 0 {
+		o.Exam.EntryGrace = time.Minute
+	}
+	if o.Exam.SyncGrace == 0 {
+		o.Exam.SyncGrace = 5 * time.Minute
+	}
+	if o.Exam.SyncGrace < 0 || o.Exam.SyncGrace > MaxSyncGrace {
+		return fmt.Errorf("AppOptions: sync grace must be between 0 and %s, got %s", MaxSyncGrace, o.Exam.SyncGrace)
+	}
+	if o.Jobs.GradeInterval == 0 {
+		o.Jobs.GradeInterval = time.Minute
+	}
+	if o.Jobs.ExpiryInterval == 0 {
+		o.Jobs.ExpiryInterval = time.Hour
+	}
+	if o.Idempotency.TTL == 0 {
+		o.Idempotency.TTL = 24 * time.Hour
+	}
+	if o.Login.MaxFailures == 0 {
+		o.Login.MaxFailures = 5
+	}
+	if o.Login.Lockout == 0 {
+		o.Login.Lockout = time.Minute
+	}
+	if o.Login.MaxLockout == 0 {
+		o.Login.MaxLockout = time.Hour
+	}
+	if o.Login.Forget == 0 {
+		o.Login.Forget = 24 * time.Hour
+	}
+	// revoked sessions, reset codes and login failures are kept in storage
+	if o.Storage.Driver == "" {
+		o.Storage.Driver = "memory"
+	}
 	if o.Database.Driver == "" {
 		o.Database.Driver = "sqlite3"
 		o.Database.Dsn = ":memory:?cache=shared"
@@ -97,3 +363,7 @@ func (o *AppOptions) SetDefault() error {
 
 	return nil
 }
+
+func (o *AppOptions) TLSEnabled() bool {
+	return o.TLS.Mode != ""
+}
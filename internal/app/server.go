@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Worker is a long running background job, it must return once ctx is done.
+type Worker func(ctx context.Context) error
+
+type namedWorker struct {
+	name   string
+	worker Worker
+}
+
+// AddWorker registers a background worker that is started by
+// (*Application).ListenAndServe and stopped with the same context as the http server.
+func (app *Application) AddWorker(name string, w Worker) {
+	app.workers = append(app.workers, namedWorker{name, w})
+}
+
+func (app *Application) startWorkers(ctx context.Context, wg *sync.WaitGroup) {
+	for _, w := range app.workers {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.Logger.Debug().Str("worker", w.name).Msg("worker started")
+			if err := w.worker(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				app.Logger.Error().Err(err).Str("worker", w.name).Msg("worker stopped with error")
+				return
+			}
+			app.Logger.Debug().Str("worker", w.name).Msg("worker stopped")
+		}()
+	}
+}
+
+func (app *Application) newServer() *http.Server {
+	o := app.Options.Server
+	return &http.Server{
+		Addr:              app.Options.Addr,
+		Handler:           app.Handler(),
+		ReadTimeout:       o.ReadTimeout,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		WriteTimeout:      o.WriteTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		MaxHeaderBytes:    o.MaxHeaderBytes,
+		TLSConfig:         app.tlsConfig,
+		ErrorLog:          log.New(app.Logger.With().Str("component", "http").Logger(), "", 0),
+	}
+}
+
+// ListenAndServe serves http and runs registered workers until ctx is done,
+// then drains in-flight requests for at most AppOptions.Server.ShutdownTimeout.
+func (app *Application) ListenAndServe(ctx context.Context) (err error) {
+	app.repositoryGuard()
+	// workers are stopped before, so resources are released even when
+	// http server fails to start
+	defer func() {
+		if cerr := app.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	app.startWorkers(ctx, wg)
+
+	srv := app.newServer()
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		cancel()
+		wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	app.Logger.Info().Dur("timeout", app.Options.Server.ShutdownTimeout).Msg("shutting down http server")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), app.Options.Server.ShutdownTimeout)
+	defer shutdownCancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err == nil {
+		err = <-errCh
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	wg.Wait()
+	return err
+}
+
+// Close releases resources held by the application, it is called by
+// (*Application).ListenAndServe after the http server has been drained.
+func (app *Application) Close() error {
+	if app.storage != nil {
+		if err := app.storage.Close(); err != nil {
+			return err
+		}
+	}
+	return app.tracing.Shutdown(context.Background())
+}
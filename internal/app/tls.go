@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/falentio/skul/internal/pkg/certificate"
+)
+
+// InitTLS prepares tls config described by AppOptions.TLS, it must be called
+// before (*Application).InitHandler so session cookies are marked secure.
+func (app *Application) InitTLS() error {
+	o := app.Options.TLS
+	switch o.Mode {
+	case "":
+		return nil
+	case TLSModeFile:
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return err
+		}
+		app.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	case TLSModeSelfSigned:
+		hosts := o.SelfSigned.Hosts
+		if len(hosts) == 0 {
+			hosts = certificate.LocalHosts()
+		}
+		cert, err := certificate.LoadOrCreateSelfSigned(certificate.SelfSignedOptions{
+			Dir:   o.SelfSigned.Dir,
+			Hosts: hosts,
+		})
+		if err != nil {
+			return err
+		}
+		app.Logger.Info().Strs("hosts", hosts).Str("dir", o.SelfSigned.Dir).Msg("using self signed certificate")
+		app.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	case TLSModeACME:
+		if len(o.ACME.Domains) == 0 {
+			return errors.New("Application: tls.acme.domains must not be empty")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(o.ACME.CacheDir),
+			HostPolicy: autocert.HostWhitelist(o.ACME.Domains...),
+			Email:      o.ACME.Email,
+		}
+		if o.ACME.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: o.ACME.DirectoryURL}
+		}
+		app.tlsConfig = m.TLSConfig()
+		if o.ACME.HTTPAddr != "" {
+			app.AddWorker("acme-http", func(ctx context.Context) error {
+				return app.serveACMEChallenge(ctx, m)
+			})
+		}
+	}
+	app.tlsConfig.MinVersion = tls.VersionTLS12
+	return nil
+}
+
+func (app *Application) serveACMEChallenge(ctx context.Context, m *autocert.Manager) error {
+	srv := &http.Server{
+		Addr:              app.Options.TLS.ACME.HTTPAddr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: app.Options.Server.ReadHeaderTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
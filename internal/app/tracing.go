@@ -0,0 +1,17 @@
+package app
+
+import (
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+// InitTracing starts exporter described by AppOptions.Tracing, it must be
+// called before (*Application).InitRepository and (*Application).InitStorage
+// so queries and storage calls are traced.
+func (app *Application) InitTracing() error {
+	t, err := tracing.New(app.Options.Tracing)
+	if err != nil {
+		return err
+	}
+	app.tracing = t
+	return nil
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+// every returns worker running job every interval until ctx is done, failed
+// runs are logged and retried on next tick. Jobs see every organization.
+func (app *Application) every(name string, interval time.Duration, job func(ctx context.Context) error) Worker {
+	return func(ctx context.Context) error {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-t.C:
+				if err := job(tenant.Unscoped(ctx)); err != nil {
+					app.Logger.Error().Err(err).Str("worker", name).Msg("job failed")
+				}
+			}
+		}
+	}
+}
+
+// InitWorkers registers background jobs, call it after
+// (*Application).InitRepository.
+func (app *Application) InitWorkers() {
+	o := app.Options.Jobs
+	if o.GradeInterval > 0 {
+		app.AddWorker("grading", app.every("grading", o.GradeInterval, func(ctx context.Context) error {
+			// answers made offline are still synced within grace after
+			// window closes
+			exam := app.Options.Exam
+			n, err := app.repository.ExamineStudentRepository.GradeExamineStudent(ctx, time.Now().Add(-exam.EntryGrace-exam.SyncGrace))
+			if n > 0 {
+				app.Logger.Info().Int64("count", n).Msg("graded attempts of closed enterance tokens")
+			}
+			return err
+		}))
+	}
+	if o.ExpiryInterval > 0 {
+		app.AddWorker("expiry", app.every("expiry", o.ExpiryInterval, func(ctx context.Context) error {
+			n, err := app.repository.APITokenRepository.DeleteExpiredAPIToken(ctx, time.Now())
+			if n > 0 {
+				app.Logger.Info().Int64("count", n).Msg("deleted expired api tokens")
+			}
+			return err
+		}))
+	}
+}
@@ -18,24 +18,58 @@ const AdminIDPrefix = "adm"
 type Admin struct {
 	Model
 
+	OrganizationID raid.Raid `json:"organizationID" gorm:"type:varchar(32);not null;index;uniqueIndex:idx_admins_organization_username"`
+
 	Name         string `json:"name" validate:"max=32" gorm:"type:varchar(32)"`
-	Username     string `json:"username" validate:"max=32" gorm:"type:varchar(32);unique;index:,expression:LOWER(username)"`
+	Username     string `json:"username" validate:"max=32" gorm:"type:varchar(32);uniqueIndex:idx_admins_organization_username;index:,expression:LOWER(username)"`
 	PasswordHash string `json:"-"`
-	Password     string `json:"password,omitempty" validate:"min=8" gorm:"-"`
+	Password     string `json:"password,omitempty" gorm:"-"`
+	Role         Role   `json:"role" validate:"omitempty,oneof=super-admin teacher proctor" gorm:"type:varchar(16);not null;default:teacher"`
+	// MustChangePassword is set when password was generated or reset, admin
+	// must change it before doing anything else.
+	MustChangePassword bool `json:"mustChangePassword" gorm:"not null;default:false"`
+	// TOTPSecret is secret of time based one time password, login requires
+	// its code once TOTPEnabled is set.
+	TOTPSecret  string `json:"-" gorm:"type:varchar(64)"`
+	TOTPEnabled bool   `json:"totpEnabled" gorm:"not null;default:false"`
+	// TOTPRecovery is space separated hashes of unused recovery codes.
+	TOTPRecovery string `json:"-"`
+	// IdentityProvider and IdentitySubject link admin to account of external
+	// identity provider, they are kept nil for local accounts.
+	IdentityProvider *string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_admins_identity"`
+	IdentitySubject  *string `json:"-" gorm:"type:varchar(255);uniqueIndex:idx_admins_identity"`
+	// Provider, Code, State and RedirectURI are sent to log in with external
+	// identity provider, Code is authorization code of OIDC provider issued
+	// for authorization State.
+	Provider    string `json:"provider,omitempty" gorm:"-"`
+	Code        string `json:"code,omitempty" gorm:"-"`
+	State       string `json:"state,omitempty" gorm:"-"`
+	RedirectURI string `json:"redirectURI,omitempty" gorm:"-"`
 
 	Examinations []*Examination `json:"examinations"`
 	Students     []*Student     `json:"students"`
 }
 
+type ListAdminOptions struct {
+	PaginateOptions
+
+	Role Role `json:"role"`
+}
+
 type AdminRepositoryRead interface {
 	GetAdminByID(ctx context.Context, adminID raid.Raid) (*Admin, error)
 	GetAdminByUsername(ctx context.Context, username string) (*Admin, error)
+	GetAdminByIdentity(ctx context.Context, provider, subject string) (*Admin, error)
+	ListAdmin(ctx context.Context, o *ListAdminOptions) ([]*Admin, error)
 }
 
 type AdminRepositoryWrite interface {
 	CreateAdmin(ctx context.Context, admin *Admin) error
 	DeleteAdmin(ctx context.Context, adminID raid.Raid) error
 	UpdateAdmin(ctx context.Context, admin *Admin) error
+	UpdateAdminPassword(ctx context.Context, adminID raid.Raid, passwordHash string, mustChange bool) error
+	UpdateAdminTOTP(ctx context.Context, adminID raid.Raid, secret string, enabled bool, recovery string) error
+	LinkAdminIdentity(ctx context.Context, adminID raid.Raid, provider, subject string) error
 }
 
 type AdminRepository interface {
@@ -46,13 +80,24 @@ type AdminRepository interface {
 type AdminServiceRead interface {
 	GetAdminByID(ctx context.Context, adminID raid.Raid) (response.Response, error)
 	GetAdminByUsername(ctx context.Context, username string) (response.Response, error)
+	ListAdmin(ctx context.Context, o *ListAdminOptions) (response.Response, error)
+	ListLockout(ctx context.Context) (response.Response, error)
 }
 
 type AdminServiceWrite interface {
 	LoginAdmin(ctx context.Context, admin *Admin) (response.Response, error)
+	AuthorizeAdmin(ctx context.Context, provider, redirectURI string) (response.Response, error)
 	CreateAdmin(ctx context.Context, admin *Admin) (response.Response, error)
 	DeleteAdmin(ctx context.Context, adminID raid.Raid) (response.Response, error)
 	UpdateAdmin(ctx context.Context, admin *Admin) (response.Response, error)
+	ChangeAdminPassword(ctx context.Context, c *ChangePassword) (response.Response, error)
+	ResetAdminPassword(ctx context.Context, adminID raid.Raid) (response.Response, error)
+	RedeemAdminPassword(ctx context.Context, r *ResetPassword) (response.Response, error)
+	VerifyAdminTOTP(ctx context.Context, l *TOTPLogin) (response.Response, error)
+	EnrollAdminTOTP(ctx context.Context) (response.Response, error)
+	ConfirmAdminTOTP(ctx context.Context, c *TOTPCode) (response.Response, error)
+	DisableAdminTOTP(ctx context.Context, c *TOTPCode) (response.Response, error)
+	ResetAdminTOTP(ctx context.Context, adminID raid.Raid) (response.Response, error)
 }
 
 type AdminService interface {
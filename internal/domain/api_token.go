@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+const APITokenIDPrefix = "atk"
+
+var (
+	ErrAPITokenNotFound = errors.New("api token: can not find api token")
+)
+
+// APIToken authenticates machine clients of an admin with
+// "Authorization: Bearer <token>", only hash of its secret is stored.
+type APIToken struct {
+	Model
+
+	OrganizationID raid.Raid `json:"organizationID" gorm:"type:varchar(32);not null;index"`
+	AdminID        raid.Raid `json:"adminID" gorm:"type:varchar(32);not null;index"`
+
+	Name       string      `json:"name" validate:"required,max=64" gorm:"type:varchar(64)"`
+	Scopes     Permissions `json:"scopes" validate:"required,min=1" gorm:"type:varchar(512)"`
+	ExpiresAt  time.Time   `json:"expiresAt" validate:"required"`
+	SecretHash string      `json:"-" gorm:"type:varchar(64);not null"`
+	// Token is only returned once when api token is created.
+	Token string `json:"token,omitempty" gorm:"-"`
+
+	Admin *Admin `json:"admin,omitempty"`
+}
+
+type ListAPITokenOptions struct {
+	PaginateOptions
+
+	AdminID raid.Raid `json:"adminID"`
+	Name    string    `json:"name"`
+}
+
+type APITokenRepositoryRead interface {
+	GetAPIToken(ctx context.Context, tokenID raid.Raid) (*APIToken, error)
+	ListAPIToken(ctx context.Context, o *ListAPITokenOptions) ([]*APIToken, error)
+}
+
+type APITokenRepositoryWrite interface {
+	CreateAPIToken(ctx context.Context, token *APIToken) error
+	DeleteAPIToken(ctx context.Context, tokenID raid.Raid) error
+	// DeleteExpiredAPIToken deletes tokens of every organization which
+	// expired before at, and returns how many were deleted.
+	DeleteExpiredAPIToken(ctx context.Context, at time.Time) (int64, error)
+}
+
+type APITokenRepository interface {
+	APITokenRepositoryRead
+	APITokenRepositoryWrite
+}
+
+// APITokenIssuer issues api token of admin of ctx for other services, e.g.
+// token of schedule feed. Issued token replaces other tokens of the admin
+// with the same name, so admin keeps single token per purpose, Token of token
+// is set once it is issued.
+type APITokenIssuer interface {
+	RotateAPIToken(ctx context.Context, token *APIToken) error
+}
+
+type APITokenServiceRead interface {
+	ListAPIToken(ctx context.Context, o *ListAPITokenOptions) (response.Response, error)
+}
+
+type APITokenServiceWrite interface {
+	CreateAPIToken(ctx context.Context, token *APIToken) (response.Response, error)
+	DeleteAPIToken(ctx context.Context, tokenID raid.Raid) (response.Response, error)
+}
+
+type APITokenService interface {
+	APITokenServiceRead
+	APITokenServiceWrite
+}
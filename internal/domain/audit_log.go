@@ -0,0 +1,148 @@
+package domain
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+const AuditLogIDPrefix = "aud"
+
+var (
+	ErrAuditLogAppendOnly = errors.New("audit log: audit log can not be changed")
+)
+
+// Audit actions are named "<resource>.<verb>".
+const (
+	AuditAdminCreate        = "admin.create"
+	AuditAdminUpdate        = "admin.update"
+	AuditAdminDelete        = "admin.delete"
+	AuditAdminPasswordReset = "admin.password.reset"
+	AuditAdminTOTPReset     = "admin.totp.reset"
+
+	AuditStudentCreate        = "student.create"
+	AuditStudentUpdate        = "student.update"
+	AuditStudentDelete        = "student.delete"
+	AuditStudentLogout        = "student.logout"
+	AuditStudentRelease       = "student.release"
+	AuditStudentPasswordReset = "student.password.reset"
+
+	AuditExaminationCreate = "examination.create"
+	AuditExaminationUpdate = "examination.update"
+	AuditExaminationDelete = "examination.delete"
+
+	AuditExamineQuestionCreate = "examine-question.create"
+	AuditExamineQuestionUpdate = "examine-question.update"
+	AuditExamineQuestionDelete = "examine-question.delete"
+
+	AuditExamineAnswerCreate = "examine-answer.create"
+	AuditExamineAnswerUpdate = "examine-answer.update"
+	AuditExamineAnswerDelete = "examine-answer.delete"
+
+	AuditEnteranceTokenCreate   = "enterance-token.create"
+	AuditEnteranceTokenUpdate   = "enterance-token.update"
+	AuditEnteranceTokenDelete   = "enterance-token.delete"
+	AuditEnteranceTokenAssign   = "enterance-token.assign"
+	AuditEnteranceTokenUnassign = "enterance-token.unassign"
+
+	AuditAPITokenCreate = "api-token.create"
+	AuditAPITokenDelete = "api-token.delete"
+)
+
+// AuditChange is value of a field before and after an action, Before is nil
+// for created and After is nil for deleted records.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditDiff maps changed field to its change.
+type AuditDiff map[string]AuditChange
+
+func (d AuditDiff) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(d)
+	return string(b), err
+}
+
+func (d *AuditDiff) Scan(v any) error {
+	switch v := v.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case []byte:
+		return json.Unmarshal(v, d)
+	}
+	return fmt.Errorf("audit log: can not scan %T into AuditDiff", v)
+}
+
+// AuditLog records who did an action to which record, it is append only.
+type AuditLog struct {
+	ID        raid.Raid `json:"id" gorm:"type:varchar(32);primaryKey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+
+	OrganizationID raid.Raid `json:"organizationID" gorm:"type:varchar(32);index"`
+	ActorID        raid.Raid `json:"actorID" gorm:"type:varchar(32);index"`
+	ActorRole      Role      `json:"actorRole" gorm:"type:varchar(16)"`
+	Action         string    `json:"action" gorm:"type:varchar(64);not null;index"`
+	TargetID       raid.Raid `json:"targetID" gorm:"type:varchar(32);index"`
+	Diff           AuditDiff `json:"diff,omitempty" gorm:"type:text"`
+	RequestID      string    `json:"requestID" gorm:"type:varchar(64)"`
+}
+
+func (l *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (l *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+type ListAuditLogOptions struct {
+	PaginateOptions
+
+	ActorID  raid.Raid `json:"actorID"`
+	TargetID raid.Raid `json:"targetID"`
+	Action   string    `json:"action"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+type AuditLogRepositoryRead interface {
+	ListAuditLog(ctx context.Context, o *ListAuditLogOptions) ([]*AuditLog, error)
+	// EachAuditLog calls fn with every audit log matching o, oldest first,
+	// pagination of o is ignored.
+	EachAuditLog(ctx context.Context, o *ListAuditLogOptions, fn func(l *AuditLog) error) error
+}
+
+type AuditLogRepositoryWrite interface {
+	CreateAuditLog(ctx context.Context, l *AuditLog) error
+}
+
+type AuditLogRepository interface {
+	AuditLogRepositoryRead
+	AuditLogRepositoryWrite
+}
+
+type AuditLogServiceRead interface {
+	ListAuditLog(ctx context.Context, o *ListAuditLogOptions) (response.Response, error)
+	// ExportAuditLog writes audit logs matching o to w as JSON lines.
+	ExportAuditLog(ctx context.Context, o *ListAuditLogOptions, w io.Writer) error
+}
+
+type AuditLogService interface {
+	AuditLogServiceRead
+}
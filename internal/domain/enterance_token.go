@@ -3,6 +3,8 @@ package domain
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/falentio/raid-go"
@@ -13,8 +15,15 @@ const EnteranceTokenIDPrefix = "eto"
 
 var (
 	ErrEnteranceTokenNotFound = errors.New("EnteranceToken: can not find enterance token")
+	ErrEnteranceTokenConflict = errors.New("EnteranceToken: enterance token overlaps enterance token of the same students")
+	ErrEnteranceTokenNotOpen  = errors.New("EnteranceToken: enterance token is not open yet")
+	ErrEnteranceTokenClosed   = errors.New("EnteranceToken: enterance token is closed")
+	ErrEnteranceTokenLate     = errors.New("EnteranceToken: late entry of enterance token is closed")
 )
 
+// codeReplacer drops separators student may type between characters of code.
+var codeReplacer = strings.NewReplacer(" ", "", "-", "")
+
 type EnteranceToken struct {
 	Model
 
@@ -23,19 +32,113 @@ type EnteranceToken struct {
 	EnteranceFrom  time.Time `json:"enteranceFrom"`
 	EnteranceUntil time.Time `json:"enteranceUntil"`
 
+	// Code is short code students type to find the token instead of its id,
+	// it is unique across organizations while token without code has empty
+	// code.
+	Code string `json:"code" gorm:"type:varchar(16);uniqueIndex:idx_enterance_tokens_code,where:code <> ''" validate:"omitempty,max=16,alphanum"`
+	// LateEntryMinutes is how long after EnteranceFrom students can still
+	// start the examination, zero allows starting until window closes.
+	LateEntryMinutes uint `json:"lateEntryMinutes"`
+
+	// Class and Grade are students the token is scheduled for, empty value
+	// matches every class or grade. Token without both is scheduled only
+	// for students assigned to it.
+	Class string `json:"class" gorm:"index"`
+	Grade string `json:"grade" gorm:"index"`
+
 	Examination *Examination `json:"examination"`
 	Students    []*Student   `json:"student" gorm:"many2many:examine_student"`
 }
 
+// NormalizeCode returns code as it is stored, so codes are matched regardless
+// of case and separators.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(codeReplacer.Replace(code))
+}
+
+// WindowFor returns t as seen by assigned student es, due date of es
+// overrides EnteranceUntil when set.
+func (t *EnteranceToken) WindowFor(es *ExamineStudent) *EnteranceToken {
+	if es == nil || es.DueDate.IsZero() {
+		return t
+	}
+	w := *t
+	w.EnteranceUntil = es.DueDate
+	return &w
+}
+
+// CheckEntry returns why student can not enter t at now, window of t is
+// widened by grace on both ends to tolerate skewed clocks. Late entry only
+// applies to student who has not started yet.
+func (t *EnteranceToken) CheckEntry(now time.Time, grace time.Duration, started bool) error {
+	if now.Before(t.EnteranceFrom.Add(-grace)) {
+		return ErrEnteranceTokenNotOpen
+	}
+	if now.After(t.EnteranceUntil.Add(grace)) {
+		return ErrEnteranceTokenClosed
+	}
+	late := t.EnteranceFrom.Add(time.Duration(t.LateEntryMinutes)*time.Minute + grace)
+	if !started && t.LateEntryMinutes > 0 && now.After(late) {
+		return ErrEnteranceTokenLate
+	}
+	return nil
+}
+
+// Overlaps reports whether windows of t and o overlap.
+func (t *EnteranceToken) Overlaps(o *EnteranceToken) bool {
+	return t.EnteranceFrom.Before(o.EnteranceUntil) && o.EnteranceFrom.Before(t.EnteranceUntil)
+}
+
+// SameAudience reports whether t and o are scheduled for some of the same
+// class and grade, students assigned to tokens are not considered.
+func (t *EnteranceToken) SameAudience(o *EnteranceToken) bool {
+	if (t.Class == "" && t.Grade == "") || (o.Class == "" && o.Grade == "") {
+		return false
+	}
+	match := func(a, b string) bool {
+		return a == "" || b == "" || a == b
+	}
+	return match(t.Class, o.Class) && match(t.Grade, o.Grade)
+}
+
 type ListEnteranceTokenOptions struct {
 	PaginateOptions
 
 	ExaminationID raid.Raid `json:"examinationID"`
 }
 
+// ScheduleOptions filters schedule of enterance tokens, tokens are included
+// when their window overlaps From and Until.
+type ScheduleOptions struct {
+	Class   string    `json:"class"`
+	Grade   string    `json:"grade"`
+	AdminID raid.Raid `json:"adminID"`
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until"`
+}
+
+// ScheduleFeed is url of iCalendar feed of schedule, relative to url it
+// was requested from.
+type ScheduleFeed struct {
+	URL string `json:"url"`
+}
+
 type EnteranceTokenRepositoryRead interface {
 	GetEnteranceToken(ctx context.Context, tokenID raid.Raid) (*EnteranceToken, error)
+	// GetEnteranceTokenByCode returns token with code, code must already
+	// be normalized by NormalizeCode.
+	GetEnteranceTokenByCode(ctx context.Context, code string) (*EnteranceToken, error)
 	ListEnteranceToken(ctx context.Context, o *ListEnteranceTokenOptions) ([]*EnteranceToken, error)
+	// ListSchedule returns tokens matching o ordered by start of their
+	// window, with their examination.
+	ListSchedule(ctx context.Context, o *ScheduleOptions) ([]*EnteranceToken, error)
+	// ListConflictingEnteranceToken returns other tokens whose window overlaps
+	// window of token and which are scheduled for some of its students.
+	ListConflictingEnteranceToken(ctx context.Context, token *EnteranceToken) ([]*EnteranceToken, error)
+	// ListConflictingEnteranceTokenOfStudents returns other tokens whose
+	// window overlaps window of token and which are scheduled for some of
+	// students, whether or not they are assigned to token yet.
+	ListConflictingEnteranceTokenOfStudents(ctx context.Context, token *EnteranceToken, studentIDs []raid.Raid) ([]*EnteranceToken, error)
 }
 
 type EnteranceTokenRepositoryWrite interface {
@@ -52,7 +155,12 @@ type EnteranceTokenRepository interface {
 
 type EnteranceTokenServiceRead interface {
 	GetEnteranceToken(ctx context.Context, tokenID raid.Raid) (response.Response, error)
+	GetEnteranceTokenByCode(ctx context.Context, code string) (response.Response, error)
+	GetExamination(ctx context.Context, tokenID raid.Raid) (response.Response, error)
 	ListEnteranceToken(ctx context.Context, o *ListEnteranceTokenOptions) (response.Response, error)
+	ListSchedule(ctx context.Context, o *ScheduleOptions) (response.Response, error)
+	ExportSchedule(ctx context.Context, o *ScheduleOptions, w io.Writer) error
+	ListExamineStudent(ctx context.Context, o *ListExamineStudentOptions) (response.Response, error)
 }
 
 type EnteranceTokenServiceWrite interface {
@@ -60,6 +168,9 @@ type EnteranceTokenServiceWrite interface {
 	UpdateEnteranceToken(ctx context.Context, token *EnteranceToken) (response.Response, error)
 	BatchCreateEnteranceToken(ctx context.Context, tokens []*EnteranceToken) (response.Response, error)
 	DeleteEnteranceToken(ctx context.Context, tokenID raid.Raid) (response.Response, error)
+	CreateScheduleFeed(ctx context.Context, o *ScheduleOptions) (response.Response, error)
+	AssignExamineStudent(ctx context.Context, o *AssignExamineStudentOptions) (response.Response, error)
+	UnassignExamineStudent(ctx context.Context, o *AssignExamineStudentOptions) (response.Response, error)
 }
 
 type EnteranceTokenService interface {
@@ -3,6 +3,8 @@ package domain
 import (
 	"context"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/falentio/raid-go"
 
@@ -18,15 +20,71 @@ var (
 type Examination struct {
 	Model
 
-	AdminID raid.Raid `json:"adminID" gorm:"type:varchar(32);not null"`
+	OrganizationID raid.Raid `json:"organizationID" gorm:"type:varchar(32);not null;index"`
+	AdminID        raid.Raid `json:"adminID" gorm:"type:varchar(32);not null"`
 
 	Name            string `json:"name"`
 	DurationMinutes uint   `json:"durationMinutes"`
 	QuestionCount   int    `json:"questionCount"`
+	// Linear examination is taken strictly in order, question can not be
+	// answered anymore once student answered later question.
+	Linear bool `json:"linear"`
+
+	Admin            *Admin                `json:"admin"`
+	EnteranceTokens  []*EnteranceToken     `json:"enteranceTokens"`
+	ExamineQuestions []*ExamineQuestion    `json:"examineQuestions"`
+	Sections         []*ExaminationSection `json:"sections" validate:"dive"`
+}
+
+// OrderedSections returns sections of e in order they are taken.
+func (e *Examination) OrderedSections() []*ExaminationSection {
+	ss := append([]*ExaminationSection(nil), e.Sections...)
+	sort.SliceStable(ss, func(i, j int) bool {
+		if ss[i].Order != ss[j].Order {
+			return ss[i].Order < ss[j].Order
+		}
+		return ss[i].ID.String() < ss[j].ID.String()
+	})
+	return ss
+}
+
+// OrderedQuestions returns questions of e in order they are numbered,
+// questions of earlier section come first and questions without section last.
+func (e *Examination) OrderedQuestions() []*ExamineQuestion {
+	rank := make(map[string]int)
+	for i, s := range e.OrderedSections() {
+		rank[s.ID.String()] = i
+	}
+	last := len(rank)
+	sectionOf := func(q *ExamineQuestion) int {
+		if i, ok := rank[q.ExaminationSectionID.String()]; ok && !q.ExaminationSectionID.IsNil() {
+			return i
+		}
+		return last
+	}
+	qs := append([]*ExamineQuestion(nil), e.ExamineQuestions...)
+	sort.SliceStable(qs, func(i, j int) bool {
+		if si, sj := sectionOf(qs[i]), sectionOf(qs[j]); si != sj {
+			return si < sj
+		}
+		if qs[i].Order != qs[j].Order {
+			return qs[i].Order < qs[j].Order
+		}
+		return qs[i].ID.String() < qs[j].ID.String()
+	})
+	return qs
+}
 
-	Admin            *Admin             `json:"admin"`
-	EnteranceTokens  []*EnteranceToken  `json:"enteranceTokens"`
-	ExamineQuestions []*ExamineQuestion `json:"examineQuestions"`
+// SectionWindows returns when each section of e is open for attempt started
+// at start, sections follow each other without break.
+func (e *Examination) SectionWindows(start time.Time) map[string][2]time.Time {
+	windows := make(map[string][2]time.Time)
+	for _, s := range e.OrderedSections() {
+		end := start.Add(time.Duration(s.DurationMinutes) * time.Minute)
+		windows[s.ID.String()] = [2]time.Time{start, end}
+		start = end
+	}
+	return windows
 }
 
 type ListExaminationOptions struct {
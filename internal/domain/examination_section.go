@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"github.com/falentio/raid-go"
+)
+
+const ExaminationSectionIDPrefix = "exs"
+
+// ExaminationSection is timed part of examination, sections are taken in
+// Order one after another starting when enterance token window opens.
+type ExaminationSection struct {
+	Model
+
+	ExaminationID raid.Raid `json:"examinationID" gorm:"type:varchar(32);not null;index"`
+
+	Name            string `json:"name"`
+	Order           int    `json:"order"`
+	DurationMinutes uint   `json:"durationMinutes" validate:"min=1"`
+}
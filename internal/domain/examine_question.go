@@ -15,6 +15,12 @@ type ExamineQuestion struct {
 	Model
 
 	ExaminationID raid.Raid `json:"examinationID" gorm:"type:varchar(32);not null"`
+	// ExaminationSectionID is section the question belongs to, question
+	// without section is not bound to section duration.
+	ExaminationSectionID raid.Raid `json:"examinationSectionID" gorm:"type:varchar(32)"`
+	// Order is position of the question within its section, questions of
+	// the same order are ordered by id.
+	Order int `json:"order"`
 
 	Question    string `json:"question"`
 	AnswerCount int    `json:"answerCount" validate:"min=1"`
@@ -2,38 +2,123 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/falentio/raid-go"
 	"gorm.io/gorm"
 )
 
+var ErrExamineStudentNotFound = errors.New("ExamineStudent: student is not assigned to enterance token")
+
+const (
+	// ExamineStudentPending is student who has not started and still can.
+	ExamineStudentPending = "pending"
+	// ExamineStudentStarted is student who has opened the examination.
+	ExamineStudentStarted = "started"
+	// ExamineStudentMissed is student who has not started before window closed.
+	ExamineStudentMissed = "missed"
+)
+
 type ExamineStudent struct {
 	gorm.Model
 
-	EnteranceTokenID raid.Raid `json:"enteranceTokenID" gorm:"type:varchar(32);primaryKey;not null"`
-	StudentID        raid.Raid `json:"graderID" gorm:"type:varchar(32);primaryKey;not null"`
+	// student is assigned once per token, ID of gorm.Model is part of
+	// primary key so uniqueness is kept by idx_examine_students_assignment
+	EnteranceTokenID raid.Raid `json:"enteranceTokenID" gorm:"type:varchar(32);primaryKey;not null;uniqueIndex:idx_examine_students_assignment"`
+	StudentID        raid.Raid `json:"studentID" gorm:"type:varchar(32);primaryKey;not null;uniqueIndex:idx_examine_students_assignment"`
 
+	// DueDate overrides EnteranceUntil of token for the student when set.
 	DueDate time.Time `json:"dueDate"`
+	// StartedAt is when student first opened examination of the token.
+	StartedAt *time.Time `json:"startedAt"`
+	// SubmittedAt is when student submitted the attempt, see AnswerSubmit.
+	SubmittedAt *time.Time `json:"submittedAt"`
+	// Score is number of correct answers selected by student, it is set
+	// once window of the token closes, see GradeExamineStudent.
+	Score    *int       `json:"score"`
+	GradedAt *time.Time `json:"gradedAt"`
+	// SyncSeq is seq of latest answer change synced by student, see
+	// AnswerSync.
+	SyncSeq uint64 `json:"syncSeq" gorm:"not null;default:0"`
+	// Status is status of attempt of student, see ExamineStudentPending and
+	// friends, it is only filled when listing students of a token.
+	Status string `json:"status,omitempty" gorm:"-"`
 
 	EnteranceToken *EnteranceToken `json:"enteranceToken"`
 	Student        *Student        `json:"student"`
 }
 
+// AttemptStatus returns status of attempt of es on token at now.
+func (es *ExamineStudent) AttemptStatus(token *EnteranceToken, now time.Time) string {
+	if es.StartedAt != nil {
+		return ExamineStudentStarted
+	}
+	if err := token.WindowFor(es).CheckEntry(now, 0, false); errors.Is(err, ErrEnteranceTokenClosed) || errors.Is(err, ErrEnteranceTokenLate) {
+		return ExamineStudentMissed
+	}
+	return ExamineStudentPending
+}
+
 type ListExamineStudentOptions struct {
 	PaginateOptions
 
 	StudentID        raid.Raid
 	EnteranceTokenID raid.Raid
+	// WithStudent preloads Student of every examine student.
+	WithStudent bool
+}
+
+// StudentAssignment selects a student by id or username, DueDate overrides
+// due date of AssignExamineStudentOptions for the student.
+type StudentAssignment struct {
+	StudentID raid.Raid `json:"studentID"`
+	Username  string    `json:"username"`
+	DueDate   time.Time `json:"dueDate"`
+}
+
+// AssignExamineStudentOptions selects students of enterance token, students
+// are selected individually by Students and all students of Class and Grade
+// when any of them is set.
+type AssignExamineStudentOptions struct {
+	EnteranceTokenID raid.Raid `json:"-"`
+
+	Students []*StudentAssignment `json:"students"`
+	Class    string               `json:"class"`
+	Grade    string               `json:"grade"`
+	// DueDate is due date of selected students without their own, it is
+	// ignored when unassigning.
+	DueDate time.Time `json:"dueDate"`
 }
 
 type ExamineStudentRepositoryRead interface {
 	ListExamineStudent(ctx context.Context, o *ListExamineStudentOptions) ([]*ExamineStudent, error)
+	// CountActiveExamineStudent counts students whose enterance token window
+	// is open at at.
+	CountActiveExamineStudent(ctx context.Context, at time.Time) (int64, error)
 }
 
 type ExamineStudentRepositoryWrite interface {
 	CreateExamineStudent(ctx context.Context, examineStudent *ExamineStudent) error
-	DeleteExamineStudent(ctx context.Context, examineStudentID raid.Raid) error
+	DeleteExamineStudent(ctx context.Context, tokenID, studentID raid.Raid) error
+	// AssignExamineStudent assigns students at once, due date of student
+	// already assigned is replaced while its start of attempt is kept.
+	AssignExamineStudent(ctx context.Context, examineStudents []*ExamineStudent) error
+	// UnassignExamineStudent unassigns students from token and returns how
+	// many of them were assigned.
+	UnassignExamineStudent(ctx context.Context, tokenID raid.Raid, studentIDs []raid.Raid) (int64, error)
+	// StartExamineStudent records at as start of attempt of student, start
+	// of attempt already started is kept.
+	StartExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, at time.Time) error
+	// SubmitExamineStudent records at as submission of attempt of student,
+	// submission already recorded is kept.
+	SubmitExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, at time.Time) error
+	// AckExamineStudent records seq as latest answer change synced by
+	// student, lower seq than recorded one is ignored.
+	AckExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, seq uint64) error
+	// GradeExamineStudent scores attempts not graded yet whose window closed
+	// before at, and returns how many were graded.
+	GradeExamineStudent(ctx context.Context, at time.Time) (int64, error)
 }
 
 type ExamineStudentRepository interface {
@@ -58,6 +58,7 @@ func (o *PaginateOptions) PageFromQuery(q url.Values) error {
 	if o.Count == 0 {
 		o.Offset = 0
 		o.Page = 1
+		return nil
 	}
 	o.Page = o.Offset/o.Count + 1
 	return nil
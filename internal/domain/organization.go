@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/falentio/raid-go"
+)
+
+const OrganizationIDPrefix = "org"
+
+var (
+	ErrOrganizationNotFound = errors.New("organization: can not find organization")
+)
+
+// Organization is a school, every admin, student and examination belongs to
+// exactly one organization and is invisible for other organizations.
+type Organization struct {
+	Model
+
+	Name string `json:"name" validate:"max=64" gorm:"type:varchar(64)"`
+}
+
+type OrganizationRepositoryRead interface {
+	GetOrganization(ctx context.Context, organizationID raid.Raid) (*Organization, error)
+	GetOrganizationByName(ctx context.Context, name string) (*Organization, error)
+}
+
+type OrganizationRepositoryWrite interface {
+	CreateOrganization(ctx context.Context, organization *Organization) error
+}
+
+type OrganizationRepository interface {
+	OrganizationRepositoryRead
+	OrganizationRepositoryWrite
+}
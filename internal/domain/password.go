@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/falentio/raid-go"
+)
+
+// ChangePassword is request body to change password of current session.
+type ChangePassword struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ResetPassword is request body to set new password with reset code issued
+// by admin.
+type ResetPassword struct {
+	// OrganizationID is organization of the account, default organization
+	// is used when it is empty.
+	OrganizationID raid.Raid `json:"organizationID"`
+	Username       string    `json:"username"`
+	Code           string    `json:"code"`
+	NewPassword    string    `json:"newPassword"`
+}
+
+// PasswordResetCode is one time code given to account owner to set new
+// password, it is only shown once.
+type PasswordResetCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
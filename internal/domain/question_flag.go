@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/falentio/raid-go"
+)
+
+const QuestionFlagIDPrefix = "qfl"
+
+// QuestionStatus is state of question in navigation grid of student.
+type QuestionStatus string
+
+const (
+	QuestionUnanswered QuestionStatus = "unanswered"
+	QuestionAnswered   QuestionStatus = "answered"
+	// QuestionFlagged is question marked as doubtful ("ragu-ragu") by student,
+	// whether it is answered or not.
+	QuestionFlagged QuestionStatus = "flagged"
+)
+
+// QuestionFlag marks question as doubtful for student within attempt of
+// enterance token.
+type QuestionFlag struct {
+	Model
+
+	StudentID         raid.Raid `json:"studentID" gorm:"type:varchar(32);not null;uniqueIndex:idx_question_flag"`
+	EnteranceTokenID  raid.Raid `json:"enteranceTokenID" gorm:"type:varchar(32);not null;uniqueIndex:idx_question_flag"`
+	ExamineQuestionID raid.Raid `json:"examineQuestionID" gorm:"type:varchar(32);not null;uniqueIndex:idx_question_flag"`
+
+	Flagged bool `json:"flagged"`
+}
+
+type ListQuestionFlagOptions struct {
+	StudentID        raid.Raid
+	EnteranceTokenID raid.Raid
+}
+
+// QuestionState is single cell of navigation grid, Number starts at 1.
+type QuestionState struct {
+	Number            int            `json:"number"`
+	ExamineQuestionID raid.Raid      `json:"examineQuestionID"`
+	Status            QuestionStatus `json:"status"`
+	Answered          bool           `json:"answered"`
+	Flagged           bool           `json:"flagged"`
+}
+
+type AnswerSummaryOptions struct {
+	StudentID        raid.Raid
+	EnteranceTokenID raid.Raid
+}
+
+// AnswerSummary is navigation grid of attempt of student, Flagged and
+// Unanswered list question numbers to warn student about before submitting.
+type AnswerSummary struct {
+	EnteranceTokenID raid.Raid        `json:"enteranceTokenID"`
+	StudentID        raid.Raid        `json:"studentID"`
+	Questions        []*QuestionState `json:"questions"`
+	Flagged          []int            `json:"flagged"`
+	Unanswered       []int            `json:"unanswered"`
+}
+
+// AnswerSubmit submits attempt of student, answers can not be changed once
+// attempt is submitted. Attempt with flagged or unanswered questions is only
+// submitted when Confirm is set, so student is warned about them first.
+type AnswerSubmit struct {
+	EnteranceTokenID raid.Raid `json:"enteranceTokenID"`
+	Confirm          bool      `json:"confirm"`
+}
+
+type QuestionFlagRepositoryRead interface {
+	ListQuestionFlag(ctx context.Context, o *ListQuestionFlagOptions) ([]*QuestionFlag, error)
+}
+
+type QuestionFlagRepositoryWrite interface {
+	// SetQuestionFlag creates flag of f or updates existing flag of the same
+	// student, enterance token and question.
+	SetQuestionFlag(ctx context.Context, f *QuestionFlag) error
+}
+
+type QuestionFlagRepository interface {
+	QuestionFlagRepositoryRead
+	QuestionFlagRepositoryWrite
+}
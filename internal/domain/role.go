@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleSuperAdmin Role = "super-admin"
+	RoleTeacher    Role = "teacher"
+	RoleProctor    Role = "proctor"
+	RoleStudent    Role = "student"
+)
+
+type Permission string
+
+const (
+	PermissionAdminManage         Permission = "admin:manage"
+	PermissionExaminationRead     Permission = "examination:read"
+	PermissionExaminationWrite    Permission = "examination:write"
+	PermissionEnteranceTokenRead  Permission = "enterance-token:read"
+	PermissionEnteranceTokenWrite Permission = "enterance-token:write"
+	// PermissionScheduleFeed only reads schedule as iCalendar feed, it is
+	// the only scope of tokens carried in url of schedule feed.
+	PermissionScheduleFeed Permission = "schedule:feed"
+	PermissionStudentRead  Permission = "student:read"
+	PermissionStudentWrite Permission = "student:write"
+	PermissionStudentReset Permission = "student:reset"
+	PermissionFileRead     Permission = "file:read"
+	PermissionFileWrite    Permission = "file:write"
+	PermissionExamTake     Permission = "exam:take"
+)
+
+var RolePermissions = map[Role][]Permission{
+	RoleSuperAdmin: {
+		PermissionAdminManage,
+		PermissionExaminationRead,
+		PermissionExaminationWrite,
+		PermissionEnteranceTokenRead,
+		PermissionEnteranceTokenWrite,
+		PermissionScheduleFeed,
+		PermissionStudentRead,
+		PermissionStudentWrite,
+		PermissionStudentReset,
+		PermissionFileRead,
+		PermissionFileWrite,
+	},
+	RoleTeacher: {
+		PermissionExaminationRead,
+		PermissionExaminationWrite,
+		PermissionEnteranceTokenRead,
+		PermissionEnteranceTokenWrite,
+		PermissionScheduleFeed,
+		PermissionStudentRead,
+		PermissionStudentWrite,
+		PermissionStudentReset,
+		PermissionFileRead,
+		PermissionFileWrite,
+	},
+	RoleProctor: {
+		PermissionEnteranceTokenRead,
+		PermissionScheduleFeed,
+		PermissionStudentRead,
+		PermissionStudentReset,
+	},
+	RoleStudent: {
+		PermissionExamTake,
+	},
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, rp := range RolePermissions[r] {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
+
+// roleRank orders staff roles, admin may only manage admins whose role does
+// not rank above its own.
+var roleRank = map[Role]int{
+	RoleProctor:    1,
+	RoleTeacher:    2,
+	RoleSuperAdmin: 3,
+}
+
+// Covers reports whether admin of role r may manage admin of role o.
+func (r Role) Covers(o Role) bool {
+	return r.IsStaff() && roleRank[r] >= roleRank[o]
+}
+
+// IsStaff reports whether role belongs to an admin account.
+func (r Role) IsStaff() bool {
+	return r == RoleSuperAdmin || r == RoleTeacher || r == RoleProctor
+}
+
+// Permissions is stored as space separated list of permission.
+type Permissions []Permission
+
+func (ps Permissions) Has(p Permission) bool {
+	for _, pp := range ps {
+		if pp == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps Permissions) Value() (driver.Value, error) {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = string(p)
+	}
+	return strings.Join(s, " "), nil
+}
+
+func (ps *Permissions) Scan(v any) error {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("Permissions: can not scan %T", v)
+	}
+	*ps = nil
+	for _, p := range strings.Fields(s) {
+		*ps = append(*ps, Permission(p))
+	}
+	return nil
+}
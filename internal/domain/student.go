@@ -18,15 +18,32 @@ const StudentIDPrefix = "stu"
 type Student struct {
 	Model
 
-	AdminID raid.Raid `json:"adminID" gorm:"type:varchar(32);not null"`
+	OrganizationID raid.Raid `json:"organizationID" gorm:"type:varchar(32);not null;index;uniqueIndex:idx_students_organization_username"`
+	AdminID        raid.Raid `json:"adminID" gorm:"type:varchar(32);not null"`
 
 	Name           string `json:"name"`
-	Username       string `json:"username" validate:"max=32" gorm:"type:varchar(32)"`
+	Username       string `json:"username" validate:"max=32" gorm:"type:varchar(32);uniqueIndex:idx_students_organization_username"`
 	Class          string `json:"class"`
 	Grade          string `json:"grade"`
 	PresenceNumber int    `json:"presenceNumber"`
 	PasswordHash   string `json:"-"`
-	Password       string `json:"password,omitempty" validate:"min=8" gorm:"-"`
+	Password       string `json:"password,omitempty" gorm:"-"`
+	// MustChangePassword is set when password was generated or reset.
+	MustChangePassword bool `json:"mustChangePassword" gorm:"not null;default:false"`
+	// Device is server issued id of device used to log in, it is read from
+	// cookie of the device, see student.SessionPolicy.
+	Device string `json:"-" gorm:"-"`
+	// IdentityProvider and IdentitySubject link student to account of
+	// external identity provider, they are kept nil for local accounts.
+	IdentityProvider *string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_students_identity"`
+	IdentitySubject  *string `json:"-" gorm:"type:varchar(255);uniqueIndex:idx_students_identity"`
+	// Provider, Code, State and RedirectURI are sent to log in with external
+	// identity provider, Code is authorization code of OIDC provider issued
+	// for authorization State.
+	Provider    string `json:"provider,omitempty" gorm:"-"`
+	Code        string `json:"code,omitempty" gorm:"-"`
+	State       string `json:"state,omitempty" gorm:"-"`
+	RedirectURI string `json:"redirectURI,omitempty" gorm:"-"`
 
 	EnteranceTokens []*EnteranceToken `json:"enteranceTokens" gorm:"many2many:examine_student"`
 	ExamineAnswer   []*ExamineAnswer  `json:"examineAnswer" gorm:"many2many:student_examine_answer"`
@@ -46,6 +63,7 @@ type ListStudentOptions struct {
 type StudentRepositoryRead interface {
 	GetStudent(ctx context.Context, studentID raid.Raid) (*Student, error)
 	GetStudentByUsername(ctx context.Context, username string) (*Student, error)
+	GetStudentByIdentity(ctx context.Context, provider, subject string) (*Student, error)
 	ListStudent(ctx context.Context, opts *ListStudentOptions) ([]*Student, error)
 }
 
@@ -54,6 +72,8 @@ type StudentRepositoryWrite interface {
 	BatchCreateStudent(ctx context.Context, students []*Student) error
 	DeleteStudent(ctx context.Context, studentID raid.Raid) error
 	UpdateStudent(ctx context.Context, student *Student) error
+	UpdateStudentPassword(ctx context.Context, studentID raid.Raid, passwordHash string, mustChange bool) error
+	LinkStudentIdentity(ctx context.Context, studentID raid.Raid, provider, subject string) error
 }
 
 type StudentRepository interface {
@@ -72,6 +92,12 @@ type StudentServiceWrite interface {
 	DeleteStudent(ctx context.Context, studentID raid.Raid) (response.Response, error)
 	UpdateStudent(ctx context.Context, student *Student) (response.Response, error)
 	LoginStudent(ctx context.Context, student *Student) (res response.Response, err error)
+	AuthorizeStudent(ctx context.Context, provider, redirectURI string) (res response.Response, err error)
+	LogoutStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error)
+	ReleaseStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error)
+	ChangeStudentPassword(ctx context.Context, c *ChangePassword) (res response.Response, err error)
+	ResetStudentPassword(ctx context.Context, studentID raid.Raid) (res response.Response, err error)
+	RedeemStudentPassword(ctx context.Context, r *ResetPassword) (res response.Response, err error)
 }
 
 type StudentService interface {
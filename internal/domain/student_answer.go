@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/falentio/raid-go"
 )
@@ -16,29 +17,76 @@ var (
 type StudentAnswer struct {
 	Model
 
-	ExamineAnswerID  raid.Raid `json:"examineAnswerID" gorm:"type:varchar(32);not null"`
-	StudentID        raid.Raid `json:"studentID" gorm:"type:varchar(32);not null"`
-	EnteranceTokenID raid.Raid `json:"enteranceTokenID" gorm:"type:varchar(32);not null"`
+	// every examine answer has single row per attempt, unselected answer is
+	// kept soft deleted
+	ExamineAnswerID  raid.Raid `json:"examineAnswerID" gorm:"type:varchar(32);not null;uniqueIndex:idx_student_answers_attempt"`
+	StudentID        raid.Raid `json:"studentID" gorm:"type:varchar(32);not null;uniqueIndex:idx_student_answers_attempt"`
+	EnteranceTokenID raid.Raid `json:"enteranceTokenID" gorm:"type:varchar(32);not null;uniqueIndex:idx_student_answers_attempt"`
+
+	// AnsweredAt is time of latest change of this answer, used to resolve
+	// conflicting changes, see AnswerChange.At.
+	AnsweredAt time.Time `json:"answeredAt"`
 
 	Student        *Student        `json:"student"`
 	ExamineAnswer  *ExamineAnswer  `json:"examineAnswer"`
 	EnteranceToken *EnteranceToken `json:"enteranceToken"`
 }
 
+// AnswerChange is single entry of change log kept by client while offline,
+// Seq increases with every change made by client within an attempt. At is
+// client time of the change, it is clamped into window of enterance token and
+// to time server receives it, since clock of client is not trusted.
+type AnswerChange struct {
+	Seq             uint64    `json:"seq" validate:"min=1"`
+	ExamineAnswerID raid.Raid `json:"examineAnswerID"`
+	Selected        bool      `json:"selected"`
+	At              time.Time `json:"at" validate:"required"`
+}
+
+// AnswerSync is changes made by client since latest ack it received.
+type AnswerSync struct {
+	EnteranceTokenID raid.Raid       `json:"enteranceTokenID"`
+	Changes          []*AnswerChange `json:"changes" validate:"max=500,dive"`
+}
+
+// RejectedAnswerChange is change which will never be applied, client must
+// not send it again.
+type RejectedAnswerChange struct {
+	Seq    uint64 `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// AnswerSyncResult acknowledges every change up to Ack and lists answers of
+// student as stored by server, which replace answers kept by client. Ack is
+// kept by server, so changes up to it are skipped when they are sent again.
+type AnswerSyncResult struct {
+	Ack      uint64                  `json:"ack"`
+	Rejected []*RejectedAnswerChange `json:"rejected"`
+	Answers  []*StudentAnswer        `json:"answers"`
+}
+
 type ListStudentAnswerOptions struct {
 	ExamineAnswerID  raid.Raid
 	StudentID        raid.Raid
 	EnteranceTokenID raid.Raid
+	// IncludeUnselected lists answers which were selected and then unselected
+	// too.
+	IncludeUnselected bool
 }
 
 type StudentAnswerRepositoryRead interface {
 	ListStudentAnswer(ctx context.Context, o *ListStudentAnswerOptions) ([]*StudentAnswer, error)
 	GetStudentAnswer(ctx context.Context, id raid.Raid) (*StudentAnswer, error)
+	// CountOpenStudentAnswer counts selected answers by id of enterance token
+	// whose window is open at at.
+	CountOpenStudentAnswer(ctx context.Context, at time.Time) (map[string]int64, error)
 }
 
 type StudentAnswerRepositoryWrite interface {
-	CreateStudentAnswer(ctx context.Context, a *StudentAnswer) error
-	DeleteStudentAnswer(ctx context.Context, id raid.Raid) error
+	// ApplyStudentAnswer selects or unselects examine answer of a for student
+	// and enterance token of a, it returns false when answer was already
+	// changed at later a.AnsweredAt.
+	ApplyStudentAnswer(ctx context.Context, a *StudentAnswer, selected bool) (bool, error)
 }
 
 type StudentAnswerRepository interface {
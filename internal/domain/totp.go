@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// TOTPEnrolment is secret of pending two factor enrolment, URI is shown as
+// QR code to authenticator apps.
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPCode is request body carrying code of authenticator app, recovery code
+// is accepted wherever TOTPCode is.
+type TOTPCode struct {
+	Code string `json:"code"`
+}
+
+// TOTPChallenge is returned by login of admin with two factor enabled, it is
+// exchanged along with code for session.
+type TOTPChallenge struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TOTPLogin is request body of second login step.
+type TOTPLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// RecoveryCodes are single use codes replacing authenticator app when it is
+// lost, they are only shown once.
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
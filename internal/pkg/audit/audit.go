@@ -0,0 +1,127 @@
+// package audit records administrative and exam critical actions into append
+// only audit log, so changes of accounts, questions and answer keys can be
+// traced back to who made them.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/falentio/raid-go"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+var AuditLogIDFactory = raid.NewRaid().WithPrefix(domain.AuditLogIDPrefix)
+
+// ignored are fields which change on every write and secrets returned once,
+// e.g. generated password or api token, which must not be kept in audit log.
+var ignored = map[string]bool{
+	"createdAt": true,
+	"updatedAt": true,
+	"deletedAt": true,
+	"password":  true,
+	"code":      true,
+	"token":     true,
+}
+
+// Recorder writes audit logs, nil Recorder records nothing so services keep
+// working without audit log in tests.
+type Recorder struct {
+	Repository domain.AuditLogRepositoryWrite
+	Auth       *auth.Auth
+}
+
+// Record appends action to target done by caller of ctx, before and after are
+// states of target, either may be nil. Error is returned so caller fails the
+// request instead of leaving action out of audit log.
+func (rec *Recorder) Record(ctx context.Context, action string, target raid.Raid, before, after any) error {
+	if rec == nil || rec.Repository == nil {
+		return nil
+	}
+	l := &domain.AuditLog{
+		Action:    action,
+		TargetID:  target,
+		RequestID: middleware.GetReqID(ctx),
+	}
+	l.ID = AuditLogIDFactory.WithRandom().WithTimestampNow()
+	tenant.Assign(ctx, &l.OrganizationID)
+	if rec.Auth != nil {
+		if c, err := rec.Auth.GetClaims(ctx); err == nil {
+			l.ActorRole = c.Role
+			l.ActorID, _ = raid.RaidFromString(c.Subject)
+			if l.OrganizationID.IsNil() {
+				l.OrganizationID, _ = raid.RaidFromString(c.Organization)
+			}
+		}
+	}
+
+	diff, err := Diff(before, after)
+	if err == nil {
+		l.Diff = diff
+		err = rec.Repository.CreateAuditLog(ctx, l)
+	}
+	if err != nil {
+		return fmt.Errorf("audit: failed to record %s of %s: %w", action, target, err)
+	}
+	return nil
+}
+
+// Diff returns top level fields of before and after whose JSON value differ,
+// nested objects and fields hidden from JSON, e.g. password hash, are left out.
+func Diff(before, after any) (domain.AuditDiff, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := domain.AuditDiff{}
+	for k, v := range b {
+		if w, ok := a[k]; !ok || !reflect.DeepEqual(v, w) {
+			diff[k] = domain.AuditChange{Before: v, After: a[k]}
+		}
+	}
+	for k, w := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = domain.AuditChange{After: w}
+		}
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+func fields(v any) (map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	for k, f := range m {
+		switch f.(type) {
+		case map[string]any, []any:
+			delete(m, k)
+			continue
+		}
+		if ignored[k] {
+			delete(m, k)
+		}
+	}
+	return m, nil
+}
@@ -3,31 +3,87 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog"
 
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/logging"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
 )
 
 var (
 	ErrUnauthorized = response.NewUnauthorized(nil, "session was not found")
 	ErrInvalidToken = response.NewBadRequest(nil, "token is invalid")
+	ErrForbidden    = response.NewForbidden(nil, "session does not have permission to do this action")
+	ErrRevoked      = response.NewUnauthorized(nil, "session was revoked")
+	ErrMustChange   = response.NewForbidden(nil, "password must be changed before doing this action")
+	ErrBearer       = response.NewForbidden(nil, "api token can not do this action, sign in instead")
+)
+
+const (
+	revokedIDPrefix      = "auth:revoked:jti:"
+	revokedSubjectPrefix = "auth:revoked:sub:"
 )
 
 var (
 	jwtIDFactory = raid.NewRaid().WithPrefix("jwt")
 )
 
+type Claims struct {
+	jwt.RegisteredClaims
+
+	Role         domain.Role `json:"role,omitempty"`
+	Organization string      `json:"org,omitempty"`
+	// Scopes limits permissions of Role when not empty, e.g. for api tokens.
+	Scopes domain.Permissions `json:"scp,omitempty"`
+	// MustChangePassword denies every permission until password is changed.
+	MustChangePassword bool `json:"mcp,omitempty"`
+	// Device is server issued id of device session was signed for.
+	Device string `json:"dev,omitempty"`
+	// Bearer is set when claims were verified from api token instead of
+	// session cookie, it is never signed.
+	Bearer bool `json:"-"`
+}
+
+// TokenVerifier verifies bearer token of machine clients.
+type TokenVerifier interface {
+	VerifyAPIToken(ctx context.Context, token string) (*Claims, error)
+}
+
 type Auth struct {
-	Name          string
-	Secure        bool
+	Name   string
+	Secure bool
+
+	// SigningMethod and Secret verify sessions without "kid" header, they
+	// also sign new sessions when Keys is empty.
 	SigningMethod jwt.SigningMethod
 	Secret        []byte
 	Logger        zerolog.Logger
 
+	// Keys signs new sessions with its current key, older keys are still
+	// accepted until they are pruned.
+	Keys *KeySet
+
+	// Lifetime is how long signed session is valid, sessions signed with zero
+	// Lifetime never expire, options of server default it to 12 hours.
+	Lifetime time.Duration
+	// RefreshThreshold is remaining lifetime of session below which
+	// (*Auth).VerifyMiddleware issues a fresh session cookie.
+	RefreshThreshold time.Duration
+	// Storage keeps revoked sessions, revocation is disabled when nil.
+	Storage storage.Storage
+	// Tokens verifies "Authorization: Bearer" header, bearer tokens are
+	// ignored when nil.
+	Tokens TokenVerifier
+
 	ctxKey string
 }
 
@@ -38,13 +94,36 @@ func (a *Auth) ctx() string {
 	return a.ctxKey
 }
 
-func (a *Auth) Sign(c jwt.RegisteredClaims) (*http.Cookie, error) {
-	c.ID = jwtIDFactory.WithRandom().WithTimestampNow().String()
-	// c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour))
+// NewSessionID returns id used as jti of a new session.
+func NewSessionID() string {
+	return jwtIDFactory.WithRandom().WithTimestampNow().String()
+}
+
+// Sign issues session cookie for c. c.ID is kept when set, so every cookie
+// refreshed from a session shares its id and is revoked together with it;
+// new id is only generated when c.ID is empty.
+func (a *Auth) Sign(c Claims) (*http.Cookie, error) {
+	now := time.Now()
+	if c.ID == "" {
+		c.ID = NewSessionID()
+	}
+	c.IssuedAt = jwt.NewNumericDate(now)
+	c.ExpiresAt = nil
+	if a.Lifetime > 0 {
+		c.ExpiresAt = jwt.NewNumericDate(now.Add(a.Lifetime))
+	}
 
-	token, err := jwt.
-		NewWithClaims(a.SigningMethod, c).
-		SignedString(a.Secret)
+	var t *jwt.Token
+	var key any
+	if k := a.currentKey(); k != nil {
+		t = jwt.NewWithClaims(k.Method, c)
+		t.Header["kid"] = k.ID
+		key = k.signKey
+	} else {
+		t = jwt.NewWithClaims(a.SigningMethod, c)
+		key = a.Secret
+	}
+	token, err := t.SignedString(key)
 	if err != nil {
 		return nil, err
 	}
@@ -55,53 +134,251 @@ func (a *Auth) Sign(c jwt.RegisteredClaims) (*http.Cookie, error) {
 		HttpOnly: true,
 		Path:     "/",
 		Secure:   a.Secure,
-		// MaxAge:   86400 * 7,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(a.Lifetime / time.Second),
 	}
 	return cookie, nil
 }
 
-func (a *Auth) Verify(token string) (*jwt.RegisteredClaims, error) {
-	claims := &jwt.RegisteredClaims{}
+func (a *Auth) Verify(token string) (*Claims, error) {
+	return a.VerifyContext(context.Background(), token)
+}
+
+// VerifyContext verifies token like Verify, revocation lookups are traced
+// as children of span in ctx.
+func (a *Auth) VerifyContext(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
 	t, err := jwt.
-		NewParser().
-		ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
-			return a.Secret, nil
-		})
+		NewParser(jwt.WithValidMethods(a.validMethods())).
+		ParseWithClaims(token, claims, a.keyFunc)
 	if err != nil {
 		a.Logger.Debug().Err(err).Msg("error while verifying jwt")
 		return nil, ErrInvalidToken
 	}
 
-	claims, ok := t.Claims.(*jwt.RegisteredClaims)
+	claims, ok := t.Claims.(*Claims)
 	if !ok {
 		return nil, ErrInvalidToken
 	}
 
+	revoked, err := a.isRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevoked
+	}
+
 	return claims, nil
 }
 
+func (a *Auth) currentKey() *Key {
+	if a.Keys == nil {
+		return nil
+	}
+	return a.Keys.Current()
+}
+
+func (a *Auth) validMethods() []string {
+	var algs []string
+	if a.Keys != nil {
+		algs = a.Keys.Methods()
+	}
+	if a.SigningMethod != nil && a.Secret != nil {
+		algs = append(algs, a.SigningMethod.Alg())
+	}
+	return algs
+}
+
+// keyFunc returns verification key of t, algorithm of t must match the
+// algorithm its key was created for, so keys can not be used with other
+// algorithms, e.g. public key as hmac secret.
+func (a *Auth) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if a.SigningMethod == nil || a.Secret == nil || t.Method.Alg() != a.SigningMethod.Alg() {
+			return nil, ErrUnknownKey
+		}
+		return a.Secret, nil
+	}
+
+	var k *Key
+	if a.Keys != nil {
+		k = a.Keys.Lookup(kid)
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, ErrUnknownAlgorithm
+	}
+	return k.verifyKey, nil
+}
+
+func (a *Auth) isRevoked(ctx context.Context, c *Claims) (bool, error) {
+	if a.Storage == nil {
+		return false, nil
+	}
+	store := tracing.Bind(ctx, a.Storage)
+
+	b, err := store.Get(revokedIDPrefix + c.ID)
+	if err != nil {
+		return false, err
+	}
+	if b != nil {
+		return true, nil
+	}
+
+	b, err = store.Get(revokedSubjectPrefix + c.Subject)
+	if err != nil {
+		return false, err
+	}
+	if b == nil || c.IssuedAt == nil {
+		return b != nil, nil
+	}
+	fields := strings.Split(string(b), ",")
+	before, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return false, err
+	}
+	for _, keep := range fields[1:] {
+		if keep == c.ID {
+			return false, nil
+		}
+	}
+	return c.IssuedAt.Unix() <= before, nil
+}
+
+// Revoke invalidates session with id of c, including its refreshed cookies.
+// Only c.ID is used, revocation is kept for a.Lifetime since refreshed cookie
+// may outlive expiry of c.
+func (a *Auth) Revoke(ctx context.Context, c *Claims) error {
+	if a.Storage == nil {
+		return nil
+	}
+	return tracing.Bind(ctx, a.Storage).Set(revokedIDPrefix+c.ID, []byte{1}, a.Lifetime)
+}
+
+// RevokeSubject invalidates every session of subject issued until now, except
+// sessions with id in keep, e.g. session which changed password.
+func (a *Auth) RevokeSubject(ctx context.Context, subject string, keep ...string) error {
+	if a.Storage == nil {
+		return nil
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	v := strings.Join(append([]string{now}, keep...), ",")
+	return tracing.Bind(ctx, a.Storage).Set(revokedSubjectPrefix+subject, []byte(v), a.Lifetime)
+}
+
+// refresh issues fresh session cookie when c is about to expire.
+func (a *Auth) refresh(w http.ResponseWriter, c *Claims) {
+	if a.Lifetime <= 0 || a.RefreshThreshold <= 0 || c.ExpiresAt == nil {
+		return
+	}
+	if time.Until(c.ExpiresAt.Time) > a.RefreshThreshold {
+		return
+	}
+	cookie, err := a.Sign(*c)
+	if err != nil {
+		a.Logger.Error().Err(err).Msg("failed to refresh session")
+		return
+	}
+	http.SetCookie(w, cookie)
+}
+
 func (a *Auth) VerifyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := r.Cookie(a.Name)
+		claims, bearer, err := a.verifyRequest(r)
 		if err != nil {
-			response.HandleError(w, r, ErrUnauthorized)
+			response.HandleError(w, r, err)
 			return
 		}
 
-		claims, err := a.Verify(token.Value)
+		ctx, err := a.withClaims(r.Context(), claims)
 		if err != nil {
 			response.HandleError(w, r, err)
 			return
 		}
-
-		ctx := context.WithValue(r.Context(), a.ctx(), claims)
+		if !bearer {
+			a.refresh(w, claims)
+		}
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (a *Auth) GetClaims(ctx context.Context) (*jwt.RegisteredClaims, error) {
-	c, ok := ctx.Value(a.ctx()).(*jwt.RegisteredClaims)
+// VerifyQueryMiddleware verifies api token sent in url query param, for
+// clients which can not send cookie or header, e.g. calendar applications.
+// Url ends up in logs and history, so sessions are refused and api token is
+// only accepted when scope is its only scope, it can be revoked by deleting
+// the api token.
+func (a *Auth) VerifyQueryMiddleware(param string, scope domain.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get(param)
+			if token == "" || a.Tokens == nil {
+				response.HandleError(w, r, ErrUnauthorized)
+				return
+			}
+			claims, err := a.Tokens.VerifyAPIToken(r.Context(), token)
+			if err != nil {
+				response.HandleError(w, r, err)
+				return
+			}
+			if len(claims.Scopes) != 1 || claims.Scopes[0] != scope {
+				response.HandleError(w, r, ErrInvalidToken)
+				return
+			}
+			claims.Bearer = true
+			ctx, err := a.withClaims(r.Context(), claims)
+			if err != nil {
+				response.HandleError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withClaims returns ctx of request verified with claims.
+func (a *Auth) withClaims(ctx context.Context, claims *Claims) (context.Context, error) {
+	ctx = context.WithValue(ctx, a.ctx(), claims)
+	logging.SetUser(ctx, claims.Subject)
+	if claims.Organization != "" {
+		org, err := raid.RaidFromString(claims.Organization)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		ctx = tenant.WithOrganization(ctx, org)
+	}
+	return ctx, nil
+}
+
+// verifyRequest verifies bearer token of r when sent, otherwise its session cookie.
+func (a *Auth) verifyRequest(r *http.Request) (claims *Claims, bearer bool, err error) {
+	if h := r.Header.Get("Authorization"); h != "" && a.Tokens != nil {
+		token := strings.TrimPrefix(h, "Bearer ")
+		if token == h {
+			return nil, true, ErrInvalidToken
+		}
+		claims, err = a.Tokens.VerifyAPIToken(r.Context(), token)
+		if err != nil {
+			return nil, true, err
+		}
+		claims.Bearer = true
+		return claims, true, nil
+	}
+
+	cookie, err := r.Cookie(a.Name)
+	if err != nil {
+		return nil, false, ErrUnauthorized
+	}
+	claims, err = a.VerifyContext(r.Context(), cookie.Value)
+	return claims, false, err
+}
+
+func (a *Auth) GetClaims(ctx context.Context) (*Claims, error) {
+	c, ok := ctx.Value(a.ctx()).(*Claims)
 	if !ok {
 		return nil, ErrUnauthorized
 	}
@@ -126,10 +403,92 @@ func (a *Auth) GetSubjectRaid(ctx context.Context, prefix string) (raid.Raid, er
 	return id, nil
 }
 
+// Authorize returns subject of session when its role has permission p.
+func (a *Auth) Authorize(ctx context.Context, p domain.Permission) (raid.Raid, error) {
+	c, err := a.GetClaims(ctx)
+	if err != nil {
+		return raid.NilRaid, err
+	}
+
+	if c.MustChangePassword {
+		return raid.NilRaid, ErrMustChange
+	}
+	if !c.Role.Can(p) || (len(c.Scopes) > 0 && !c.Scopes.Has(p)) {
+		return raid.NilRaid, ErrForbidden
+	}
+
+	id, err := raid.RaidFromString(c.Subject)
+	if err != nil {
+		return raid.NilRaid, ErrInvalidToken
+	}
+
+	return id, nil
+}
+
+// GetSessionClaims returns claims like GetClaims, but refuses claims of api
+// token, for actions on account itself such as changing password or minting
+// api tokens.
+func (a *Auth) GetSessionClaims(ctx context.Context) (*Claims, error) {
+	c, err := a.GetClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.Bearer {
+		return nil, ErrBearer
+	}
+	return c, nil
+}
+
+// GetRole returns role of session, it returns empty role when there is no session
+// or its password must be changed.
+func (a *Auth) GetRole(ctx context.Context) domain.Role {
+	c, err := a.GetClaims(ctx)
+	if err != nil || c.MustChangePassword {
+		return ""
+	}
+	return c.Role
+}
+
+// RequirePermission rejects request whose session role does not have permission p,
+// it must be used after (*Auth).VerifyMiddleware.
+func (a *Auth) RequirePermission(p domain.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := a.Authorize(r.Context(), p); err != nil {
+				response.HandleError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects request verified with api token, it must be used
+// after (*Auth).VerifyMiddleware, see (*Auth).GetSessionClaims.
+func (a *Auth) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.GetSessionClaims(r.Context()); err != nil {
+			response.HandleError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (a *Auth) Logout(w http.ResponseWriter, r *http.Request) {
+	if token, err := r.Cookie(a.Name); err == nil {
+		if claims, err := a.VerifyContext(r.Context(), token.Value); err == nil {
+			if err := a.Revoke(r.Context(), claims); err != nil {
+				response.HandleError(w, r, err)
+				return
+			}
+		}
+	}
+
 	http.SetCookie(w, &http.Cookie{
 		Name:    a.Name,
-		MaxAge:  0,
+		Path:    "/",
+		MaxAge:  -1,
 		Expires: time.Unix(0, 0).UTC(),
 	})
 
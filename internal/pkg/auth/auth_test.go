@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/domain"
+)
+
+func newTestAuth() *Auth {
+	return &Auth{
+		Name:          "session",
+		SigningMethod: jwt.SigningMethodHS512,
+		Secret:        []byte("secret"),
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	t.Parallel()
+	a := newTestAuth()
+	subject := raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().WithTimestampNow().String()
+
+	handler := a.VerifyMiddleware(a.RequirePermission(domain.PermissionAdminManage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	for _, tc := range []struct {
+		Role domain.Role
+		Code int
+	}{
+		{domain.RoleSuperAdmin, http.StatusNoContent},
+		{domain.RoleTeacher, http.StatusForbidden},
+		{domain.RoleProctor, http.StatusForbidden},
+		{domain.RoleStudent, http.StatusForbidden},
+		{"", http.StatusForbidden},
+	} {
+		tc := tc
+		t.Run(string(tc.Role), func(t *testing.T) {
+			c, err := a.Sign(Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+				Role:             tc.Role,
+			})
+			if err != nil {
+				t.Fatal("failed to sign claims", err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(c)
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.Code {
+				t.Errorf("expected status %d for role %q, got %d", tc.Code, tc.Role, w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without session, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	t.Parallel()
+	a := newTestAuth()
+	a.Lifetime = time.Hour
+	a.Storage = memory.New()
+	subject := raid.NewRaid().WithPrefix(domain.StudentIDPrefix).WithRandom().WithTimestampNow().String()
+
+	sign := func() *Claims {
+		c, err := a.Sign(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}})
+		if err != nil {
+			t.Fatal("failed to sign claims", err)
+		}
+		claims, err := a.Verify(c.Value)
+		if err != nil {
+			t.Fatal("failed to verify fresh session", err)
+		}
+		if c.MaxAge != int(time.Hour/time.Second) {
+			t.Errorf("expected cookie max age %d, got %d", int(time.Hour/time.Second), c.MaxAge)
+		}
+		return claims
+	}
+
+	c1, c2 := sign(), sign()
+	if err := a.Revoke(context.Background(), c1); err != nil {
+		t.Fatal("failed to revoke session", err)
+	}
+	if _, err := a.Verify(mustToken(t, a, c1)); err != ErrRevoked {
+		t.Errorf("revoked session must be rejected, got %v", err)
+	}
+	// refreshed cookie keeps id of session, so it is revoked too
+	refreshed, err := a.Sign(*c1)
+	if err != nil {
+		t.Fatal("failed to refresh session", err)
+	}
+	if _, err := a.Verify(refreshed.Value); err != ErrRevoked {
+		t.Errorf("refreshed cookie of revoked session must be rejected, got %v", err)
+	}
+	if _, err := a.Verify(mustToken(t, a, c2)); err != nil {
+		t.Errorf("other session must stay valid, got %v", err)
+	}
+
+	if err := a.RevokeSubject(context.Background(), subject); err != nil {
+		t.Fatal("failed to revoke subject", err)
+	}
+	c2.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	if _, err := a.Verify(mustToken(t, a, c2)); err != ErrRevoked {
+		t.Errorf("session of revoked subject must be rejected, got %v", err)
+	}
+	// sessions issued in the same second as revocation are revoked too
+	c3 := &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "same-second", Subject: subject, IssuedAt: jwt.NewNumericDate(time.Now())}}
+	if _, err := a.Verify(mustToken(t, a, c3)); err != ErrRevoked {
+		t.Errorf("session issued in the second of revocation must be rejected, got %v", err)
+	}
+	// iat in the future is invalid, so revocation is moved back instead
+	earlier := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	if err := a.Storage.Set(revokedSubjectPrefix+subject, []byte(earlier), 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := a.Verify(mustToken(t, a, c3)); err != nil {
+		t.Errorf("session issued after revocation must stay valid, got %v", err)
+	}
+
+	kept := &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "kept", Subject: subject, IssuedAt: jwt.NewNumericDate(time.Now())}}
+	if err := a.RevokeSubject(context.Background(), subject, kept.ID); err != nil {
+		t.Fatal("failed to revoke subject", err)
+	}
+	if _, err := a.Verify(mustToken(t, a, kept)); err != nil {
+		t.Errorf("kept session must stay valid, got %v", err)
+	}
+	kept.ID = "other"
+	if _, err := a.Verify(mustToken(t, a, kept)); err != ErrRevoked {
+		t.Errorf("other session of revoked subject must be rejected, got %v", err)
+	}
+}
+
+// mustToken re-encodes claims without touching id or issued at.
+func mustToken(t *testing.T, a *Auth, c *Claims) string {
+	s, err := jwt.NewWithClaims(a.SigningMethod, c).SignedString(a.Secret)
+	if err != nil {
+		t.Fatal("failed to encode claims", err)
+	}
+	return s
+}
+
+// fakeTokens verifies api tokens named by their scopes.
+type fakeTokens map[string]domain.Permissions
+
+func (f fakeTokens) VerifyAPIToken(ctx context.Context, token string) (*Claims, error) {
+	scopes, ok := f[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().String()},
+		Role:             domain.RoleTeacher,
+		Scopes:           scopes,
+	}, nil
+}
+
+func TestVerifyQueryMiddleware(t *testing.T) {
+	t.Parallel()
+	a := newTestAuth()
+	a.Tokens = fakeTokens{
+		"feed":  {domain.PermissionScheduleFeed},
+		"wider": {domain.PermissionScheduleFeed, domain.PermissionEnteranceTokenRead},
+		"other": {domain.PermissionEnteranceTokenRead},
+	}
+	subject := raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().WithTimestampNow().String()
+
+	handler := a.VerifyQueryMiddleware("token", domain.PermissionScheduleFeed)(a.RequirePermission(domain.PermissionScheduleFeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	sign := func(scopes domain.Permissions) string {
+		c, err := a.Sign(Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+			Role:             domain.RoleTeacher,
+			Scopes:           scopes,
+		})
+		if err != nil {
+			t.Fatal("failed to sign claims", err)
+		}
+		return c.Value
+	}
+
+	for name, tc := range map[string]struct {
+		Token string
+		Code  int
+	}{
+		"feed":           {"feed", http.StatusNoContent},
+		"wider":          {"wider", http.StatusBadRequest},
+		"other":          {"other", http.StatusBadRequest},
+		"scoped session": {sign(domain.Permissions{domain.PermissionScheduleFeed}), http.StatusBadRequest},
+		"session":        {sign(nil), http.StatusBadRequest},
+		"missing":        {"", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?token="+tc.Token, nil))
+		if w.Code != tc.Code {
+			t.Errorf("expected status %d for %s token, got %d", tc.Code, name, w.Code)
+		}
+	}
+}
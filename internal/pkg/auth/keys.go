@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("auth: unknown signing algorithm")
+	ErrUnknownKey       = errors.New("auth: unknown signing key")
+
+	keyIDFactory = raid.NewRaid().WithPrefix("kid")
+)
+
+const (
+	pemTypeHMAC      = "HMAC KEY"
+	pemTypePrivate   = "PRIVATE KEY"
+	pemHeaderAlg     = "Algorithm"
+	pemHeaderCreated = "Created"
+)
+
+// Key is a signing key of sessions, identified by ID in "kid" header.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+
+	// signKey is []byte, ed25519.PrivateKey or *rsa.PrivateKey
+	signKey any
+	// verifyKey is []byte, ed25519.PublicKey or *rsa.PublicKey
+	verifyKey any
+}
+
+// SigningMethod returns signing method of alg, only HS512, EdDSA and RS256
+// are supported.
+func SigningMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodHS512.Alg():
+		return jwt.SigningMethodHS512, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, alg)
+}
+
+// GenerateKey generates new key for alg.
+func GenerateKey(alg string, now time.Time) (*Key, error) {
+	method, err := SigningMethod(alg)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{
+		ID:        keyIDFactory.WithRandom().WithTimestamp(now).String(),
+		Method:    method,
+		CreatedAt: now,
+	}
+	switch method {
+	case jwt.SigningMethodHS512:
+		b := make([]byte, 64)
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+		k.signKey, k.verifyKey = b, b
+	case jwt.SigningMethodEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		k.signKey, k.verifyKey = priv, pub
+	case jwt.SigningMethodRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		k.signKey, k.verifyKey = priv, &priv.PublicKey
+	}
+	return k, nil
+}
+
+// MarshalPEM encodes k with its algorithm and creation time as pem headers.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	block := &pem.Block{
+		Headers: map[string]string{
+			pemHeaderAlg:     k.Method.Alg(),
+			pemHeaderCreated: k.CreatedAt.UTC().Format(time.RFC3339),
+		},
+	}
+	switch sk := k.signKey.(type) {
+	case []byte:
+		block.Type, block.Bytes = pemTypeHMAC, sk
+	default:
+		b, err := x509.MarshalPKCS8PrivateKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		block.Type, block.Bytes = pemTypePrivate, b
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// ParseKey decodes key encoded by (*Key).MarshalPEM.
+func ParseKey(id string, b []byte) (*Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("auth: key %q is not pem encoded", id)
+	}
+	method, err := SigningMethod(block.Headers[pemHeaderAlg])
+	if err != nil {
+		return nil, err
+	}
+	created, err := time.Parse(time.RFC3339, block.Headers[pemHeaderCreated])
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{ID: id, Method: method, CreatedAt: created}
+	if block.Type == pemTypeHMAC {
+		k.signKey, k.verifyKey = block.Bytes, block.Bytes
+	} else {
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch priv := priv.(type) {
+		case ed25519.PrivateKey:
+			k.signKey, k.verifyKey = priv, priv.Public()
+		case *rsa.PrivateKey:
+			k.signKey, k.verifyKey = priv, &priv.PublicKey
+		}
+	}
+	if !k.matches() {
+		return nil, fmt.Errorf("auth: key %q does not match algorithm %q", id, method.Alg())
+	}
+	return k, nil
+}
+
+// matches reports whether key material is usable with k.Method.
+func (k *Key) matches() bool {
+	switch k.verifyKey.(type) {
+	case []byte:
+		return k.Method == jwt.SigningMethodHS512
+	case ed25519.PublicKey:
+		return k.Method == jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		return k.Method == jwt.SigningMethodRS256
+	}
+	return false
+}
+
+// KeySet holds keys accepted for verification, newest key signs new sessions.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+func NewKeySet(keys ...*Key) *KeySet {
+	s := &KeySet{}
+	for _, k := range keys {
+		s.Add(k)
+	}
+	return s
+}
+
+// Add adds k to s, replacing key with same id.
+func (s *KeySet) Add(k *Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*Key, 0, len(s.keys)+1)
+	for _, old := range s.keys {
+		if old.ID != k.ID {
+			keys = append(keys, old)
+		}
+	}
+	keys = append(keys, k)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	s.keys = keys
+}
+
+// Current returns key signing new sessions, nil when s is empty.
+func (s *KeySet) Current() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.keys) == 0 {
+		return nil
+	}
+	return s.keys[len(s.keys)-1]
+}
+
+// Lookup returns key with id kid, nil when not found.
+func (s *KeySet) Lookup(kid string) *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// Prune removes keys created before t and returns them, current key is
+// always kept.
+func (s *KeySet) Prune(t time.Time) []*Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []*Key
+	keys := make([]*Key, 0, len(s.keys))
+	for i, k := range s.keys {
+		if k.CreatedAt.Before(t) && i != len(s.keys)-1 {
+			removed = append(removed, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	s.keys = keys
+	return removed
+}
+
+// Methods returns algorithms of keys in s.
+func (s *KeySet) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var algs []string
+	seen := map[string]bool{}
+	for _, k := range s.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWK is public key of asymmetric signing key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// PublicKey returns public key described by k, e.g. key of other issuer.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch k.KeyType {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", ErrUnknownKey, k.Curve)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point is not on curve %q", ErrUnknownKey, k.Curve)
+		}
+		return pub, nil
+	case "OKP":
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: curve %q", ErrUnknownKey, k.Curve)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("%w: key type %q", ErrUnknownKey, k.KeyType)
+}
+
+// JWKS returns public keys of s, hmac keys are never published.
+func (s *KeySet) JWKS() []JWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jwks := make([]JWK, 0, len(s.keys))
+	for _, k := range s.keys {
+		jwk := JWK{KeyID: k.ID, Algorithm: k.Method.Alg(), Use: "sig"}
+		switch vk := k.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(vk)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(vk.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(vk.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// KeyDir persists keys as "<kid>.pem" files in a directory.
+type KeyDir string
+
+func (d KeyDir) Load() ([]*Key, error) {
+	entries, err := os.ReadDir(string(d))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".pem" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(string(d), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		k, err := ParseKey(strings.TrimSuffix(e.Name(), ".pem"), b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (d KeyDir) Save(k *Key) error {
+	b, err := k.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(string(d), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(d), k.ID+".pem"), b, 0600)
+}
+
+func (d KeyDir) Remove(k *Key) error {
+	err := os.Remove(filepath.Join(string(d), k.ID+".pem"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Rotate adds new key for alg to set when current key is older than every
+// or uses other algorithm, and removes keys older than retain, so sessions
+// signed by previous key stay valid until they expire. Changes are persisted
+// to dir.
+func Rotate(set *KeySet, dir KeyDir, alg string, every, retain time.Duration, now time.Time) error {
+	cur := set.Current()
+	if cur == nil || cur.Method.Alg() != alg || (every > 0 && now.Sub(cur.CreatedAt) >= every) {
+		k, err := GenerateKey(alg, now)
+		if err != nil {
+			return err
+		}
+		if err := dir.Save(k); err != nil {
+			return err
+		}
+		set.Add(k)
+	}
+	if retain <= 0 {
+		return nil
+	}
+	for _, k := range set.Prune(now.Add(-retain)) {
+		if err := dir.Remove(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JWKS serves public keys of a.Keys, so other services can verify sessions.
+func (a *Auth) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys := []JWK{}
+	if a.Keys != nil {
+		keys = a.Keys.JWKS()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(map[string][]JWK{"keys": keys})
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestRotate(t *testing.T) {
+	t.Parallel()
+	dir := KeyDir(t.TempDir())
+	set := NewKeySet()
+	now := time.Now()
+
+	for _, alg := range []string{"HS512", "EdDSA", "RS256"} {
+		alg := alg
+		t.Run(alg, func(t *testing.T) {
+			if err := Rotate(set, dir, alg, time.Hour, 3*time.Hour, now); err != nil {
+				t.Fatal("failed to rotate keys", err)
+			}
+			if got := set.Current().Method.Alg(); got != alg {
+				t.Errorf("expected current key to use %s, got %s", alg, got)
+			}
+		})
+	}
+
+	a := &Auth{Name: "session", Keys: set}
+	c, err := a.Sign(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "foo"}})
+	if err != nil {
+		t.Fatal("failed to sign claims", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := Rotate(set, dir, "RS256", time.Hour, 3*time.Hour, now); err != nil {
+		t.Fatal("failed to rotate keys", err)
+	}
+	if _, err := a.Verify(c.Value); err != nil {
+		t.Error("session signed with previous key must stay valid", err)
+	}
+
+	loaded, err := dir.Load()
+	if err != nil {
+		t.Fatal("failed to load keys", err)
+	}
+	if len(loaded) != 4 {
+		t.Errorf("expected 4 persisted keys, got %d", len(loaded))
+	}
+	if NewKeySet(loaded...).Current().ID != set.Current().ID {
+		t.Error("loaded key set must sign with the same key")
+	}
+
+	now = now.Add(3 * time.Hour)
+	if err := Rotate(set, dir, "RS256", time.Hour, 3*time.Hour, now); err != nil {
+		t.Fatal("failed to rotate keys", err)
+	}
+	if _, err := a.Verify(c.Value); err != ErrInvalidToken {
+		t.Errorf("session signed with pruned key must be rejected, got %v", err)
+	}
+	// previous key of rotation at now+2h is kept next to the new one
+	if loaded, _ := dir.Load(); len(loaded) != 2 {
+		t.Errorf("expected pruned keys to be removed from disk, got %d keys", len(loaded))
+	}
+}
+
+func TestVerifyAlgorithmPinning(t *testing.T) {
+	t.Parallel()
+	k, err := GenerateKey("EdDSA", time.Now())
+	if err != nil {
+		t.Fatal("failed to generate key", err)
+	}
+	a := &Auth{Name: "session", Keys: NewKeySet(k)}
+
+	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "foo"}}
+	forged := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	forged.Header["kid"] = k.ID
+	s, err := forged.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal("failed to forge token", err)
+	}
+	if _, err := a.Verify(s); err != ErrInvalidToken {
+		t.Errorf("token with none algorithm must be rejected, got %v", err)
+	}
+
+	withoutKid := &Auth{Name: "session", Keys: NewKeySet(k), SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	legacy.Header["kid"] = k.ID
+	s, err = legacy.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal("failed to sign token", err)
+	}
+	if _, err := withoutKid.Verify(s); err != ErrInvalidToken {
+		t.Errorf("token using other algorithm than its key must be rejected, got %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Parallel()
+	set := NewKeySet()
+	for _, alg := range []string{"HS512", "EdDSA", "RS256"} {
+		k, err := GenerateKey(alg, time.Now())
+		if err != nil {
+			t.Fatal("failed to generate key", err)
+		}
+		set.Add(k)
+	}
+	a := &Auth{Keys: set}
+
+	w := httptest.NewRecorder()
+	a.JWKS(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	res := struct {
+		Keys []JWK `json:"keys"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal("failed to decode jwks", err)
+	}
+	if len(res.Keys) != 2 {
+		t.Fatalf("expected only 2 public keys, got %d", len(res.Keys))
+	}
+	for _, k := range res.Keys {
+		if k.KeyType != "OKP" && k.KeyType != "RSA" {
+			t.Errorf("unexpected key type %q", k.KeyType)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// package certificate loads and generates tls certificates for skul server,
+// self signed certificates are meant for lan only school deployments.
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CertFileName = "cert.pem"
+	KeyFileName  = "key.pem"
+)
+
+var (
+	ErrNoHosts = errors.New("certificate: no hosts given for self signed certificate")
+)
+
+// SelfSignedOptions configures generated self signed certificate.
+type SelfSignedOptions struct {
+	// Dir is where the certificate and key are persisted, so clients only
+	// need to trust it once.
+	Dir string
+	// Hosts are dns names or ip addresses included in certificate.
+	Hosts []string
+	// ValidFor is how long generated certificate is valid.
+	ValidFor time.Duration
+	// Now is used to check expiry, defaults to time.Now.
+	Now func() time.Time
+}
+
+// LoadOrCreateSelfSigned loads certificate persisted in o.Dir, a new
+// certificate is generated and persisted when it does not exist, is expired
+// or does not cover all o.Hosts.
+func LoadOrCreateSelfSigned(o SelfSignedOptions) (tls.Certificate, error) {
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	if o.ValidFor == 0 {
+		o.ValidFor = 365 * 24 * time.Hour
+	}
+	if len(o.Hosts) == 0 {
+		return tls.Certificate{}, ErrNoHosts
+	}
+
+	certFile := filepath.Join(o.Dir, CertFileName)
+	keyFile := filepath.Join(o.Dir, KeyFileName)
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil && isUsable(cert, o) {
+		return cert, nil
+	}
+
+	certPEM, keyPEM, err := GenerateSelfSigned(o.Hosts, o.Now(), o.ValidFor)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := os.MkdirAll(o.Dir, 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func isUsable(cert tls.Certificate, o SelfSignedOptions) bool {
+	if len(cert.Certificate) == 0 {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false
+	}
+	// renew a bit earlier, so clients do not hit expired certificate mid exam
+	if o.Now().Add(24 * time.Hour).After(leaf.NotAfter) {
+		return false
+	}
+	for _, h := range o.Hosts {
+		if leaf.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateSelfSigned returns pem encoded certificate and private key valid for hosts.
+func GenerateSelfSigned(hosts []string, now time.Time, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"skul"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// LocalHosts returns hostname and non loopback interface addresses of this
+// machine, those are what students in the same lan use to reach the server.
+func LocalHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		hosts = append(hosts, ipnet.IP.String())
+	}
+	return hosts
+}
@@ -0,0 +1,66 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	o := SelfSignedOptions{
+		Dir:   dir,
+		Hosts: []string{"localhost", "192.168.1.10"},
+		Now:   func() time.Time { return now },
+	}
+
+	cert, err := LoadOrCreateSelfSigned(o)
+	if err != nil {
+		t.Fatal("failed to create self signed certificate", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal("failed to parse generated certificate", err)
+	}
+	for _, h := range o.Hosts {
+		if err := leaf.VerifyHostname(h); err != nil {
+			t.Errorf("generated certificate does not cover %q: %s", h, err)
+		}
+	}
+
+	persisted, err := os.ReadFile(filepath.Join(dir, CertFileName))
+	if err != nil {
+		t.Fatal("certificate was not persisted", err)
+	}
+
+	if _, err := LoadOrCreateSelfSigned(o); err != nil {
+		t.Fatal("failed to load self signed certificate", err)
+	}
+	reloaded, _ := os.ReadFile(filepath.Join(dir, CertFileName))
+	if !bytes.Equal(persisted, reloaded) {
+		t.Error("persisted certificate must be reused while still valid")
+	}
+
+	o.Hosts = append(o.Hosts, "skul.lan")
+	if _, err := LoadOrCreateSelfSigned(o); err != nil {
+		t.Fatal("failed to recreate self signed certificate", err)
+	}
+	reloaded, _ = os.ReadFile(filepath.Join(dir, CertFileName))
+	if bytes.Equal(persisted, reloaded) {
+		t.Error("certificate must be regenerated when hosts changed")
+	}
+
+	persisted = reloaded
+	now = now.Add(366 * 24 * time.Hour)
+	if _, err := LoadOrCreateSelfSigned(o); err != nil {
+		t.Fatal("failed to recreate self signed certificate", err)
+	}
+	reloaded, _ = os.ReadFile(filepath.Join(dir, CertFileName))
+	if bytes.Equal(persisted, reloaded) {
+		t.Error("certificate must be regenerated when expired")
+	}
+}
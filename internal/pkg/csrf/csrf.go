@@ -0,0 +1,136 @@
+// package csrf protects cookie authenticated mutations with double submit
+// token and origin checks.
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+var (
+	ErrOrigin = response.NewForbidden(nil, "request origin is not allowed")
+	ErrToken  = response.NewForbidden(nil, "missing or invalid csrf token")
+)
+
+type Options struct {
+	// CookieName is cookie holding csrf token, it is readable by javascript
+	// so it can be echoed in HeaderName.
+	CookieName string
+	HeaderName string
+	// SessionCookie is cookie authenticating request, token is only required
+	// when it is sent, e.g. clients using bearer token are not affected.
+	SessionCookie string
+	Secure        bool
+	// AllowedOrigins are origins other than the server itself allowed to send
+	// mutations, e.g. "https://exam.example.com".
+	AllowedOrigins []string
+}
+
+func (o *Options) setDefault() {
+	if o.CookieName == "" {
+		o.CookieName = "csrf"
+	}
+	if o.HeaderName == "" {
+		o.HeaderName = "X-CSRF-Token"
+	}
+}
+
+// Protect issues csrf token cookie and rejects unsafe requests coming from
+// other origin or carrying session cookie without matching csrf token. Token
+// is also sent in o.HeaderName of every response, so clients of allowed
+// origins which can not read the cookie can still echo it.
+func Protect(o Options) func(http.Handler) http.Handler {
+	o.setDefault()
+	allowed := make(map[string]bool, len(o.AllowedOrigins))
+	for _, origin := range o.AllowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := ""
+			if c, err := r.Cookie(o.CookieName); err == nil {
+				token = c.Value
+			}
+			if token == "" {
+				var err error
+				if token, err = newToken(); err != nil {
+					response.HandleError(w, r, err)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     o.CookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   o.Secure,
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+			w.Header().Set(o.HeaderName, token)
+
+			if isSafe(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !sameOrigin(r, allowed) {
+				response.HandleError(w, r, ErrOrigin)
+				return
+			}
+
+			if _, err := r.Cookie(o.SessionCookie); o.SessionCookie != "" && err == nil {
+				sent := r.Header.Get(o.HeaderName)
+				if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					response.HandleError(w, r, ErrToken)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// sameOrigin reports whether Origin or Referer of r is the server itself or
+// one of allowed origins, requests without both headers are not sent by
+// browsers and are allowed.
+func sameOrigin(r *http.Request, allowed map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Referer()
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
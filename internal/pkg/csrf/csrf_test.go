@@ -0,0 +1,67 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	t.Parallel()
+	handler := Protect(Options{
+		SessionCookie:  "session",
+		AllowedOrigins: []string{"https://exam.example.com"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://skul.local/", nil))
+	var token *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "csrf" {
+			token = c
+		}
+	}
+	if token == nil || token.Value == "" {
+		t.Fatal("csrf token cookie must be issued")
+	}
+	if got := w.Header().Get("X-CSRF-Token"); got != token.Value {
+		t.Errorf("csrf token must be sent in response header, got %q", got)
+	}
+
+	for _, tc := range []struct {
+		Name    string
+		Origin  string
+		Session bool
+		Header  string
+		Code    int
+	}{
+		{"same origin", "http://skul.local", true, token.Value, http.StatusNoContent},
+		{"allowed origin", "https://exam.example.com", true, token.Value, http.StatusNoContent},
+		{"other origin", "https://evil.example.com", true, token.Value, http.StatusForbidden},
+		{"missing token", "http://skul.local", true, "", http.StatusForbidden},
+		{"wrong token", "http://skul.local", true, "foo", http.StatusForbidden},
+		{"without session", "", false, "", http.StatusNoContent},
+	} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://skul.local/api/student/create", nil)
+			r.AddCookie(token)
+			if tc.Session {
+				r.AddCookie(&http.Cookie{Name: "session", Value: "foo"})
+			}
+			if tc.Origin != "" {
+				r.Header.Set("Origin", tc.Origin)
+			}
+			if tc.Header != "" {
+				r.Header.Set("X-CSRF-Token", tc.Header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.Code {
+				t.Errorf("expected status %d, got %d", tc.Code, w.Code)
+			}
+		})
+	}
+}
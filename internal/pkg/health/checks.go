@@ -0,0 +1,105 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/storage"
+	"gorm.io/gorm"
+)
+
+const probePrefix = "health:probe:"
+
+var ErrProbeMismatch = errors.New("health: value read from storage does not match value written")
+
+// Database checks connection to database of db.
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Migrations checks tables and columns of models exist, so instance started
+// against database of older schema is not marked ready. Schema only changes
+// when instance migrates it at startup, so it is checked once when Migrations
+// is called and every probe reports the same result.
+func Migrations(ctx context.Context, db *gorm.DB, models ...any) Check {
+	err := migrations(ctx, db, models...)
+	return func(ctx context.Context) error {
+		return err
+	}
+}
+
+func migrations(ctx context.Context, db *gorm.DB, models ...any) error {
+	tx := db.WithContext(ctx)
+	m := tx.Migrator()
+	var pending []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if !m.HasTable(model) {
+			pending = append(pending, stmt.Schema.Table)
+			continue
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if !m.HasColumn(model, name) {
+				pending = append(pending, stmt.Schema.Table+"."+name)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("health: pending migration of %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Storage checks value written to s can be read back and deleted.
+func Storage(s storage.Storage) Check {
+	return func(ctx context.Context) error {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		key := probePrefix + hex.EncodeToString(b)
+		if err := s.Set(key, b, time.Minute); err != nil {
+			return err
+		}
+		got, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, b) {
+			return ErrProbeMismatch
+		}
+		return s.Delete(key)
+	}
+}
+
+// DiskSpace checks at least min bytes are free on filesystem of dir.
+func DiskSpace(dir string, min uint64) Check {
+	return func(ctx context.Context) error {
+		free, ok, err := freeSpace(dir)
+		if err != nil || !ok {
+			return err
+		}
+		if free < min {
+			return fmt.Errorf("health: %d bytes free on disk of %q, want at least %d", free, dir, min)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd
+
+package health
+
+import "syscall"
+
+func freeSpace(dir string) (uint64, bool, error) {
+	st := &syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, st); err != nil {
+		return 0, false, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true, nil
+}
@@ -0,0 +1,149 @@
+// package health reports whether the server and its dependencies work, so
+// container orchestrators only route requests to instances that are ready.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+type Options struct {
+	// Timeout bounds every check of readiness probe.
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// MinFreeDisk is number of bytes which must be free on disk of badger
+	// storage.
+	MinFreeDisk uint64 `yaml:"min_free_disk" json:"min_free_disk"`
+}
+
+// Check returns error when component it checks does not work.
+type Check func(ctx context.Context) error
+
+// Component is result of check of single component, only its status is
+// responded as error may reveal details of infrastructure to anyone able to
+// reach the probe.
+type Component struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"-"`
+	Duration time.Duration `json:"-"`
+}
+
+// Report is result of all checks, Status is down when any component is down.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Health runs named checks of components.
+type Health struct {
+	Timeout time.Duration
+	Logger  zerolog.Logger
+
+	names  []string
+	checks []Check
+}
+
+// Add registers check of component name.
+func (h *Health) Add(name string, c Check) {
+	h.names = append(h.names, name)
+	h.checks = append(h.checks, c)
+}
+
+// Check runs all checks concurrently.
+func (h *Health) Check(ctx context.Context) *Report {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	components := make([]Component, len(h.checks))
+	wg := &sync.WaitGroup{}
+	for i, c := range h.checks {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status:     StatusUp,
+		Components: make(map[string]Component, len(h.checks)),
+	}
+	for i, c := range components {
+		if c.Status == StatusDown {
+			report.Status = StatusDown
+		}
+		report.Components[h.names[i]] = c
+	}
+	return report
+}
+
+// run runs c, c is abandoned once ctx is done so hanging dependency does not
+// hang probe too.
+func run(ctx context.Context, c Check) Component {
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	component := Component{
+		Status:   StatusUp,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		component.Status = StatusDown
+		component.Error = err.Error()
+	}
+	return component
+}
+
+// Live responds ok as long as server is able to serve requests, it checks no
+// dependency so broken database does not get the instance restarted.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	response.NewOK(&Report{
+		Status:     StatusUp,
+		Components: map[string]Component{},
+	}).ServeHTTP(w, r)
+}
+
+// Ready responds status of all checks, with status 503 when any of them
+// fails. Errors of failed checks are logged instead of responded.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	for name, c := range report.Components {
+		if c.Status == StatusDown {
+			logging.Ctx(r.Context(), h.Logger).Warn().
+				Str("component", name).
+				Str("error", c.Error).
+				Dur("duration", c.Duration).
+				Msg("readiness check failed")
+		}
+	}
+	response.NewResponse(report, code).ServeHTTP(w, r)
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/storage/memory"
+	"gorm.io/gorm"
+)
+
+type migrated struct {
+	ID   int
+	Name string
+}
+
+type pending struct {
+	ID int
+}
+
+func ready(t *testing.T, h *Health) (int, *Report) {
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	res := &struct {
+		Data *Report `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+		t.Fatal(err.Error())
+	}
+	return w.Code, res.Data
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:health?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&migrated{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	h := &Health{Timeout: time.Second}
+	h.Add("database", Database(db))
+	h.Add("migrations", Migrations(context.Background(), db, &migrated{}))
+	h.Add("storage", Storage(memory.New()))
+	h.Add("disk", DiskSpace(t.TempDir(), 1))
+	code, report := ready(t, h)
+	if code != http.StatusOK || report.Status != StatusUp {
+		t.Fatalf("expected ready, got %d %+v", code, report)
+	}
+	if len(report.Components) != 4 {
+		t.Errorf("expected 4 components, got %d", len(report.Components))
+	}
+
+	h.Add("pending", Migrations(context.Background(), db, &pending{}))
+	h.Add("hanging", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return errors.New("too late")
+	})
+	h.Timeout = 10 * time.Millisecond
+	w := httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready, got %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "pending migration") || strings.Contains(body, "deadline") {
+		t.Errorf("expected errors of checks to not be responded, got %s", body)
+	}
+
+	report = h.Check(context.Background())
+	if report.Status != StatusDown {
+		t.Fatalf("expected not ready, got %+v", report)
+	}
+	if c := report.Components["pending"]; c.Status != StatusDown || c.Error == "" {
+		t.Errorf("expected missing table to be reported as pending migration, got %+v", c)
+	}
+	if c := report.Components["hanging"]; c.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected hanging check to time out, got %+v", c)
+	}
+	if c := report.Components["database"]; c.Status != StatusUp {
+		t.Errorf("expected database to stay up, got %+v", c)
+	}
+
+	if err := db.AutoMigrate(&pending{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := Migrations(context.Background(), db, &pending{})(context.Background()); err != nil {
+		t.Errorf("expected migrated table to pass, got %v", err)
+	}
+	if c := h.Check(context.Background()).Components["pending"]; c.Status != StatusDown {
+		t.Errorf("expected migrations to be checked once when check was created, got %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	h.Live(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected liveness to not depend on checks, got %d", w.Code)
+	}
+}
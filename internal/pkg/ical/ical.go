@@ -0,0 +1,130 @@
+// package ical writes calendars in iCalendar format (RFC 5545), so schedules
+// can be subscribed from calendar applications.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	timeFormat = "20060102T150405Z"
+	// lines longer than maxLineLength octets are folded
+	maxLineLength = 75
+)
+
+type Event struct {
+	// UID must stay the same for the same event, calendar applications use
+	// it to update event they already have.
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Updated     time.Time
+}
+
+type Calendar struct {
+	// ProductID identifies application which created the calendar.
+	ProductID string
+	Name      string
+	Events    []*Event
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes content line, folded so every line is at most maxLineLength
+// octets without splitting utf-8 sequence.
+func (w *writer) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	l := name + ":" + value
+	limit := maxLineLength
+	for len(l) > limit {
+		i := limit
+		// continuation byte of utf-8 sequence starts with bits 10
+		for i > 0 && l[i]&0xC0 == 0x80 {
+			i--
+		}
+		if _, w.err = w.w.WriteString(l[:i] + "\r\n "); w.err != nil {
+			return
+		}
+		l = l[i:]
+		// leading space of continuation line counts too
+		limit = maxLineLength - 1
+	}
+	_, w.err = w.w.WriteString(l + "\r\n")
+}
+
+// WriteTo writes c to dst.
+func (c *Calendar) WriteTo(dst io.Writer) (int64, error) {
+	cw := &countWriter{w: dst}
+	w := &writer{w: bufio.NewWriter(cw)}
+	now := formatTime(time.Now())
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", escape(c.ProductID))
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		stamp := now
+		if !e.Updated.IsZero() {
+			stamp = formatTime(e.Updated)
+		}
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", escape(e.UID))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART", formatTime(e.Start))
+		w.line("DTEND", formatTime(e.End))
+		w.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION", escape(e.Description))
+		}
+		w.line("END", "VEVENT")
+	}
+	w.line("END", "VCALENDAR")
+
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return cw.n, w.err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,59 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2026, 3, 2, 7, 30, 0, 0, time.FixedZone("WIB", 7*60*60))
+	c := &Calendar{
+		ProductID: "-//skul//schedule//EN",
+		Name:      "X IPA 1",
+		Events: []*Event{{
+			UID:         "eto123@skul",
+			Summary:     "Matematika, Bab 1; Aljabar",
+			Description: strings.Repeat("ujian ", 20) + "\nbawa kalkulator",
+			Start:       start,
+			End:         start.Add(90 * time.Minute),
+			Updated:     start.Add(-24 * time.Hour),
+		}},
+	}
+
+	b := &strings.Builder{}
+	n, err := c.WriteTo(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	out := b.String()
+	if n != int64(len(out)) {
+		t.Errorf("expected %d bytes to be written, got %d", len(out), n)
+	}
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:X IPA 1\r\n",
+		"DTSTART:20260302T003000Z\r\n",
+		"DTEND:20260302T020000Z\r\n",
+		"DTSTAMP:20260301T003000Z\r\n",
+		`SUMMARY:Matematika\, Bab 1\; Aljabar` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected calendar to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	for _, l := range lines {
+		if len(l) > maxLineLength {
+			t.Errorf("expected line to be folded, got %d octets: %q", len(l), l)
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:`+strings.Repeat("ujian ", 20)+`\nbawa kalkulator`) {
+		t.Errorf("expected folded description to unfold to original, got:\n%s", unfolded)
+	}
+}
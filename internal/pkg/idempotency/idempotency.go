@@ -0,0 +1,265 @@
+// package idempotency replays stored response of create request retried with
+// the same "Idempotency-Key" header, so retry after timeout does not create
+// the same resource twice. Only successful responses are stored, responses
+// carrying secrets must be stored with the secrets redacted, see Redact.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gofiber/storage"
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from storage.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	keyPrefix    = "idempotency:"
+	maxKeyLength = 255
+)
+
+type Options struct {
+	// TTL is how long responses are kept for replay.
+	TTL time.Duration `yaml:"ttl" json:"ttl"`
+}
+
+type record struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// Idempotency stores responses of requests sent with Idempotency-Key, keys are
+// scoped to caller so two callers can not read response of each other. Nil
+// Idempotency ignores the header.
+type Idempotency struct {
+	Storage storage.Storage
+	Auth    *auth.Auth
+	TTL     time.Duration
+	Logger  zerolog.Logger
+
+	// inflight refuses retry sent while the first request is still in
+	// progress. It is kept in memory of this process, as storage has no
+	// atomic check and set, so retries handled by different instances at
+	// the same time are not refused and both may run.
+	mu       sync.Mutex
+	inflight map[string]struct{}
+}
+
+func (i *Idempotency) acquire(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.inflight == nil {
+		i.inflight = make(map[string]struct{})
+	}
+	if _, ok := i.inflight[key]; ok {
+		return false
+	}
+	i.inflight[key] = struct{}{}
+	return true
+}
+
+func (i *Idempotency) release(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.inflight, key)
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		_, _ = io.WriteString(h, p)
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// requestFingerprint identifies request by media type and body, parameters of
+// content type are left out. Multipart body is identified by its parts, since
+// client picks new boundary on every retry of the same upload.
+func requestFingerprint(contentType string, body []byte) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return hash(contentType, string(body)), nil
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return hash(mediaType, string(body)), nil
+	}
+	parts := []string{mediaType}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		b, err := io.ReadAll(p)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, p.FormName(), p.FileName(), p.Header.Get("Content-Type"), hash(string(b)))
+	}
+	return hash(parts...), nil
+}
+
+// redact removes fields from every object of JSON body b, at any depth.
+func redact(b []byte, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return b, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, f := range fields {
+				delete(v, f)
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	return json.Marshal(v)
+}
+
+// Middleware must be used after (*auth.Auth).VerifyMiddleware.
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return i.handler(next, nil)
+}
+
+// Redact returns Middleware which removes fields from JSON response before
+// it is stored, so secrets such as generated passwords are not kept in
+// storage. Replayed response lacks the fields.
+func (i *Idempotency) Redact(fields ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return i.handler(next, fields)
+	}
+}
+
+func (i *Idempotency) handler(next http.Handler, fields []string) http.Handler {
+	if i == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idemKey := r.Header.Get(Header)
+		if idemKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idemKey) > maxKeyLength {
+			response.HandleError(w, r, response.NewBadRequest(nil, "%s header must not be longer than %d characters", Header, maxKeyLength))
+			return
+		}
+		claims, err := i.Auth.GetClaims(r.Context())
+		if err != nil {
+			response.HandleError(w, r, err)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.HandleError(w, r, response.NewBadRequest(nil, "failed to read body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key := keyPrefix + hash(claims.Subject, r.Method, r.URL.Path, idemKey)
+		fingerprint, err := requestFingerprint(r.Header.Get("Content-Type"), body)
+		if err != nil {
+			response.HandleError(w, r, response.NewBadRequest(nil, "failed to read multipart body"))
+			return
+		}
+
+		if !i.acquire(key) {
+			response.HandleError(w, r, response.NewConflict(nil, "request with the same %s is still in progress", Header))
+			return
+		}
+		defer i.release(key)
+
+		b, err := tracing.Bind(r.Context(), i.Storage).Get(key)
+		if err != nil {
+			response.HandleError(w, r, err)
+			return
+		}
+		if b != nil {
+			rec := &record{}
+			if err := json.Unmarshal(b, rec); err != nil {
+				response.HandleError(w, r, err)
+				return
+			}
+			if rec.Fingerprint != fingerprint {
+				response.HandleError(w, r, response.NewUnprocessableEntity(nil, "%s was already used with different request", Header))
+				return
+			}
+			if rec.ContentType != "" {
+				w.Header().Set("Content-Type", rec.ContentType)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(rec.Status)
+			_, _ = w.Write(rec.Body)
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(buf)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// failed request may succeed when retried, e.g. once conflicting
+		// resource is deleted
+		if status >= http.StatusBadRequest {
+			return
+		}
+		stored, err := redact(buf.Bytes(), fields)
+		if err == nil {
+			b, err = json.Marshal(&record{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: ww.Header().Get("Content-Type"),
+				Body:        stored,
+			})
+		}
+		if err == nil {
+			err = tracing.Bind(r.Context(), i.Storage).Set(key, b, i.TTL)
+		}
+		if err != nil {
+			logging.Ctx(r.Context(), i.Logger).Error().Err(err).Msg("failed to store idempotent response")
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package idempotency
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+func TestIdempotency(t *testing.T) {
+	t.Parallel()
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	i := &Idempotency{Storage: memory.New(), Auth: a, TTL: time.Minute}
+
+	var created int64
+	block := make(chan struct{})
+	r := chi.NewRouter()
+	r.Use(a.VerifyMiddleware)
+	r.With(i.Middleware).Post("/create", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if string(b) == "slow" {
+			<-block
+		}
+		if string(b) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if string(b) == "conflict" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		n := atomic.AddInt64(&created, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"body":%q}`, n, b)
+	})
+	r.With(i.Redact("password")).Post("/secret", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data":[{"id":1,"password":"generated"}]}`)
+	})
+	r.With(i.Middleware).Post("/upload", func(w http.ResponseWriter, r *http.Request) {
+		file, h, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(file)
+		n := atomic.AddInt64(&created, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"name":%q,"body":%q}`, n, h.Filename, b)
+	})
+
+	sign := func(subject string) *http.Cookie {
+		c, err := a.Sign(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}})
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		return c
+	}
+	ani, budi := sign("stu-ani"), sign("stu-budi")
+	post := func(url string, session *http.Cookie, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.AddCookie(session)
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	do := func(session *http.Cookie, key, body string) *httptest.ResponseRecorder {
+		return post("/create", session, key, body)
+	}
+
+	first := do(ani, "key-1", "ani")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, first.Code)
+	}
+	replay := do(ani, "key-1", "ani")
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("expected stored response to be replayed, got %d %s", replay.Code, replay.Body)
+	}
+	if replay.Header().Get(ReplayedHeader) != "true" || replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected replayed response headers, got %v", replay.Header())
+	}
+	if n := atomic.LoadInt64(&created); n != 1 {
+		t.Errorf("expected resource to be created once, got %d", n)
+	}
+
+	if w := do(ani, "key-1", "other"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected key reused with other body to be refused, got %d", w.Code)
+	}
+	if w := do(budi, "key-1", "ani"); w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("expected key to be scoped to caller, got %d", w.Code)
+	}
+	do(ani, "", "ani")
+	do(ani, "", "ani")
+	if n := atomic.LoadInt64(&created); n != 4 {
+		t.Errorf("expected requests without key to not be deduplicated, got %d", n)
+	}
+
+	if w := do(ani, "key-2", "fail"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if w := do(ani, "key-2", "fail"); w.Header().Get(ReplayedHeader) != "" {
+		t.Error("expected failed response to not be replayed")
+	}
+
+	if w := do(ani, "key-4", "conflict"); w.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := do(ani, "key-4", "conflict"); w.Header().Get(ReplayedHeader) != "" {
+		t.Error("expected client error to not be replayed")
+	}
+
+	if w := post("/secret", ani, "key-5", ""); !strings.Contains(w.Body.String(), "generated") {
+		t.Errorf("expected first response to carry secret, got %s", w.Body)
+	}
+	if w := post("/secret", ani, "key-5", ""); w.Header().Get(ReplayedHeader) != "true" || w.Body.String() != `{"data":[{"id":1}]}` {
+		t.Errorf("expected secret to be redacted from replayed response, got %s", w.Body)
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- do(ani, "key-3", "slow")
+	}()
+	for !func() bool {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		return len(i.inflight) > 0
+	}() {
+		time.Sleep(time.Millisecond)
+	}
+	if w := do(ani, "key-3", "slow"); w.Code != http.StatusConflict {
+		t.Errorf("expected concurrent retry to be refused, got %d", w.Code)
+	}
+	close(block)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	upload := func(key, content string) *httptest.ResponseRecorder {
+		// every call writes with new random boundary, as browsers do
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "soal.pdf")
+		_, _ = io.WriteString(fw, content)
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set(Header, key)
+		req.AddCookie(ani)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	uploaded := upload("key-6", "content")
+	if uploaded.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, uploaded.Code)
+	}
+	if w := upload("key-6", "content"); w.Header().Get(ReplayedHeader) != "true" || w.Body.String() != uploaded.Body.String() {
+		t.Errorf("expected retried upload with new boundary to be replayed, got %d %s", w.Code, w.Body)
+	}
+	if w := upload("key-6", "other content"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected key reused with other file to be refused, got %d", w.Code)
+	}
+
+	if w := do(ani, strings.Repeat("k", maxKeyLength+1), "ani"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected too long key to be refused, got %d", w.Code)
+	}
+}
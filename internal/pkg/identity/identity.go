@@ -0,0 +1,233 @@
+// package identity verifies credentials against external account providers,
+// e.g. school directory over LDAP or OIDC, so admins and students can log in
+// with accounts they already have.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage"
+)
+
+var (
+	// ErrInvalidCredentials is returned when provider rejects credentials or
+	// can not verify that kind of credentials.
+	ErrInvalidCredentials = errors.New("identity: invalid credentials")
+	ErrUnknownProvider    = errors.New("identity: unknown provider")
+)
+
+const (
+	TypeLDAP = "ldap"
+	TypeOIDC = "oidc"
+)
+
+// Credentials are sent by user logging in, Password is verified by every
+// provider while Code is authorization code only verified by OIDC providers,
+// along with State of authorization it was issued for.
+type Credentials struct {
+	Username    string
+	Password    string
+	Code        string
+	State       string
+	RedirectURI string
+}
+
+// Authorization is started log in with authorization code, user is
+// redirected to URL and comes back with code and State.
+type Authorization struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+// Identity is account verified by provider.
+type Identity struct {
+	Provider string
+	// Subject is stable id of account within provider.
+	Subject  string
+	Username string
+	Name     string
+	Class    string
+	Grade    string
+}
+
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, c *Credentials) (*Identity, error)
+}
+
+// Authorizer is authenticator accepting authorization code, code is only
+// accepted for authorization started by Authorize.
+type Authorizer interface {
+	Authorize(ctx context.Context, redirectURI string) (*Authorization, error)
+}
+
+// Mapping names attributes (LDAP) or claims (OIDC) read into Identity, empty
+// name leaves its field empty.
+type Mapping struct {
+	Username string `yaml:"username" json:"username"`
+	Name     string `yaml:"name" json:"name"`
+	Class    string `yaml:"class" json:"class"`
+	Grade    string `yaml:"grade" json:"grade"`
+}
+
+func (m Mapping) attributes() []string {
+	var attrs []string
+	for _, a := range []string{m.Username, m.Name, m.Class, m.Grade} {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// identity returns Identity read from values of attributes by m.
+func (m Mapping) identity(provider, subject string, get func(attr string) string) *Identity {
+	id := &Identity{Provider: provider, Subject: subject}
+	for _, f := range []struct {
+		attr string
+		dst  *string
+	}{
+		{m.Username, &id.Username},
+		{m.Name, &id.Name},
+		{m.Class, &id.Class},
+		{m.Grade, &id.Grade},
+	} {
+		if f.attr != "" {
+			*f.dst = strings.TrimSpace(get(f.attr))
+		}
+	}
+	return id
+}
+
+type Options struct {
+	// Name identifies provider in login requests, it must be unique.
+	Name string `yaml:"name" json:"name"`
+	// Type is one of "ldap" or "oidc".
+	Type    string      `yaml:"type" json:"type"`
+	Mapping Mapping     `yaml:"mapping" json:"mapping"`
+	LDAP    LDAPOptions `yaml:"ldap" json:"ldap"`
+	OIDC    OIDCOptions `yaml:"oidc" json:"oidc"`
+
+	// Organization and Admin own students provisioned on their first login,
+	// students are not provisioned when left empty. Admins are only linked
+	// on their first login by provider with Organization.
+	Organization string `yaml:"organization" json:"organization"`
+	Admin        string `yaml:"admin" json:"admin"`
+}
+
+// Provider is authenticator along with owner of accounts it provisions.
+type Provider struct {
+	Authenticator
+
+	Organization raid.Raid
+	Admin        raid.Raid
+}
+
+// Provisions reports whether accounts unknown to skul are created on login.
+func (p *Provider) Provisions() bool {
+	return !p.Organization.IsNil() && !p.Admin.IsNil()
+}
+
+// New returns provider described by o, store keeps pending authorizations
+// of OIDC provider.
+func New(o Options, store storage.Storage) (*Provider, error) {
+	if o.Name == "" {
+		return nil, fmt.Errorf("identity: provider name is required")
+	}
+
+	p := &Provider{}
+	var err error
+	switch o.Type {
+	case TypeLDAP:
+		p.Authenticator, err = NewLDAP(o.Name, o.LDAP, o.Mapping)
+	case TypeOIDC:
+		var oidc *OIDC
+		if oidc, err = NewOIDC(o.Name, o.OIDC, o.Mapping); err == nil {
+			oidc.Storage = store
+			p.Authenticator = oidc
+		}
+	default:
+		err = fmt.Errorf("identity: unknown type %q of provider %q", o.Type, o.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		name string
+		src  string
+		dst  *raid.Raid
+	}{
+		{"organization", o.Organization, &p.Organization},
+		{"admin", o.Admin, &p.Admin},
+	} {
+		if f.src == "" {
+			continue
+		}
+		if *f.dst, err = raid.RaidFromString(f.src); err != nil {
+			return nil, fmt.Errorf("identity: invalid %s of provider %q: %w", f.name, o.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// Authenticate tries providers in order, provider is only the one named
+// by name when it is not empty.
+func Authenticate(ctx context.Context, providers []*Provider, name string, c *Credentials) (*Provider, *Identity, error) {
+	found := false
+	for _, p := range providers {
+		if name != "" && p.Name() != name {
+			continue
+		}
+		found = true
+		id, err := p.Authenticate(ctx, c)
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, id, nil
+	}
+	if name != "" && !found {
+		return nil, nil, ErrUnknownProvider
+	}
+	return nil, nil, ErrInvalidCredentials
+}
+
+// Authorize starts log in with authorization code of provider named name.
+func Authorize(ctx context.Context, providers []*Provider, name, redirectURI string) (*Authorization, error) {
+	for _, p := range providers {
+		if p.Name() != name {
+			continue
+		}
+		a, ok := p.Authenticator.(Authorizer)
+		if !ok {
+			return nil, ErrUnknownProvider
+		}
+		return a.Authorize(ctx, redirectURI)
+	}
+	return nil, ErrUnknownProvider
+}
+
+// NewProviders returns providers described by opts, in the same order.
+func NewProviders(opts []Options, store storage.Storage) ([]*Provider, error) {
+	providers := make([]*Provider, 0, len(opts))
+	names := make(map[string]bool, len(opts))
+	for _, o := range opts {
+		if names[o.Name] {
+			return nil, fmt.Errorf("identity: duplicate provider name %q", o.Name)
+		}
+		names[o.Name] = true
+		p, err := New(o, store)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
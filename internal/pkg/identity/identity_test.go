@@ -0,0 +1,302 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+type fakeEntry struct {
+	password string
+	entry    *ldap.Entry
+}
+
+// fakeDirectory is in-process stand-in of ldap server.
+type fakeDirectory struct {
+	entries []fakeEntry
+	bound   string
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if username == "cn=reader,dc=school" && password == "reader" {
+		d.bound = username
+		return nil
+	}
+	for _, e := range d.entries {
+		if e.entry.DN == username && e.password == password {
+			d.bound = username
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if d.bound != "cn=reader,dc=school" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("bind required"))
+	}
+	res := &ldap.SearchResult{}
+	for _, e := range d.entries {
+		if req.Filter == "(&(objectClass=person)(uid="+e.entry.GetAttributeValue("uid")+"))" {
+			res.Entries = append(res.Entries, e.entry)
+		}
+	}
+	return res, nil
+}
+
+func (d *fakeDirectory) Close() {}
+
+func TestLDAP(t *testing.T) {
+	t.Parallel()
+	dn := "uid=budi,ou=students,dc=school"
+	l, err := NewLDAP("school", LDAPOptions{
+		URL:          "ldap://localhost",
+		BindDN:       "cn=reader,dc=school",
+		BindPassword: "reader",
+		BaseDN:       "dc=school",
+		Filter:       "(&(objectClass=person)(uid=%s))",
+	}, Mapping{Class: "departmentNumber", Grade: "employeeType"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	l.Dial = func(ctx context.Context) (LDAPConn, error) {
+		return &fakeDirectory{entries: []fakeEntry{{
+			password: "secret",
+			entry: ldap.NewEntry(dn, map[string][]string{
+				"uid":              {"budi"},
+				"cn":               {"Budi Santoso"},
+				"departmentNumber": {"IPA 1"},
+				"employeeType":     {"12"},
+			}),
+		}}}, nil
+	}
+
+	id, err := l.Authenticate(context.Background(), &Credentials{Username: "budi", Password: "secret"})
+	if err != nil {
+		t.Fatal("failed to authenticate", err)
+	}
+	want := Identity{Provider: "school", Subject: dn, Username: "budi", Name: "Budi Santoso", Class: "IPA 1", Grade: "12"}
+	if *id != want {
+		t.Errorf("expected identity %+v, got %+v", want, *id)
+	}
+
+	for _, c := range []*Credentials{
+		{Username: "budi", Password: "wrong"},
+		{Username: "budi", Password: ""},
+		{Username: "budi*", Password: "secret"},
+		{Code: "code"},
+	} {
+		if _, err := l.Authenticate(context.Background(), c); err != ErrInvalidCredentials {
+			t.Errorf("expected credentials %+v to be invalid, got %v", c, err)
+		}
+	}
+}
+
+// fakeProvider is in-process stand-in of OpenID Connect provider, it issues
+// "valid-code" for the last authorization approved by approve.
+type fakeProvider struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	challenge, nonce string
+}
+
+// approve records PKCE challenge and nonce of authorization url as user
+// would approve it, state sent back with code is returned.
+func (f *fakeProvider) approve(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization must use S256 PKCE challenge: %s", authURL)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.challenge, f.nonce = q.Get("code_challenge"), q.Get("nonce")
+	return q.Get("state")
+}
+
+// fakeOIDC is in-process stand-in of OpenID Connect provider.
+func fakeOIDC(t *testing.T, audience string) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	f := &fakeProvider{Server: srv}
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]auth.JWK{"keys": {{
+			KeyType:   "RSA",
+			KeyID:     "k1",
+			Algorithm: "RS256",
+			Use:       "sig",
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "skul" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		challenge, nonce := f.challenge, f.nonce
+		f.mu.Unlock()
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		ok := r.PostFormValue("grant_type") == "password" && r.PostFormValue("username") == "siti" && r.PostFormValue("password") == "secret" ||
+			r.PostFormValue("grant_type") == "authorization_code" && r.PostFormValue("code") == "valid-code" &&
+				base64.RawURLEncoding.EncodeToString(verifier[:]) == challenge
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":                srv.URL,
+			"aud":                audience,
+			"sub":                "user-42",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"preferred_username": "siti",
+			"name":               "Siti Aminah",
+			"grade":              11,
+		}
+		if r.PostFormValue("grant_type") == "authorization_code" {
+			claims["nonce"] = nonce
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": s, "token_type": "Bearer"})
+	})
+	return f
+}
+
+func TestOIDC(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	options := func(issuer string) OIDCOptions {
+		return OIDCOptions{Issuer: issuer, ClientID: "skul", ClientSecret: "client-secret", PasswordGrant: true}
+	}
+
+	srv := fakeOIDC(t, "skul")
+	o, err := NewOIDC("sso", options(srv.URL), Mapping{Grade: "grade"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	o.Storage = memory.New()
+
+	const callback = "https://skul.example/callback"
+	authorization, err := o.Authorize(ctx, callback)
+	if err != nil {
+		t.Fatal("failed to start authorization", err)
+	}
+	state := srv.approve(t, authorization.URL)
+	if state != authorization.State {
+		t.Fatalf("expected state %q in authorization url, got %q", authorization.State, state)
+	}
+	code := &Credentials{Code: "valid-code", State: state, RedirectURI: callback}
+
+	for _, c := range []*Credentials{
+		{Username: "siti", Password: "secret"},
+		code,
+	} {
+		id, err := o.Authenticate(ctx, c)
+		if err != nil {
+			t.Fatalf("failed to authenticate %+v: %v", c, err)
+		}
+		want := Identity{Provider: "sso", Subject: "user-42", Username: "siti", Name: "Siti Aminah", Grade: "11"}
+		if *id != want {
+			t.Errorf("expected identity %+v, got %+v", want, *id)
+		}
+	}
+	if _, err := o.Authenticate(ctx, &Credentials{Username: "siti", Password: "wrong"}); err != ErrInvalidCredentials {
+		t.Errorf("wrong password must be invalid credentials, got %v", err)
+	}
+	if _, err := o.Authenticate(ctx, code); err != ErrInvalidCredentials {
+		t.Errorf("state must be used once, got %v", err)
+	}
+	authorization, _ = o.Authorize(ctx, callback)
+	state = srv.approve(t, authorization.URL)
+	if _, err := o.Authenticate(ctx, &Credentials{Code: "valid-code", RedirectURI: callback}); err != ErrInvalidCredentials {
+		t.Errorf("code without state must be invalid credentials, got %v", err)
+	}
+	if _, err := o.Authenticate(ctx, &Credentials{Code: "valid-code", State: state, RedirectURI: "https://evil.example/callback"}); err != ErrInvalidCredentials {
+		t.Errorf("code sent to other redirect uri must be invalid credentials, got %v", err)
+	}
+
+	// verifier of other authorization does not match approved challenge
+	first, _ := o.Authorize(ctx, callback)
+	second, _ := o.Authorize(ctx, callback)
+	srv.approve(t, second.URL)
+	if _, err := o.Authenticate(ctx, &Credentials{Code: "valid-code", State: first.State, RedirectURI: callback}); err != ErrInvalidCredentials {
+		t.Errorf("code must be exchanged with verifier of its authorization, got %v", err)
+	}
+
+	other := fakeOIDC(t, "other-client")
+	o, err = NewOIDC("sso", options(other.URL), Mapping{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := o.Authenticate(ctx, &Credentials{Username: "siti", Password: "secret"}); err == nil {
+		t.Error("id token issued for other client must be rejected")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	srv := fakeOIDC(t, "skul")
+	providers, err := NewProviders([]Options{{
+		Name: "sso",
+		Type: TypeOIDC,
+		OIDC: OIDCOptions{Issuer: srv.URL, ClientID: "skul", ClientSecret: "client-secret", PasswordGrant: true},
+	}}, memory.New())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dup := Options{Name: "dup", Type: TypeLDAP, LDAP: LDAPOptions{URL: "ldap://localhost", BaseDN: "dc=school"}}
+	if _, err := NewProviders([]Options{dup, dup}, nil); err == nil {
+		t.Error("duplicate provider name must be rejected")
+	}
+
+	c := &Credentials{Username: "siti", Password: "secret"}
+	if p, _, err := Authenticate(context.Background(), providers, "", c); err != nil || p.Name() != "sso" {
+		t.Errorf("expected provider %q to authenticate, got %v", "sso", err)
+	}
+	if _, _, err := Authenticate(context.Background(), providers, "ldap", c); err != ErrUnknownProvider {
+		t.Errorf("expected unknown provider, got %v", err)
+	}
+}
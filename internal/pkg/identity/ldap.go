@@ -0,0 +1,136 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type LDAPOptions struct {
+	// URL of directory, e.g. "ldaps://ldap.example.sch.id:636".
+	URL      string `yaml:"url" json:"url"`
+	StartTLS bool   `yaml:"start_tls" json:"start_tls"`
+	// BindDN and BindPassword are used to search user, directory is searched
+	// anonymously when BindDN is empty.
+	BindDN       string `yaml:"bind_dn" json:"bind_dn"`
+	BindPassword string `yaml:"bind_password" json:"-"`
+	BaseDN       string `yaml:"base_dn" json:"base_dn"`
+	// Filter finds user entry, "%s" is replaced by escaped username.
+	Filter  string        `yaml:"filter" json:"filter"`
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+}
+
+// LDAPConn is subset of *ldap.Conn used by LDAP.
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// LDAP verifies password by binding as user entry found in directory.
+type LDAP struct {
+	name    string
+	options LDAPOptions
+	mapping Mapping
+
+	// Dial opens connection to directory, it is replaced by tests.
+	Dial func(ctx context.Context) (LDAPConn, error)
+}
+
+func NewLDAP(name string, o LDAPOptions, m Mapping) (*LDAP, error) {
+	if o.URL == "" || o.BaseDN == "" {
+		return nil, fmt.Errorf("identity: url and base_dn of ldap provider %q are required", name)
+	}
+	if o.Filter == "" {
+		o.Filter = "(uid=%s)"
+	}
+	if !strings.Contains(o.Filter, "%s") {
+		return nil, fmt.Errorf("identity: filter of ldap provider %q must contain %%s", name)
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if m.Username == "" {
+		m.Username = "uid"
+	}
+	if m.Name == "" {
+		m.Name = "cn"
+	}
+	l := &LDAP{name: name, options: o, mapping: m}
+	l.Dial = l.dial
+	return l, nil
+}
+
+func (l *LDAP) Name() string {
+	return l.name
+}
+
+func (l *LDAP) dial(ctx context.Context) (LDAPConn, error) {
+	conn, err := ldap.DialURL(l.options.URL)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.options.Timeout)
+	if l.options.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(l.options.URL, "ldap://"), "ldaps://")
+		host, _, _ = strings.Cut(host, ":")
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (l *LDAP) Authenticate(ctx context.Context, c *Credentials) (*Identity, error) {
+	// empty password is unauthenticated bind which most directories accept
+	if c.Username == "" || c.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.Dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("identity: failed to connect to ldap provider %q: %w", l.name, err)
+	}
+	defer conn.Close()
+
+	if l.options.BindDN != "" {
+		if err := conn.Bind(l.options.BindDN, l.options.BindPassword); err != nil {
+			return nil, fmt.Errorf("identity: failed to bind to ldap provider %q: %w", l.name, err)
+		}
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.options.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(l.options.Timeout/time.Second), false,
+		strings.ReplaceAll(l.options.Filter, "%s", ldap.EscapeFilter(c.Username)),
+		l.mapping.attributes(),
+		nil,
+	))
+	// ambiguous username is rejected rather than guessing the account
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("identity: failed to search ldap provider %q: %w", l.name, err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, c.Password); err != nil {
+		var lerr *ldap.Error
+		if errors.As(err, &lerr) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return l.mapping.identity(l.name, entry.DN, entry.GetEqualFoldAttributeValue), nil
+}
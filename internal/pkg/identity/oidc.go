@@ -0,0 +1,378 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/storage"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+var ErrUnknownKey = errors.New("identity: unknown signing key of id token")
+
+const (
+	// AuthorizationLifetime is how long authorization started by Authorize
+	// waits for its code.
+	AuthorizationLifetime = 10 * time.Minute
+	// keysRefetch is minimum interval between fetches of signing keys, so
+	// id tokens with unknown key id do not make provider fetch them on every
+	// login.
+	keysRefetch = time.Minute
+
+	authorizationPrefix = "identity:authorization:"
+)
+
+type OIDCOptions struct {
+	// Issuer is url of provider, its configuration is discovered from
+	// "<issuer>/.well-known/openid-configuration".
+	Issuer       string   `yaml:"issuer" json:"issuer"`
+	ClientID     string   `yaml:"client_id" json:"client_id"`
+	ClientSecret string   `yaml:"client_secret" json:"-"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+	// PasswordGrant exchanges username and password for id token with
+	// resource owner password credentials grant, otherwise only
+	// authorization code is accepted.
+	PasswordGrant bool          `yaml:"password_grant" json:"password_grant"`
+	Timeout       time.Duration `yaml:"timeout" json:"timeout"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDC verifies id token issued by OpenID Connect provider in exchange of
+// authorization code or password.
+type OIDC struct {
+	name    string
+	options OIDCOptions
+	mapping Mapping
+
+	Client *http.Client
+	// Storage keeps state, nonce and PKCE verifier of pending authorizations.
+	Storage storage.Storage
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+}
+
+// authorization is pending authorization kept until its code is exchanged.
+type authorization struct {
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	RedirectURI string `json:"redirectURI"`
+}
+
+func NewOIDC(name string, o OIDCOptions, m Mapping) (*OIDC, error) {
+	if o.Issuer == "" || o.ClientID == "" {
+		return nil, fmt.Errorf("identity: issuer and client_id of oidc provider %q are required", name)
+	}
+	o.Issuer = strings.TrimSuffix(o.Issuer, "/")
+	if len(o.Scopes) == 0 {
+		o.Scopes = []string{"openid", "profile"}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if m.Username == "" {
+		m.Username = "preferred_username"
+	}
+	if m.Name == "" {
+		m.Name = "name"
+	}
+	return &OIDC{
+		name:    name,
+		options: o,
+		mapping: m,
+		Client:  &http.Client{Timeout: o.Timeout},
+	}, nil
+}
+
+func (o *OIDC) Name() string {
+	return o.name
+}
+
+func (o *OIDC) get(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("identity: %s responded with status %d", u, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
+
+func (o *OIDC) discover(ctx context.Context) (*discovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	d := &discovery{}
+	if err := o.get(ctx, o.options.Issuer+"/.well-known/openid-configuration", d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != o.options.Issuer {
+		return nil, fmt.Errorf("identity: oidc provider %q reported issuer %q", o.name, d.Issuer)
+	}
+	o.discovery = d
+	return d, nil
+}
+
+// key returns public key with id kid, keys are fetched again when kid is
+// unknown, e.g. after provider rotated its keys, at most once per keysRefetch.
+func (o *OIDC) key(ctx context.Context, d *discovery, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(o.fetched) < keysRefetch {
+		return nil, ErrUnknownKey
+	}
+	o.fetched = time.Now()
+
+	set := struct {
+		Keys []auth.JWK `json:"keys"`
+	}{}
+	if err := o.get(ctx, d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	o.keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		o.keys[jwk.KeyID] = k
+	}
+	if k, ok := o.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// random returns url safe encoding of n random bytes.
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Authorize starts log in with authorization code, state, nonce and PKCE
+// verifier are kept in o.Storage so code is only accepted once for the
+// authorization it was issued for.
+func (o *OIDC) Authorize(ctx context.Context, redirectURI string) (*Authorization, error) {
+	if o.Storage == nil {
+		return nil, fmt.Errorf("identity: oidc provider %q has no storage for authorizations", o.name)
+	}
+	d, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.AuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("identity: oidc provider %q has no authorization endpoint", o.name)
+	}
+
+	var state string
+	a := &authorization{RedirectURI: redirectURI}
+	for _, dst := range []*string{&state, &a.Nonce, &a.Verifier} {
+		if *dst, err = random(32); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Storage.Set(authorizationPrefix+o.name+":"+state, b, AuthorizationLifetime); err != nil {
+		return nil, err
+	}
+
+	challenge := sha256.Sum256([]byte(a.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.options.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(o.options.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", a.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return &Authorization{URL: d.AuthorizationEndpoint + sep + q.Encode(), State: state}, nil
+}
+
+// take returns and forgets pending authorization of state.
+func (o *OIDC) take(state string) (*authorization, error) {
+	if o.Storage == nil || state == "" {
+		return nil, ErrInvalidCredentials
+	}
+	key := authorizationPrefix + o.name + ":" + state
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	b, err := o.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	if err := o.Storage.Delete(key); err != nil {
+		return nil, err
+	}
+	a := &authorization{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (o *OIDC) Authenticate(ctx context.Context, c *Credentials) (*Identity, error) {
+	form := url.Values{}
+	nonce := ""
+	switch {
+	case c.Code != "":
+		a, err := o.take(c.State)
+		if err != nil {
+			return nil, err
+		}
+		if a.RedirectURI != c.RedirectURI {
+			return nil, ErrInvalidCredentials
+		}
+		nonce = a.Nonce
+		form.Set("grant_type", "authorization_code")
+		form.Set("code", c.Code)
+		form.Set("redirect_uri", a.RedirectURI)
+		form.Set("code_verifier", a.Verifier)
+	case o.options.PasswordGrant && c.Username != "" && c.Password != "":
+		form.Set("grant_type", "password")
+		form.Set("username", c.Username)
+		form.Set("password", c.Password)
+		form.Set("scope", strings.Join(o.options.Scopes, " "))
+	default:
+		return nil, ErrInvalidCredentials
+	}
+
+	d, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := o.exchange(ctx, d, form)
+	if err != nil {
+		return nil, err
+	}
+	return o.verify(ctx, d, token, nonce)
+}
+
+// exchange returns id token issued by token endpoint for form.
+func (o *OIDC) exchange(ctx context.Context, d *discovery, form url.Values) (string, error) {
+	if o.options.ClientSecret == "" {
+		form.Set("client_id", o.options.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.options.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.options.ClientID), url.QueryEscape(o.options.ClientSecret))
+	}
+
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	// RFC 6749 section 5.2, invalid grant is reported as bad request
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return "", ErrInvalidCredentials
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("identity: token endpoint of oidc provider %q responded with status %d", o.name, res.StatusCode)
+	}
+
+	body := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("identity: oidc provider %q did not issue id token", o.name)
+	}
+	return body.IDToken, nil
+}
+
+// verify returns identity of id token, nonce of token must be nonce when it
+// is not empty.
+func (o *OIDC) verify(ctx context.Context, d *discovery, token, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.
+		NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"})).
+		ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return o.key(ctx, d, kid)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("identity: invalid id token of oidc provider %q: %w", o.name, err)
+	}
+	if !claims.VerifyIssuer(d.Issuer, true) || !claims.VerifyAudience(o.options.ClientID, true) {
+		return nil, fmt.Errorf("identity: id token of oidc provider %q was not issued for this client", o.name)
+	}
+	if n, _ := claims["nonce"].(string); nonce != "" && n != nonce {
+		return nil, fmt.Errorf("identity: nonce of id token of oidc provider %q does not match", o.name)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("identity: id token of oidc provider %q does not expire", o.name)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("identity: id token of oidc provider %q has no subject", o.name)
+	}
+
+	return o.mapping.identity(o.name, sub, func(claim string) string {
+		switch v := claims[claim].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			return fmt.Sprint(v)
+		}
+	}), nil
+}
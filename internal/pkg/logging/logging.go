@@ -0,0 +1,111 @@
+// package logging writes structured access log of every request and carries
+// request scoped logger in context, so log lines of services can be joined
+// with their request by request id.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+type Options struct {
+	// Level is minimum level written, e.g. "debug", "info" or "warn".
+	Level string `yaml:"level" json:"level"`
+	// Format is one of "json" or "console" (human readable).
+	Format string `yaml:"format" json:"format"`
+}
+
+// New returns logger writing to w as configured by o.
+func New(o Options, w io.Writer) (zerolog.Logger, error) {
+	level, err := zerolog.ParseLevel(o.Level)
+	if err != nil {
+		return zerolog.Nop(), fmt.Errorf("logging: %w", err)
+	}
+	switch o.Format {
+	case "", FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}
+	default:
+		return zerolog.Nop(), fmt.Errorf("logging: unknown log format %q", o.Format)
+	}
+	return zerolog.New(w).With().Timestamp().Logger().Level(level), nil
+}
+
+// Ctx returns logger of request ctx, fallback is returned outside of request,
+// e.g. in workers and tests.
+func Ctx(ctx context.Context, fallback zerolog.Logger) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &fallback
+}
+
+// SetUser adds user id to logger of request ctx, it is written on every
+// following line including the access log.
+func SetUser(ctx context.Context, id string) {
+	l := zerolog.Ctx(ctx)
+	if l.GetLevel() == zerolog.Disabled {
+		return
+	}
+	l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("user", id)
+	})
+}
+
+// AccessLog stores logger with request id in request context and writes one
+// line per request once it is served, it must be used after
+// middleware.RequestID.
+func AccessLog(logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(logger.
+				With().
+				Str("request_id", middleware.GetReqID(r.Context())).
+				Logger().
+				WithContext(r.Context()))
+			// logger stored in context, it also carries fields added by
+			// handlers, e.g. user
+			l := zerolog.Ctx(r.Context())
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				route := ""
+				if rc := chi.RouteContext(r.Context()); rc != nil {
+					route = rc.RoutePattern()
+				}
+
+				e := l.Info()
+				if status >= http.StatusInternalServerError {
+					e = l.Error()
+				}
+				e.
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Str("route", route).
+					Int("status", status).
+					Dur("latency", time.Since(start)).
+					Int("bytes", ww.BytesWritten()).
+					Str("remote", r.RemoteAddr).
+					Msg("request served")
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	for _, o := range []Options{
+		{Level: "verbose", Format: FormatJSON},
+		{Level: "info", Format: "xml"},
+	} {
+		if _, err := New(o, io.Discard); err == nil {
+			t.Errorf("expected options %+v to be invalid", o)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	l, err := New(Options{Level: "warn", Format: FormatJSON}, buf)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	l.Info().Msg("hidden")
+	l.Warn().Msg("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") {
+		t.Errorf("expected only warn line, got %q", out)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(AccessLog(logger))
+	r.Get("/student/{studentID}", func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), "adm-1")
+		Ctx(r.Context(), zerolog.Nop()).Info().Msg("from service")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/student/stu-1", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected service and access log lines, got %q", buf.String())
+	}
+	service, access := map[string]any{}, map[string]any{}
+	if err := json.Unmarshal([]byte(lines[0]), &service); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &access); err != nil {
+		t.Fatal(err.Error())
+	}
+	if service["request_id"] == nil || service["request_id"] != access["request_id"] {
+		t.Errorf("service and access log must share request id, got %v and %v", service["request_id"], access["request_id"])
+	}
+	want := map[string]any{
+		"user":   "adm-1",
+		"route":  "/student/{studentID}",
+		"path":   "/student/stu-1",
+		"status": float64(http.StatusTeapot),
+		"bytes":  float64(5),
+	}
+	for k, v := range want {
+		if access[k] != v {
+			t.Errorf("expected access log %s to be %v, got %v", k, v, access[k])
+		}
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("access log must record latency")
+	}
+
+	fallback := zerolog.New(io.Discard).Level(zerolog.WarnLevel)
+	if l := Ctx(context.Background(), fallback); l.GetLevel() != zerolog.WarnLevel {
+		t.Error("logger outside of request must be fallback")
+	}
+}
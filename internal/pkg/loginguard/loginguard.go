@@ -0,0 +1,344 @@
+// package loginguard protects login routes from guessing passwords, failures
+// are counted per account so one class behind a single NAT does not lock
+// itself out, while guessing single account from many addresses is slowed
+// down by exponential lockout. Accounts and lockout events are kept per
+// organization of context, see package tenant.
+package loginguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/gofiber/storage"
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+const (
+	accountPrefix = "loginguard:account:"
+	eventsKey     = "loginguard:events:"
+	// maxEvents is number of latest lockout events kept per organization.
+	maxEvents = 1000
+)
+
+type Options struct {
+	// MaxFailures is number of failed logins before account is locked.
+	MaxFailures int `yaml:"max_failures" json:"max_failures"`
+	// Lockout is duration of first lockout, it doubles for every next lockout
+	// until MaxLockout.
+	Lockout    time.Duration `yaml:"lockout" json:"lockout"`
+	MaxLockout time.Duration `yaml:"max_lockout" json:"max_lockout"`
+	// Forget is how long failures of account are remembered.
+	Forget time.Duration `yaml:"forget" json:"forget"`
+	// TrustedNetworks are CIDR of lab subnets which are not rate limited by ip.
+	TrustedNetworks []string `yaml:"trusted_networks" json:"trusted_networks"`
+	// TrustedProxies are CIDR of reverse proxies whose X-Real-IP and
+	// X-Forwarded-For headers are honoured, see RealIP. Headers of any other
+	// client are ignored so it can not pick its own address.
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+}
+
+// Event records lockout of an account.
+type Event struct {
+	Account     string    `json:"account"`
+	IP          string    `json:"ip,omitempty"`
+	Failures    int       `json:"failures"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"lockedUntil"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type state struct {
+	Failures    int       `json:"failures"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// Guard counts failed logins per account in Storage, so lockouts survive restart
+// when persistent storage is used.
+type Guard struct {
+	Options Options
+	Storage storage.Storage
+	Logger  zerolog.Logger
+
+	mu      sync.Mutex
+	trusted []*net.IPNet
+	proxies []*net.IPNet
+}
+
+func New(o Options, s storage.Storage, logger zerolog.Logger) (*Guard, error) {
+	g := &Guard{Options: o, Storage: s, Logger: logger}
+	var err error
+	if g.trusted, err = parseNetworks("trusted network", o.TrustedNetworks); err != nil {
+		return nil, err
+	}
+	if g.proxies, err = parseNetworks("trusted proxy", o.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func parseNetworks(kind string, cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("loginguard: invalid %s %q: %w", kind, cidr, err)
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Account returns key of account with username of kind, e.g. "admin" or "student".
+func Account(kind, username string) string {
+	return kind + ":" + strings.ToLower(username)
+}
+
+// namespace returns organization of ctx, usernames are only unique within
+// organization.
+func namespace(ctx context.Context) string {
+	org, _ := tenant.Organization(ctx)
+	return org.String()
+}
+
+func (g *Guard) load(ctx context.Context, account string) (*state, error) {
+	st := &state{}
+	b, err := tracing.Bind(ctx, g.Storage).Get(accountPrefix + namespace(ctx) + ":" + account)
+	if err != nil || b == nil {
+		return st, err
+	}
+	return st, json.Unmarshal(b, st)
+}
+
+func (g *Guard) save(ctx context.Context, account string, st *state) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	ttl := g.Options.Forget
+	if d := time.Until(st.LockedUntil) + g.Options.Forget; d > ttl {
+		ttl = d
+	}
+	return tracing.Bind(ctx, g.Storage).Set(accountPrefix+namespace(ctx)+":"+account, b, ttl)
+}
+
+// Check returns error when account is locked.
+func (g *Guard) Check(ctx context.Context, account string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, err := g.load(ctx, account)
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(st.LockedUntil); wait > 0 {
+		return locked(wait)
+	}
+	return nil
+}
+
+func locked(wait time.Duration) error {
+	return response.NewError(nil, fmt.Sprintf("too many failed logins, try again in %s", wait.Round(time.Second)), http.StatusTooManyRequests)
+}
+
+// Fail records failed login of account, account is locked and lockout event
+// is stored once MaxFailures is reached. Only failures of existing accounts
+// should be recorded, so unknown usernames can not fill storage.
+func (g *Guard) Fail(ctx context.Context, account string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, err := g.load(ctx, account)
+	if err != nil {
+		return err
+	}
+	st.Failures++
+	if st.Failures < g.Options.MaxFailures {
+		return g.save(ctx, account, st)
+	}
+
+	lockout := g.Options.Lockout << st.Lockouts
+	if lockout <= 0 || lockout > g.Options.MaxLockout {
+		lockout = g.Options.MaxLockout
+	}
+	now := time.Now()
+	e := &Event{
+		Account:     account,
+		IP:          ClientIP(ctx),
+		Failures:    st.Failures,
+		Lockouts:    st.Lockouts + 1,
+		LockedUntil: now.Add(lockout),
+		CreatedAt:   now,
+	}
+	st.Failures = 0
+	st.Lockouts++
+	st.LockedUntil = e.LockedUntil
+	if err := g.save(ctx, account, st); err != nil {
+		return err
+	}
+
+	logging.Ctx(ctx, g.Logger).Warn().
+		Str("account", e.Account).
+		Str("ip", e.IP).
+		Int("lockouts", e.Lockouts).
+		Time("lockedUntil", e.LockedUntil).
+		Msg("account locked after too many failed logins")
+	return g.appendEvent(ctx, e)
+}
+
+// Succeed forgets failures of account after successful login.
+func (g *Guard) Succeed(ctx context.Context, account string) error {
+	return g.Reset(ctx, account)
+}
+
+// Reset unlocks account and forgets its failures.
+func (g *Guard) Reset(ctx context.Context, account string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return tracing.Bind(ctx, g.Storage).Delete(accountPrefix + namespace(ctx) + ":" + account)
+}
+
+func (g *Guard) appendEvent(ctx context.Context, e *Event) error {
+	events, err := g.events(ctx)
+	if err != nil {
+		return err
+	}
+	events = append(events, e)
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+	b, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return tracing.Bind(ctx, g.Storage).Set(eventsKey+namespace(ctx), b, 0)
+}
+
+func (g *Guard) events(ctx context.Context) ([]*Event, error) {
+	events := make([]*Event, 0)
+	b, err := tracing.Bind(ctx, g.Storage).Get(eventsKey + namespace(ctx))
+	if err != nil || b == nil {
+		return events, err
+	}
+	return events, json.Unmarshal(b, &events)
+}
+
+// Events returns latest lockout events of organization of ctx, newest last.
+func (g *Guard) Events(ctx context.Context) ([]*Event, error) {
+	if g == nil {
+		return make([]*Event, 0), nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.events(ctx)
+}
+
+// Trusted reports whether ip belongs to trusted network.
+func (g *Guard) Trusted(ip string) bool {
+	if g == nil {
+		return false
+	}
+	return contains(g.trusted, ip)
+}
+
+// RealIP replaces RemoteAddr of request sent by trusted proxy with address of
+// client the proxy reports, the rightmost address of X-Forwarded-For which is
+// not a trusted proxy, or X-Real-IP. It must be used before any middleware
+// reading RemoteAddr, such as Limit.
+func (g *Guard) RealIP(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := g.forwardedIP(r); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *Guard) forwardedIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !contains(g.proxies, peer) {
+		return ""
+	}
+	// addresses left of the rightmost untrusted one are sent by client
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if net.ParseIP(ip) == nil {
+				return ""
+			}
+			if !contains(g.proxies, ip) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return ""
+}
+
+type ctxKey struct{}
+
+// ClientIP returns address of client stored by (*Guard).Limit.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+	return ip
+}
+
+// Limit rate limits requests per ip, except requests from trusted networks,
+// it also stores client ip in request context for lockout events. Address is
+// read from RemoteAddr, which is only rewritten by RealIP for trusted proxies.
+func (g *Guard) Limit(requestLimit int, windowLength time.Duration) func(http.Handler) http.Handler {
+	limit := httprate.LimitByIP(requestLimit, windowLength)
+	return func(next http.Handler) http.Handler {
+		limited := limit(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _ := httprate.KeyByIP(r)
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, ip))
+			if g.Trusted(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package loginguard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage/memory"
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+func TestGuard(t *testing.T) {
+	t.Parallel()
+	g, err := New(Options{
+		MaxFailures: 3,
+		Lockout:     time.Minute,
+		MaxLockout:  3 * time.Minute,
+		Forget:      time.Hour,
+	}, memory.New(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx := context.Background()
+	account := Account("admin", "Foo")
+
+	lockout := func() time.Duration {
+		for i := 0; i < 3; i++ {
+			if err := g.Check(ctx, account); err != nil {
+				t.Fatalf("account must not be locked before %d failures, got %v", 3, err)
+			}
+			if err := g.Fail(ctx, account); err != nil {
+				t.Fatal("failed to record failure", err)
+			}
+		}
+		if err := g.Check(ctx, account); err == nil {
+			t.Fatal("account must be locked after too many failures")
+		}
+		st, err := g.load(ctx, account)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		d := time.Until(st.LockedUntil)
+		// unlock without forgetting lockouts, as if lockout has passed
+		st.LockedUntil = time.Time{}
+		if err := g.save(ctx, account, st); err != nil {
+			t.Fatal(err.Error())
+		}
+		return d
+	}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		if got := lockout(); got > want || got < want-time.Second {
+			t.Errorf("expected lockout %d to be %s, got %s", i+1, want, got)
+		}
+	}
+
+	events, err := g.Events(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(events) != 3 || events[0].Account != "admin:foo" {
+		t.Errorf("expected 3 lockout events of %q, got %+v", "admin:foo", events)
+	}
+
+	// the same username of other organization is a different account
+	other := tenant.WithOrganization(ctx, raid.NewRaid().WithPrefix("org").WithRandom())
+	if err := g.Check(other, account); err != nil {
+		t.Errorf("account of other organization must not be locked, got %v", err)
+	}
+	if events, _ := g.Events(other); len(events) != 0 {
+		t.Errorf("lockout events must not be listed for other organization, got %+v", events)
+	}
+
+	if err := g.Fail(ctx, account); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := g.Succeed(ctx, account); err != nil {
+		t.Fatal(err.Error())
+	}
+	if st, _ := g.load(ctx, account); st.Failures != 0 || st.Lockouts != 0 {
+		t.Errorf("successful login must forget failures, got %+v", st)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	t.Parallel()
+	g, err := New(Options{TrustedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}}, memory.New(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := New(Options{TrustedNetworks: []string{"10.0.0.0"}}, memory.New(), zerolog.Nop()); err == nil {
+		t.Error("invalid trusted network must be rejected")
+	}
+	if _, err := New(Options{TrustedProxies: []string{"proxy"}}, memory.New(), zerolog.Nop()); err == nil {
+		t.Error("invalid trusted proxy must be rejected")
+	}
+
+	var seen string
+	h := g.RealIP(g.Limit(1, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = ClientIP(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	forwarded := func(addr string, header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = addr + ":1234"
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	call := func(addr string) int {
+		return forwarded(addr, nil)
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := call("10.1.2.3"); code != http.StatusNoContent {
+			t.Errorf("trusted network must not be rate limited, got status %d", code)
+		}
+	}
+	call("192.168.1.1")
+	if code := call("192.168.1.1"); code != http.StatusTooManyRequests {
+		t.Errorf("untrusted network must be rate limited, got status %d", code)
+	}
+
+	spoofed := http.Header{"X-Real-Ip": {"10.1.2.3"}, "X-Forwarded-For": {"10.1.2.3"}}
+	if code := forwarded("192.168.1.1", spoofed); code != http.StatusTooManyRequests || seen != "192.168.1.1" {
+		t.Errorf("forwarded address of untrusted client must be ignored, got status %d from %q", code, seen)
+	}
+
+	if code := forwarded("172.16.0.1", http.Header{"X-Forwarded-For": {"10.9.9.9, 10.1.2.3, 172.16.0.2"}}); code != http.StatusNoContent || seen != "10.1.2.3" {
+		t.Errorf("expected rightmost untrusted address sent by proxy, got status %d from %q", code, seen)
+	}
+	forwarded("172.16.0.1", http.Header{"X-Forwarded-For": {"10.1.2.3, 192.168.2.2"}})
+	if code := forwarded("172.16.0.1", http.Header{"X-Forwarded-For": {"10.1.2.3, 192.168.2.2"}}); code != http.StatusTooManyRequests || seen != "192.168.2.2" {
+		t.Errorf("address prepended by client behind proxy must be ignored, got status %d from %q", code, seen)
+	}
+	if code := forwarded("172.16.0.1", http.Header{"X-Real-Ip": {"10.4.4.4"}}); code != http.StatusNoContent || seen != "10.4.4.4" {
+		t.Errorf("expected X-Real-IP sent by proxy, got status %d from %q", code, seen)
+	}
+}
@@ -0,0 +1,199 @@
+// package metrics exposes prometheus metrics of http handlers, database,
+// storage and running exams at /metrics.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+const namespace = "skul"
+
+type Options struct {
+	// Token is required as bearer token to scrape /metrics, metrics are not
+	// served when it is empty.
+	Token string `yaml:"token" json:"-"`
+}
+
+// Metrics holds collectors of this server in its own registry, nil Metrics
+// records nothing so services keep working without metrics in tests.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpDuration *prometheus.HistogramVec
+	dbDuration   *prometheus.HistogramVec
+	storageOps   *prometheus.CounterVec
+	answers      prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of http requests by chi route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Latency of database queries by operation and table.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "table"}),
+		storageOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_operations_total",
+			Help:      "Key value storage operations by operation and result.",
+		}, []string{"operation", "result"}),
+		answers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "student_answers_total",
+			Help:      "Answers submitted by students, its rate is answers per second.",
+		}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.dbDuration,
+		m.storageOps,
+		m.answers,
+	)
+	return m
+}
+
+// Handler serves metrics of m to requests with token, every request is
+// refused when token is empty so metrics are never public by mistake.
+func (m *Metrics) Handler(token string) http.Handler {
+	if token == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response.HandleError(w, r, response.NewNotFound(nil, "metrics are disabled, metrics token is not set"))
+		})
+	}
+	h := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			response.HandleError(w, r, response.NewUnauthorized(nil, "invalid metrics token"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Middleware observes latency of requests by route pattern, pattern is used
+// instead of path so ids in path do not create new series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := "unmatched"
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				route = rc.RoutePattern()
+			}
+			m.httpDuration.
+				WithLabelValues(r.Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// AnswerSubmitted counts answer submitted by student, answers per enterance
+// token are reported by TokenAnswers instead so closed tokens add no series.
+func (m *Metrics) AnswerSubmitted() {
+	if m == nil {
+		return
+	}
+	m.answers.Inc()
+}
+
+// ActiveAttempts registers gauge of exam attempts whose enterance token
+// window is open, count is called on every scrape.
+func (m *Metrics) ActiveAttempts(count func(ctx context.Context) (int64, error)) {
+	m.Registry.MustRegister(&countCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exam", "active_attempts"),
+			"Students whose enterance token window is open.",
+			nil, nil,
+		),
+		count: count,
+	})
+}
+
+// TokenAnswers registers gauge of selected answers by enterance token whose
+// window is open, count is called on every scrape.
+func (m *Metrics) TokenAnswers(count func(ctx context.Context) (map[string]int64, error)) {
+	m.Registry.MustRegister(&labelCountCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exam", "token_answers"),
+			"Selected answers of students by open enterance token.",
+			[]string{"enterance_token"}, nil,
+		),
+		count: count,
+	})
+}
+
+// countCollector reports gauge counted at scrape time.
+type countCollector struct {
+	desc  *prometheus.Desc
+	count func(ctx context.Context) (int64, error)
+}
+
+func (c *countCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
+
+// labelCountCollector reports gauge counted at scrape time by single label.
+type labelCountCollector struct {
+	desc  *prometheus.Desc
+	count func(ctx context.Context) (map[string]int64, error)
+}
+
+func (c *labelCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *labelCountCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for label, n := range count {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), label)
+	}
+}
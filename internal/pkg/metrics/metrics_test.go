@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofiber/storage/memory"
+	"gorm.io/gorm"
+)
+
+type row struct {
+	ID   int
+	Name string
+}
+
+func scrape(t *testing.T, h http.Handler, token string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	b, _ := io.ReadAll(w.Body)
+	return w.Code, string(b)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	m := New()
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/student/{studentID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/student/stu-1", nil))
+
+	db, err := gorm.Open(sqlite.Open("file:metrics?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.Use(&GormPlugin{Metrics: m}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.Create(&row{Name: "a"}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := &Storage{Storage: memory.New(), Metrics: m}
+	_ = s.Set("key", []byte("value"), 0)
+	_, _ = s.Get("key")
+	_, _ = s.Get("missing")
+
+	m.AnswerSubmitted()
+	m.AnswerSubmitted()
+	active := int64(3)
+	m.ActiveAttempts(func(ctx context.Context) (int64, error) {
+		return active, nil
+	})
+	m.TokenAnswers(func(ctx context.Context) (map[string]int64, error) {
+		return map[string]int64{"ent-open": 4}, nil
+	})
+
+	code, body := scrape(t, m.Handler("secret"), "secret")
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	for _, want := range []string{
+		`skul_http_request_duration_seconds_count{method="GET",route="/student/{studentID}",status="204"} 1`,
+		`skul_db_query_duration_seconds_count{operation="create",table="rows"} 1`,
+		`skul_storage_operations_total{operation="get",result="miss"} 1`,
+		`skul_storage_operations_total{operation="get",result="ok"} 1`,
+		`skul_storage_operations_total{operation="set",result="ok"} 1`,
+		`skul_student_answers_total 2`,
+		`skul_exam_active_attempts 3`,
+		`skul_exam_token_answers{enterance_token="ent-open"} 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+
+	if code, _ := scrape(t, m.Handler(""), ""); code != http.StatusNotFound {
+		t.Errorf("expected metrics without token to be disabled, got %d", code)
+	}
+	if code, _ := scrape(t, m.Handler("secret"), ""); code != http.StatusUnauthorized {
+		t.Errorf("expected scrape without token to be refused, got %d", code)
+	}
+	if code, _ := scrape(t, m.Handler("secret"), "secret"); code != http.StatusOK {
+		t.Errorf("expected scrape with token to be allowed, got %d", code)
+	}
+
+	var nilMetrics *Metrics
+	nilMetrics.AnswerSubmitted()
+
+	failing := New()
+	failing.ActiveAttempts(func(ctx context.Context) (int64, error) {
+		return 0, errors.New("database is down")
+	})
+	if code, _ := scrape(t, failing.Handler("secret"), "secret"); code != http.StatusInternalServerError {
+		t.Errorf("expected failed collector to fail scrape, got %d", code)
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/gofiber/storage"
+)
+
+// Storage counts operations of wrapped storage.
+type Storage struct {
+	storage.Storage
+	Metrics *Metrics
+}
+
+var _ storage.Storage = new(Storage)
+
+func (s *Storage) count(operation string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	s.Metrics.storageOps.WithLabelValues(operation, result).Inc()
+}
+
+func (s *Storage) Get(key string) ([]byte, error) {
+	b, err := s.Storage.Get(key)
+	if err == nil && b == nil {
+		s.Metrics.storageOps.WithLabelValues("get", "miss").Inc()
+		return b, err
+	}
+	s.count("get", err)
+	return b, err
+}
+
+func (s *Storage) Set(key string, val []byte, exp time.Duration) error {
+	err := s.Storage.Set(key, val, exp)
+	s.count("set", err)
+	return err
+}
+
+func (s *Storage) Delete(key string) error {
+	err := s.Storage.Delete(key)
+	s.count("delete", err)
+	return err
+}
+
+func (s *Storage) Reset() error {
+	err := s.Storage.Reset()
+	s.count("reset", err)
+	return err
+}
@@ -0,0 +1,164 @@
+// package password validates passwords against configurable policy and
+// issues one time codes to reset forgotten passwords.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/storage"
+
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+var (
+	ErrInvalidCode = response.NewBadRequest(map[string]string{"code": "invalid"}, "reset code is invalid or expired")
+)
+
+// maxLength is the longest password bcrypt can hash.
+const maxLength = 72
+
+type Policy struct {
+	MinLength     int  `yaml:"min_length" json:"min_length"`
+	RequireUpper  bool `yaml:"require_upper" json:"require_upper"`
+	RequireLower  bool `yaml:"require_lower" json:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit" json:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol" json:"require_symbol"`
+}
+
+// Validate returns bad request error describing every rule of p broken by password.
+func (p Policy) Validate(password string) error {
+	var broken []string
+	if len(password) < p.MinLength {
+		broken = append(broken, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	if len(password) > maxLength {
+		broken = append(broken, fmt.Sprintf("at most %d characters", maxLength))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		broken = append(broken, "an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		broken = append(broken, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		broken = append(broken, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		broken = append(broken, "a symbol")
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+	msg := "password must contain " + strings.Join(broken, ", ")
+	return response.NewBadRequest(map[string]string{"password": msg}, msg)
+}
+
+const (
+	resetPrefix = "password:reset:"
+	// codeAlphabet omits characters easily confused when read aloud or handwritten.
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 8
+	maxAttempts  = 5
+)
+
+type resetCode struct {
+	Hash      string    `json:"hash"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Resetter issues one time reset codes, codes are stored hashed in Storage.
+type Resetter struct {
+	Storage  storage.Storage
+	Lifetime time.Duration
+}
+
+func hashCode(code string) string {
+	h := sha256.Sum256([]byte(strings.ToUpper(code)))
+	return hex.EncodeToString(h[:])
+}
+
+// Issue returns new reset code of subject, replacing previous one.
+func (r *Resetter) Issue(subject string) (code string, expiresAt time.Time, err error) {
+	b := make([]byte, codeLength)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		b[i] = codeAlphabet[n.Int64()]
+	}
+	code = string(b)
+	expiresAt = time.Now().Add(r.Lifetime)
+
+	if err := r.save(subject, &resetCode{Hash: hashCode(code), ExpiresAt: expiresAt}); err != nil {
+		return "", time.Time{}, err
+	}
+	return code, expiresAt, nil
+}
+
+// Redeem consumes reset code of subject, the code is discarded after too many
+// wrong attempts.
+func (r *Resetter) Redeem(subject, code string) error {
+	b, err := r.Storage.Get(resetPrefix + subject)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return ErrInvalidCode
+	}
+	rc := &resetCode{}
+	if err := json.Unmarshal(b, rc); err != nil {
+		return err
+	}
+	if time.Now().After(rc.ExpiresAt) {
+		return ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(rc.Hash)) != 1 {
+		rc.Attempts++
+		if rc.Attempts >= maxAttempts {
+			if err := r.Storage.Delete(resetPrefix + subject); err != nil {
+				return err
+			}
+			return ErrInvalidCode
+		}
+		if err := r.save(subject, rc); err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+
+	return r.Storage.Delete(resetPrefix + subject)
+}
+
+func (r *Resetter) save(subject string, rc *resetCode) error {
+	b, err := json.Marshal(rc)
+	if err != nil {
+		return err
+	}
+	return r.Storage.Set(resetPrefix+subject, b, time.Until(rc.ExpiresAt))
+}
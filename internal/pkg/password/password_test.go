@@ -0,0 +1,59 @@
+package password
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/storage/memory"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+	p := Policy{MinLength: 8, RequireUpper: true, RequireDigit: true, RequireSymbol: true}
+	for _, tc := range []struct {
+		Password string
+		Valid    bool
+	}{
+		{"Abcdef1!", true},
+		{"Abc1!", false},
+		{"abcdefg1!", false},
+		{"Abcdefgh!", false},
+		{"Abcdefgh1", false},
+	} {
+		if err := p.Validate(tc.Password); (err == nil) != tc.Valid {
+			t.Errorf("expected validity of %q to be %v, got error %v", tc.Password, tc.Valid, err)
+		}
+	}
+}
+
+func TestResetter(t *testing.T) {
+	t.Parallel()
+	r := &Resetter{Storage: memory.New(), Lifetime: time.Minute}
+
+	code, _, err := r.Issue("foo")
+	if err != nil {
+		t.Fatal("failed to issue code", err)
+	}
+	if err := r.Redeem("bar", code); err != ErrInvalidCode {
+		t.Errorf("code must not be redeemed by other subject, got %v", err)
+	}
+	if err := r.Redeem("foo", code); err != nil {
+		t.Error("failed to redeem code", err)
+	}
+	if err := r.Redeem("foo", code); err != ErrInvalidCode {
+		t.Errorf("code must only be redeemed once, got %v", err)
+	}
+
+	code, _, err = r.Issue("foo")
+	if err != nil {
+		t.Fatal("failed to issue code", err)
+	}
+	for i := 0; i < maxAttempts; i++ {
+		if err := r.Redeem("foo", "WRONG"); err != ErrInvalidCode {
+			t.Errorf("wrong code must be rejected, got %v", err)
+		}
+	}
+	if err := r.Redeem("foo", code); err != ErrInvalidCode {
+		t.Errorf("code must be discarded after %d wrong attempts, got %v", maxAttempts, err)
+	}
+}
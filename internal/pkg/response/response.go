@@ -7,6 +7,8 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/falentio/skul/internal/pkg/logging"
 )
 
 var logger = log.Logger
@@ -62,8 +64,8 @@ func NewNoContent() *HttpResponse[any] {
 
 type HttpResponsePaginate[T any] struct {
 	*HttpResponse[T]
-	Data []T `json:"data"`
-	Page Page
+	Data []T  `json:"data"`
+	Page Page `json:"page"`
 }
 
 type Page struct {
@@ -72,6 +74,15 @@ type Page struct {
 	Page   int `json:"page"`
 }
 
+// ServeHTTP encodes whole page, promoted (*HttpResponse).ServeHTTP would only
+// encode embedded response without datas.
+func (o HttpResponsePaginate[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(o.Code)
+	if err := json.NewEncoder(w).Encode(o); err != nil {
+		HandleError(w, r, err)
+	}
+}
+
 func NewPaginate[T any](datas []T, page Page) HttpResponsePaginate[T] {
 	return HttpResponsePaginate[T]{
 		HttpResponse: &HttpResponse[T]{
@@ -90,7 +101,7 @@ type HttpError struct {
 
 func HandleError(w http.ResponseWriter, r *http.Request, err error) {
 	if re, ok := err.(ResponseError); !ok {
-		logger.Error().Err(err).Msg("internal server error")
+		logging.Ctx(r.Context(), logger).Error().Err(err).Msg("internal server error")
 		HandleError(w, r, NewInternalServerError(nil, "internal server error"))
 	} else {
 		w.Header().Set("content-type", "application/json; charset=utf-8")
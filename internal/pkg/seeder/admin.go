@@ -2,6 +2,7 @@ package seeder
 
 import (
 	"context"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -9,20 +10,28 @@ import (
 	"github.com/falentio/skul/internal/service/admin"
 )
 
-func AdminRepository(r domain.AdminRepository) error {
+// AdminRepository creates admins whose username is not taken yet.
+func AdminRepository(ctx context.Context, r domain.AdminRepository) error {
 	password, err := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 	for _, a := range []*domain.Admin{
-		{Username: "admin"},
-		{Username: "foo"},
+		{Username: "admin", Role: domain.RoleSuperAdmin},
+		{Username: "foo", Role: domain.RoleTeacher},
 	} {
+		_, err := r.GetAdminByUsername(ctx, a.Username)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, domain.ErrAdminNotFound) {
+			return err
+		}
 		a.ID = admin.AdminIDFactory.WithTimestampNow().WithRandom()
 		a.Name = a.Username
 		a.PasswordHash = string(password)
 
-		if err := r.CreateAdmin(context.Background(), a); err != nil {
+		if err := r.CreateAdmin(ctx, a); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,26 @@
+package seeder
+
+import (
+	"context"
+	"errors"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/service/organization"
+)
+
+// OrganizationRepository returns default organization, it is only created
+// when it does not exist yet.
+func OrganizationRepository(r domain.OrganizationRepository) (*domain.Organization, error) {
+	o, err := r.GetOrganizationByName(context.Background(), "default")
+	if !errors.Is(err, domain.ErrOrganizationNotFound) {
+		return o, err
+	}
+
+	o = &domain.Organization{Name: "default"}
+	o.ID = organization.OrganizationIDFactory.WithTimestampNow().WithRandom()
+
+	if err := r.CreateOrganization(context.Background(), o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
@@ -2,6 +2,7 @@ package seeder
 
 import (
 	"context"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -10,7 +11,8 @@ import (
 	"github.com/falentio/skul/internal/service/student"
 )
 
-func StudentRepository(s domain.StudentRepository) error {
+// StudentRepository creates students whose username is not taken yet.
+func StudentRepository(ctx context.Context, s domain.StudentRepository) error {
 	password, err := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -20,12 +22,19 @@ func StudentRepository(s domain.StudentRepository) error {
 		{Username: "foo"},
 		{Username: "bar"},
 	} {
+		_, err := s.GetStudentByUsername(ctx, std.Username)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, domain.ErrStudentNotFound) {
+			return err
+		}
 		std.ID = student.StudentIDFactory.WithTimestampNow().WithRandom()
 		std.AdminID = admin.AdminIDFactory.WithTimestampNow().WithRandom()
 		std.Name = std.Username
 		std.PasswordHash = string(password)
 
-		if err := s.CreateStudent(context.Background(), std); err != nil {
+		if err := s.CreateStudent(ctx, std); err != nil {
 			return err
 		}
 	}
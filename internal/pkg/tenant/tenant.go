@@ -0,0 +1,127 @@
+// package tenant carries the organisation (school) of current caller in
+// context, repositories use it to scope every query to that organisation.
+// Context without organisation sees nothing, unless it is explicitly made
+// Unscoped.
+package tenant
+
+import (
+	"context"
+
+	"github.com/falentio/raid-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const Column = "organization_id"
+
+type ctxKey struct{}
+
+type unscopedKey struct{}
+
+// WithOrganization returns ctx scoped to organization id.
+func WithOrganization(ctx context.Context, id raid.Raid) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// Unscoped returns ctx which sees every organization, it must only be used
+// by system jobs and while looking up credentials whose organization is not
+// known yet, e.g. api tokens.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// IsUnscoped reports whether ctx without organization was made Unscoped.
+func IsUnscoped(ctx context.Context) bool {
+	v, _ := ctx.Value(unscopedKey{}).(bool)
+	return v
+}
+
+// none filters out every row, it is used when ctx is neither scoped nor
+// Unscoped, so forgetting to scope ctx fails closed.
+func none(db *gorm.DB) *gorm.DB {
+	return db.Where("1 = 0")
+}
+
+// Organization returns organization of ctx, ok is false when ctx is not scoped.
+func Organization(ctx context.Context) (id raid.Raid, ok bool) {
+	id, ok = ctx.Value(ctxKey{}).(raid.Raid)
+	return id, ok && !id.IsNil()
+}
+
+// WithOrganizationOr returns ctx scoped to id, or to fallback when id is nil,
+// e.g. organization sent with login or the default one.
+func WithOrganizationOr(ctx context.Context, id, fallback raid.Raid) context.Context {
+	if id.IsNil() {
+		id = fallback
+	}
+	return WithOrganization(ctx, id)
+}
+
+// Assign sets dst to organization of ctx, dst is left untouched when ctx is not scoped.
+func Assign(ctx context.Context, dst *raid.Raid) {
+	if id, ok := Organization(ctx); ok {
+		*dst = id
+	}
+}
+
+// Scope filters current table by organization of ctx.
+func Scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		id, ok := Organization(ctx)
+		if !ok {
+			if IsUnscoped(ctx) {
+				return db
+			}
+			return none(db)
+		}
+		return db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: Column},
+			Value:  id.String(),
+		})
+	}
+}
+
+// ScopeParent filters current table by column referencing a row of parentTable
+// which belongs to organization of ctx.
+func ScopeParent(ctx context.Context, column, parentTable string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		id, ok := Organization(ctx)
+		if !ok {
+			if IsUnscoped(ctx) {
+				return db
+			}
+			return none(db)
+		}
+		return db.Where(column+" IN (?)", ParentIDs(db, id, parentTable))
+	}
+}
+
+// ParentIDs returns sub query selecting id of rows in table owned by organization id.
+func ParentIDs(db *gorm.DB, id raid.Raid, table string) *gorm.DB {
+	return db.
+		Session(&gorm.Session{NewDB: true}).
+		Table(table).
+		Select("id").
+		Where(Column+" = ?", id.String()).
+		Where("deleted_at IS NULL")
+}
+
+// Owns reports whether row with id in table is visible for organization of ctx,
+// it is always true when ctx is Unscoped and false when ctx is not scoped.
+func Owns(ctx context.Context, db *gorm.DB, table string, id raid.Raid) (bool, error) {
+	org, ok := Organization(ctx)
+	if !ok {
+		return IsUnscoped(ctx), nil
+	}
+	var count int64
+	err := db.
+		Session(&gorm.Session{NewDB: true}).
+		WithContext(ctx).
+		Table(table).
+		Where("id = ?", id.String()).
+		Where(Column+" = ?", org.String()).
+		Where("deleted_at IS NULL").
+		Count(&count).
+		Error
+	return count > 0, err
+}
@@ -0,0 +1,158 @@
+// package totp implements time based one time passwords (RFC 6238) used as
+// second login factor, along with single use recovery codes.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+var (
+	ErrInvalidCode = response.NewBadRequest(map[string]string{"code": "invalid"}, "authentication code is invalid")
+)
+
+const (
+	// Period and Digits are defaults of RFC 6238, the only ones supported by
+	// most authenticator apps.
+	Period = 30 * time.Second
+	Digits = 6
+	// modulo is 10^Digits.
+	modulo = 1000000
+	// Skew is number of periods before and after current time accepted, to
+	// tolerate clock drift of devices.
+	Skew = 1
+
+	secretSize = 20
+
+	// recoveryAlphabet omits characters easily confused when handwritten.
+	recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryLength   = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns random base32 secret.
+func NewSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+func decode(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// Counter returns time step of t.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+func hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, v%modulo)
+}
+
+// Code returns code of secret at t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, Counter(t)), nil
+}
+
+// Validate returns time step matched by code, code is accepted within Skew
+// periods of t. Callers must reject steps already used to prevent replay.
+func Validate(secret, code string, t time.Time) (counter int64, ok bool) {
+	key, err := decode(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	now := Counter(t)
+	for c := now - Skew; c <= now+Skew; c++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, c)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns otpauth uri of secret, it is shown as QR code to be scanned
+// by authenticator apps.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// HashRecoveryCode returns hash of recovery code stored instead of the code.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// NewRecoveryCodes returns n recovery codes and their hashes.
+func NewRecoveryCodes(n int) (codes, hashes []string, err error) {
+	max := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryLength)
+		for j := range b {
+			r, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryAlphabet[r.Int64()]
+		}
+		code := string(b[:recoveryLength/2]) + "-" + string(b[recoveryLength/2:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode returns hashes without hash of code, ok is false when code
+// is not one of hashes.
+func UseRecoveryCode(hashes []string, code string) (rest []string, ok bool) {
+	h := HashRecoveryCode(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(h)) == 1 {
+			rest = append(rest, hashes[:i]...)
+			return append(rest, hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		Time int64
+		Code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	} {
+		code, err := Code(secret, time.Unix(tc.Time, 0))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if code != tc.Code {
+			t.Errorf("expected code at %d to be %s, got %s", tc.Time, tc.Code, code)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	if _, ok := Validate(secret, "081804", now.Add(Period)); !ok {
+		t.Error("code of previous period must be accepted")
+	}
+	if _, ok := Validate(secret, "081804", now.Add(3*Period)); ok {
+		t.Error("code older than skew must be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	codes, hashes, err := NewRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	rest, ok := UseRecoveryCode(hashes, strings.ToUpper(codes[1]))
+	if !ok || len(rest) != 2 {
+		t.Fatalf("recovery code must be accepted once, got %v %v", ok, rest)
+	}
+	if _, ok := UseRecoveryCode(rest, codes[1]); ok {
+		t.Error("used recovery code must be rejected")
+	}
+}
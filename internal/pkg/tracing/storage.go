@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Storage records span of calls of wrapped storage, storage.Storage has no
+// context argument so only calls of storage returned by Bind are recorded.
+type Storage struct {
+	storage.Storage
+	Tracing *Tracing
+
+	ctx context.Context
+}
+
+var _ storage.Storage = new(Storage)
+
+// Bind returns s whose calls are recorded as children of span in ctx, s is
+// returned as is when it is not traced.
+func Bind(ctx context.Context, s storage.Storage) storage.Storage {
+	ts, ok := s.(*Storage)
+	if !ok || ts.Tracing == nil {
+		return s
+	}
+	bound := *ts
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *Storage) do(operation string, fn func() error) {
+	if s.ctx == nil {
+		_ = fn()
+		return
+	}
+	_, span, ok := s.Tracing.startChild(s.ctx, "storage."+operation, attribute.String("storage.operation", operation))
+	if !ok {
+		_ = fn()
+		return
+	}
+	defer span.End()
+	if err := fn(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (s *Storage) Get(key string) (b []byte, err error) {
+	s.do("get", func() error {
+		b, err = s.Storage.Get(key)
+		return err
+	})
+	return b, err
+}
+
+func (s *Storage) Set(key string, val []byte, exp time.Duration) (err error) {
+	s.do("set", func() error {
+		err = s.Storage.Set(key, val, exp)
+		return err
+	})
+	return err
+}
+
+func (s *Storage) Delete(key string) (err error) {
+	s.do("delete", func() error {
+		err = s.Storage.Delete(key)
+		return err
+	})
+	return err
+}
+
+func (s *Storage) Reset() (err error) {
+	s.do("reset", func() error {
+		err = s.Storage.Reset()
+		return err
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+// package tracing records OpenTelemetry spans from router through services
+// down to database queries and storage calls, spans are exported to OTLP
+// collector so slow requests can be broken down by layer.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/falentio/skul"
+
+type Options struct {
+	// Endpoint is host:port of OTLP/HTTP collector, e.g. "localhost:4318",
+	// tracing is disabled when empty.
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Insecure sends spans over plain http.
+	Insecure    bool   `yaml:"insecure" json:"insecure"`
+	ServiceName string `yaml:"service_name" json:"service_name"`
+	// SampleRatio is fraction of traces recorded, including traces continued
+	// from caller, see Sampler.
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio"`
+}
+
+// Tracing starts spans of this server, nil Tracing starts no spans so
+// services keep working without tracing in tests.
+type Tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New returns Tracing exporting to collector of o, it returns nil when
+// tracing is disabled.
+func New(o Options) (*Tracing, error) {
+	if o.Endpoint == "" {
+		return nil, nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint)}
+	if o.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exp, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	return NewWithExporter(exp, o.ServiceName, Sampler(o.SampleRatio), false), nil
+}
+
+// Sampler records ratio of traces, sampled flag of caller is ignored so
+// clients can not make every request recorded, spans within this server
+// follow decision of their parent.
+func Sampler(ratio float64) sdktrace.Sampler {
+	root := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(root,
+		sdktrace.WithRemoteParentSampled(root),
+		sdktrace.WithRemoteParentNotSampled(root),
+	)
+}
+
+// NewWithExporter returns Tracing exporting to exp, spans are exported as
+// soon as they end when sync is true, e.g. to tracetest.InMemoryExporter in
+// tests, otherwise they are batched.
+func NewWithExporter(exp sdktrace.SpanExporter, serviceName string, sampler sdktrace.Sampler, sync bool) *Tracing {
+	export := sdktrace.WithBatcher(exp)
+	if sync {
+		export = sdktrace.WithSyncer(exp)
+	}
+	provider := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentation),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// Shutdown exports remaining spans and stops t.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// Start starts span as child of span in ctx, span of ctx is returned as is
+// when t is nil.
+func (t *Tracing) Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startChild starts span only when ctx is already traced, so queries and
+// storage calls outside of request, e.g. migration, are not recorded as
+// traces of their own.
+func (t *Tracing) startChild(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span, bool) {
+	if t == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx, nil, false
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, span, true
+}
+
+// Middleware starts server span of every request, trace of caller is
+// continued when "traceparent" header is sent. Trace id is added to logger
+// of request, so it must be used after logging.AccessLog.
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+			),
+		)
+		defer span.End()
+		if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled && span.SpanContext().IsValid() {
+			l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("trace_id", span.SpanContext().TraceID().String())
+			})
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rc.RoutePattern())
+			span.SetAttributes(semconv.HTTPRouteKey.String(rc.RoutePattern()))
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofiber/storage/memory"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+)
+
+type row struct {
+	ID   int
+	Name string
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+	exp := tracetest.NewInMemoryExporter()
+	tr := NewWithExporter(exp, "skul", sdktrace.AlwaysSample(), true)
+
+	db, err := gorm.Open(sqlite.Open("file:tracing?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.Use(&GormPlugin{Tracing: tr}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := len(exp.GetSpans()); n != 0 {
+		t.Fatalf("expected queries outside of request to not be traced, got %d spans", n)
+	}
+	s := &Storage{Storage: memory.New(), Tracing: tr}
+
+	r := chi.NewRouter()
+	r.Use(tr.Middleware)
+	r.Post("/student/{studentID}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tr.Start(r.Context(), "StudentService.CreateStudent")
+		defer span.End()
+		if err := db.WithContext(ctx).Create(&row{Name: "a"}).Error; err != nil {
+			t.Error(err.Error())
+		}
+		_ = Bind(ctx, s).Set("key", []byte("value"), 0)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/student/stu-1", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	_ = s.Set("unbound", []byte("value"), 0)
+
+	spans := exp.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d: %v", len(spans), byName)
+	}
+	server, ok := byName["POST /student/{studentID}"]
+	if !ok {
+		t.Fatalf("expected server span to be named by route, got %v", byName)
+	}
+	if got := server.SpanContext.TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected trace of caller to be continued, got %s", got)
+	}
+	if server.Status.Code.String() != "Error" {
+		t.Errorf("expected 5xx response to mark span as error, got %s", server.Status.Code)
+	}
+	service := byName["StudentService.CreateStudent"]
+	if service.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("expected service span to be child of server span")
+	}
+	for _, name := range []string{"gorm.create", "storage.set"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Errorf("expected %s span", name)
+			continue
+		}
+		if span.Parent.SpanID() != service.SpanContext.SpanID() {
+			t.Errorf("expected %s span to be child of service span", name)
+		}
+	}
+
+	var nilTracing *Tracing
+	ctx, span := nilTracing.Start(context.Background(), "noop")
+	span.End()
+	if ctx != context.Background() {
+		t.Error("expected nil Tracing to return context as is")
+	}
+	if err := nilTracing.Shutdown(context.Background()); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+	exp := tracetest.NewInMemoryExporter()
+	tr := NewWithExporter(exp, "skul", Sampler(0), true)
+
+	r := chi.NewRouter()
+	r.Use(tr.Middleware)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := len(exp.GetSpans()); n != 0 {
+		t.Errorf("expected sampled flag of caller to be ignored, got %d spans", n)
+	}
+}
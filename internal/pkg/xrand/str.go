@@ -11,6 +11,8 @@ const (
 	lowercase = "abcdefghijklmnopqrstuvwxyz"
 	uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	number    = "1234567890"
+	// code leaves out characters easily mistaken for each other, e.g. 0 and O
+	code = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
 )
 
 var Smol = &SmolRand{}
@@ -53,3 +55,12 @@ func (sr *SmolRand) GeneratePassword(l int) string {
 	})
 	return string(res)
 }
+
+// GenerateCode returns code of length l which is easy to read and type.
+func (sr *SmolRand) GenerateCode(l int) string {
+	res := make([]byte, l)
+	for i := range res {
+		res[i] = code[sr.Rand.Intn(len(code))]
+	}
+	return string(res)
+}
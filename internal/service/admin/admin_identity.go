@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+// authenticate returns admin whose credentials are sent, local password is
+// checked first then s.Providers. failed reports whether credentials of
+// existing admin were wrong, failures of unknown usernames are not counted.
+func (s *AdminService) authenticate(ctx context.Context, admin *domain.Admin) (a *domain.Admin, failed bool, err error) {
+	if admin.Username != "" {
+		a, err = s.AdminRepository.GetAdminByUsername(ctx, admin.Username)
+		if err != nil && !errors.Is(err, domain.ErrAdminNotFound) {
+			return nil, false, err
+		}
+	}
+	if a != nil && admin.Provider == "" && admin.Code == "" &&
+		bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(admin.Password)) == nil {
+		return a, false, nil
+	}
+
+	if len(s.Providers) == 0 {
+		if a == nil {
+			return nil, false, response.NewBadRequest(nil, "can not find admin with username %q", admin.Username)
+		}
+		return nil, true, response.NewBadRequest(map[string]string{"password": "not match"}, "failed to login to user with username %q", admin.Username)
+	}
+
+	p, id, err := identity.Authenticate(ctx, s.Providers, admin.Provider, &identity.Credentials{
+		Username:    admin.Username,
+		Password:    admin.Password,
+		Code:        admin.Code,
+		State:       admin.State,
+		RedirectURI: admin.RedirectURI,
+	})
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		return nil, false, response.NewBadRequest(map[string]string{"provider": "unknown"}, "unknown identity provider %q", admin.Provider)
+	}
+	if errors.Is(err, identity.ErrInvalidCredentials) {
+		return nil, a != nil, response.NewBadRequest(map[string]string{"password": "not match"}, "failed to login to user with username %q", admin.Username)
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("provider", admin.Provider).Msg("failed to authenticate admin with identity provider")
+		return nil, false, response.NewError(nil, "identity provider is unavailable", http.StatusBadGateway)
+	}
+
+	// provider of organization only logs in admins of its organization
+	if !p.Organization.IsNil() {
+		ctx = tenant.WithOrganization(ctx, p.Organization)
+	}
+	if id.Subject == "" {
+		return nil, false, response.NewBadRequest(nil, "identity provider %q did not return subject", p.Name())
+	}
+	// admins are matched by subject, username of provider may be changed and
+	// then taken by other account
+	a, err = s.AdminRepository.GetAdminByIdentity(ctx, p.Name(), id.Subject)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		a, err = s.link(ctx, p, id)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !p.Organization.IsNil() && a.OrganizationID != p.Organization {
+		return nil, false, response.NewForbidden(nil, "admin %q does not belong to identity provider %q", id.Username, p.Name())
+	}
+	return a, false, nil
+}
+
+// link links existing admin with username of identity on its first login
+// with p, only admins not linked yet are linked. Staff role is granted in
+// skul, so admins are never provisioned. Organization of provider not bound
+// to organization is sent by client, so such provider never links admins.
+func (s *AdminService) link(ctx context.Context, p *identity.Provider, id *identity.Identity) (*domain.Admin, error) {
+	if p.Organization.IsNil() {
+		return nil, response.NewForbidden(nil, "identity provider %q is not bound to organization, it can not link admin %q", p.Name(), id.Username)
+	}
+	if id.Username == "" {
+		return nil, response.NewBadRequest(nil, "identity provider %q did not return username", p.Name())
+	}
+	a, err := s.AdminRepository.GetAdminByUsername(ctx, id.Username)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewBadRequest(nil, "can not find admin with username %q", id.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.IdentitySubject != nil {
+		return nil, response.NewForbidden(nil, "admin %q is linked to other account of identity provider", id.Username)
+	}
+	if err := s.AdminRepository.LinkAdminIdentity(ctx, a.ID, p.Name(), id.Subject); err != nil {
+		return nil, err
+	}
+	logging.Ctx(ctx, s.Logger).Info().
+		Str("provider", p.Name()).
+		Str("admin", a.ID.String()).
+		Msg("linked admin to identity provider")
+	return a, nil
+}
+
+// AuthorizeAdmin starts log in of admin with OIDC provider, admin is
+// redirected to returned url and client sends back its code and state.
+func (s *AdminService) AuthorizeAdmin(ctx context.Context, provider, redirectURI string) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.AuthorizeAdmin")
+	defer span.End()
+
+	if redirectURI == "" {
+		err = response.NewBadRequest(map[string]string{"redirectURI": "required"}, "redirect uri is required")
+		return
+	}
+	a, err := identity.Authorize(ctx, s.Providers, provider, redirectURI)
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		err = response.NewBadRequest(map[string]string{"provider": "unknown"}, "unknown identity provider %q", provider)
+		return
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("provider", provider).Msg("failed to authorize admin with identity provider")
+		err = response.NewError(nil, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	res = response.NewOK(a)
+	return
+}
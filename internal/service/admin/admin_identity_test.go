@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+// fakeAuthenticator accepts password "secret" of every username, subject is
+// prefixed username.
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Name() string {
+	return "directory"
+}
+
+func (fakeAuthenticator) Authenticate(ctx context.Context, c *identity.Credentials) (*identity.Identity, error) {
+	if c.Password != "secret" {
+		return nil, identity.ErrInvalidCredentials
+	}
+	return &identity.Identity{Provider: "directory", Subject: "sub-" + c.Username, Username: c.Username}, nil
+}
+
+func TestLinkAdminIdentity(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:admin_identity?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Examination{}, &domain.Student{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	admin := &domain.Admin{Username: "admin", Role: domain.RoleSuperAdmin}
+	admin.ID = AdminIDFactory.WithRandom().WithTimestampNow()
+	admin.OrganizationID = raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatal("failed to create admin", err)
+	}
+	linked := func() bool {
+		stored := &domain.Admin{}
+		if err := db.First(stored, "id = ?", admin.ID.String()).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		return stored.IdentitySubject != nil
+	}
+
+	repo := &AdminRepositoryGorm{db}
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	login := &domain.Admin{Username: "admin", Password: "secret", OrganizationID: admin.OrganizationID}
+
+	unbound := &AdminService{AdminRepository: repo, Auth: a, Providers: []*identity.Provider{{Authenticator: fakeAuthenticator{}}}}
+	if _, err := unbound.LoginAdmin(context.Background(), login); err == nil {
+		t.Error("provider not bound to organization must not link admin of organization sent by client")
+	}
+	if linked() {
+		t.Fatal("admin must not be linked by provider not bound to organization")
+	}
+
+	bound := &AdminService{AdminRepository: repo, Auth: a, Providers: []*identity.Provider{{Authenticator: fakeAuthenticator{}, Organization: admin.OrganizationID}}}
+	if _, err := bound.LoginAdmin(context.Background(), &domain.Admin{Username: "admin", Password: "secret"}); err != nil {
+		t.Fatal("failed to log in with provider of organization", err)
+	}
+	if !linked() {
+		t.Error("admin must be linked by provider of its organization")
+	}
+	if a, err := repo.GetAdminByIdentity(tenant.WithOrganization(context.Background(), admin.OrganizationID), "directory", "sub-admin"); err != nil || a.ID != admin.ID {
+		t.Errorf("expected linked admin to be found by identity, got %v", err)
+	}
+}
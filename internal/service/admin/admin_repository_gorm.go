@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.AdminRepository = new(AdminRepositoryGorm)
@@ -18,6 +19,7 @@ type AdminRepositoryGorm struct {
 }
 
 func (r *AdminRepositoryGorm) CreateAdmin(ctx context.Context, admin *domain.Admin) error {
+	tenant.Assign(ctx, &admin.OrganizationID)
 	err := r.DB.
 		WithContext(ctx).
 		Omit("Examinations").
@@ -34,6 +36,7 @@ func (r *AdminRepositoryGorm) GetAdminByID(ctx context.Context, adminID raid.Rai
 	admin := &domain.Admin{Model: domain.Model{ID: adminID}}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
 		Preload("Examinations", func(db *gorm.DB) *gorm.DB {
 			return db.Limit(10)
 		}).
@@ -55,6 +58,7 @@ func (r *AdminRepositoryGorm) GetAdminByUsername(ctx context.Context, username s
 	admin := &domain.Admin{}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
 		Preload("Examinations", func(db *gorm.DB) *gorm.DB {
 			return db.Limit(10)
 		}).
@@ -72,21 +76,123 @@ func (r *AdminRepositoryGorm) GetAdminByUsername(ctx context.Context, username s
 	return admin, err
 }
 
-func (r *AdminRepositoryGorm) DeleteAdmin(ctx context.Context, adminID raid.Raid) error {
+func (r *AdminRepositoryGorm) GetAdminByIdentity(ctx context.Context, provider, subject string) (*domain.Admin, error) {
+	admin := &domain.Admin{}
 	err := r.DB.
 		WithContext(ctx).
-		Delete(&domain.Admin{Model: domain.Model{ID: adminID}}).
+		Scopes(tenant.Scope(ctx)).
+		First(admin, "identity_provider = ? AND identity_subject = ?", provider, subject).
 		Error
-	return err
+	if err != nil {
+		admin = nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domain.ErrAdminNotFound
+	}
+	return admin, err
 }
 
-func (r *AdminRepositoryGorm) UpdateAdmin(ctx context.Context, admin *domain.Admin) error {
-	err := r.DB.
+func (r *AdminRepositoryGorm) ListAdmin(ctx context.Context, o *domain.ListAdminOptions) ([]*domain.Admin, error) {
+	admins := make([]*domain.Admin, 0)
+	db := r.DB.
 		WithContext(ctx).
-		Updates(admin).
+		Model(&domain.Admin{}).
+		Scopes(tenant.Scope(ctx))
+	if o.Role != "" {
+		db = db.Where("role = ?", o.Role)
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
+		Offset(o.Offset).
+		Find(&admins).
 		Error
+	if err != nil {
+		admins = nil
+	}
+	return admins, err
+}
+
+func (r *AdminRepositoryGorm) DeleteAdmin(ctx context.Context, adminID raid.Raid) error {
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		Delete(&domain.Admin{Model: domain.Model{ID: adminID}})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrAdminNotFound
+	}
+	return res.Error
+}
+
+func (r *AdminRepositoryGorm) UpdateAdmin(ctx context.Context, admin *domain.Admin) error {
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		// credentials are only written by UpdateAdminPassword, UpdateAdminTOTP
+		// and LinkAdminIdentity, struct updates would skip clearing them anyway
+		Omit("OrganizationID", "PasswordHash", "MustChangePassword", "TOTPSecret", "TOTPEnabled", "TOTPRecovery", "IdentityProvider", "IdentitySubject").
+		Updates(admin)
+	err := res.Error
 	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
 		return domain.ErrAdminConflict
 	}
+	if err == nil && res.RowsAffected == 0 {
+		return domain.ErrAdminNotFound
+	}
+	return err
+}
+
+func (r *AdminRepositoryGorm) UpdateAdminPassword(ctx context.Context, adminID raid.Raid, passwordHash string, mustChange bool) error {
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.Admin{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id = ?", adminID.String()).
+		Updates(map[string]any{
+			"password_hash":        passwordHash,
+			"must_change_password": mustChange,
+		})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrAdminNotFound
+	}
+	return res.Error
+}
+
+func (r *AdminRepositoryGorm) UpdateAdminTOTP(ctx context.Context, adminID raid.Raid, secret string, enabled bool, recovery string) error {
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.Admin{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id = ?", adminID.String()).
+		Updates(map[string]any{
+			"totp_secret":   secret,
+			"totp_enabled":  enabled,
+			"totp_recovery": recovery,
+		})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrAdminNotFound
+	}
+	return res.Error
+}
+
+func (r *AdminRepositoryGorm) LinkAdminIdentity(ctx context.Context, adminID raid.Raid, provider, subject string) error {
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.Admin{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id = ?", adminID.String()).
+		Updates(map[string]any{
+			"identity_provider": provider,
+			"identity_subject":  subject,
+		})
+	err := res.Error
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
+		return domain.ErrAdminConflict
+	}
+	if err == nil && res.RowsAffected == 0 {
+		return domain.ErrAdminNotFound
+	}
 	return err
 }
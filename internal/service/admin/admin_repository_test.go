@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 func TestAdminRepository(t *testing.T) {
@@ -29,25 +30,27 @@ func TestAdminRepository(t *testing.T) {
 	} {
 		tc := tc
 		t.Run(tc.Name, func(t *testing.T) {
-			admin1 := &domain.Admin{Model: domain.Model{ID: raid.NewRaid()}, Username: "foo"}
-			err := tc.Repo.CreateAdmin(context.Background(), admin1)
+			orgID := raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+			ctx := tenant.WithOrganization(context.Background(), orgID)
+			admin1 := &domain.Admin{Model: domain.Model{ID: raid.NewRaid()}, OrganizationID: orgID, Username: "foo"}
+			err := tc.Repo.CreateAdmin(ctx, admin1)
 			if err != nil {
 				t.Error("failed to create admin", err)
 			}
 
-			admin2 := &domain.Admin{Model: domain.Model{ID: raid.NewRaid()}, Username: "foo"}
-			err = tc.Repo.CreateAdmin(context.Background(), admin2)
+			admin2 := &domain.Admin{Model: domain.Model{ID: raid.NewRaid()}, OrganizationID: orgID, Username: "foo"}
+			err = tc.Repo.CreateAdmin(ctx, admin2)
 			if err == nil || err != domain.ErrAdminConflict {
 				t.Errorf("%#+v", err)
 				t.Error("CreateAdmin must return domain.ErrAdminConflict while creating with existing data")
 			}
 			admin2.Username = "bar"
-			err = tc.Repo.CreateAdmin(context.Background(), admin2)
+			err = tc.Repo.CreateAdmin(ctx, admin2)
 			if err != nil {
 				t.Error("failed to create admin", err)
 			}
 
-			storedAdmin, err := tc.Repo.GetAdminByID(context.Background(), admin1.ID)
+			storedAdmin, err := tc.Repo.GetAdminByID(ctx, admin1.ID)
 			if err != nil {
 				t.Error("failed to get admin", err)
 			}
@@ -55,7 +58,7 @@ func TestAdminRepository(t *testing.T) {
 				t.Errorf("invalid admin data returned, username changed from %s to %s", admin1.Username, storedAdmin.Username)
 			}
 
-			storedAdmin, err = tc.Repo.GetAdminByUsername(context.Background(), admin1.Username)
+			storedAdmin, err = tc.Repo.GetAdminByUsername(ctx, admin1.Username)
 			if err != nil {
 				t.Error("failed to get admin", err)
 			}
@@ -63,12 +66,12 @@ func TestAdminRepository(t *testing.T) {
 				t.Errorf("invalid admin data returned, username changed from %s to %s", admin1.Username, storedAdmin.Username)
 			}
 
-			err = tc.Repo.UpdateAdmin(context.Background(), &domain.Admin{Model: domain.Model{ID: admin1.ID}, Username: "baz"})
+			err = tc.Repo.UpdateAdmin(ctx, &domain.Admin{Model: domain.Model{ID: admin1.ID}, Username: "baz"})
 			if err != nil {
 				t.Error("failed to update admin", err)
 			}
 
-			storedAdmin, err = tc.Repo.GetAdminByID(context.Background(), admin1.ID)
+			storedAdmin, err = tc.Repo.GetAdminByID(ctx, admin1.ID)
 			if err != nil {
 				t.Error("failed to get admin", err)
 			}
@@ -76,12 +79,12 @@ func TestAdminRepository(t *testing.T) {
 				t.Errorf("invalid admin data returned, username changed from %s to %s", admin1.Username, storedAdmin.Username)
 			}
 
-			err = tc.Repo.DeleteAdmin(context.Background(), admin1.ID)
+			err = tc.Repo.DeleteAdmin(ctx, admin1.ID)
 			if err != nil {
 				t.Error("failed to delete admin", err)
 			}
 
-			storedAdmin, err = tc.Repo.GetAdminByID(context.Background(), admin1.ID)
+			storedAdmin, err = tc.Repo.GetAdminByID(ctx, admin1.ID)
 			if err == nil {
 				t.Error("failed to delete admin")
 			}
@@ -92,7 +95,7 @@ func TestAdminRepository(t *testing.T) {
 				t.Error("GetAdminByID must return nil admin if error")
 			}
 
-			storedAdmin, err = tc.Repo.GetAdminByID(context.Background(), raid.NilRaid)
+			storedAdmin, err = tc.Repo.GetAdminByID(ctx, raid.NilRaid)
 			if err == nil {
 				t.Error("error not returned while getting unexists admin ID")
 			}
@@ -105,3 +108,59 @@ func TestAdminRepository(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminRepositoryTenant(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:admin_tenant?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Examination{}, &domain.Student{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	repo := &AdminRepositoryGorm{db}
+	orgA := tenant.WithOrganization(context.Background(), raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom())
+	orgB := tenant.WithOrganization(context.Background(), raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom())
+
+	admin := &domain.Admin{Model: domain.Model{ID: AdminIDFactory.WithRandom()}, Username: "tenant-a"}
+	if err := repo.CreateAdmin(orgA, admin); err != nil {
+		t.Fatal("failed to create admin", err)
+	}
+
+	if _, err := repo.GetAdminByID(orgB, admin.ID); err != domain.ErrAdminNotFound {
+		t.Error("GetAdminByID must return domain.ErrAdminNotFound for admin of other organization")
+	}
+	if _, err := repo.GetAdminByUsername(orgB, admin.Username); err != domain.ErrAdminNotFound {
+		t.Error("GetAdminByUsername must return domain.ErrAdminNotFound for admin of other organization")
+	}
+	if admins, err := repo.ListAdmin(orgB, &domain.ListAdminOptions{}); err != nil || len(admins) != 0 {
+		t.Errorf("ListAdmin must not return admin of other organization, got %d admins, err %v", len(admins), err)
+	}
+	if err := repo.UpdateAdmin(orgB, &domain.Admin{Model: domain.Model{ID: admin.ID}, Name: "hijacked"}); err != domain.ErrAdminNotFound {
+		t.Error("UpdateAdmin must return domain.ErrAdminNotFound for admin of other organization")
+	}
+	if err := repo.DeleteAdmin(orgB, admin.ID); err != domain.ErrAdminNotFound {
+		t.Error("DeleteAdmin must return domain.ErrAdminNotFound for admin of other organization")
+	}
+	if _, err := repo.GetAdminByID(context.Background(), admin.ID); err != domain.ErrAdminNotFound {
+		t.Error("GetAdminByID must return domain.ErrAdminNotFound without organization")
+	}
+	if _, err := repo.GetAdminByID(tenant.Unscoped(context.Background()), admin.ID); err != nil {
+		t.Error("GetAdminByID must return admin of any organization when explicitly unscoped", err)
+	}
+	if err := repo.CreateAdmin(orgB, &domain.Admin{Model: domain.Model{ID: AdminIDFactory.WithRandom()}, Username: admin.Username}); err != nil {
+		t.Error("username must be unique per organization only", err)
+	}
+
+	stored, err := repo.GetAdminByID(orgA, admin.ID)
+	if err != nil {
+		t.Fatal("failed to get admin", err)
+	}
+	if stored.Name == "hijacked" {
+		t.Error("admin was updated by other organization")
+	}
+	if admins, err := repo.ListAdmin(orgA, &domain.ListAdminOptions{}); err != nil || len(admins) != 1 {
+		t.Errorf("ListAdmin must return admin of own organization, got %d admins, err %v", len(admins), err)
+	}
+}
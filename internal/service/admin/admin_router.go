@@ -5,32 +5,61 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/falentio/raid-go"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
+	"github.com/falentio/skul/internal/pkg/loginguard"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
 type AdminRouter struct {
 	AdminService domain.AdminService
 	Auth         *auth.Auth
+	Idempotency  *idempotency.Idempotency
+	Guard        *loginguard.Guard
 }
 
 func (ar *AdminRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
-		r.Use(httprate.LimitByIP(5, time.Minute))
-		r.Post("/", ar.CreateAdmin)
+		r.Use(ar.Guard.Limit(5, time.Minute))
 		r.Post("/login", ar.LoginAdmin)
+		r.Get("/login/{provider}", ar.AuthorizeAdmin)
+		r.Post("/password/reset", ar.RedeemAdminPassword)
+		r.Post("/login/totp", ar.VerifyAdminTOTP)
 	})
 	r.Group(func(r chi.Router) {
 		r.Use(ar.Auth.VerifyMiddleware)
 		r.Use(middleware.NoCache)
 		r.Get("/info", ar.GetAdminByID)
+	})
+	r.Group(func(r chi.Router) {
+		// account itself is only managed by signed in admin, api token
+		// scopes only limit permissions checked by (*auth.Auth).Authorize
+		r.Use(ar.Auth.VerifyMiddleware)
+		r.Use(ar.Auth.RequireSession)
+		r.Use(middleware.NoCache)
 		r.Put("/info", ar.UpdateAdmin)
 		r.Delete("/info", ar.DeleteAdmin)
+		r.Put("/password", ar.ChangeAdminPassword)
+		r.Post("/totp", ar.EnrollAdminTOTP)
+		r.Post("/totp/confirm", ar.ConfirmAdminTOTP)
+		r.Delete("/totp", ar.DisableAdminTOTP)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(ar.Auth.VerifyMiddleware)
+		r.Use(ar.Auth.RequirePermission(domain.PermissionAdminManage))
+		r.Use(middleware.NoCache)
+		r.With(ar.Idempotency.Redact("password")).Post("/", ar.CreateAdmin)
+		r.Get("/list", ar.ListAdmin)
+		r.Put("/{adminID}", ar.UpdateOtherAdmin)
+		r.Delete("/{adminID}", ar.DeleteOtherAdmin)
+		r.Post("/{adminID}/password/reset", ar.ResetAdminPassword)
+		r.Post("/{adminID}/totp/reset", ar.ResetAdminTOTP)
+		r.Get("/lockouts", ar.ListLockout)
 	})
 }
 
@@ -69,6 +98,19 @@ func (ar *AdminRouter) LoginAdmin(w http.ResponseWriter, r *http.Request) {
 	res.ServeHTTP(w, r)
 }
 
+func (ar *AdminRouter) AuthorizeAdmin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	redirectURI := r.URL.Query().Get("redirectURI")
+
+	res, err := ar.AdminService.AuthorizeAdmin(r.Context(), provider, redirectURI)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
 func (ar *AdminRouter) GetAdminByID(w http.ResponseWriter, r *http.Request) {
 	adminID, err := ar.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
 	if err != nil {
@@ -124,3 +166,205 @@ func (ar *AdminRouter) DeleteAdmin(w http.ResponseWriter, r *http.Request) {
 
 	res.ServeHTTP(w, r)
 }
+
+func (ar *AdminRouter) ListAdmin(w http.ResponseWriter, r *http.Request) {
+	o := &domain.ListAdminOptions{}
+	if err := o.PageFromQuery(r.URL.Query()); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+	o.Role = domain.Role(r.URL.Query().Get("role"))
+
+	res, err := ar.AdminService.ListAdmin(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) UpdateOtherAdmin(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "adminID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid adminID received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	admin := &domain.Admin{}
+	if err := json.NewDecoder(r.Body).Decode(admin); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+	admin.ID = id
+
+	res, err := ar.AdminService.UpdateAdmin(r.Context(), admin)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) DeleteOtherAdmin(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "adminID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid adminID received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.DeleteAdmin(r.Context(), id)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) ChangeAdminPassword(w http.ResponseWriter, r *http.Request) {
+	c := &domain.ChangePassword{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.ChangeAdminPassword(r.Context(), c)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) ResetAdminPassword(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "adminID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid admin id, received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.ResetAdminPassword(r.Context(), id)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) RedeemAdminPassword(w http.ResponseWriter, r *http.Request) {
+	reset := &domain.ResetPassword{}
+	if err := json.NewDecoder(r.Body).Decode(reset); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.RedeemAdminPassword(r.Context(), reset)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) ListLockout(w http.ResponseWriter, r *http.Request) {
+	res, err := ar.AdminService.ListLockout(r.Context())
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) VerifyAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	l := &domain.TOTPLogin{}
+	if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.VerifyAdminTOTP(r.Context(), l)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) EnrollAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	res, err := ar.AdminService.EnrollAdminTOTP(r.Context())
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) ConfirmAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	c := &domain.TOTPCode{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.ConfirmAdminTOTP(r.Context(), c)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) DisableAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	c := &domain.TOTPCode{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.DisableAdminTOTP(r.Context(), c)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *AdminRouter) ResetAdminTOTP(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "adminID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid admin id, received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AdminService.ResetAdminTOTP(r.Context(), id)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
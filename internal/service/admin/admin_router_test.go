@@ -1 +1,112 @@
 package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+// fakeTokens verifies api tokens of admin by their name.
+type fakeTokens map[string]*auth.Claims
+
+func (f fakeTokens) VerifyAPIToken(ctx context.Context, token string) (*auth.Claims, error) {
+	c, ok := f[token]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	claims := *c
+	return &claims, nil
+}
+
+func TestAdminSelfService(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:admin_self_service?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Examination{}, &domain.Student{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	admin := &domain.Admin{Username: "foo", PasswordHash: string(hash), Role: domain.RoleSuperAdmin}
+	admin.ID = AdminIDFactory.WithRandom().WithTimestampNow()
+	admin.OrganizationID = raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatal("failed to create admin", err)
+	}
+
+	claims := func(scopes ...domain.Permission) *auth.Claims {
+		return &auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: admin.ID.String()},
+			Role:             admin.Role,
+			Organization:     admin.OrganizationID.String(),
+			Scopes:           scopes,
+		}
+	}
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	a.Tokens = fakeTokens{
+		"read":   claims(domain.PermissionStudentRead),
+		"manage": claims(domain.PermissionAdminManage),
+	}
+	service := &AdminService{AdminRepository: &AdminRepositoryGorm{db}, Auth: a}
+	r := chi.NewRouter()
+	r.Route("/admin", (&AdminRouter{AdminService: service, Auth: a}).Route)
+
+	call := func(method, path, token string, body any) int {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	unchanged := func(t *testing.T) {
+		stored := &domain.Admin{}
+		if err := db.First(stored, "id = ?", admin.ID.String()).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte("password")) != nil {
+			t.Error("password of admin must not be changed by api token")
+		}
+	}
+
+	if code := call(http.MethodPut, "/admin/info", "read", map[string]any{"id": admin.ID, "password": "taken-over"}); code != http.StatusForbidden {
+		t.Errorf("expected scoped api token to be refused updating its admin, got %d", code)
+	}
+	if code := call(http.MethodPut, "/admin/password", "read", &domain.ChangePassword{OldPassword: "password", NewPassword: "taken-over"}); code != http.StatusForbidden {
+		t.Errorf("expected scoped api token to be refused changing password, got %d", code)
+	}
+	if code := call(http.MethodPost, "/admin/totp", "read", nil); code != http.StatusForbidden {
+		t.Errorf("expected scoped api token to be refused enrolling totp, got %d", code)
+	}
+	if code := call(http.MethodPut, "/admin/"+admin.ID.String(), "manage", map[string]any{"password": "taken-over"}); code != http.StatusForbidden {
+		t.Errorf("expected api token to be refused updating its own admin, got %d", code)
+	}
+	unchanged(t)
+
+	session, err := a.Sign(*claims())
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	req := httptest.NewRequest(http.MethodPut, "/admin/info", bytes.NewReader([]byte(`{"name":"Foo"}`)))
+	req.AddCookie(session)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected session to update its admin, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -3,16 +3,26 @@ package admin
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/password"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
+	"github.com/falentio/skul/internal/pkg/xrand"
 )
 
 var AdminIDFactory = raid.NewRaid().WithPrefix(domain.AdminIDPrefix)
@@ -21,24 +31,63 @@ var _ domain.AdminService = new(AdminService)
 type AdminService struct {
 	AdminRepository domain.AdminRepository
 	Auth            *auth.Auth
+	Tracing         *tracing.Tracing
 	Logger          zerolog.Logger
+	PasswordPolicy  password.Policy
+	Resetter        *password.Resetter
+	Guard           *loginguard.Guard
+	Audit           *audit.Recorder
+
+	// Storage keeps pending second login steps and used TOTP codes.
+	Storage storage.Storage
+	totpMu  sync.Mutex
+	// TOTPIssuer names this server in authenticator apps.
+	TOTPIssuer string
+	// Providers verify admins without matching local password, in order,
+	// admins are never provisioned by them.
+	Providers []*identity.Provider
+	// Organization is organization of admins logging in without sending
+	// their organization.
+	Organization raid.Raid
 }
 
 func (s *AdminService) CreateAdmin(ctx context.Context, admin *domain.Admin) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.CreateAdmin")
+	defer span.End()
+
+	_, err = s.Auth.Authorize(ctx, domain.PermissionAdminManage)
+	if err != nil {
+		return
+	}
+
 	admin.ID = AdminIDFactory.WithRandom().WithTimestampNow()
 	admin.Students = nil
 	admin.Examinations = nil
+	admin.TOTPEnabled = false
+	if admin.Role == "" {
+		admin.Role = domain.RoleTeacher
+	}
 
 	err = validator.Struct(admin)
 	if err != nil {
 		return
 	}
+	// generated password is returned once and must be changed on first login
+	admin.MustChangePassword = admin.Password == ""
+	if admin.MustChangePassword {
+		admin.Password = xrand.Smol.GeneratePassword(12)
+	} else if err = s.PasswordPolicy.Validate(admin.Password); err != nil {
+		return
+	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return
 	}
 	admin.PasswordHash = string(hash)
+	if !admin.MustChangePassword {
+		admin.Password = ""
+	}
 
 	err = s.AdminRepository.CreateAdmin(ctx, admin)
 	if errors.Is(err, domain.ErrAdminConflict) {
@@ -47,36 +96,106 @@ func (s *AdminService) CreateAdmin(ctx context.Context, admin *domain.Admin) (re
 	if err != nil {
 		return
 	}
+	if err = s.Audit.Record(ctx, domain.AuditAdminCreate, admin.ID, nil, admin); err != nil {
+		return
+	}
 
 	res = response.NewCreated(admin)
 	return
 }
 
 func (s *AdminService) LoginAdmin(ctx context.Context, admin *domain.Admin) (res response.Response, err error) {
-	a, err := s.AdminRepository.GetAdminByUsername(ctx, admin.Username)
-	if errors.Is(err, domain.ErrAdminNotFound) {
-		err = response.NewBadRequest(nil, "can not find admin with username %q", admin.Username)
+	ctx, span := s.Tracing.Start(ctx, "AdminService.LoginAdmin")
+	defer span.End()
+
+	// authorization code logins have no username to count failures of, codes
+	// are not guessable anyway
+	account := ""
+	if admin.Username != "" {
+		account = loginguard.Account("admin", admin.Username)
 	}
-	if err != nil {
+	ctx = tenant.WithOrganizationOr(ctx, admin.OrganizationID, s.Organization)
+	if err = s.Guard.Check(ctx, account); err != nil {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(admin.Password))
+	a, failed, err := s.authenticate(ctx, admin)
+	if failed {
+		s.fail(ctx, account)
+	}
 	if err != nil {
-		err = response.NewBadRequest(map[string]string{"password": "not match"}, "failed to login to user with username %q", admin.Username)
+		return
+	}
+	// code login is checked against account it resolved to, so locked admin
+	// can not log in with code instead
+	if account == "" {
+		ctx = tenant.WithOrganization(ctx, a.OrganizationID)
+		account = loginguard.Account("admin", a.Username)
+		if err = s.Guard.Check(ctx, account); err != nil {
+			return
+		}
+	}
+	// second factor is required before session is issued
+	if a.TOTPEnabled {
+		return s.challenge(ctx, a)
+	}
+	if err = s.Guard.Succeed(ctx, account); err != nil {
 		return
 	}
 
-	c, err := s.Auth.Sign(jwt.RegisteredClaims{
-		Subject: a.ID.String(),
+	return s.sign(a)
+}
+
+// sign issues session cookie of a.
+func (s *AdminService) sign(a *domain.Admin) (response.Response, error) {
+	c, err := s.Auth.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: a.ID.String(),
+		},
+		Role:               a.Role,
+		Organization:       a.OrganizationID.String(),
+		MustChangePassword: a.MustChangePassword,
 	})
+	if err != nil {
+		return nil, err
+	}
 	r := response.NewNoContent()
 	r.Cookies = append(r.Cookies, c)
 
 	return r, nil
 }
 
+func (s *AdminService) fail(ctx context.Context, account string) {
+	if account == "" {
+		return
+	}
+	if err := s.Guard.Fail(ctx, account); err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("account", account).Msg("failed to record failed login")
+	}
+}
+
+// ListLockout returns latest accounts locked after too many failed logins.
+func (s *AdminService) ListLockout(ctx context.Context) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ListLockout")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionAdminManage); err != nil {
+		return
+	}
+
+	events, err := s.Guard.Events(ctx)
+	if err != nil {
+		return
+	}
+
+	res = response.NewOK(events)
+	return
+}
+
 func (s *AdminService) GetAdminByID(ctx context.Context, adminID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.GetAdminByID")
+	defer span.End()
+
 	admin, err := s.AdminRepository.GetAdminByID(ctx, adminID)
 	if err == domain.ErrAdminNotFound {
 		err = response.NewNotFound(nil, "can not find admin with id %q", adminID.String())
@@ -91,6 +210,9 @@ func (s *AdminService) GetAdminByID(ctx context.Context, adminID raid.Raid) (res
 }
 
 func (s *AdminService) GetAdminByUsername(ctx context.Context, username string) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.GetAdminByUsername")
+	defer span.End()
+
 	admin, err := s.AdminRepository.GetAdminByUsername(ctx, username)
 	if err == domain.ErrAdminNotFound {
 		err = response.NewNotFound(nil, "can not find admin with username %q", username)
@@ -104,7 +226,50 @@ func (s *AdminService) GetAdminByUsername(ctx context.Context, username string)
 	return
 }
 
+func (s *AdminService) ListAdmin(ctx context.Context, o *domain.ListAdminOptions) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ListAdmin")
+	defer span.End()
+
+	_, err = s.Auth.Authorize(ctx, domain.PermissionAdminManage)
+	if err != nil {
+		return
+	}
+
+	admins, err := s.AdminRepository.ListAdmin(ctx, o)
+	if err != nil {
+		return
+	}
+
+	res = response.NewPaginate(admins, response.Page{
+		Count:  o.Count,
+		Offset: o.Offset,
+		Page:   o.Page,
+	})
+	return
+}
+
+// UpdateAdmin updates admin data, only super admin may update other admin or change role.
 func (s *AdminService) UpdateAdmin(ctx context.Context, admin *domain.Admin) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.UpdateAdmin")
+	defer span.End()
+
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	if err != nil {
+		return
+	}
+	if id.String() != admin.ID.String() || admin.Role != "" {
+		if _, err = s.manage(ctx, admin.ID); err != nil {
+			return
+		}
+		if !s.Auth.GetRole(ctx).Covers(admin.Role) {
+			err = response.NewForbidden(nil, "can not grant role %q", admin.Role)
+			return
+		}
+	} else if _, err = s.Auth.GetSessionClaims(ctx); err != nil {
+		// api token can not update account of its own admin, e.g. its password
+		return
+	}
+
 	admin.Students = nil
 	admin.Examinations = nil
 
@@ -113,32 +278,220 @@ func (s *AdminService) UpdateAdmin(ctx context.Context, admin *domain.Admin) (re
 		return
 	}
 
+	var hash []byte
 	if admin.Password != "" {
-		var hash []byte
+		if err = s.PasswordPolicy.Validate(admin.Password); err != nil {
+			return
+		}
 		hash, err = bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return
 		}
-		admin.Password = string(hash)
+		admin.Password = ""
 	}
 
+	before, _ := s.AdminRepository.GetAdminByID(ctx, admin.ID)
 	err = s.AdminRepository.UpdateAdmin(ctx, admin)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", admin.ID)
+	}
 	if errors.Is(err, domain.ErrAdminConflict) {
 		err = response.NewUnprocessableEntity(nil, "can not create admin, data conflicted with other existing admin")
 	}
 	if err != nil {
 		return
 	}
+	if hash != nil {
+		if err = s.setAdminPassword(ctx, admin.ID, string(hash)); err != nil {
+			return
+		}
+	}
+	after, _ := s.AdminRepository.GetAdminByID(ctx, admin.ID)
+	if err = s.Audit.Record(ctx, domain.AuditAdminUpdate, admin.ID, before, after); err != nil {
+		return
+	}
 
 	res = response.NewOK(admin)
 	return
 }
 
+// setAdminPassword sets password hash of admin and clears must change flag,
+// struct updates skip false so it is written explicitly. Other sessions of
+// the admin are revoked, current one is kept when admin changed its own.
+func (s *AdminService) setAdminPassword(ctx context.Context, adminID raid.Raid, hash string) error {
+	if err := s.AdminRepository.UpdateAdminPassword(ctx, adminID, hash, false); err != nil {
+		return err
+	}
+	keep := []string{}
+	if claims, err := s.Auth.GetClaims(ctx); err == nil && claims.Subject == adminID.String() {
+		keep = append(keep, claims.ID)
+	}
+	return s.Auth.RevokeSubject(ctx, adminID.String(), keep...)
+}
+
+// manage authorizes current admin to edit other admin and returns it, role of
+// the other admin must not rank above role of current admin.
+func (s *AdminService) manage(ctx context.Context, adminID raid.Raid) (*domain.Admin, error) {
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionAdminManage); err != nil {
+		return nil, err
+	}
+	a, err := s.AdminRepository.GetAdminByID(ctx, adminID)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", adminID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !s.Auth.GetRole(ctx).Covers(a.Role) {
+		return nil, response.NewForbidden(nil, "can not manage admin with role %q", a.Role)
+	}
+	return a, nil
+}
+
 func (s *AdminService) DeleteAdmin(ctx context.Context, adminID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.DeleteAdmin")
+	defer span.End()
+
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	if err != nil {
+		return
+	}
+	if id.String() != adminID.String() {
+		if _, err = s.manage(ctx, adminID); err != nil {
+			return
+		}
+	}
+
+	before, _ := s.AdminRepository.GetAdminByID(ctx, adminID)
 	err = s.AdminRepository.DeleteAdmin(ctx, adminID)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", adminID)
+	}
+	if err != nil {
+		return
+	}
+	if err = s.Audit.Record(ctx, domain.AuditAdminDelete, adminID, before, nil); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return
+}
+
+// ChangeAdminPassword changes password of current admin and clears the must
+// change password flag of its session.
+func (s *AdminService) ChangeAdminPassword(ctx context.Context, c *domain.ChangePassword) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ChangeAdminPassword")
+	defer span.End()
+
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
 	if err != nil {
 		return
 	}
+	claims, err := s.Auth.GetClaims(ctx)
+	if err != nil {
+		return
+	}
+
+	a, err := s.AdminRepository.GetAdminByID(ctx, id)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", id)
+	}
+	if err != nil {
+		return
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(c.OldPassword)); err != nil {
+		err = response.NewBadRequest(map[string]string{"oldPassword": "not match"}, "old password does not match")
+		return
+	}
+	if c.NewPassword == c.OldPassword {
+		err = response.NewBadRequest(map[string]string{"newPassword": "unchanged"}, "new password must differ from old password")
+		return
+	}
+	if err = s.PasswordPolicy.Validate(c.NewPassword); err != nil {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	err = s.AdminRepository.UpdateAdminPassword(ctx, id, string(hash), false)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", id)
+	}
+	if err != nil {
+		return
+	}
+
+	renewed := *claims
+	renewed.MustChangePassword = false
+	cookie, err := s.Auth.Sign(renewed)
+	if err != nil {
+		return
+	}
+	// other sessions may be of whoever knew old password, renewed session
+	// keeps id of current one
+	if err = s.Auth.RevokeSubject(ctx, id.String(), claims.ID); err != nil {
+		return
+	}
+	r := response.NewNoContent()
+	r.Cookies = append(r.Cookies, cookie)
+	return r, nil
+}
+
+// ResetAdminPassword issues one time code which admin uses to set new password.
+func (s *AdminService) ResetAdminPassword(ctx context.Context, adminID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ResetAdminPassword")
+	defer span.End()
+
+	if _, err = s.manage(ctx, adminID); err != nil {
+		return
+	}
+
+	code, expiresAt, err := s.Resetter.Issue(adminID.String())
+	if err != nil {
+		return
+	}
+	if err = s.Audit.Record(ctx, domain.AuditAdminPasswordReset, adminID, nil, nil); err != nil {
+		return
+	}
+
+	res = response.NewCreated(&domain.PasswordResetCode{Code: code, ExpiresAt: expiresAt})
+	return
+}
+
+// RedeemAdminPassword sets new password with reset code and logs out every
+// session of the admin.
+func (s *AdminService) RedeemAdminPassword(ctx context.Context, r *domain.ResetPassword) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.RedeemAdminPassword")
+	defer span.End()
+
+	ctx = tenant.WithOrganizationOr(ctx, r.OrganizationID, s.Organization)
+	a, err := s.AdminRepository.GetAdminByUsername(ctx, r.Username)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = password.ErrInvalidCode
+	}
+	if err != nil {
+		return
+	}
+	if err = s.PasswordPolicy.Validate(r.NewPassword); err != nil {
+		return
+	}
+	if err = s.Resetter.Redeem(a.ID.String(), r.Code); err != nil {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(r.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	if err = s.AdminRepository.UpdateAdminPassword(ctx, a.ID, string(hash), false); err != nil {
+		return
+	}
+	if err = s.Auth.RevokeSubject(ctx, a.ID.String()); err != nil {
+		return
+	}
 
 	res = response.NewNoContent()
 	return
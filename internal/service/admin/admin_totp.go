@@ -0,0 +1,305 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/falentio/raid-go"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/totp"
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+var ErrInvalidChallenge = response.NewUnauthorized(nil, "login challenge is invalid or expired")
+
+const (
+	challengePrefix = "admin:totp:challenge:"
+	usedCodePrefix  = "admin:totp:used:"
+	// challengeLifetime is how long admin has to enter code after password.
+	challengeLifetime = 5 * time.Minute
+	recoveryCodes     = 10
+)
+
+func (s *AdminService) issuer() string {
+	if s.TOTPIssuer == "" {
+		return "skul"
+	}
+	return s.TOTPIssuer
+}
+
+// challenge stores pending second login step of a, its id is exchanged with
+// code of a for session by VerifyAdminTOTP.
+func (s *AdminService) challenge(ctx context.Context, a *domain.Admin) (response.Response, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	if err := tracing.Bind(ctx, s.Storage).Set(challengePrefix+id, []byte(a.ID.String()), challengeLifetime); err != nil {
+		return nil, err
+	}
+	return response.NewOK(&domain.TOTPChallenge{
+		Challenge: id,
+		ExpiresAt: time.Now().Add(challengeLifetime),
+	}), nil
+}
+
+// checkCode accepts current code of authenticator app of a or one of its
+// recovery codes, recovery code is consumed. Codes are checked under
+// s.totpMu against fresh admin, so the same code can not be used twice by
+// concurrent requests; storage is local to the process.
+func (s *AdminService) checkCode(ctx context.Context, a *domain.Admin, code string) error {
+	s.totpMu.Lock()
+	defer s.totpMu.Unlock()
+
+	a, err := s.AdminRepository.GetAdminByID(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+	code = strings.TrimSpace(code)
+	if counter, ok := totp.Validate(a.TOTPSecret, code, time.Now()); ok {
+		return s.useCounter(ctx, a.ID, counter)
+	}
+
+	rest, ok := totp.UseRecoveryCode(strings.Fields(a.TOTPRecovery), code)
+	if !ok {
+		return totp.ErrInvalidCode
+	}
+	a.TOTPRecovery = strings.Join(rest, " ")
+	return s.AdminRepository.UpdateAdminTOTP(ctx, a.ID, a.TOTPSecret, a.TOTPEnabled, a.TOTPRecovery)
+}
+
+// useCounter rejects code whose time step was already used by admin, so code
+// seen by someone else can not be replayed. It must be called with s.totpMu
+// held.
+func (s *AdminService) useCounter(ctx context.Context, adminID raid.Raid, counter int64) error {
+	key := usedCodePrefix + adminID.String()
+	b, err := tracing.Bind(ctx, s.Storage).Get(key)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		last, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return err
+		}
+		if counter <= last {
+			return totp.ErrInvalidCode
+		}
+	}
+	ttl := (2*totp.Skew + 1) * totp.Period
+	return tracing.Bind(ctx, s.Storage).Set(key, []byte(strconv.FormatInt(counter, 10)), ttl)
+}
+
+// VerifyAdminTOTP is second login step of admin with two factor enabled.
+func (s *AdminService) VerifyAdminTOTP(ctx context.Context, l *domain.TOTPLogin) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.VerifyAdminTOTP")
+	defer span.End()
+
+	if l.Challenge == "" {
+		err = ErrInvalidChallenge
+		return
+	}
+	b, err := tracing.Bind(ctx, s.Storage).Get(challengePrefix + l.Challenge)
+	if err != nil {
+		return
+	}
+	if b == nil {
+		err = ErrInvalidChallenge
+		return
+	}
+	adminID, err := raid.RaidFromString(string(b))
+	if err != nil {
+		return
+	}
+
+	// challenge was issued for admin of any organization
+	a, err := s.AdminRepository.GetAdminByID(tenant.Unscoped(ctx), adminID)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = ErrInvalidChallenge
+	}
+	if err != nil {
+		return
+	}
+	ctx = tenant.WithOrganization(ctx, a.OrganizationID)
+	account := loginguard.Account("admin", a.Username)
+	if err = s.Guard.Check(ctx, account); err != nil {
+		return
+	}
+
+	if err = s.checkCode(ctx, a, l.Code); err != nil {
+		if errors.Is(err, totp.ErrInvalidCode) {
+			s.fail(ctx, account)
+			// challenge is only tried once, so code can not be guessed
+			// without knowing password again
+			if derr := tracing.Bind(ctx, s.Storage).Delete(challengePrefix + l.Challenge); derr != nil {
+				err = derr
+			}
+		}
+		return
+	}
+	if err = tracing.Bind(ctx, s.Storage).Delete(challengePrefix + l.Challenge); err != nil {
+		return
+	}
+	if err = s.Guard.Succeed(ctx, account); err != nil {
+		return
+	}
+
+	return s.sign(a)
+}
+
+// current returns admin of session.
+func (s *AdminService) current(ctx context.Context) (*domain.Admin, error) {
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.AdminRepository.GetAdminByID(ctx, id)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", id)
+	}
+	return a, err
+}
+
+// EnrollAdminTOTP generates new secret of current admin, two factor is not
+// required until the secret is confirmed with ConfirmAdminTOTP.
+func (s *AdminService) EnrollAdminTOTP(ctx context.Context) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.EnrollAdminTOTP")
+	defer span.End()
+
+	a, err := s.current(ctx)
+	if err != nil {
+		return
+	}
+	if a.TOTPEnabled {
+		err = response.NewConflict(nil, "two factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return
+	}
+	if err = s.AdminRepository.UpdateAdminTOTP(ctx, a.ID, secret, false, ""); err != nil {
+		return
+	}
+
+	res = response.NewCreated(&domain.TOTPEnrolment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer(), a.Username, secret),
+	})
+	return
+}
+
+// ConfirmAdminTOTP enables two factor of current admin once code of enrolled
+// secret is valid, recovery codes are returned once.
+func (s *AdminService) ConfirmAdminTOTP(ctx context.Context, c *domain.TOTPCode) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ConfirmAdminTOTP")
+	defer span.End()
+
+	a, err := s.current(ctx)
+	if err != nil {
+		return
+	}
+	if a.TOTPEnabled {
+		err = response.NewConflict(nil, "two factor authentication is already enabled")
+		return
+	}
+	if a.TOTPSecret == "" {
+		err = response.NewBadRequest(nil, "two factor authentication must be enrolled first")
+		return
+	}
+
+	counter, ok := totp.Validate(a.TOTPSecret, strings.TrimSpace(c.Code), time.Now())
+	if !ok {
+		err = totp.ErrInvalidCode
+		return
+	}
+	s.totpMu.Lock()
+	err = s.useCounter(ctx, a.ID, counter)
+	s.totpMu.Unlock()
+	if err != nil {
+		return
+	}
+
+	codes, hashes, err := totp.NewRecoveryCodes(recoveryCodes)
+	if err != nil {
+		return
+	}
+	if err = s.AdminRepository.UpdateAdminTOTP(ctx, a.ID, a.TOTPSecret, true, strings.Join(hashes, " ")); err != nil {
+		return
+	}
+
+	res = response.NewCreated(&domain.RecoveryCodes{Codes: codes})
+	return
+}
+
+// DisableAdminTOTP disables two factor of current admin, it requires current
+// code or recovery code.
+func (s *AdminService) DisableAdminTOTP(ctx context.Context, c *domain.TOTPCode) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.DisableAdminTOTP")
+	defer span.End()
+
+	a, err := s.current(ctx)
+	if err != nil {
+		return
+	}
+	if !a.TOTPEnabled {
+		err = response.NewBadRequest(nil, "two factor authentication is not enabled")
+		return
+	}
+	if err = s.checkCode(ctx, a, c.Code); err != nil {
+		return
+	}
+
+	if err = s.AdminRepository.UpdateAdminTOTP(ctx, a.ID, "", false, ""); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return
+}
+
+// ResetAdminTOTP disables two factor of other admin who lost both
+// authenticator app and recovery codes, admin disables its own two factor
+// with DisableAdminTOTP.
+func (s *AdminService) ResetAdminTOTP(ctx context.Context, adminID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "AdminService.ResetAdminTOTP")
+	defer span.End()
+
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	if err != nil {
+		return
+	}
+	if id.String() == adminID.String() {
+		err = response.NewForbidden(nil, "two factor authentication of own account is disabled with its code")
+		return
+	}
+	if _, err = s.manage(ctx, adminID); err != nil {
+		return
+	}
+
+	err = s.AdminRepository.UpdateAdminTOTP(ctx, adminID, "", false, "")
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", adminID)
+	}
+	if err != nil {
+		return
+	}
+	if err = s.Audit.Record(ctx, domain.AuditAdminTOTPReset, adminID, nil, nil); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return
+}
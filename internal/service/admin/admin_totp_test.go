@@ -0,0 +1,174 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/totp"
+)
+
+func TestAdminTOTP(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:admin_totp?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Examination{}, &domain.Student{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	admin := &domain.Admin{Username: "foo", PasswordHash: string(hash), Role: domain.RoleTeacher}
+	admin.ID = AdminIDFactory.WithRandom().WithTimestampNow()
+	admin.OrganizationID = raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatal("failed to create admin", err)
+	}
+
+	store := memory.New()
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	// httptest requests come from 192.0.2.1, trusted so they are not rate limited
+	guard, err := loginguard.New(loginguard.Options{
+		MaxFailures:     5,
+		Lockout:         time.Minute,
+		MaxLockout:      time.Minute,
+		Forget:          time.Hour,
+		TrustedNetworks: []string{"192.0.2.0/24"},
+	}, store, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	service := &AdminService{AdminRepository: &AdminRepositoryGorm{db}, Auth: a, Storage: store, Guard: guard, Organization: admin.OrganizationID}
+	r := chi.NewRouter()
+	r.Route("/admin", (&AdminRouter{AdminService: service, Auth: a, Guard: guard}).Route)
+
+	call := func(method, path string, body any, cookie *http.Cookie, data any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := struct {
+			Data any `json:"data"`
+		}{data}
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w
+	}
+	session := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "session" {
+				return c
+			}
+		}
+		return nil
+	}
+	login := func() *httptest.ResponseRecorder {
+		return call(http.MethodPost, "/admin/login", &domain.Admin{Username: "foo", Password: "password"}, nil, nil)
+	}
+
+	cookie := session(login())
+	if cookie == nil {
+		t.Fatal("admin without two factor must log in with password only")
+	}
+
+	enrolment := &domain.TOTPEnrolment{}
+	if w := call(http.MethodPost, "/admin/totp", nil, cookie, enrolment); w.Code != http.StatusCreated || enrolment.Secret == "" {
+		t.Fatalf("failed to enroll totp, status %d: %s", w.Code, w.Body.String())
+	}
+	if session(login()) == nil {
+		t.Error("two factor must not be required before enrolment is confirmed")
+	}
+
+	now := time.Now()
+	code, _ := totp.Code(enrolment.Secret, now)
+	recovery := &domain.RecoveryCodes{}
+	if w := call(http.MethodPost, "/admin/totp/confirm", &domain.TOTPCode{Code: code}, cookie, recovery); w.Code != http.StatusCreated || len(recovery.Codes) == 0 {
+		t.Fatalf("failed to confirm totp, status %d: %s", w.Code, w.Body.String())
+	}
+
+	challenge := &domain.TOTPChallenge{}
+	relogin := func() {
+		w := login()
+		_ = json.Unmarshal(w.Body.Bytes(), &struct {
+			Data any `json:"data"`
+		}{challenge})
+		if session(w) != nil || challenge.Challenge == "" {
+			t.Fatalf("password login must return challenge instead of session, status %d: %s", w.Code, w.Body.String())
+		}
+	}
+	relogin()
+
+	verify := func(code string) *httptest.ResponseRecorder {
+		return call(http.MethodPost, "/admin/login/totp", &domain.TOTPLogin{Challenge: challenge.Challenge, Code: code}, nil, nil)
+	}
+	if w := verify(code); session(w) != nil {
+		t.Error("used code must not be replayed")
+	}
+	if w := verify(recovery.Codes[0]); session(w) != nil {
+		t.Error("challenge must be consumed by failed code")
+	}
+	relogin()
+	if w := verify(recovery.Codes[0]); session(w) == nil {
+		t.Fatalf("recovery code must be accepted, status %d: %s", w.Code, w.Body.String())
+	}
+	if w := verify(recovery.Codes[1]); session(w) != nil {
+		t.Error("challenge must be used once")
+	}
+
+	relogin()
+	if w := verify(recovery.Codes[0]); session(w) != nil {
+		t.Error("recovery code must be used once")
+	}
+	relogin()
+	next, _ := totp.Code(enrolment.Secret, now.Add(totp.Period))
+	if w := verify(next); session(w) == nil {
+		t.Errorf("code of authenticator app must be accepted, status %d: %s", w.Code, w.Body.String())
+	}
+
+	reset := "/admin/" + admin.ID.String() + "/totp/reset"
+	if w := call(http.MethodPost, reset, nil, cookie, nil); w.Code != http.StatusForbidden {
+		t.Errorf("admin must not reset own two factor, status %d: %s", w.Code, w.Body.String())
+	}
+	superAdmin, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: AdminIDFactory.WithRandom().String()},
+		Role:             domain.RoleSuperAdmin,
+		Organization:     admin.OrganizationID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	if w := call(http.MethodPost, reset, nil, superAdmin, nil); w.Code != http.StatusNoContent {
+		t.Errorf("super admin must reset two factor of teacher, status %d: %s", w.Code, w.Body.String())
+	}
+	if session(login()) == nil {
+		t.Error("two factor must not be required after reset")
+	}
+
+	// failures of unknown usernames are not counted, so they are never locked
+	for i := 0; i < 6; i++ {
+		call(http.MethodPost, "/admin/login", &domain.Admin{Username: "ghost", Password: "password"}, nil, nil)
+	}
+	if err := guard.Check(tenant.WithOrganization(context.Background(), admin.OrganizationID), loginguard.Account("admin", "ghost")); err != nil {
+		t.Errorf("unknown username must not be locked, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+var _ domain.APITokenRepository = new(APITokenRepositoryGorm)
+
+type APITokenRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+func (r *APITokenRepositoryGorm) CreateAPIToken(ctx context.Context, token *domain.APIToken) error {
+	tenant.Assign(ctx, &token.OrganizationID)
+	ok, err := tenant.Owns(ctx, r.DB, "admins", token.AdminID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrAdminNotFound
+	}
+	return r.DB.
+		WithContext(ctx).
+		Omit("Admin").
+		Create(token).
+		Error
+}
+
+func (r *APITokenRepositoryGorm) GetAPIToken(ctx context.Context, tokenID raid.Raid) (*domain.APIToken, error) {
+	token := &domain.APIToken{}
+	err := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		Preload("Admin").
+		First(token, "id = ?", tokenID.String()).
+		Error
+	if err != nil {
+		token = nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domain.ErrAPITokenNotFound
+	}
+	return token, err
+}
+
+func (r *APITokenRepositoryGorm) ListAPIToken(ctx context.Context, o *domain.ListAPITokenOptions) ([]*domain.APIToken, error) {
+	tokens := make([]*domain.APIToken, 0)
+	db := r.DB.
+		WithContext(ctx).
+		Model(&domain.APIToken{}).
+		Scopes(tenant.Scope(ctx))
+	if !o.AdminID.IsNil() {
+		db = db.Where("admin_id = ?", o.AdminID.String())
+	}
+	if o.Name != "" {
+		db = db.Where("name = ?", o.Name)
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
+		Offset(o.Offset).
+		Find(&tokens).
+		Error
+	if err != nil {
+		tokens = nil
+	}
+	return tokens, err
+}
+
+func (r *APITokenRepositoryGorm) DeleteAPIToken(ctx context.Context, tokenID raid.Raid) error {
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		Delete(&domain.APIToken{Model: domain.Model{ID: tokenID}})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrAPITokenNotFound
+	}
+	return res.Error
+}
+
+func (r *APITokenRepositoryGorm) DeleteExpiredAPIToken(ctx context.Context, at time.Time) (int64, error) {
+	res := r.DB.
+		WithContext(ctx).
+		Where("expires_at < ?", at).
+		Delete(&domain.APIToken{})
+	return res.RowsAffected, res.Error
+}
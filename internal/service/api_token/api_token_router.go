@@ -0,0 +1,91 @@
+package apitoken
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/falentio/raid-go"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+type APITokenRouter struct {
+	APITokenService domain.APITokenService
+	Auth            *auth.Auth
+	Idempotency     *idempotency.Idempotency
+}
+
+func (ar *APITokenRouter) Route(r chi.Router) {
+	r.Use(ar.Auth.VerifyMiddleware)
+	r.Use(ar.Auth.RequireSession)
+	r.Use(middleware.NoCache)
+	r.With(ar.Idempotency.Redact("token")).Post("/", ar.CreateAPIToken)
+	r.Get("/list", ar.ListAPIToken)
+	r.Delete("/{tokenID}", ar.DeleteAPIToken)
+}
+
+func (ar *APITokenRouter) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	token := &domain.APIToken{}
+	if err := json.NewDecoder(r.Body).Decode(token); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.APITokenService.CreateAPIToken(r.Context(), token)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *APITokenRouter) ListAPIToken(w http.ResponseWriter, r *http.Request) {
+	o := &domain.ListAPITokenOptions{}
+	q := r.URL.Query()
+	if err := o.PageFromQuery(q); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+	if adminID := q.Get("adminID"); adminID != "" {
+		id, err := raid.RaidFromString(adminID)
+		if err != nil {
+			err = response.NewBadRequest(map[string]string{"adminID": "invalid"}, "invalid query param adminID, got %q", adminID)
+			response.HandleError(w, r, err)
+			return
+		}
+		o.AdminID = id
+	}
+
+	res, err := ar.APITokenService.ListAPIToken(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (ar *APITokenRouter) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "tokenID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid tokenID received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.APITokenService.DeleteAPIToken(r.Context(), id)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
@@ -0,0 +1,262 @@
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
+	"github.com/falentio/skul/internal/pkg/validator"
+)
+
+var APITokenIDFactory = raid.NewRaid().WithPrefix(domain.APITokenIDPrefix)
+var _ domain.APITokenService = new(APITokenService)
+var _ auth.TokenVerifier = new(APITokenService)
+var _ domain.APITokenIssuer = new(APITokenService)
+
+var ErrInvalidAPIToken = response.NewUnauthorized(nil, "api token is invalid or expired")
+
+// tokenPrefix makes leaked api tokens easy to find by secret scanners.
+const tokenPrefix = "skul_"
+
+type APITokenService struct {
+	APITokenRepository domain.APITokenRepository
+	Auth               *auth.Auth
+	Tracing            *tracing.Tracing
+	Audit              *audit.Recorder
+	Logger             zerolog.Logger
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// caller returns admin id and claims of staff session, api tokens are refused
+// so leaked api token can not mint tokens outliving its own revocation.
+func (s *APITokenService) caller(ctx context.Context) (raid.Raid, *auth.Claims, error) {
+	c, err := s.Auth.GetSessionClaims(ctx)
+	if err != nil {
+		return raid.NilRaid, nil, err
+	}
+	if !c.Role.IsStaff() {
+		return raid.NilRaid, nil, auth.ErrForbidden
+	}
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	if err != nil {
+		return raid.NilRaid, nil, err
+	}
+	return id, c, nil
+}
+
+func (s *APITokenService) CreateAPIToken(ctx context.Context, token *domain.APIToken) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.CreateAPIToken")
+	defer span.End()
+
+	if err := s.IssueAPIToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return response.NewCreated(token), nil
+}
+
+// IssueAPIToken creates token for admin of ctx, its secret is only set to
+// token.Token.
+func (s *APITokenService) IssueAPIToken(ctx context.Context, token *domain.APIToken) error {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.IssueAPIToken")
+	defer span.End()
+
+	adminID, c, err := s.caller(ctx)
+	if err != nil {
+		return err
+	}
+
+	token.ID = APITokenIDFactory.WithRandom().WithTimestampNow()
+	token.AdminID = adminID
+	token.Admin = nil
+	if err := validator.Struct(token); err != nil {
+		return err
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return response.NewBadRequest(map[string]string{"expiresAt": "past"}, "api token must expire in the future")
+	}
+	// api token can not have more permission than session minting it
+	for _, p := range token.Scopes {
+		if !c.Role.Can(p) || (len(c.Scopes) > 0 && !c.Scopes.Has(p)) {
+			return response.NewForbidden(map[string]string{"scopes": "forbidden"}, "session does not have permission %q", p)
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	token.SecretHash = hashSecret(secret)
+
+	err = s.APITokenRepository.CreateAPIToken(ctx, token)
+	if errors.Is(err, domain.ErrAdminNotFound) {
+		err = response.NewNotFound(nil, "can not find admin with id %q", adminID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditAPITokenCreate, token.ID, nil, token); err != nil {
+		return err
+	}
+
+	token.Token = tokenPrefix + token.ID.String() + "." + secret
+	return nil
+}
+
+// RotateAPIToken issues token like IssueAPIToken, then deletes other tokens of
+// the admin with the same name.
+func (s *APITokenService) RotateAPIToken(ctx context.Context, token *domain.APIToken) error {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.RotateAPIToken")
+	defer span.End()
+
+	if err := s.IssueAPIToken(ctx, token); err != nil {
+		return err
+	}
+
+	tokens, err := s.APITokenRepository.ListAPIToken(ctx, &domain.ListAPITokenOptions{
+		AdminID: token.AdminID,
+		Name:    token.Name,
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.ID == token.ID {
+			continue
+		}
+		err := s.APITokenRepository.DeleteAPIToken(ctx, t.ID)
+		if errors.Is(err, domain.ErrAPITokenNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.Audit.Record(ctx, domain.AuditAPITokenDelete, t.ID, t, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *APITokenService) ListAPIToken(ctx context.Context, o *domain.ListAPITokenOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.ListAPIToken")
+	defer span.End()
+
+	adminID, c, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Role.Can(domain.PermissionAdminManage) {
+		o.AdminID = adminID
+	}
+
+	tokens, err := s.APITokenRepository.ListAPIToken(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewPaginate(tokens, response.Page{
+		Count:  o.Count,
+		Offset: o.Offset,
+	}), nil
+}
+
+func (s *APITokenService) DeleteAPIToken(ctx context.Context, tokenID raid.Raid) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.DeleteAPIToken")
+	defer span.End()
+
+	adminID, c, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.APITokenRepository.GetAPIToken(ctx, tokenID)
+	if err == nil && token.AdminID != adminID && !c.Role.Can(domain.PermissionAdminManage) {
+		err = domain.ErrAPITokenNotFound
+	}
+	if err == nil {
+		err = s.APITokenRepository.DeleteAPIToken(ctx, tokenID)
+	}
+	if errors.Is(err, domain.ErrAPITokenNotFound) {
+		err = response.NewNotFound(nil, "can not find api token with id %q", tokenID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditAPITokenDelete, tokenID, token, nil); err != nil {
+		return nil, err
+	}
+
+	return response.NewNoContent(), nil
+}
+
+// VerifyAPIToken returns claims of api token, role is read from its admin
+// so demoted admin can not keep using older permission.
+func (s *APITokenService) VerifyAPIToken(ctx context.Context, token string) (*auth.Claims, error) {
+	ctx, span := s.Tracing.Start(ctx, "APITokenService.VerifyAPIToken")
+	defer span.End()
+
+	idStr, secret, ok := strings.Cut(strings.TrimPrefix(token, tokenPrefix), ".")
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+	id, err := raid.RaidFromString(idStr)
+	if err != nil || id.Prefix() != domain.APITokenIDPrefix {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// organization of caller is only known once token is found
+	stored, err := s.APITokenRepository.GetAPIToken(tenant.Unscoped(ctx), id)
+	if errors.Is(err, domain.ErrAPITokenNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(stored.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIToken
+	}
+	if time.Now().After(stored.ExpiresAt) || stored.Admin == nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	return &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        stored.ID.String(),
+			Subject:   stored.AdminID.String(),
+			ExpiresAt: jwt.NewNumericDate(stored.ExpiresAt),
+		},
+		Role:         stored.Admin.Role,
+		Organization: stored.OrganizationID.String(),
+		Scopes:       stored.Scopes,
+	}, nil
+}
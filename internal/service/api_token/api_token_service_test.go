@@ -0,0 +1,133 @@
+package apitoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+func TestAPIToken(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:api_token?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.APIToken{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	admin := &domain.Admin{Username: "teacher", Role: domain.RoleTeacher}
+	admin.ID = raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().WithTimestampNow()
+	admin.OrganizationID = raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatal("failed to create admin", err)
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	service := &APITokenService{APITokenRepository: &APITokenRepositoryGorm{db}, Auth: a}
+	a.Tokens = service
+
+	r := chi.NewRouter()
+	r.Route("/api-token", (&APITokenRouter{APITokenService: service, Auth: a}).Route)
+	r.With(a.VerifyMiddleware, a.RequirePermission(domain.PermissionStudentRead)).Get("/students", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.With(a.VerifyMiddleware, a.RequirePermission(domain.PermissionStudentWrite)).Post("/students", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	session, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: admin.ID.String()},
+		Role:             admin.Role,
+		Organization:     admin.OrganizationID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+
+	create := func(scopes ...domain.Permission) (*httptest.ResponseRecorder, *domain.APIToken) {
+		b, _ := json.Marshal(&domain.APIToken{Name: "sync", Scopes: scopes, ExpiresAt: time.Now().Add(time.Hour)})
+		req := httptest.NewRequest(http.MethodPost, "/api-token/", bytes.NewReader(b))
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := struct {
+			Data *domain.APIToken `json:"data"`
+		}{}
+		_ = json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&res)
+		return w, res.Data
+	}
+	call := func(method, token string) int {
+		req := httptest.NewRequest(method, "/students", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if w, _ := create(domain.PermissionAdminManage); w.Code != http.StatusForbidden {
+		t.Errorf("api token must not have more permission than its admin, got status %d", w.Code)
+	}
+
+	w, token := create(domain.PermissionStudentRead)
+	if w.Code != http.StatusCreated || token == nil || token.Token == "" {
+		t.Fatalf("failed to create api token, status %d: %s", w.Code, w.Body.String())
+	}
+
+	stored := &domain.APIToken{}
+	if err := db.First(stored, "id = ?", token.ID.String()).Error; err != nil {
+		t.Fatal("failed to get stored api token", err)
+	}
+	if stored.SecretHash == "" || bytes.Contains([]byte(token.Token), []byte(stored.SecretHash)) {
+		t.Error("api token must be stored hashed")
+	}
+
+	if code := call(http.MethodGet, token.Token); code != http.StatusNoContent {
+		t.Errorf("api token must be accepted within its scopes, got status %d", code)
+	}
+	if code := call(http.MethodPost, token.Token); code != http.StatusForbidden {
+		t.Errorf("api token must be rejected outside its scopes, got status %d", code)
+	}
+	if code := call(http.MethodGet, token.Token+"x"); code != http.StatusUnauthorized {
+		t.Errorf("api token with invalid secret must be rejected, got status %d", code)
+	}
+
+	// api token can not mint api tokens outliving its own revocation
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		path := "/api-token/"
+		if method == http.MethodGet {
+			path = "/api-token/list"
+		}
+		b, _ := json.Marshal(&domain.APIToken{Name: "child", Scopes: domain.Permissions{domain.PermissionStudentRead}, ExpiresAt: time.Now().AddDate(100, 0, 0)})
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("api token must not manage api tokens, %s %s got status %d", method, path, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api-token/"+token.ID.String(), nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("failed to revoke api token, status %d", w.Code)
+	}
+	if code := call(http.MethodGet, token.Token); code != http.StatusUnauthorized {
+		t.Errorf("revoked api token must be rejected, got status %d", code)
+	}
+}
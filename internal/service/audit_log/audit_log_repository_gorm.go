@@ -0,0 +1,84 @@
+package auditlog
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+var _ domain.AuditLogRepository = new(AuditLogRepositoryGorm)
+
+// exportBatchSize is number of audit logs loaded at once while exporting.
+const exportBatchSize = 500
+
+type AuditLogRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+func (r *AuditLogRepositoryGorm) CreateAuditLog(ctx context.Context, l *domain.AuditLog) error {
+	tenant.Assign(ctx, &l.OrganizationID)
+	return r.DB.
+		WithContext(ctx).
+		Create(l).
+		Error
+}
+
+func (r *AuditLogRepositoryGorm) filter(ctx context.Context, o *domain.ListAuditLogOptions) *gorm.DB {
+	db := r.DB.
+		WithContext(ctx).
+		Model(&domain.AuditLog{}).
+		Scopes(tenant.Scope(ctx))
+	if !o.ActorID.IsNil() {
+		db = db.Where("actor_id = ?", o.ActorID.String())
+	}
+	if !o.TargetID.IsNil() {
+		db = db.Where("target_id = ?", o.TargetID.String())
+	}
+	if o.Action != "" {
+		db = db.Where("action = ?", o.Action)
+	}
+	if !o.Since.IsZero() {
+		db = db.Where("created_at >= ?", o.Since)
+	}
+	if !o.Until.IsZero() {
+		db = db.Where("created_at < ?", o.Until)
+	}
+	return db
+}
+
+func (r *AuditLogRepositoryGorm) ListAuditLog(ctx context.Context, o *domain.ListAuditLogOptions) ([]*domain.AuditLog, error) {
+	logs := make([]*domain.AuditLog, 0)
+	db := r.filter(ctx, o)
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("created_at DESC").
+		Order("id DESC").
+		Offset(o.Offset).
+		Find(&logs).
+		Error
+	if err != nil {
+		logs = nil
+	}
+	return logs, err
+}
+
+func (r *AuditLogRepositoryGorm) EachAuditLog(ctx context.Context, o *domain.ListAuditLogOptions, fn func(l *domain.AuditLog) error) error {
+	logs := make([]*domain.AuditLog, 0, exportBatchSize)
+	return r.filter(ctx, o).
+		Order("created_at").
+		Order("id").
+		FindInBatches(&logs, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, l := range logs {
+				if err := fn(l); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Error
+}
@@ -0,0 +1,124 @@
+package auditlog
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+type AuditLogRouter struct {
+	AuditLogService domain.AuditLogService
+	Auth            *auth.Auth
+}
+
+func (ar *AuditLogRouter) Route(r chi.Router) {
+	r.Use(ar.Auth.VerifyMiddleware)
+	r.Use(middleware.NoCache)
+	r.Get("/list", ar.ListAuditLog)
+	r.Get("/export", ar.ExportAuditLog)
+}
+
+// options reads filters of audit log from query, times are RFC 3339.
+func options(q url.Values) (*domain.ListAuditLogOptions, error) {
+	o := &domain.ListAuditLogOptions{Action: q.Get("action")}
+	for _, f := range []struct {
+		name string
+		dst  *raid.Raid
+	}{
+		{"actorID", &o.ActorID},
+		{"targetID", &o.TargetID},
+	} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		id, err := raid.RaidFromString(v)
+		if err != nil {
+			return nil, response.NewBadRequest(map[string]string{f.name: "invalid"}, "invalid query param %s, got %q", f.name, v)
+		}
+		*f.dst = id
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"since", &o.Since},
+		{"until", &o.Until},
+	} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, response.NewBadRequest(map[string]string{f.name: "invalid"}, "invalid query param %s, got %q", f.name, v)
+		}
+		*f.dst = t
+	}
+	return o, nil
+}
+
+func (ar *AuditLogRouter) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	o, err := options(q)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+	if err := o.PageFromQuery(q); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := ar.AuditLogService.ListAuditLog(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+// exportWriter sets headers of JSON lines on first write, so errors before
+// any audit log is written are still served as JSON error.
+type exportWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (e *exportWriter) Write(b []byte) (int, error) {
+	if !e.written {
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+		e.w.Header().Set("Content-Disposition", `attachment; filename="audit-log.jsonl"`)
+		e.w.WriteHeader(http.StatusOK)
+		e.written = true
+	}
+	return e.w.Write(b)
+}
+
+func (ar *AuditLogRouter) ExportAuditLog(w http.ResponseWriter, r *http.Request) {
+	o, err := options(r.URL.Query())
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	ew := &exportWriter{w: w}
+	err = ar.AuditLogService.ExportAuditLog(r.Context(), o, ew)
+	if err != nil && !ew.written {
+		response.HandleError(w, r, err)
+		return
+	}
+	if !ew.written {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,56 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/rs/zerolog"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+var _ domain.AuditLogService = new(AuditLogService)
+
+type AuditLogService struct {
+	AuditLogRepository domain.AuditLogRepositoryRead
+	Auth               *auth.Auth
+	Tracing            *tracing.Tracing
+	Logger             zerolog.Logger
+}
+
+func (s *AuditLogService) ListAuditLog(ctx context.Context, o *domain.ListAuditLogOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "AuditLogService.ListAuditLog")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionAdminManage); err != nil {
+		return nil, err
+	}
+
+	logs, err := s.AuditLogRepository.ListAuditLog(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewPaginate(logs, response.Page{
+		Count:  o.Count,
+		Offset: o.Offset,
+	}), nil
+}
+
+func (s *AuditLogService) ExportAuditLog(ctx context.Context, o *domain.ListAuditLogOptions, w io.Writer) error {
+	ctx, span := s.Tracing.Start(ctx, "AuditLogService.ExportAuditLog")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionAdminManage); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	return s.AuditLogRepository.EachAuditLog(ctx, o, func(l *domain.AuditLog) error {
+		return enc.Encode(l)
+	})
+}
@@ -0,0 +1,121 @@
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:audit_log?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.AuditLog{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	repo := &AuditLogRepositoryGorm{db}
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	rec := &audit.Recorder{Repository: repo, Auth: a}
+	target := raid.NewRaid().WithPrefix(domain.StudentIDPrefix).WithRandom().WithTimestampNow()
+	orgID := raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Route("/audit-log", (&AuditLogRouter{AuditLogService: &AuditLogService{AuditLogRepository: repo, Auth: a}, Auth: a}).Route)
+	r.With(a.VerifyMiddleware).Put("/student", func(w http.ResponseWriter, r *http.Request) {
+		before := &domain.Student{Name: "Ani", Class: "X-1", Password: "generated"}
+		after := &domain.Student{Name: "Ani", Class: "X-2"}
+		if err := rec.Record(r.Context(), domain.AuditStudentUpdate, target, before, after); err != nil {
+			t.Error("failed to record audit log", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	sign := func(role domain.Role) *http.Cookie {
+		c, err := a.Sign(auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().String()},
+			Role:             role,
+			Organization:     orgID.String(),
+		})
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		return c
+	}
+	admin, teacher := sign(domain.RoleSuperAdmin), sign(domain.RoleTeacher)
+	do := func(method, url string, session *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do(http.MethodPut, "/student", teacher); w.Code != http.StatusNoContent {
+			t.Fatalf("expected status %d, got %d", http.StatusNoContent, w.Code)
+		}
+	}
+
+	if w := do(http.MethodGet, "/audit-log/list", teacher); w.Code != http.StatusForbidden {
+		t.Errorf("teacher must not read audit log, got status %d", w.Code)
+	}
+	w := do(http.MethodGet, "/audit-log/list?action="+domain.AuditStudentUpdate+"&targetID="+target.String(), admin)
+	res := struct {
+		Data []*domain.AuditLog `json:"data"`
+		Page *response.Page     `json:"page"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil || len(res.Data) != 2 {
+		t.Fatalf("expected 2 audit logs, got %d: %v", len(res.Data), err)
+	}
+	if res.Page == nil {
+		t.Error("list must be sent along with its page")
+	}
+	l := res.Data[0]
+	if l.ActorRole != domain.RoleTeacher || l.ActorID.IsNil() || l.RequestID == "" {
+		t.Errorf("audit log must record actor and request id, got %+v", l)
+	}
+	if len(l.Diff) != 1 || l.Diff["class"].Before != "X-1" || l.Diff["class"].After != "X-2" {
+		t.Errorf("expected only class in diff, got %+v", l.Diff)
+	}
+
+	if err := db.Model(l).Update("action", "nothing").Error; err != domain.ErrAuditLogAppendOnly {
+		t.Errorf("audit log must not be updated, got %v", err)
+	}
+	if err := db.Delete(l).Error; err != domain.ErrAuditLogAppendOnly {
+		t.Errorf("audit log must not be deleted, got %v", err)
+	}
+
+	w = do(http.MethodGet, "/audit-log/export", admin)
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("expected JSON lines, got content type %q", ct)
+	}
+	lines := 0
+	for s := bufio.NewScanner(bytes.NewReader(w.Body.Bytes())); s.Scan(); lines++ {
+		l := &domain.AuditLog{}
+		if err := json.Unmarshal(s.Bytes(), l); err != nil || l.TargetID != target {
+			t.Errorf("invalid exported line %q: %v", s.Text(), err)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 exported lines, got %d", lines)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.EnteranceTokenRepository = new(EnteranceTokenRepositoryGorm)
@@ -16,7 +17,25 @@ type EnteranceTokenRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+func (r *EnteranceTokenRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "examination_id", "examinations")
+}
+
+func (r *EnteranceTokenRepositoryGorm) checkExamination(ctx context.Context, examinationID raid.Raid) error {
+	ok, err := tenant.Owns(ctx, r.DB, "examinations", examinationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrExaminationNotFound
+	}
+	return nil
+}
+
 func (r *EnteranceTokenRepositoryGorm) CreateEnteranceToken(ctx context.Context, token *domain.EnteranceToken) error {
+	if err := r.checkExamination(ctx, token.ExaminationID); err != nil {
+		return err
+	}
 	return r.DB.
 		WithContext(ctx).
 		Omit("Examination").
@@ -26,15 +45,29 @@ func (r *EnteranceTokenRepositoryGorm) CreateEnteranceToken(ctx context.Context,
 }
 
 func (r *EnteranceTokenRepositoryGorm) UpdateEnteranceToken(ctx context.Context, token *domain.EnteranceToken) error {
-	return r.DB.
+	if !token.ExaminationID.IsNil() {
+		if err := r.checkExamination(ctx, token.ExaminationID); err != nil {
+			return err
+		}
+	}
+	res := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		Omit("Examination").
 		Omit("Students").
-		Updates(token).
-		Error
+		Updates(token)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrEnteranceTokenNotFound
+	}
+	return res.Error
 }
 
 func (r *EnteranceTokenRepositoryGorm) BatchCreateEnteranceToken(ctx context.Context, tokens []*domain.EnteranceToken) error {
+	for _, token := range tokens {
+		if err := r.checkExamination(ctx, token.ExaminationID); err != nil {
+			return err
+		}
+	}
 	return r.DB.
 		WithContext(ctx).
 		Omit("Examination").
@@ -48,6 +81,7 @@ func (r *EnteranceTokenRepositoryGorm) GetEnteranceToken(ctx context.Context, to
 
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		Preload("Examination").
 		First(token, "id = ?", tokenID.String()).
 		Error
@@ -61,16 +95,46 @@ func (r *EnteranceTokenRepositoryGorm) GetEnteranceToken(ctx context.Context, to
 	return token, err
 }
 
+func (r *EnteranceTokenRepositoryGorm) GetEnteranceTokenByCode(ctx context.Context, code string) (*domain.EnteranceToken, error) {
+	// tokens without code have empty code
+	if code == "" {
+		return nil, domain.ErrEnteranceTokenNotFound
+	}
+	token := &domain.EnteranceToken{}
+
+	err := r.DB.
+		WithContext(ctx).
+		Scopes(r.scope(ctx)).
+		Where("code = ?", code).
+		First(token).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrEnteranceTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
 func (r *EnteranceTokenRepositoryGorm) ListEnteranceToken(ctx context.Context, o *domain.ListEnteranceTokenOptions) ([]*domain.EnteranceToken, error) {
 	tokens := make([]*domain.EnteranceToken, 0)
 
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
-		Find(tokens).
-		Where(o).
-		Order("ID").
-		Limit(o.Count).
+		Model(&domain.EnteranceToken{}).
+		Scopes(r.scope(ctx))
+	if !o.ExaminationID.IsNil() {
+		db = db.Where("examination_id = ?", o.ExaminationID.String())
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(o.Offset).
+		Find(&tokens).
 		Error
 	if err != nil {
 		tokens = nil
@@ -79,9 +143,184 @@ func (r *EnteranceTokenRepositoryGorm) ListEnteranceToken(ctx context.Context, o
 	return tokens, err
 }
 
-func (r *EnteranceTokenRepositoryGorm) DeleteEnteranceToken(ctx context.Context, tokenID raid.Raid) error {
-	return r.DB.
+// audience matches tokens scheduled for class and grade, empty value on
+// either side matches every class or grade.
+func audience(db *gorm.DB, class, grade string) *gorm.DB {
+	return db.
+		Session(&gorm.Session{NewDB: true}).
+		Where("enterance_tokens.class <> '' OR enterance_tokens.grade <> ''").
+		Where("? = '' OR enterance_tokens.class = '' OR enterance_tokens.class = ?", class, class).
+		Where("? = '' OR enterance_tokens.grade = '' OR enterance_tokens.grade = ?", grade, grade)
+}
+
+// assignedIn selects tokens with assigned student of class and grade.
+func assignedIn(db *gorm.DB, class, grade string) *gorm.DB {
+	return db.
+		Session(&gorm.Session{NewDB: true}).
+		Table("examine_students").
+		Select("examine_students.enterance_token_id").
+		Joins("JOIN students ON students.id = examine_students.student_id AND students.deleted_at IS NULL").
+		Where("examine_students.deleted_at IS NULL").
+		Where("? = '' OR students.class = ?", class, class).
+		Where("? = '' OR students.grade = ?", grade, grade)
+}
+
+// scheduledFor matches tokens scheduled for students of class and grade.
+func scheduledFor(db *gorm.DB, class, grade string) *gorm.DB {
+	return db.
+		Session(&gorm.Session{NewDB: true}).
+		Where(audience(db, class, grade)).
+		Or("enterance_tokens.id IN (?)", assignedIn(db, class, grade))
+}
+
+func (r *EnteranceTokenRepositoryGorm) ListSchedule(ctx context.Context, o *domain.ScheduleOptions) ([]*domain.EnteranceToken, error) {
+	tokens := make([]*domain.EnteranceToken, 0)
+
+	db := r.DB.
+		WithContext(ctx).
+		Model(&domain.EnteranceToken{}).
+		Scopes(r.scope(ctx)).
+		Preload("Examination")
+	if !o.From.IsZero() {
+		db = db.Where("enterance_tokens.enterance_until > ?", o.From)
+	}
+	if !o.Until.IsZero() {
+		db = db.Where("enterance_tokens.enterance_from < ?", o.Until)
+	}
+	if !o.AdminID.IsNil() {
+		db = db.Where("enterance_tokens.examination_id IN (?)", r.DB.
+			Session(&gorm.Session{NewDB: true}).
+			Table("examinations").
+			Select("id").
+			Where("admin_id = ?", o.AdminID.String()).
+			Where("deleted_at IS NULL"),
+		)
+	}
+	if o.Class != "" || o.Grade != "" {
+		db = db.Where(scheduledFor(r.DB, o.Class, o.Grade))
+	}
+	err := db.
+		Order("enterance_tokens.enterance_from").
+		Order("enterance_tokens.id").
+		Find(&tokens).
+		Error
+	if err != nil {
+		tokens = nil
+	}
+
+	return tokens, err
+}
+
+func (r *EnteranceTokenRepositoryGorm) ListConflictingEnteranceToken(ctx context.Context, token *domain.EnteranceToken) ([]*domain.EnteranceToken, error) {
+	tokens := make([]*domain.EnteranceToken, 0)
+
+	// students assigned to token
+	students := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Table("examine_students").
+		Select("student_id").
+		Where("enterance_token_id = ?", token.ID.String()).
+		Where("deleted_at IS NULL")
+	same := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Where("enterance_tokens.id IN (?)", r.DB.
+			Session(&gorm.Session{NewDB: true}).
+			Table("examine_students").
+			Select("enterance_token_id").
+			Where("student_id IN (?)", students).
+			Where("deleted_at IS NULL"),
+		).
+		Or("(enterance_tokens.class <> '' OR enterance_tokens.grade <> '') AND EXISTS (?)", r.DB.
+			Session(&gorm.Session{NewDB: true}).
+			Table("examine_students").
+			Select("1").
+			Joins("JOIN students ON students.id = examine_students.student_id AND students.deleted_at IS NULL").
+			Where("examine_students.enterance_token_id = ?", token.ID.String()).
+			Where("examine_students.deleted_at IS NULL").
+			Where("enterance_tokens.class = '' OR students.class = enterance_tokens.class").
+			Where("enterance_tokens.grade = '' OR students.grade = enterance_tokens.grade"),
+		)
+	if token.Class != "" || token.Grade != "" {
+		same = same.Or(scheduledFor(r.DB, token.Class, token.Grade))
+	}
+
+	err := r.DB.
+		WithContext(ctx).
+		Model(&domain.EnteranceToken{}).
+		Scopes(r.scope(ctx)).
+		Where("enterance_tokens.id <> ?", token.ID.String()).
+		Where("enterance_tokens.enterance_from < ? AND enterance_tokens.enterance_until > ?", token.EnteranceUntil, token.EnteranceFrom).
+		Where(same).
+		Order("enterance_tokens.enterance_from").
+		Order("enterance_tokens.id").
+		Find(&tokens).
+		Error
+	if err != nil {
+		tokens = nil
+	}
+
+	return tokens, err
+}
+
+func (r *EnteranceTokenRepositoryGorm) ListConflictingEnteranceTokenOfStudents(ctx context.Context, token *domain.EnteranceToken, studentIDs []raid.Raid) ([]*domain.EnteranceToken, error) {
+	tokens := make([]*domain.EnteranceToken, 0)
+	if len(studentIDs) == 0 {
+		return tokens, nil
+	}
+	ids := make([]string, 0, len(studentIDs))
+	for _, id := range studentIDs {
+		ids = append(ids, id.String())
+	}
+
+	// tokens students are assigned to, due date of student on other token
+	// widens its window too
+	assigned := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Table("examine_students").
+		Select("1").
+		Where("examine_students.enterance_token_id = enterance_tokens.id").
+		Where("examine_students.student_id IN ?", ids).
+		Where("examine_students.deleted_at IS NULL").
+		Where("enterance_tokens.enterance_until > ? OR examine_students.due_date > ?", token.EnteranceFrom, token.EnteranceFrom)
+	// tokens scheduled for class or grade of students
+	scheduled := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Table("students").
+		Select("1").
+		Where("students.id IN ?", ids).
+		Where("students.deleted_at IS NULL").
+		Where("enterance_tokens.class = '' OR students.class = enterance_tokens.class").
+		Where("enterance_tokens.grade = '' OR students.grade = enterance_tokens.grade")
+
+	err := r.DB.
 		WithContext(ctx).
-		Delete(&domain.EnteranceToken{}, "id = ?", tokenID.String()).
+		Model(&domain.EnteranceToken{}).
+		Scopes(r.scope(ctx)).
+		Where("enterance_tokens.id <> ?", token.ID.String()).
+		Where("enterance_tokens.enterance_from < ?", token.EnteranceUntil).
+		Where(r.DB.
+			Session(&gorm.Session{NewDB: true}).
+			Where("EXISTS (?)", assigned).
+			Or("(enterance_tokens.class <> '' OR enterance_tokens.grade <> '') AND enterance_tokens.enterance_until > ? AND EXISTS (?)", token.EnteranceFrom, scheduled),
+		).
+		Order("enterance_tokens.enterance_from").
+		Order("enterance_tokens.id").
+		Find(&tokens).
 		Error
+	if err != nil {
+		tokens = nil
+	}
+
+	return tokens, err
+}
+
+func (r *EnteranceTokenRepositoryGorm) DeleteEnteranceToken(ctx context.Context, tokenID raid.Raid) error {
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(r.scope(ctx)).
+		Delete(&domain.EnteranceToken{}, "id = ?", tokenID.String())
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrEnteranceTokenNotFound
+	}
+	return res.Error
 }
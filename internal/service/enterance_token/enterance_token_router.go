@@ -1,8 +1,17 @@
 package enterancetoken
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/falentio/raid-go"
 	"github.com/go-chi/chi/v5"
@@ -10,21 +19,38 @@ import (
 
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/ical"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
 type EnteranceTokenRouter struct {
 	EnteranceTokenService *EnteranceTokenService
 	Auth                  *auth.Auth
+	Idempotency           *idempotency.Idempotency
 }
 
 func (e *EnteranceTokenRouter) Route(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(e.Auth.VerifyQueryMiddleware(FeedParam, domain.PermissionScheduleFeed))
+		r.Use(middleware.NoCache)
+		r.Get("/schedule.ics", e.ExportSchedule)
+	})
 	r.Group(func(r chi.Router) {
 		r.Use(e.Auth.VerifyMiddleware)
 		r.Use(middleware.NoCache)
+		r.Get("/schedule", e.ListSchedule)
+		// feed url carries api token, so only signed in admin creates it
+		r.With(e.Auth.RequireSession).Post("/schedule-feed", e.CreateScheduleFeed)
 		r.Get("/{enteranceTokenID}", e.GetEnteranceToken)
-		r.Get("/{enteranceTokenID}/examination", e.GetEnteranceToken)
-		r.Post("/create", e.CreateEnteranceToken)
+		r.Get("/code/{code}", e.GetEnteranceTokenByCode)
+		r.Get("/{enteranceTokenID}/examination", e.GetExamination)
+		r.Get("/{enteranceTokenID}/students", e.ListExamineStudent)
+		r.Post("/{enteranceTokenID}/students/assign", e.AssignExamineStudent)
+		r.Post("/{enteranceTokenID}/students/unassign", e.UnassignExamineStudent)
+		r.Put("/{enteranceTokenID}/students/{studentID}", e.AssignExamineStudent)
+		r.Delete("/{enteranceTokenID}/students/{studentID}", e.UnassignExamineStudent)
+		r.With(e.Idempotency.Middleware).Post("/create", e.CreateEnteranceToken)
 		r.Put("/{enteranceTokenID}", e.UpdateEnteranceToken)
 		r.Delete("/{enteranceTokenID}", e.DeleteEnteranceToken)
 	})
@@ -48,6 +74,16 @@ func (e *EnteranceTokenRouter) GetEnteranceToken(w http.ResponseWriter, r *http.
 	res.ServeHTTP(w, r)
 }
 
+func (e *EnteranceTokenRouter) GetEnteranceTokenByCode(w http.ResponseWriter, r *http.Request) {
+	res, err := e.EnteranceTokenService.GetEnteranceTokenByCode(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
 func (e *EnteranceTokenRouter) GetExamination(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "enteranceTokenID")
 	id, err := raid.RaidFromString(idStr)
@@ -150,3 +186,250 @@ func (e *EnteranceTokenRouter) ListEnteranceToken(w http.ResponseWriter, r *http
 
 	res.ServeHTTP(w, r)
 }
+
+// scheduleOptions reads filters of schedule from query, times are RFC 3339.
+func scheduleOptions(q url.Values) (*domain.ScheduleOptions, error) {
+	o := &domain.ScheduleOptions{Class: q.Get("class"), Grade: q.Get("grade")}
+	if v := q.Get("adminID"); v != "" {
+		id, err := raid.RaidFromString(v)
+		if err != nil {
+			return nil, response.NewBadRequest(map[string]string{"adminID": "invalid"}, "invalid query param adminID, got %q", v)
+		}
+		o.AdminID = id
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &o.From},
+		{"until", &o.Until},
+	} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, response.NewBadRequest(map[string]string{f.name: "invalid"}, "invalid query param %s, got %q", f.name, v)
+		}
+		*f.dst = t
+	}
+	return o, nil
+}
+
+func (e *EnteranceTokenRouter) ListSchedule(w http.ResponseWriter, r *http.Request) {
+	o, err := scheduleOptions(r.URL.Query())
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := e.EnteranceTokenService.ListSchedule(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (e *EnteranceTokenRouter) CreateScheduleFeed(w http.ResponseWriter, r *http.Request) {
+	o := &domain.ScheduleOptions{}
+	if err := json.NewDecoder(r.Body).Decode(o); err != nil && !errors.Is(err, io.EOF) {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := e.EnteranceTokenService.CreateScheduleFeed(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (e *EnteranceTokenRouter) ExportSchedule(w http.ResponseWriter, r *http.Request) {
+	o, err := scheduleOptions(r.URL.Query())
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := e.EnteranceTokenService.ExportSchedule(r.Context(), o, buf); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="schedule.ics"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+// assignmentsFromCSV reads students from csv with header, students are
+// identified by studentID or username column and dueDate column is optional.
+func assignmentsFromCSV(r io.Reader) ([]*domain.StudentAssignment, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, response.NewBadRequest(nil, "csv is empty")
+	}
+	if err != nil {
+		return nil, response.NewBadRequest(nil, "failed to read csv: %s", err)
+	}
+	column := map[string]int{"studentid": -1, "username": -1, "duedate": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := column[name]; ok {
+			column[name] = i
+		}
+	}
+	if column["studentid"] < 0 && column["username"] < 0 {
+		return nil, response.NewBadRequest(nil, "csv must has studentID or username column")
+	}
+	get := func(record []string, name string) string {
+		if i := column[name]; i >= 0 && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	students := make([]*domain.StudentAssignment, 0)
+	errs := make(map[string]string)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, response.NewBadRequest(nil, "failed to read csv: %s", err)
+		}
+		key := fmt.Sprintf("line.%d", line)
+		sa := &domain.StudentAssignment{Username: get(record, "username")}
+		if v := get(record, "studentid"); v != "" {
+			if sa.StudentID, err = raid.RaidFromString(v); err != nil {
+				errs[key] = "invalid studentID"
+				continue
+			}
+		}
+		if v := get(record, "duedate"); v != "" {
+			if sa.DueDate, err = time.Parse(time.RFC3339, v); err != nil {
+				errs[key] = "invalid dueDate"
+				continue
+			}
+		}
+		if sa.StudentID.IsNil() && sa.Username == "" {
+			continue
+		}
+		students = append(students, sa)
+	}
+	if len(errs) > 0 {
+		return nil, response.NewBadRequest(errs, "invalid %d lines of csv", len(errs))
+	}
+	return students, nil
+}
+
+// assignOptions reads students selected by request, from url when it
+// selects a student, from csv body or from json body.
+func assignOptions(r *http.Request) (*domain.AssignExamineStudentOptions, error) {
+	idStr := chi.URLParam(r, "enteranceTokenID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		return nil, response.NewBadRequest(nil, "invalid enteranceTokenID received: %q", idStr)
+	}
+	o := &domain.AssignExamineStudentOptions{}
+
+	if idStr := chi.URLParam(r, "studentID"); idStr != "" {
+		studentID, err := raid.RaidFromString(idStr)
+		if err != nil {
+			return nil, response.NewBadRequest(nil, "invalid studentID received: %q", idStr)
+		}
+		sa := &domain.StudentAssignment{}
+		// body is optional, it only carries due date of student
+		if err := json.NewDecoder(r.Body).Decode(sa); err != nil && !errors.Is(err, io.EOF) {
+			return nil, response.NewBadRequest(nil, "failed to decode body")
+		}
+		sa.StudentID, sa.Username = studentID, ""
+		o.Students = []*domain.StudentAssignment{sa}
+		o.EnteranceTokenID = id
+		return o, nil
+	}
+
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "text/csv" {
+		q := r.URL.Query()
+		if v := q.Get("dueDate"); v != "" {
+			if o.DueDate, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, response.NewBadRequest(map[string]string{"dueDate": "invalid"}, "invalid query param dueDate, got %q", v)
+			}
+		}
+		if o.Students, err = assignmentsFromCSV(r.Body); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(o); err != nil {
+		return nil, response.NewBadRequest(nil, "failed to decode body")
+	}
+	o.EnteranceTokenID = id
+	return o, nil
+}
+
+func (e *EnteranceTokenRouter) AssignExamineStudent(w http.ResponseWriter, r *http.Request) {
+	o, err := assignOptions(r)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := e.EnteranceTokenService.AssignExamineStudent(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (e *EnteranceTokenRouter) UnassignExamineStudent(w http.ResponseWriter, r *http.Request) {
+	o, err := assignOptions(r)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := e.EnteranceTokenService.UnassignExamineStudent(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (e *EnteranceTokenRouter) ListExamineStudent(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "enteranceTokenID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid enteranceTokenID received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	o := &domain.ListExamineStudentOptions{EnteranceTokenID: id}
+	if err := o.PageFromQuery(r.URL.Query()); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := e.EnteranceTokenService.ListExamineStudent(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
@@ -4,33 +4,67 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/falentio/raid-go"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/ical"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 	"github.com/falentio/skul/internal/pkg/xrand"
 )
 
 var EnteranceTokenIDFactory = raid.NewRaid().WithPrefix(domain.EnteranceTokenIDPrefix)
 
+const (
+	// FeedParam is url query param carrying token of schedule feed.
+	FeedParam = "token"
+	// FeedLifetime is how long token of schedule feed is valid, calendar
+	// applications keep polling the feed long after it was subscribed.
+	FeedLifetime = 365 * 24 * time.Hour
+
+	codeLength   = 6
+	codeAttempts = 5
+)
+
 type EnteranceTokenService struct {
 	EnteranceTokenRepository domain.EnteranceTokenRepository
 	ExaminationRepository    domain.ExaminationRepositoryRead
-	ExamineStudentRepository domain.ExamineStudentRepositoryRead
+	ExamineStudentRepository domain.ExamineStudentRepository
+	StudentRepository        domain.StudentRepositoryRead
+	APITokenIssuer           domain.APITokenIssuer
 	Auth                     *auth.Auth
+	Tracing                  *tracing.Tracing
+	Audit                    *audit.Recorder
+
+	// EntryGrace widens enterance token window on both ends when student
+	// opens examination.
+	EntryGrace time.Duration
 }
 
 func (s *EnteranceTokenService) GetEnteranceToken(ctx context.Context, tokenID raid.Raid) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.GetEnteranceToken")
+	defer span.End()
+
 	id, err := s.Auth.GetSubjectRaid(ctx, "")
 	if err != nil {
 		return nil, err
 	}
 
-	if id.Prefix() != domain.AdminIDPrefix {
+	role := s.Auth.GetRole(ctx)
+	if !role.Can(domain.PermissionEnteranceTokenRead) {
+		if !role.Can(domain.PermissionExamTake) {
+			return nil, auth.ErrForbidden
+		}
 		stds, err := s.ExamineStudentRepository.ListExamineStudent(ctx, &domain.ListExamineStudentOptions{
 			StudentID:        id,
 			EnteranceTokenID: tokenID,
@@ -50,7 +84,7 @@ func (s *EnteranceTokenService) GetEnteranceToken(ctx context.Context, tokenID r
 	if err != nil {
 		return nil, err
 	}
-	if id.Prefix() != domain.AdminIDPrefix {
+	if !role.Can(domain.PermissionEnteranceTokenRead) {
 		token.Students = nil
 	}
 
@@ -58,12 +92,20 @@ func (s *EnteranceTokenService) GetEnteranceToken(ctx context.Context, tokenID r
 }
 
 func (s *EnteranceTokenService) GetExamination(ctx context.Context, tokenID raid.Raid) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.GetExamination")
+	defer span.End()
+
 	id, err := s.Auth.GetSubjectRaid(ctx, "")
 	if err != nil {
 		return nil, err
 	}
 
-	if id.Prefix() != domain.AdminIDPrefix {
+	role := s.Auth.GetRole(ctx)
+	var es *domain.ExamineStudent
+	if !role.Can(domain.PermissionExaminationRead) {
+		if !role.Can(domain.PermissionExamTake) {
+			return nil, auth.ErrForbidden
+		}
 		stds, err := s.ExamineStudentRepository.ListExamineStudent(ctx, &domain.ListExamineStudentOptions{
 			StudentID:        id,
 			EnteranceTokenID: tokenID,
@@ -74,6 +116,7 @@ func (s *EnteranceTokenService) GetExamination(ctx context.Context, tokenID raid
 		if len(stds) == 0 {
 			return nil, response.NewForbidden(nil, "student with id %q does has permission to use enterance token with id %q", id, tokenID)
 		}
+		es = stds[0]
 	}
 
 	token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, tokenID)
@@ -83,8 +126,16 @@ func (s *EnteranceTokenService) GetExamination(ctx context.Context, tokenID raid
 	if err != nil {
 		return nil, err
 	}
+	if es != nil {
+		if err := s.enter(ctx, token, es); err != nil {
+			return nil, err
+		}
+	}
 
 	exa, err := s.ExaminationRepository.GetExamination(ctx, token.ExaminationID)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", token.ExaminationID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +143,7 @@ func (s *EnteranceTokenService) GetExamination(ctx context.Context, tokenID raid
 		return nil, response.NewBadRequest(nil, "invalid examination, question count is less then desired ammount")
 	}
 
-	if id.Prefix() != domain.AdminIDPrefix {
+	if !role.Can(domain.PermissionExaminationRead) {
 		rng := rand.New(rand.NewSource(0))
 		seed := fmt.Sprintf("%s%s%s", tokenID, exa.ID, id)
 		xrand.Seed(rng, seed)
@@ -145,7 +196,10 @@ func (s *EnteranceTokenService) GetExamination(ctx context.Context, tokenID raid
 }
 
 func (s *EnteranceTokenService) ListEnteranceToken(ctx context.Context, o *domain.ListEnteranceTokenOptions) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.ListEnteranceToken")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenRead)
 	if err != nil {
 		return nil, err
 	}
@@ -159,16 +213,33 @@ func (s *EnteranceTokenService) ListEnteranceToken(ctx context.Context, o *domai
 }
 
 func (s *EnteranceTokenService) CreateEnteranceToken(ctx context.Context, token *domain.EnteranceToken) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.CreateEnteranceToken")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := validator.Struct(token); err != nil {
+	token.ID = EnteranceTokenIDFactory.WithRandom().WithTimestampNow()
+	if err := s.validate(token); err != nil {
+		return nil, err
+	}
+	if err := s.checkConflict(ctx, token); err != nil {
+		return nil, err
+	}
+	if err := s.assignCode(ctx, token, nil); err != nil {
 		return nil, err
 	}
 
-	if err := s.EnteranceTokenRepository.CreateEnteranceToken(ctx, token); err != nil {
+	err = s.EnteranceTokenRepository.CreateEnteranceToken(ctx, token)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", token.ExaminationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditEnteranceTokenCreate, token.ID, nil, token); err != nil {
 		return nil, err
 	}
 
@@ -176,16 +247,59 @@ func (s *EnteranceTokenService) CreateEnteranceToken(ctx context.Context, token
 }
 
 func (s *EnteranceTokenService) UpdateEnteranceToken(ctx context.Context, token *domain.EnteranceToken) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.UpdateEnteranceToken")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
 	if err != nil {
 		return nil, err
 	}
 
+	token.Code = domain.NormalizeCode(token.Code)
 	if err := validator.Struct(token); err != nil {
 		return nil, err
 	}
 
-	if err := s.EnteranceTokenRepository.UpdateEnteranceToken(ctx, token); err != nil {
+	before, _ := s.EnteranceTokenRepository.GetEnteranceToken(ctx, token.ID)
+	if before != nil {
+		// fields left empty are not updated
+		merged := *before
+		if !token.EnteranceFrom.IsZero() {
+			merged.EnteranceFrom = token.EnteranceFrom
+		}
+		if !token.EnteranceUntil.IsZero() {
+			merged.EnteranceUntil = token.EnteranceUntil
+		}
+		if token.Class != "" {
+			merged.Class = token.Class
+		}
+		if token.Grade != "" {
+			merged.Grade = token.Grade
+		}
+		if !merged.EnteranceUntil.After(merged.EnteranceFrom) {
+			return nil, response.NewBadRequest(map[string]string{"enteranceUntil": "gtfield"}, "enteranceUntil must be after enteranceFrom")
+		}
+		if err := s.checkConflict(ctx, &merged); err != nil {
+			return nil, err
+		}
+		if token.Code != "" && token.Code != before.Code {
+			if err := s.checkCode(ctx, token.Code); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = s.EnteranceTokenRepository.UpdateEnteranceToken(ctx, token)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", token.ExaminationID)
+	}
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		err = response.NewNotFound(nil, "can not find enterance token with id %q", token.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	after, _ := s.EnteranceTokenRepository.GetEnteranceToken(ctx, token.ID)
+	if err := s.Audit.Record(ctx, domain.AuditEnteranceTokenUpdate, token.ID, before, after); err != nil {
 		return nil, err
 	}
 
@@ -193,33 +307,549 @@ func (s *EnteranceTokenService) UpdateEnteranceToken(ctx context.Context, token
 }
 
 func (s *EnteranceTokenService) BatchCreateEnteranceToken(ctx context.Context, tokens []*domain.EnteranceToken) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.BatchCreateEnteranceToken")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, token := range tokens {
-		if err := validator.Struct(token); err != nil {
+	for i, token := range tokens {
+		token.ID = EnteranceTokenIDFactory.WithRandom().WithTimestampNow()
+		if err := s.validate(token); err != nil {
+			return nil, err
+		}
+		if err := s.checkConflict(ctx, token); err != nil {
+			return nil, err
+		}
+		for _, other := range tokens[:i] {
+			if token.Overlaps(other) && token.SameAudience(other) {
+				return nil, response.NewConflict(nil, "enterance token %d overlaps other enterance token of the same students in batch", i)
+			}
+		}
+		if err := s.assignCode(ctx, token, tokens[:i]); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := s.EnteranceTokenRepository.BatchCreateEnteranceToken(ctx, tokens); err != nil {
+	err = s.EnteranceTokenRepository.BatchCreateEnteranceToken(ctx, tokens)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination for one of enterance tokens")
+	}
+	if err != nil {
 		return nil, err
 	}
+	for _, token := range tokens {
+		if err := s.Audit.Record(ctx, domain.AuditEnteranceTokenCreate, token.ID, nil, token); err != nil {
+			return nil, err
+		}
+	}
 
 	return response.NewOK(tokens), nil
 }
 
 func (s *EnteranceTokenService) DeleteEnteranceToken(ctx context.Context, tokenID raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.DeleteEnteranceToken")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	before, _ := s.EnteranceTokenRepository.GetEnteranceToken(ctx, tokenID)
+	err = s.EnteranceTokenRepository.DeleteEnteranceToken(ctx, tokenID)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		err = response.NewNotFound(nil, "can not find enterance token with id %q", tokenID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditEnteranceTokenDelete, tokenID, before, nil); err != nil {
+		return nil, err
+	}
+
+	return response.NewNoContent(), nil
+}
+
+// checkConflict refuses token whose window overlaps window of other token
+// scheduled for the same students.
+func (s *EnteranceTokenService) checkConflict(ctx context.Context, token *domain.EnteranceToken) error {
+	ts, err := s.EnteranceTokenRepository.ListConflictingEnteranceToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	return conflict(ts)
+}
+
+// checkAssignConflict refuses assignment of ess to token when window of token
+// as seen by the assigned student, widened by its due date, overlaps window of
+// other token scheduled for the student.
+func (s *EnteranceTokenService) checkAssignConflict(ctx context.Context, token *domain.EnteranceToken, ess []*domain.ExamineStudent) error {
+	// students sharing due date share window, usually all of them do
+	order := make([]int64, 0, 1)
+	groups := make(map[int64][]*domain.ExamineStudent)
+	for _, es := range ess {
+		key := es.DueDate.UnixNano()
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], es)
+	}
+
+	seen := make(map[string]bool)
+	conflicting := make([]*domain.EnteranceToken, 0)
+	for _, key := range order {
+		ids := make([]raid.Raid, 0, len(groups[key]))
+		for _, es := range groups[key] {
+			ids = append(ids, es.StudentID)
+		}
+		ts, err := s.EnteranceTokenRepository.ListConflictingEnteranceTokenOfStudents(ctx, token.WindowFor(groups[key][0]), ids)
+		if err != nil {
+			return err
+		}
+		for _, t := range ts {
+			if !seen[t.ID.String()] {
+				seen[t.ID.String()] = true
+				conflicting = append(conflicting, t)
+			}
+		}
+	}
+	return conflict(conflicting)
+}
+
+// conflict returns conflict error listing ts, or nil when ts is empty.
+func conflict(ts []*domain.EnteranceToken) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	errs := make(map[string]string, len(ts))
+	for _, t := range ts {
+		errs[t.ID.String()] = fmt.Sprintf("scheduled from %s until %s", t.EnteranceFrom.Format(time.RFC3339), t.EnteranceUntil.Format(time.RFC3339))
+	}
+	return response.NewConflict(errs, "enterance token overlaps %d enterance token of the same students", len(ts))
+}
+
+func (s *EnteranceTokenService) ListSchedule(ctx context.Context, o *domain.ScheduleOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.ListSchedule")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenRead)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := s.EnteranceTokenRepository.ListSchedule(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(ts), nil
+}
+
+// CreateScheduleFeed returns url of iCalendar feed of schedule, so it can be
+// subscribed from calendar applications. The url carries api token which can
+// only read the feed, it is listed with other api tokens of admin and revoked
+// by deleting it. Admin has single feed token, creating feed again rotates it
+// so url of earlier feed stops working.
+func (s *EnteranceTokenService) CreateScheduleFeed(ctx context.Context, o *domain.ScheduleOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.CreateScheduleFeed")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenRead); err != nil {
+		return nil, err
+	}
+
+	token := &domain.APIToken{
+		Name:      "schedule feed",
+		Scopes:    domain.Permissions{domain.PermissionScheduleFeed},
+		ExpiresAt: time.Now().Add(FeedLifetime),
+	}
+	if err := s.APITokenIssuer.RotateAPIToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	if o.Class != "" {
+		q.Set("class", o.Class)
+	}
+	if o.Grade != "" {
+		q.Set("grade", o.Grade)
+	}
+	if !o.AdminID.IsNil() {
+		q.Set("adminID", o.AdminID.String())
+	}
+	q.Set(FeedParam, token.Token)
+
+	return response.NewOK(&domain.ScheduleFeed{URL: "schedule.ics?" + q.Encode()}), nil
+}
+
+// ExportSchedule writes schedule as iCalendar to w.
+func (s *EnteranceTokenService) ExportSchedule(ctx context.Context, o *domain.ScheduleOptions, w io.Writer) error {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.ExportSchedule")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionScheduleFeed); err != nil {
+		return err
+	}
+
+	ts, err := s.EnteranceTokenRepository.ListSchedule(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(o.Grade + " " + o.Class)
+	if name == "" {
+		name = "Examination schedule"
+	}
+	c := &ical.Calendar{
+		ProductID: "-//skul//examination schedule//EN",
+		Name:      name,
+		Events:    make([]*ical.Event, 0, len(ts)),
+	}
+	for _, t := range ts {
+		e := &ical.Event{
+			UID:     t.ID.String() + "@skul",
+			Summary: "Examination",
+			Start:   t.EnteranceFrom,
+			End:     t.EnteranceUntil,
+			Updated: t.UpdatedAt,
+		}
+		if t.Examination != nil {
+			e.Summary = t.Examination.Name
+		}
+		if audience := strings.TrimSpace(t.Grade + " " + t.Class); audience != "" {
+			e.Description = "Scheduled for " + audience
+		}
+		c.Events = append(c.Events, e)
+	}
+
+	_, err = c.WriteTo(w)
+	return err
+}
+
+// validate validates new token, its code is normalized first.
+func (s *EnteranceTokenService) validate(token *domain.EnteranceToken) error {
+	token.Code = domain.NormalizeCode(token.Code)
+	if err := validator.Struct(token); err != nil {
+		return err
+	}
+	if !token.EnteranceUntil.After(token.EnteranceFrom) {
+		return response.NewBadRequest(map[string]string{"enteranceUntil": "gtfield"}, "enteranceUntil must be after enteranceFrom")
+	}
+	return nil
+}
+
+// checkCode refuses code already used by other token, codes are unique
+// across organizations.
+func (s *EnteranceTokenService) checkCode(ctx context.Context, code string) error {
+	_, err := s.EnteranceTokenRepository.GetEnteranceTokenByCode(tenant.Unscoped(ctx), code)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return response.NewConflict(map[string]string{"code": "taken"}, "code %q is already used by other enterance token", code)
+}
+
+// assignCode generates code of token when it has none, pending are tokens
+// not created yet whose codes must not be reused.
+func (s *EnteranceTokenService) assignCode(ctx context.Context, token *domain.EnteranceToken, pending []*domain.EnteranceToken) error {
+	taken := func(code string) bool {
+		for _, t := range pending {
+			if t.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+	if token.Code != "" {
+		if taken(token.Code) {
+			return response.NewConflict(map[string]string{"code": "taken"}, "code %q is used by other enterance token in batch", token.Code)
+		}
+		return s.checkCode(ctx, token.Code)
+	}
+	for i := 0; i < codeAttempts; i++ {
+		code := xrand.Smol.GenerateCode(codeLength)
+		if taken(code) {
+			continue
+		}
+		_, err := s.EnteranceTokenRepository.GetEnteranceTokenByCode(tenant.Unscoped(ctx), code)
+		if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+			token.Code = code
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("EnteranceTokenService: failed to generate unique code after %d attempts", codeAttempts)
+}
+
+// enter refuses student opening examination of token outside of its window,
+// and records start of attempt of student.
+func (s *EnteranceTokenService) enter(ctx context.Context, token *domain.EnteranceToken, es *domain.ExamineStudent) error {
+	token = token.WindowFor(es)
+	now := time.Now()
+	err := token.CheckEntry(now, s.EntryGrace, es.StartedAt != nil)
+	switch {
+	case errors.Is(err, domain.ErrEnteranceTokenNotOpen):
+		return response.NewForbidden(map[string]string{"enteranceToken": "not_open"}, "enterance token with id %q is not open yet, it opens at %s", token.ID, token.EnteranceFrom.Format(time.RFC3339))
+	case errors.Is(err, domain.ErrEnteranceTokenClosed):
+		return response.NewForbidden(map[string]string{"enteranceToken": "closed"}, "enterance token with id %q is closed since %s", token.ID, token.EnteranceUntil.Format(time.RFC3339))
+	case errors.Is(err, domain.ErrEnteranceTokenLate):
+		late := token.EnteranceFrom.Add(time.Duration(token.LateEntryMinutes) * time.Minute)
+		return response.NewForbidden(map[string]string{"enteranceToken": "late"}, "late entry of enterance token with id %q is closed since %s", token.ID, late.Format(time.RFC3339))
+	case err != nil:
+		return err
+	}
+	if es.StartedAt != nil {
+		return nil
+	}
+	return s.ExamineStudentRepository.StartExamineStudent(ctx, token.ID, es.StudentID, now)
+}
+
+// GetEnteranceTokenByCode returns token with code typed by student, code is
+// matched regardless of case and separators. Student not assigned to token
+// is answered as if code did not exist, so codes can not be enumerated.
+func (s *EnteranceTokenService) GetEnteranceTokenByCode(ctx context.Context, code string) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.GetEnteranceTokenByCode")
+	defer span.End()
+
+	role := s.Auth.GetRole(ctx)
+	if !role.Can(domain.PermissionEnteranceTokenRead) && !role.Can(domain.PermissionExamTake) {
+		return nil, auth.ErrForbidden
+	}
+
+	code = domain.NormalizeCode(code)
+	notFound := response.NewNotFound(nil, "can not find enterance token with code %q", code)
+	if code == "" {
+		return nil, notFound
+	}
+	token, err := s.EnteranceTokenRepository.GetEnteranceTokenByCode(ctx, code)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		return nil, notFound
+	}
 	if err != nil {
 		return nil, err
 	}
+	if !role.Can(domain.PermissionEnteranceTokenRead) {
+		id, err := s.Auth.GetSubjectRaid(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		stds, err := s.ExamineStudentRepository.ListExamineStudent(ctx, &domain.ListExamineStudentOptions{
+			StudentID:        id,
+			EnteranceTokenID: token.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(stds) == 0 {
+			return nil, notFound
+		}
+	}
+
+	return s.GetEnteranceToken(ctx, token.ID)
+}
+
+// selectStudents returns students selected by o, assigned to token with their
+// own due date or due date of o.
+func (s *EnteranceTokenService) selectStudents(ctx context.Context, token *domain.EnteranceToken, o *domain.AssignExamineStudentOptions) ([]*domain.ExamineStudent, error) {
+	if len(o.Students) == 0 && o.Class == "" && o.Grade == "" {
+		return nil, response.NewBadRequest(nil, "no student is selected, students, class or grade is required")
+	}
+
+	ess := make([]*domain.ExamineStudent, 0, len(o.Students))
+	seen := make(map[string]bool)
+	add := func(studentID raid.Raid, dueDate time.Time) {
+		if seen[studentID.String()] {
+			return
+		}
+		seen[studentID.String()] = true
+		if dueDate.IsZero() {
+			dueDate = o.DueDate
+		}
+		ess = append(ess, &domain.ExamineStudent{
+			EnteranceTokenID: token.ID,
+			StudentID:        studentID,
+			DueDate:          dueDate,
+		})
+	}
+
+	errs := make(map[string]string)
+	for i, sa := range o.Students {
+		key := fmt.Sprintf("students.%d", i)
+		var (
+			student *domain.Student
+			err     error
+		)
+		switch {
+		case !sa.StudentID.IsNil():
+			student, err = s.StudentRepository.GetStudent(ctx, sa.StudentID)
+		case sa.Username != "":
+			student, err = s.StudentRepository.GetStudentByUsername(ctx, sa.Username)
+		default:
+			errs[key] = "required"
+			continue
+		}
+		if errors.Is(err, domain.ErrStudentNotFound) {
+			errs[key] = "not_found"
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		add(student.ID, sa.DueDate)
+	}
+	if len(errs) > 0 {
+		return nil, response.NewBadRequest(errs, "invalid %d of selected students", len(errs))
+	}
+
+	if o.Class != "" || o.Grade != "" {
+		students, err := s.StudentRepository.ListStudent(ctx, &domain.ListStudentOptions{
+			Class: o.Class,
+			Grade: o.Grade,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, student := range students {
+			add(student.ID, time.Time{})
+		}
+	}
+	return ess, nil
+}
+
+// AssignExamineStudent assigns students selected by o to enterance token,
+// student already assigned gets its due date replaced.
+func (s *EnteranceTokenService) AssignExamineStudent(ctx context.Context, o *domain.AssignExamineStudentOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.AssignExamineStudent")
+	defer span.End()
 
-	if err := s.EnteranceTokenRepository.DeleteEnteranceToken(ctx, tokenID); err != nil {
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, o.EnteranceTokenID)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		return nil, response.NewNotFound(nil, "can not find enterance token with id %q", o.EnteranceTokenID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ess, err := s.selectStudents(ctx, token, o)
+	if err != nil {
+		return nil, err
+	}
+	for _, es := range ess {
+		if !es.DueDate.IsZero() && !es.DueDate.After(token.EnteranceFrom) {
+			return nil, response.NewBadRequest(map[string]string{"dueDate": "invalid"}, "due date of student with id %q must be after enterance from of token", es.StudentID)
+		}
+	}
+	if err := s.checkAssignConflict(ctx, token, ess); err != nil {
+		return nil, err
+	}
+
+	err = s.ExamineStudentRepository.AssignExamineStudent(ctx, ess)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find some of selected students")
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.Audit.Record(ctx, domain.AuditEnteranceTokenAssign, token.ID, nil, map[string]any{
+		"class":   o.Class,
+		"grade":   o.Grade,
+		"dueDate": o.DueDate,
+		"count":   len(ess),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(ess), nil
+}
+
+// UnassignExamineStudent unassigns students selected by o from enterance
+// token, students who are not assigned are ignored.
+func (s *EnteranceTokenService) UnassignExamineStudent(ctx context.Context, o *domain.AssignExamineStudentOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.UnassignExamineStudent")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, o.EnteranceTokenID)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		return nil, response.NewNotFound(nil, "can not find enterance token with id %q", o.EnteranceTokenID)
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	return nil, nil
+	ess, err := s.selectStudents(ctx, token, o)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]raid.Raid, 0, len(ess))
+	for _, es := range ess {
+		ids = append(ids, es.StudentID)
+	}
+
+	count, err := s.ExamineStudentRepository.UnassignExamineStudent(ctx, token.ID, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Audit.Record(ctx, domain.AuditEnteranceTokenUnassign, token.ID, map[string]any{
+		"class": o.Class,
+		"grade": o.Grade,
+		"count": count,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(map[string]int64{"unassigned": count}), nil
+}
+
+// ListExamineStudent returns students assigned to enterance token with status
+// of their attempt.
+func (s *EnteranceTokenService) ListExamineStudent(ctx context.Context, o *domain.ListExamineStudentOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "EnteranceTokenService.ListExamineStudent")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionEnteranceTokenRead)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, o.EnteranceTokenID)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		return nil, response.NewNotFound(nil, "can not find enterance token with id %q", o.EnteranceTokenID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o.WithStudent = true
+	ess, err := s.ExamineStudentRepository.ListExamineStudent(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, es := range ess {
+		es.Status = es.AttemptStatus(token, now)
+	}
+
+	return response.NewPaginate(ess, response.Page{
+		Count:  o.Count,
+		Offset: o.Offset,
+	}), nil
 }
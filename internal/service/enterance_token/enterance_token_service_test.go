@@ -0,0 +1,658 @@
+package enterancetoken
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/service/examine_student"
+	"github.com/falentio/skul/internal/service/student"
+)
+
+// fakeAPITokens issues api tokens of session in ctx and verifies them until
+// they are deleted or rotated.
+type fakeAPITokens struct {
+	auth   *auth.Auth
+	tokens map[string]*auth.Claims
+	issued int
+}
+
+func (f *fakeAPITokens) RotateAPIToken(ctx context.Context, token *domain.APIToken) error {
+	c, err := f.auth.GetClaims(ctx)
+	if err != nil {
+		return err
+	}
+	for t, issued := range f.tokens {
+		if issued.Subject == c.Subject {
+			delete(f.tokens, t)
+		}
+	}
+	f.issued++
+	token.Token = fmt.Sprintf("skul_%d", f.issued)
+	f.tokens[token.Token] = &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: c.Subject},
+		Role:             c.Role,
+		Organization:     c.Organization,
+		Scopes:           token.Scopes,
+	}
+	return nil
+}
+
+func (f *fakeAPITokens) VerifyAPIToken(ctx context.Context, token string) (*auth.Claims, error) {
+	if c, ok := f.tokens[token]; ok {
+		return c, nil
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+func TestSchedule(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:enterance_token_schedule?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Examination{}, &domain.EnteranceToken{}, &domain.Student{}, &domain.ExamineStudent{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	orgID, adminID := newID(domain.OrganizationIDPrefix), newID(domain.AdminIDPrefix)
+	ex := &domain.Examination{Name: "Matematika", OrganizationID: orgID, AdminID: adminID}
+	ex.ID = newID(domain.ExaminationIDPrefix)
+	if err := db.Create(ex).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	student := &domain.Student{Name: "ani", Class: "IPA 1", Grade: "10", OrganizationID: orgID, AdminID: adminID}
+	student.ID = newID(domain.StudentIDPrefix)
+	if err := db.Create(student).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	tokens := &fakeAPITokens{auth: a, tokens: make(map[string]*auth.Claims)}
+	a.Tokens = tokens
+	r := chi.NewRouter()
+	r.Route("/enterance-token", (&EnteranceTokenRouter{
+		Auth: a,
+		EnteranceTokenService: &EnteranceTokenService{
+			EnteranceTokenRepository: &EnteranceTokenRepositoryGorm{db},
+			APITokenIssuer:           tokens,
+			Auth:                     a,
+		},
+	}).Route)
+
+	c, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: adminID.String()},
+		Role:             domain.RoleTeacher,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	do := func(method, url string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.AddCookie(c)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time {
+		return day.Add(time.Duration(hour) * time.Hour)
+	}
+	create := func(class, grade string, from, until int) (int, *domain.EnteranceToken) {
+		w := do(http.MethodPost, "/enterance-token/create", &domain.EnteranceToken{
+			ExaminationID:  ex.ID,
+			Class:          class,
+			Grade:          grade,
+			EnteranceFrom:  at(from),
+			EnteranceUntil: at(until),
+		})
+		res := &struct {
+			Data *domain.EnteranceToken `json:"data"`
+		}{}
+		_ = json.NewDecoder(w.Body).Decode(res)
+		return w.Code, res.Data
+	}
+
+	code, morning := create("IPA 1", "10", 8, 10)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code, _ := create("", "10", 9, 11); code != http.StatusConflict {
+		t.Errorf("expected token of whole grade overlapping token of its class to be refused, got %d", code)
+	}
+	if code, _ := create("IPA 1", "11", 9, 11); code != http.StatusOK {
+		t.Errorf("expected token of other grade to be created, got %d", code)
+	}
+	code, noon := create("IPA 1", "10", 10, 12)
+	if code != http.StatusOK {
+		t.Errorf("expected token right after other token to be created, got %d", code)
+	}
+
+	// token without class and grade is scheduled only for assigned students
+	code, remedial := create("", "", 13, 15)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if err := db.Create(&domain.ExamineStudent{EnteranceTokenID: remedial.ID, StudentID: student.ID}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	w := do(http.MethodPut, "/enterance-token/"+remedial.ID.String(), &domain.EnteranceToken{EnteranceFrom: at(11), EnteranceUntil: at(13)})
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected token of assigned student overlapping token of its class to be refused, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), noon.ID.String()) {
+		t.Errorf("expected conflicting token to be listed, got %s", w.Body)
+	}
+
+	w = do(http.MethodGet, "/enterance-token/schedule?class="+url.QueryEscape("IPA 1")+"&grade=10", nil)
+	res := &struct {
+		Data []*domain.EnteranceToken `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+		t.Fatal(err.Error())
+	}
+	want := []raid.Raid{morning.ID, noon.ID, remedial.ID}
+	if len(res.Data) != len(want) {
+		t.Fatalf("expected %d tokens in schedule, got %d", len(want), len(res.Data))
+	}
+	for i, token := range res.Data {
+		if token.ID != want[i] {
+			t.Errorf("expected token %d of schedule to be %s, got %s", i, want[i], token.ID)
+		}
+	}
+
+	w = do(http.MethodGet, "/enterance-token/schedule?adminID="+newID(domain.AdminIDPrefix).String(), nil)
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil || len(res.Data) != 0 {
+		t.Errorf("expected schedule of other admin to be empty, got %d, err %v", len(res.Data), err)
+	}
+
+	createFeed := func() *domain.ScheduleFeed {
+		w := do(http.MethodPost, "/enterance-token/schedule-feed", &domain.ScheduleOptions{Class: "IPA 1", Grade: "10"})
+		feed := &struct {
+			Data *domain.ScheduleFeed `json:"data"`
+		}{}
+		if err := json.NewDecoder(w.Body).Decode(feed); err != nil || feed.Data == nil {
+			t.Fatalf("failed to decode feed, got %d: %v", w.Code, err)
+		}
+		return feed.Data
+	}
+	// calendar application has no session
+	calendar := func(feed *domain.ScheduleFeed) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/enterance-token/"+feed.URL, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := do(http.MethodGet, "/enterance-token/schedule-feed", nil); w.Code == http.StatusOK {
+		t.Errorf("expected feed to not be created by GET, got %d", w.Code)
+	}
+	rotated := createFeed()
+	feed := createFeed()
+	if len(tokens.tokens) != 1 {
+		t.Errorf("expected admin to keep single feed token, got %d", len(tokens.tokens))
+	}
+	if w := calendar(rotated); w.Code == http.StatusOK {
+		t.Error("expected earlier feed to be revoked once feed is created again")
+	}
+	w = calendar(feed)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("expected calendar, got %d %s", w.Code, w.Body)
+	}
+	if n := strings.Count(w.Body.String(), "BEGIN:VEVENT"); n != len(want) {
+		t.Errorf("expected %d events in calendar, got %d", len(want), n)
+	}
+	if !strings.Contains(w.Body.String(), "SUMMARY:Matematika") {
+		t.Errorf("expected event to be named after examination, got %s", w.Body)
+	}
+
+	for token, c := range tokens.tokens {
+		if len(c.Scopes) != 1 || c.Scopes[0] != domain.PermissionScheduleFeed {
+			t.Errorf("expected feed token to only read feed, got %v", c.Scopes)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/enterance-token/schedule", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected feed token to only be accepted by feed, got %d", w.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/enterance-token/schedule-feed", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected feed token to not create feed, got %d", w.Code)
+		}
+		delete(tokens.tokens, token)
+	}
+	if w := calendar(feed); w.Code == http.StatusOK {
+		t.Error("expected feed to be revoked once its api token is deleted")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/enterance-token/schedule.ics?token="+c.Value, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("expected session to not be accepted in url")
+	}
+}
+
+type fakeExaminationRepository map[raid.Raid]*domain.Examination
+
+func (r fakeExaminationRepository) GetExamination(ctx context.Context, examinationID raid.Raid) (*domain.Examination, error) {
+	if ex, ok := r[examinationID]; ok {
+		return ex, nil
+	}
+	return nil, domain.ErrExaminationNotFound
+}
+
+func (r fakeExaminationRepository) ListExamination(ctx context.Context, o *domain.ListExaminationOptions) ([]*domain.Examination, error) {
+	return nil, nil
+}
+
+func TestEntry(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:enterance_token_entry?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Examination{}, &domain.EnteranceToken{}, &domain.Student{}, &domain.ExamineStudent{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	orgID, adminID := newID(domain.OrganizationIDPrefix), newID(domain.AdminIDPrefix)
+	ex := &domain.Examination{Name: "Fisika", OrganizationID: orgID, AdminID: adminID}
+	ex.ID = newID(domain.ExaminationIDPrefix)
+	if err := db.Create(ex).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	student := &domain.Student{Name: "budi", OrganizationID: orgID, AdminID: adminID}
+	student.ID = newID(domain.StudentIDPrefix)
+	if err := db.Create(student).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	now := time.Now()
+	newToken := func(from, until time.Duration, lateEntry uint) *domain.EnteranceToken {
+		token := &domain.EnteranceToken{
+			ExaminationID:    ex.ID,
+			EnteranceFrom:    now.Add(from),
+			EnteranceUntil:   now.Add(until),
+			LateEntryMinutes: lateEntry,
+		}
+		token.ID = newID(domain.EnteranceTokenIDPrefix)
+		if err := db.Create(token).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := db.Create(&domain.ExamineStudent{EnteranceTokenID: token.ID, StudentID: student.ID}).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		return token
+	}
+	upcoming := newToken(time.Hour, 2*time.Hour, 0)
+	closed := newToken(-2*time.Hour, -time.Hour, 0)
+	late := newToken(-30*time.Minute, time.Hour, 10)
+	open := newToken(-30*time.Minute, time.Hour, 0)
+	// opens within grace
+	skewed := newToken(30*time.Second, time.Hour, 0)
+
+	repo := &examinestudent.ExamineStudetnRepositoryGorm{DB: db}
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	r := chi.NewRouter()
+	r.Route("/enterance-token", (&EnteranceTokenRouter{
+		Auth: a,
+		EnteranceTokenService: &EnteranceTokenService{
+			EnteranceTokenRepository: &EnteranceTokenRepositoryGorm{db},
+			ExaminationRepository:    fakeExaminationRepository{ex.ID: ex},
+			ExamineStudentRepository: repo,
+			Auth:                     a,
+			EntryGrace:               time.Minute,
+		},
+	}).Route)
+
+	sign := func(subject raid.Raid, role domain.Role) *http.Cookie {
+		c, err := a.Sign(auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: subject.String()},
+			Role:             role,
+			Organization:     orgID.String(),
+		})
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		return c
+	}
+	studentSession, teacherSession := sign(student.ID, domain.RoleStudent), sign(adminID, domain.RoleTeacher)
+	do := func(c *http.Cookie, method, url string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.AddCookie(c)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	enter := func(token *domain.EnteranceToken) (int, string) {
+		w := do(studentSession, http.MethodGet, "/enterance-token/"+token.ID.String()+"/examination", nil)
+		res := &response.HttpError{}
+		_ = json.NewDecoder(w.Body).Decode(res)
+		return w.Code, res.Errors["enteranceToken"]
+	}
+
+	for _, tc := range []struct {
+		name   string
+		token  *domain.EnteranceToken
+		code   int
+		reason string
+	}{
+		{"not open", upcoming, http.StatusForbidden, "not_open"},
+		{"closed", closed, http.StatusForbidden, "closed"},
+		{"late", late, http.StatusForbidden, "late"},
+		{"open", open, http.StatusOK, ""},
+		{"within grace", skewed, http.StatusOK, ""},
+	} {
+		if code, reason := enter(tc.token); code != tc.code || reason != tc.reason {
+			t.Errorf("%s: expected %d %q, got %d %q", tc.name, tc.code, tc.reason, code, reason)
+		}
+	}
+	if w := do(teacherSession, http.MethodGet, "/enterance-token/"+closed.ID.String()+"/examination", nil); w.Code != http.StatusOK {
+		t.Errorf("expected staff to open examination of closed token, got %d", w.Code)
+	}
+
+	ess, err := repo.ListExamineStudent(tenant.WithOrganization(context.Background(), orgID), &domain.ListExamineStudentOptions{StudentID: student.ID, EnteranceTokenID: open.ID})
+	if err != nil || len(ess) != 1 || ess[0].StartedAt == nil {
+		t.Fatalf("expected start of attempt to be recorded, got %+v, err %v", ess, err)
+	}
+	started := *ess[0].StartedAt
+
+	// student who started before late entry closed may enter again
+	if err := repo.StartExamineStudent(tenant.WithOrganization(context.Background(), orgID), late.ID, student.ID, late.EnteranceFrom); err != nil {
+		t.Fatal(err.Error())
+	}
+	if code, reason := enter(late); code != http.StatusOK {
+		t.Errorf("expected started attempt to be entered again, got %d %q", code, reason)
+	}
+	enter(open)
+	ess, _ = repo.ListExamineStudent(tenant.WithOrganization(context.Background(), orgID), &domain.ListExamineStudentOptions{StudentID: student.ID, EnteranceTokenID: open.ID})
+	if !ess[0].StartedAt.Equal(started) {
+		t.Errorf("expected start of attempt to be kept, got %s, want %s", ess[0].StartedAt, started)
+	}
+
+	t.Run("code", func(t *testing.T) {
+		create := func(code string) (int, *domain.EnteranceToken) {
+			w := do(teacherSession, http.MethodPost, "/enterance-token/create", &domain.EnteranceToken{
+				ExaminationID:  ex.ID,
+				Code:           code,
+				EnteranceFrom:  now.Add(3 * time.Hour),
+				EnteranceUntil: now.Add(4 * time.Hour),
+			})
+			res := &struct {
+				Data *domain.EnteranceToken `json:"data"`
+			}{}
+			_ = json.NewDecoder(w.Body).Decode(res)
+			return w.Code, res.Data
+		}
+		code, generated := create("")
+		if code != http.StatusOK || len(generated.Code) != codeLength {
+			t.Fatalf("expected code to be generated, got %d %+v", code, generated)
+		}
+		code, custom := create("fis-10a")
+		if code != http.StatusOK || custom.Code != "FIS10A" {
+			t.Fatalf("expected code to be normalized, got %d %+v", code, custom)
+		}
+		if code, _ := create("FIS 10A"); code != http.StatusConflict {
+			t.Errorf("expected taken code to be refused, got %d", code)
+		}
+		if code, _ := create("fis_10a"); code != http.StatusBadRequest {
+			t.Errorf("expected code with invalid character to be refused, got %d", code)
+		}
+
+		if err := db.Create(&domain.ExamineStudent{EnteranceTokenID: custom.ID, StudentID: student.ID}).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		w := do(studentSession, http.MethodGet, "/enterance-token/code/fis-10a", nil)
+		res := &struct {
+			Data *domain.EnteranceToken `json:"data"`
+		}{}
+		if err := json.NewDecoder(w.Body).Decode(res); err != nil || res.Data == nil || res.Data.ID != custom.ID {
+			t.Errorf("expected token to be found by code, got %d %+v", w.Code, res.Data)
+		}
+		if w := do(studentSession, http.MethodGet, "/enterance-token/code/"+generated.Code, nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected token of unassigned student to not be found, got %d", w.Code)
+		}
+		if w := do(studentSession, http.MethodGet, "/enterance-token/code/-", nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected empty code to not be found, got %d", w.Code)
+		}
+		if w := do(studentSession, http.MethodGet, "/enterance-token/code/NOPE99", nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected unknown code to not be found, got %d", w.Code)
+		}
+	})
+}
+
+func TestAssignExamineStudent(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:enterance_token_assign?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Examination{}, &domain.ExamineAnswer{}, &domain.EnteranceToken{}, &domain.Student{}, &domain.ExamineStudent{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	orgID, adminID := newID(domain.OrganizationIDPrefix), newID(domain.AdminIDPrefix)
+	ex := &domain.Examination{Name: "Kimia", OrganizationID: orgID, AdminID: adminID}
+	ex.ID = newID(domain.ExaminationIDPrefix)
+	if err := db.Create(ex).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	students := make(map[string]*domain.Student)
+	for _, s := range []struct{ username, class, grade string }{
+		{"ani", "A", "10"},
+		{"budi", "A", "10"},
+		{"cici", "A", "10"},
+		{"dodi", "B", "10"},
+		{"euis", "A", "11"},
+	} {
+		std := &domain.Student{Username: s.username, Class: s.class, Grade: s.grade, OrganizationID: orgID, AdminID: adminID}
+		std.ID = newID(domain.StudentIDPrefix)
+		if err := db.Create(std).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		students[s.username] = std
+	}
+	now := time.Now().Truncate(time.Second)
+	token := &domain.EnteranceToken{ExaminationID: ex.ID, EnteranceFrom: now.Add(time.Hour), EnteranceUntil: now.Add(3 * time.Hour)}
+	token.ID = newID(domain.EnteranceTokenIDPrefix)
+	past := &domain.EnteranceToken{ExaminationID: ex.ID, EnteranceFrom: now.Add(-2 * time.Hour), EnteranceUntil: now.Add(-time.Hour)}
+	past.ID = newID(domain.EnteranceTokenIDPrefix)
+	if err := db.Create([]*domain.EnteranceToken{token, past}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	repo := &examinestudent.ExamineStudetnRepositoryGorm{DB: db}
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	r := chi.NewRouter()
+	r.Route("/enterance-token", (&EnteranceTokenRouter{
+		Auth: a,
+		EnteranceTokenService: &EnteranceTokenService{
+			EnteranceTokenRepository: &EnteranceTokenRepositoryGorm{db},
+			ExamineStudentRepository: repo,
+			StudentRepository:        &student.StudentRepositoryGorm{DB: db},
+			Auth:                     a,
+		},
+	}).Route)
+
+	session, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: adminID.String()},
+		Role:             domain.RoleTeacher,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	do := func(method, url, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	base := "/enterance-token/" + token.ID.String() + "/students"
+	list := func(token *domain.EnteranceToken) map[string]*domain.ExamineStudent {
+		w := do(http.MethodGet, "/enterance-token/"+token.ID.String()+"/students", "", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected students to be listed, got %d: %s", w.Code, w.Body.String())
+		}
+		res := &struct {
+			Data []*domain.ExamineStudent `json:"data"`
+		}{}
+		if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+			t.Fatal(err.Error())
+		}
+		ess := make(map[string]*domain.ExamineStudent)
+		for _, es := range res.Data {
+			if es.Student == nil {
+				t.Fatalf("expected student of %q to be included", es.StudentID)
+			}
+			ess[es.Student.Username] = es
+		}
+		return ess
+	}
+	dueDate := token.EnteranceFrom.Add(time.Hour)
+
+	w := do(http.MethodPost, base+"/assign", "application/json", fmt.Sprintf(`{"class":"A","grade":"10","dueDate":%q}`, dueDate.Format(time.RFC3339)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected class to be assigned, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPut, base+"/"+students["dodi"].ID.String(), "application/json", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected student to be assigned, got %d: %s", w.Code, w.Body.String())
+	}
+	csvDueDate := token.EnteranceFrom.Add(30 * time.Minute)
+	w = do(http.MethodPost, base+"/assign", "text/csv; charset=utf-8", "Username,DueDate\nbudi,"+csvDueDate.Format(time.RFC3339)+"\n\neuis,\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected csv to be assigned, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ess := list(token)
+	if len(ess) != 5 {
+		t.Fatalf("expected 5 students to be assigned, got %d", len(ess))
+	}
+	for username, want := range map[string]time.Time{
+		"ani":  dueDate,
+		"budi": csvDueDate,
+		"dodi": {},
+		"euis": {},
+	} {
+		if !ess[username].DueDate.Equal(want) {
+			t.Errorf("expected due date of %s to be %s, got %s", username, want, ess[username].DueDate)
+		}
+		if ess[username].Status != domain.ExamineStudentPending {
+			t.Errorf("expected %s to be pending, got %q", username, ess[username].Status)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		contentType, body string
+		code              int
+	}{
+		"nothing selected":     {"application/json", `{}`, http.StatusBadRequest},
+		"unknown student":      {"application/json", `{"students":[{"username":"zaki"}]}`, http.StatusBadRequest},
+		"due date before from": {"application/json", fmt.Sprintf(`{"class":"B","dueDate":%q}`, now.Format(time.RFC3339)), http.StatusBadRequest},
+		"csv without id":       {"text/csv", "name\nani\n", http.StatusBadRequest},
+		"csv invalid due date": {"text/csv", "username,dueDate\nani,tomorrow\n", http.StatusBadRequest},
+	} {
+		if w := do(http.MethodPost, base+"/assign", tc.contentType, tc.body); w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", name, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	if err := repo.StartExamineStudent(tenant.WithOrganization(context.Background(), orgID), token.ID, students["ani"].ID, now); err != nil {
+		t.Fatal(err.Error())
+	}
+	w = do(http.MethodPost, base+"/unassign", "application/json", `{"class":"A","grade":"10"}`)
+	res := &struct {
+		Data map[string]int64 `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil || res.Data["unassigned"] != 3 {
+		t.Fatalf("expected class to be unassigned, got %d %+v", w.Code, res.Data)
+	}
+	if w := do(http.MethodDelete, base+"/"+students["euis"].ID.String(), "", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected student to be unassigned, got %d", w.Code)
+	}
+	if ess := list(token); len(ess) != 1 || ess["dodi"] == nil {
+		t.Fatalf("expected only dodi to be left, got %v", ess)
+	}
+
+	// assigning again restores attempt of the student
+	if w := do(http.MethodPut, base+"/"+students["ani"].ID.String(), "application/json", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected student to be assigned again, got %d", w.Code)
+	}
+	if es := list(token)["ani"]; es == nil || es.Status != domain.ExamineStudentStarted || !es.DueDate.IsZero() {
+		t.Errorf("expected attempt of ani to be kept and due date to be cleared, got %+v", es)
+	}
+
+	t.Run("due date", func(t *testing.T) {
+		extended := now.Add(time.Hour).Format(time.RFC3339)
+		body := fmt.Sprintf(`{"students":[{"studentID":%q,"dueDate":%q},{"studentID":%q}]}`, students["ani"].ID, extended, students["budi"].ID)
+		if w := do(http.MethodPost, "/enterance-token/"+past.ID.String()+"/students/assign", "application/json", body); w.Code != http.StatusOK {
+			t.Fatalf("expected students to be assigned, got %d: %s", w.Code, w.Body.String())
+		}
+		ess := list(past)
+		if ess["ani"].Status != domain.ExamineStudentPending {
+			t.Errorf("expected extended student to be pending, got %q", ess["ani"].Status)
+		}
+		if ess["budi"].Status != domain.ExamineStudentMissed {
+			t.Errorf("expected student to have missed closed token, got %q", ess["budi"].Status)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		assign := past.ID.String() + "/students/assign"
+		overlapping := now.Add(2 * time.Hour).Format(time.RFC3339)
+		body := fmt.Sprintf(`{"students":[{"studentID":%q,"dueDate":%q}]}`, students["ani"].ID, overlapping)
+		if w := do(http.MethodPost, "/enterance-token/"+assign, "application/json", body); w.Code != http.StatusConflict {
+			t.Errorf("expected due date overlapping other token of student to be refused, got %d: %s", w.Code, w.Body.String())
+		}
+
+		scheduled := &domain.EnteranceToken{ExaminationID: ex.ID, Class: "B", EnteranceFrom: now.Add(-3 * time.Hour), EnteranceUntil: now.Add(-90 * time.Minute)}
+		scheduled.ID = newID(domain.EnteranceTokenIDPrefix)
+		if err := db.Create(scheduled).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		body = fmt.Sprintf(`{"students":[{"studentID":%q}]}`, students["dodi"].ID)
+		if w := do(http.MethodPost, "/enterance-token/"+assign, "application/json", body); w.Code != http.StatusConflict {
+			t.Errorf("expected student of class scheduled for overlapping token to be refused, got %d: %s", w.Code, w.Body.String())
+		}
+		if ess := list(past); ess["dodi"] != nil || !ess["ani"].DueDate.Equal(now.Add(time.Hour)) {
+			t.Errorf("expected refused assignment to be left unchanged, got %+v", ess)
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.ExaminationRepository = new(ExaminationRepositoryGorm)
@@ -17,6 +18,7 @@ type ExaminationRepositoryGorm struct {
 }
 
 func (r *ExaminationRepositoryGorm) CreateExamination(ctx context.Context, examination *domain.Examination) error {
+	tenant.Assign(ctx, &examination.OrganizationID)
 	return r.DB.
 		WithContext(ctx).
 		Omit("Admin").
@@ -31,11 +33,13 @@ func (r *ExaminationRepositoryGorm) GetExamination(ctx context.Context, examinat
 	ex.ID = examinationID
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
 		Preload("Admin").
 		Preload("EnteranceTokens").
 		Preload("ExamineQuestions").
 		Preload("ExamineQuestions.ExamineAnswers").
 		Preload("ExamineQuestions.ExamineAttatchment").
+		Preload("Sections").
 		First(ex, "id = ?", ex.ID.String()).
 		Error
 	if err != nil {
@@ -49,26 +53,79 @@ func (r *ExaminationRepositoryGorm) GetExamination(ctx context.Context, examinat
 
 func (r *ExaminationRepositoryGorm) ListExamination(ctx context.Context, o *domain.ListExaminationOptions) ([]*domain.Examination, error) {
 	exs := make([]*domain.Examination, 0)
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
 		Model(&domain.Examination{}).
-		Where(o).
-		Limit(o.Count).
+		Scopes(tenant.Scope(ctx))
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(o.Offset).
-		Find(exs).
+		Find(&exs).
 		Error
+	if err != nil {
+		exs = nil
+	}
 	return exs, err
 }
 
 func (r *ExaminationRepositoryGorm) DeleteExamination(ctx context.Context, examinationID raid.Raid) error {
 	ex := &domain.Examination{}
 	ex.ID = examinationID
-	return r.DB.WithContext(ctx).Delete(ex).Error
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		Delete(ex)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExaminationNotFound
+	}
+	return res.Error
 }
 
 func (r *ExaminationRepositoryGorm) UpdateExamination(ctx context.Context, examination *domain.Examination) error {
-	return r.DB.
-		WithContext(ctx).
-		Updates(examination).
-		Error
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.
+			Scopes(tenant.Scope(ctx)).
+			Omit("OrganizationID", "Admin", "EnteranceTokens", "ExamineQuestions", "Sections").
+			Updates(examination)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return domain.ErrExaminationNotFound
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		// zero value is skipped by Updates, linear mode must be turned off too
+		if err := tx.Model(examination).Update("linear", examination.Linear).Error; err != nil {
+			return err
+		}
+		if examination.Sections == nil {
+			return nil
+		}
+		return r.replaceSections(tx, examination)
+	})
+}
+
+// replaceSections replaces sections of examination with examination.Sections,
+// sections missing from it are deleted.
+func (r *ExaminationRepositoryGorm) replaceSections(tx *gorm.DB, examination *domain.Examination) error {
+	ids := make([]string, 0, len(examination.Sections))
+	for _, s := range examination.Sections {
+		s.ExaminationID = examination.ID
+		ids = append(ids, s.ID.String())
+	}
+	db := tx.Where("examination_id = ?", examination.ID.String())
+	if len(ids) > 0 {
+		db = db.Where("id NOT IN ?", ids)
+	}
+	if err := db.Delete(&domain.ExaminationSection{}).Error; err != nil {
+		return err
+	}
+	for _, s := range examination.Sections {
+		if err := tx.Save(s).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
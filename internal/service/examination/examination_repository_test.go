@@ -0,0 +1,187 @@
+package examination
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/service/enterance_token"
+	"github.com/falentio/skul/internal/service/examine_question"
+)
+
+func TestExaminationRepositoryTenant(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:examination_tenant?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(
+		&domain.Admin{},
+		&domain.Examination{},
+		&domain.ExaminationSection{},
+		&domain.EnteranceToken{},
+		&domain.ExamineQuestion{},
+		&domain.ExamineAnswer{},
+		&domain.ExamineAttatchment{},
+	); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	repo := &ExaminationRepositoryGorm{db}
+	tokenRepo := &enterancetoken.EnteranceTokenRepositoryGorm{DB: db}
+	questionRepo := &examinequestion.ExamineQuestionRepositoryGorm{DB: db}
+
+	orgA := tenant.WithOrganization(context.Background(), raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom())
+	orgB := tenant.WithOrganization(context.Background(), raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom())
+
+	ex := &domain.Examination{Name: "math"}
+	ex.ID = ExaminationIDFactory.WithRandom().WithTimestampNow()
+	ex.AdminID = raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom()
+	if err := repo.CreateExamination(orgA, ex); err != nil {
+		t.Fatal("failed to create examination", err)
+	}
+
+	token := &domain.EnteranceToken{ExaminationID: ex.ID, EnteranceFrom: time.Now(), EnteranceUntil: time.Now().Add(time.Hour)}
+	token.ID = enterancetoken.EnteranceTokenIDFactory.WithRandom().WithTimestampNow()
+	if err := tokenRepo.CreateEnteranceToken(orgA, token); err != nil {
+		t.Fatal("failed to create enterance token", err)
+	}
+
+	t.Run("examination", func(t *testing.T) {
+		if _, err := repo.GetExamination(orgB, ex.ID); err != domain.ErrExaminationNotFound {
+			t.Error("GetExamination must return domain.ErrExaminationNotFound for examination of other organization")
+		}
+		if exs, err := repo.ListExamination(orgB, &domain.ListExaminationOptions{}); err != nil || len(exs) != 0 {
+			t.Errorf("ListExamination must not return examination of other organization, got %d, err %v", len(exs), err)
+		}
+		if err := repo.UpdateExamination(orgB, &domain.Examination{Model: domain.Model{ID: ex.ID}, Name: "hijacked"}); err != domain.ErrExaminationNotFound {
+			t.Error("UpdateExamination must return domain.ErrExaminationNotFound for examination of other organization")
+		}
+		if err := repo.DeleteExamination(orgB, ex.ID); err != domain.ErrExaminationNotFound {
+			t.Error("DeleteExamination must return domain.ErrExaminationNotFound for examination of other organization")
+		}
+
+		stored, err := repo.GetExamination(orgA, ex.ID)
+		if err != nil {
+			t.Fatal("failed to get examination", err)
+		}
+		if stored.Name != ex.Name {
+			t.Errorf("examination was modified by other organization, name changed to %q", stored.Name)
+		}
+		if exs, err := repo.ListExamination(orgA, &domain.ListExaminationOptions{}); err != nil || len(exs) != 1 {
+			t.Errorf("ListExamination must return examination of own organization, got %d, err %v", len(exs), err)
+		}
+	})
+
+	t.Run("enterance token", func(t *testing.T) {
+		if _, err := tokenRepo.GetEnteranceToken(orgB, token.ID); err != domain.ErrEnteranceTokenNotFound {
+			t.Error("GetEnteranceToken must return domain.ErrEnteranceTokenNotFound for token of other organization")
+		}
+		if ts, err := tokenRepo.ListEnteranceToken(orgB, &domain.ListEnteranceTokenOptions{}); err != nil || len(ts) != 0 {
+			t.Errorf("ListEnteranceToken must not return token of other organization, got %d, err %v", len(ts), err)
+		}
+		if err := tokenRepo.DeleteEnteranceToken(orgB, token.ID); err != domain.ErrEnteranceTokenNotFound {
+			t.Error("DeleteEnteranceToken must return domain.ErrEnteranceTokenNotFound for token of other organization")
+		}
+
+		foreign := &domain.EnteranceToken{ExaminationID: ex.ID}
+		foreign.ID = enterancetoken.EnteranceTokenIDFactory.WithRandom().WithTimestampNow()
+		if err := tokenRepo.CreateEnteranceToken(orgB, foreign); err != domain.ErrExaminationNotFound {
+			t.Error("CreateEnteranceToken must return domain.ErrExaminationNotFound for examination of other organization")
+		}
+
+		if _, err := tokenRepo.GetEnteranceToken(orgA, token.ID); err != nil {
+			t.Error("failed to get enterance token of own organization", err)
+		}
+	})
+
+	t.Run("examine question", func(t *testing.T) {
+		q := &domain.ExamineQuestion{ExaminationID: ex.ID, Question: "1 + 1", AnswerCount: 2}
+		q.ID = examinequestion.ExamineQuestionIDFactory.WithRandom().WithTimestampNow()
+		if err := questionRepo.CreateExamineQuestion(orgB, q); err != domain.ErrExaminationNotFound {
+			t.Error("CreateExamineQuestion must return domain.ErrExaminationNotFound for examination of other organization")
+		}
+		if err := questionRepo.CreateExamineQuestion(orgA, q); err != nil {
+			t.Fatal("failed to create examine question", err)
+		}
+		if _, err := questionRepo.GetExamineQuestion(orgB, q.ID); err != domain.ErrExamineQuestionNotFound {
+			t.Error("GetExamineQuestion must return domain.ErrExamineQuestionNotFound for question of other organization")
+		}
+		if qs, err := questionRepo.ListExamineQuestion(orgB, &domain.ListExamineQuestionOptions{}); err != nil || len(qs) != 0 {
+			t.Errorf("ListExamineQuestion must not return question of other organization, got %d, err %v", len(qs), err)
+		}
+		if _, err := questionRepo.GetExamineQuestion(orgA, q.ID); err != nil {
+			t.Error("failed to get examine question of own organization", err)
+		}
+	})
+}
+
+func TestExaminationRepositorySections(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:examination_sections?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(
+		&domain.Admin{},
+		&domain.Examination{},
+		&domain.ExaminationSection{},
+		&domain.EnteranceToken{},
+		&domain.ExamineQuestion{},
+		&domain.ExamineAnswer{},
+		&domain.ExamineAttatchment{},
+	); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	repo := &ExaminationRepositoryGorm{db}
+	ctx := tenant.WithOrganization(context.Background(), raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom())
+	newSection := func(name string, order int) *domain.ExaminationSection {
+		s := &domain.ExaminationSection{Name: name, Order: order, DurationMinutes: 30}
+		s.ID = ExaminationSectionIDFactory.WithRandom().WithTimestampNow()
+		return s
+	}
+
+	ex := &domain.Examination{Name: "math", Linear: true}
+	ex.ID = ExaminationIDFactory.WithRandom().WithTimestampNow()
+	ex.AdminID = raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom()
+	algebra, geometry := newSection("algebra", 1), newSection("geometry", 2)
+	ex.Sections = []*domain.ExaminationSection{geometry, algebra}
+	for _, s := range ex.Sections {
+		s.ExaminationID = ex.ID
+	}
+	if err := repo.CreateExamination(ctx, ex); err != nil {
+		t.Fatal("failed to create examination", err)
+	}
+
+	stored, err := repo.GetExamination(ctx, ex.ID)
+	if err != nil {
+		t.Fatal("failed to get examination", err)
+	}
+	if ss := stored.OrderedSections(); len(ss) != 2 || ss[0].ID != algebra.ID || ss[1].ID != geometry.ID {
+		t.Errorf("expected sections in order of algebra and geometry, got %+v", ss)
+	}
+
+	calculus := newSection("calculus", 3)
+	update := &domain.Examination{Name: "math", Sections: []*domain.ExaminationSection{algebra, calculus}}
+	update.ID = ex.ID
+	if err := repo.UpdateExamination(ctx, update); err != nil {
+		t.Fatal("failed to update examination", err)
+	}
+	stored, err = repo.GetExamination(ctx, ex.ID)
+	if err != nil {
+		t.Fatal("failed to get examination", err)
+	}
+	if ss := stored.OrderedSections(); len(ss) != 2 || ss[0].ID != algebra.ID || ss[1].ID != calculus.ID {
+		t.Errorf("expected sections to be replaced by algebra and calculus, got %+v", ss)
+	}
+	if stored.Linear {
+		t.Error("expected linear mode to be turned off")
+	}
+}
@@ -10,22 +10,25 @@ import (
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
 type ExaminationRouter struct {
 	ExaminationService domain.ExaminationService
 	Auth               *auth.Auth
+	Idempotency        *idempotency.Idempotency
 }
 
 func (e *ExaminationRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.NoCache)
 		r.Use(e.Auth.VerifyMiddleware)
+		r.Use(e.Auth.RequirePermission(domain.PermissionExaminationRead))
 		r.Get("/list", e.ListExamination)
 		r.Get("/{examinationID}", e.GetExamination)
 		r.Delete("/{examinationID}", e.DeleteExamination)
-		r.Post("/create", e.CreateExamination)
+		r.With(e.Idempotency.Middleware).Post("/create", e.CreateExamination)
 		r.Put("/update", e.UpdateExamination)
 	})
 }
@@ -8,22 +8,30 @@ import (
 
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 )
 
 var _ domain.ExaminationService = new(ExaminationService)
 var ExaminationIDFactory = raid.NewRaid().WithPrefix(domain.ExaminationIDPrefix)
+var ExaminationSectionIDFactory = raid.NewRaid().WithPrefix(domain.ExaminationSectionIDPrefix)
 
 type ExaminationService struct {
 	ExaminationRepository domain.ExaminationRepository
 	Auth                  *auth.Auth
+	Tracing               *tracing.Tracing
+	Audit                 *audit.Recorder
 	Logger                zerolog.Logger
 }
 
 func (s *ExaminationService) GetExamination(ctx context.Context, examinationID raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExaminationService.GetExamination")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +48,10 @@ func (s *ExaminationService) GetExamination(ctx context.Context, examinationID r
 }
 
 func (s *ExaminationService) ListExamination(ctx context.Context, o *domain.ListExaminationOptions) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExaminationService.ListExamination")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead)
 	if err != nil {
 		return nil, err
 	}
@@ -57,12 +68,20 @@ func (s *ExaminationService) ListExamination(ctx context.Context, o *domain.List
 }
 
 func (s *ExaminationService) CreateExamination(ctx context.Context, examination *domain.Examination) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExaminationService.CreateExamination")
+	defer span.End()
+
+	adminID, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
 
 	examination.ID = ExaminationIDFactory.WithTimestampNow().WithRandom()
+	examination.AdminID = adminID
+	for _, section := range examination.Sections {
+		section.ID = ExaminationSectionIDFactory.WithTimestampNow().WithRandom()
+		section.ExaminationID = examination.ID
+	}
 
 	if err := validator.Struct(examination); err != nil {
 		return nil, err
@@ -71,17 +90,31 @@ func (s *ExaminationService) CreateExamination(ctx context.Context, examination
 	if err := s.ExaminationRepository.CreateExamination(ctx, examination); err != nil {
 		return nil, err
 	}
+	if err := s.Audit.Record(ctx, domain.AuditExaminationCreate, examination.ID, nil, examination); err != nil {
+		return nil, err
+	}
 
 	return response.NewOK(examination), nil
 }
 
 func (s *ExaminationService) DeleteExamination(ctx context.Context, examinationID raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExaminationService.DeleteExamination")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.ExaminationRepository.DeleteExamination(ctx, examinationID); err != nil {
+	before, _ := s.ExaminationRepository.GetExamination(ctx, examinationID)
+	err = s.ExaminationRepository.DeleteExamination(ctx, examinationID)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", examinationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditExaminationDelete, examinationID, before, nil); err != nil {
 		return nil, err
 	}
 
@@ -89,7 +122,10 @@ func (s *ExaminationService) DeleteExamination(ctx context.Context, examinationI
 }
 
 func (s *ExaminationService) UpdateExamination(ctx context.Context, examination *domain.Examination) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExaminationService.UpdateExamination")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -98,9 +134,30 @@ func (s *ExaminationService) UpdateExamination(ctx context.Context, examination
 		return nil, err
 	}
 
-	if err := s.ExaminationRepository.UpdateExamination(ctx, examination); err != nil {
+	before, _ := s.ExaminationRepository.GetExamination(ctx, examination.ID)
+	// section keeps its id only when it already belongs to examination
+	existing := make(map[string]bool)
+	if before != nil {
+		for _, section := range before.Sections {
+			existing[section.ID.String()] = true
+		}
+	}
+	for _, section := range examination.Sections {
+		if section.ID.IsNil() || !existing[section.ID.String()] {
+			section.ID = ExaminationSectionIDFactory.WithTimestampNow().WithRandom()
+		}
+	}
+	err = s.ExaminationRepository.UpdateExamination(ctx, examination)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", examination.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	after, _ := s.ExaminationRepository.GetExamination(ctx, examination.ID)
+	if err := s.Audit.Record(ctx, domain.AuditExaminationUpdate, examination.ID, before, after); err != nil {
 		return nil, err
 	}
 
-	return nil, nil
+	return response.NewOK(examination), nil
 }
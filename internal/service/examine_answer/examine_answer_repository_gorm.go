@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.ExamineAnswerRepository = new(ExamineAnswerRepositoryGorm)
@@ -16,29 +17,53 @@ type ExamineAnswerRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+func (r *ExamineAnswerRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "examination_id", "examinations")
+}
+
+func (r *ExamineAnswerRepositoryGorm) checkExamination(ctx context.Context, examinationID raid.Raid) error {
+	ok, err := tenant.Owns(ctx, r.DB, "examinations", examinationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrExaminationNotFound
+	}
+	return nil
+}
+
 func (r *ExamineAnswerRepositoryGorm) CreateExamineAnswer(ctx context.Context, examineAnswer *domain.ExamineAnswer) error {
+	if err := r.checkExamination(ctx, examineAnswer.ExaminationID); err != nil {
+		return err
+	}
 	return r.DB.
 		WithContext(ctx).
-		Omit("Examination").
-		Omit("ExamineQuestion").
+		Omit("Examination", "ExamineQuestion").
 		Create(examineAnswer).
 		Error
 }
 
 func (r *ExamineAnswerRepositoryGorm) UpdateExamineAnswer(ctx context.Context, examineAnswer *domain.ExamineAnswer) error {
-	return r.DB.
+	res := r.DB.
 		WithContext(ctx).
-		Omit("Examination").
-		Omit("ExamineQuestion").
-		Updates(examineAnswer).
-		Error
+		Scopes(r.scope(ctx)).
+		Omit("ExaminationID", "Examination", "ExamineQuestion").
+		Updates(examineAnswer)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineAnswerNotFound
+	}
+	return res.Error
 }
 
 func (r *ExamineAnswerRepositoryGorm) BatchCreateExamineAnswer(ctx context.Context, examineAnswer []*domain.ExamineAnswer) error {
+	for _, a := range examineAnswer {
+		if err := r.checkExamination(ctx, a.ExaminationID); err != nil {
+			return err
+		}
+	}
 	return r.DB.
 		WithContext(ctx).
-		Omit("Examination").
-		Omit("ExamineQuestion").
+		Omit("Examination", "ExamineQuestion").
 		Create(examineAnswer).
 		Error
 }
@@ -48,6 +73,7 @@ func (r *ExamineAnswerRepositoryGorm) GetExamineAnswer(ctx context.Context, exam
 
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		Preload("Examination").
 		Preload("ExamineQuestion").
 		First(a, "id = ?", examineAnswerID.String()).
@@ -65,12 +91,20 @@ func (r *ExamineAnswerRepositoryGorm) GetExamineAnswer(ctx context.Context, exam
 func (r *ExamineAnswerRepositoryGorm) ListExamineAnswer(ctx context.Context, o *domain.ListExamineAnswerOptions) ([]*domain.ExamineAnswer, error) {
 	as := make([]*domain.ExamineAnswer, 0)
 
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
-		Order("ID").
-		Limit(o.Count).
+		Model(&domain.ExamineAnswer{}).
+		Scopes(r.scope(ctx))
+	if !o.ExaminationID.IsNil() {
+		db = db.Where("examination_id = ?", o.ExaminationID.String())
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(o.Offset).
-		Find(as).
+		Find(&as).
 		Error
 	if err != nil {
 		as = nil
@@ -79,8 +113,12 @@ func (r *ExamineAnswerRepositoryGorm) ListExamineAnswer(ctx context.Context, o *
 }
 
 func (r *ExamineAnswerRepositoryGorm) DeleteExamineAnswer(ctx context.Context, examineAnswerID raid.Raid) error {
-	return r.DB.
+	res := r.DB.
 		WithContext(ctx).
-		Delete(&domain.ExamineAnswer{}, "id = ?", examineAnswerID.String()).
-		Error
+		Scopes(r.scope(ctx)).
+		Delete(&domain.ExamineAnswer{}, "id = ?", examineAnswerID.String())
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineAnswerNotFound
+	}
+	return res.Error
 }
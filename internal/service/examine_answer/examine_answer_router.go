@@ -7,6 +7,7 @@ import (
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -15,15 +16,17 @@ import (
 type ExamineAnswerRouter struct {
 	ExamineAnswerService *ExamineAnswerService
 	Auth                 *auth.Auth
+	Idempotency          *idempotency.Idempotency
 }
 
 func (e *ExamineAnswerRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(e.Auth.VerifyMiddleware)
+		r.Use(e.Auth.RequirePermission(domain.PermissionExaminationRead))
 		r.Use(middleware.NoCache)
 		r.Get("/{examineAnswerID}", e.GetExamineAnswer)
 		r.Delete("/{examineAnswerID}", e.DeleteExamineAnswer)
-		r.Post("/create", e.CreateExamineAnswer)
+		r.With(e.Idempotency.Middleware).Post("/create", e.CreateExamineAnswer)
 		r.Put("/{examineAnswerID}", e.UpdateExamineAnswer)
 	})
 }
@@ -2,38 +2,56 @@ package examineanswer
 
 import (
 	"context"
+	"errors"
 
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 )
 
 type ExamineAnswerService struct {
 	ExamineAnswerRepository domain.ExamineAnswerRepository
 	Auth                    *auth.Auth
+	Tracing                 *tracing.Tracing
+	Audit                   *audit.Recorder
 }
 
 func (s *ExamineAnswerService) CreateExamineAnswer(ctx context.Context, as *domain.ExamineAnswer) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "ExamineAnswerService.CreateExamineAnswer")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite); err != nil {
 		return nil, err
 	}
 
+	as.ID = raid.NewRaid().WithPrefix(domain.ExamineAnswerIDPrefix).WithRandom().WithTimestampNow()
 	if err := validator.Struct(as); err != nil {
 		return nil, err
 	}
 
 	err := s.ExamineAnswerRepository.CreateExamineAnswer(ctx, as)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", as.ExaminationID)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err := s.Audit.Record(ctx, domain.AuditExamineAnswerCreate, as.ID, nil, as); err != nil {
+		return nil, err
+	}
 
 	return response.NewOK(as), nil
 }
 
 func (s *ExamineAnswerService) UpdateExamineAnswer(ctx context.Context, as *domain.ExamineAnswer) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "ExamineAnswerService.UpdateExamineAnswer")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite); err != nil {
 		return nil, err
 	}
 
@@ -41,20 +59,34 @@ func (s *ExamineAnswerService) UpdateExamineAnswer(ctx context.Context, as *doma
 		return nil, err
 	}
 
-	err := s.ExamineAnswerRepository.CreateExamineAnswer(ctx, as)
+	before, _ := s.ExamineAnswerRepository.GetExamineAnswer(ctx, as.ID)
+	err := s.ExamineAnswerRepository.UpdateExamineAnswer(ctx, as)
+	if errors.Is(err, domain.ErrExamineAnswerNotFound) {
+		err = response.NewNotFound(nil, "can not find examine answer with id %q", as.ID)
+	}
 	if err != nil {
 		return nil, err
 	}
+	after, _ := s.ExamineAnswerRepository.GetExamineAnswer(ctx, as.ID)
+	if err := s.Audit.Record(ctx, domain.AuditExamineAnswerUpdate, as.ID, before, after); err != nil {
+		return nil, err
+	}
 
 	return response.NewOK(as), nil
 }
 
 func (s *ExamineAnswerService) GetExamineAnswer(ctx context.Context, id raid.Raid) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "ExamineAnswerService.GetExamineAnswer")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead); err != nil {
 		return nil, err
 	}
 
 	as, err := s.ExamineAnswerRepository.GetExamineAnswer(ctx, id)
+	if errors.Is(err, domain.ErrExamineAnswerNotFound) {
+		err = response.NewNotFound(nil, "can not find examine answer with id %q", id)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -63,14 +95,24 @@ func (s *ExamineAnswerService) GetExamineAnswer(ctx context.Context, id raid.Rai
 }
 
 func (s *ExamineAnswerService) DeleteExamineAnswer(ctx context.Context, id raid.Raid) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "ExamineAnswerService.DeleteExamineAnswer")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite); err != nil {
 		return nil, err
 	}
 
+	before, _ := s.ExamineAnswerRepository.GetExamineAnswer(ctx, id)
 	err := s.ExamineAnswerRepository.DeleteExamineAnswer(ctx, id)
+	if errors.Is(err, domain.ErrExamineAnswerNotFound) {
+		err = response.NewNotFound(nil, "can not find examine answer with id %q", id)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err := s.Audit.Record(ctx, domain.AuditExamineAnswerDelete, id, before, nil); err != nil {
+		return nil, err
+	}
 
 	return response.NewNoContent(), nil
 }
@@ -8,13 +8,63 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 type ExamineAttatchmentRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+// questionIDs returns sub query selecting examine question visible for organization of ctx.
+func (r *ExamineAttatchmentRepositoryGorm) questionIDs(db *gorm.DB, org raid.Raid) *gorm.DB {
+	return db.
+		Session(&gorm.Session{NewDB: true}).
+		Table("examine_questions").
+		Select("id").
+		Where("examination_id IN (?)", tenant.ParentIDs(db, org, "examinations")).
+		Where("deleted_at IS NULL")
+}
+
+func (r *ExamineAttatchmentRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		org, ok := tenant.Organization(ctx)
+		if !ok {
+			if tenant.IsUnscoped(ctx) {
+				return db
+			}
+			return db.Where("1 = 0")
+		}
+		return db.Where("examine_question_id IN (?)", r.questionIDs(db, org))
+	}
+}
+
+func (r *ExamineAttatchmentRepositoryGorm) checkExamineQuestion(ctx context.Context, id raid.Raid) error {
+	org, ok := tenant.Organization(ctx)
+	if !ok {
+		if tenant.IsUnscoped(ctx) {
+			return nil
+		}
+		return domain.ErrExamineQuestionNotFound
+	}
+	var count int64
+	err := r.questionIDs(r.DB, org).
+		WithContext(ctx).
+		Where("id = ?", id.String()).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrExamineQuestionNotFound
+	}
+	return nil
+}
+
 func (r *ExamineAttatchmentRepositoryGorm) CreateExamineAttathcment(ctx context.Context, a *domain.ExamineAttatchment) error {
+	if err := r.checkExamineQuestion(ctx, a.ExamineQuestionID); err != nil {
+		return err
+	}
 	return r.DB.
 		WithContext(ctx).
 		Omit("ExamineQuestion").
@@ -23,14 +73,23 @@ func (r *ExamineAttatchmentRepositoryGorm) CreateExamineAttathcment(ctx context.
 }
 
 func (r *ExamineAttatchmentRepositoryGorm) UpdateExamineAttathcment(ctx context.Context, a *domain.ExamineAttatchment) error {
-	return r.DB.
+	res := r.DB.
 		WithContext(ctx).
-		Omit("ExamineQuestion").
-		Updates(a).
-		Error
+		Scopes(r.scope(ctx)).
+		Omit("ExamineQuestionID", "ExamineQuestion").
+		Updates(a)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineAttatchmentNotFound
+	}
+	return res.Error
 }
 
 func (r *ExamineAttatchmentRepositoryGorm) BatchCreateExamineAttathcment(ctx context.Context, a []*domain.ExamineAttatchment) error {
+	for _, att := range a {
+		if err := r.checkExamineQuestion(ctx, att.ExamineQuestionID); err != nil {
+			return err
+		}
+	}
 	return r.DB.
 		WithContext(ctx).
 		Omit("ExamineQuestion").
@@ -42,6 +101,7 @@ func (r *ExamineAttatchmentRepositoryGorm) GetExamineAttathcment(ctx context.Con
 	att := &domain.ExamineAttatchment{}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		Preload("ExamineQuestion").
 		First(att, "id = ?", id.String()).
 		Error
@@ -51,17 +111,22 @@ func (r *ExamineAttatchmentRepositoryGorm) GetExamineAttathcment(ctx context.Con
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		err = domain.ErrExamineAttatchmentNotFound
 	}
-	return nil, nil
+	return att, err
 }
 
 func (r *ExamineAttatchmentRepositoryGorm) ListExamineAnswer(ctx context.Context, o *domain.ListExaminationOptions) ([]*domain.ExamineAttatchment, error) {
 	atts := make([]*domain.ExamineAttatchment, 0)
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
-		Limit(o.Count).
+		Model(&domain.ExamineAttatchment{}).
+		Scopes(r.scope(ctx))
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(o.Offset).
-		Where(o).
-		Find(atts).
+		Find(&atts).
 		Error
 	if err != nil {
 		atts = nil
@@ -70,5 +135,12 @@ func (r *ExamineAttatchmentRepositoryGorm) ListExamineAnswer(ctx context.Context
 }
 
 func (r *ExamineAttatchmentRepositoryGorm) DeleteExamineAttathcment(ctx context.Context, id raid.Raid) error {
-	return r.DB.WithContext(ctx).Delete(&domain.ExamineAttatchment{}, "id = ?", id.String()).Error
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(r.scope(ctx)).
+		Delete(&domain.ExamineAttatchment{}, "id = ?", id.String())
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineAttatchmentNotFound
+	}
+	return res.Error
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -15,15 +16,17 @@ import (
 type ExamineAttatchmentRouter struct {
 	ExamineAttatchmentService *ExamineAttatchmentService
 	Auth                      *auth.Auth
+	Idempotency               *idempotency.Idempotency
 }
 
 func (a *ExamineAttatchmentRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(a.Auth.VerifyMiddleware)
+		r.Use(a.Auth.RequirePermission(domain.PermissionExaminationRead))
 		r.Use(middleware.NoCache)
 		r.Get("/{examineAttatchmentID}", a.GetExamineAttatchment)
 		r.Delete("/{examineAttatchmentID}", a.DeleteExamineAttatchment)
-		r.Post("/create", a.CreateExamineAttatchment)
+		r.With(a.Idempotency.Middleware).Post("/create", a.CreateExamineAttatchment)
 		r.Put("/{examineAttatchmentID}", a.UpdateExamineAttatchment)
 	})
 }
@@ -10,17 +10,22 @@ import (
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 )
 
 type ExamineAttatchmentService struct {
 	ExamineAttatchmentRepository domain.ExamineAttatchmentRepository
 	Auth                         *auth.Auth
+	Tracing                      *tracing.Tracing
 	Logger                       zerolog.Logger
 }
 
 func (s *ExamineAttatchmentService) CreateExamineAttatchment(ctx context.Context, a *domain.ExamineAttatchment) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineAttatchmentService.CreateExamineAttatchment")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -29,8 +34,12 @@ func (s *ExamineAttatchmentService) CreateExamineAttatchment(ctx context.Context
 		return nil, err
 	}
 
-	a.ID = raid.NewRaid().WithPrefix(domain.ExamineAttatchmentIDPrefix)
-	if err := s.ExamineAttatchmentRepository.CreateExamineAttathcment(ctx, a); err != nil {
+	a.ID = raid.NewRaid().WithPrefix(domain.ExamineAttatchmentIDPrefix).WithRandom().WithTimestampNow()
+	err = s.ExamineAttatchmentRepository.CreateExamineAttathcment(ctx, a)
+	if errors.Is(err, domain.ErrExamineQuestionNotFound) {
+		err = response.NewNotFound(nil, "can not find examine question with id %q", a.ExamineQuestionID)
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -38,7 +47,10 @@ func (s *ExamineAttatchmentService) CreateExamineAttatchment(ctx context.Context
 }
 
 func (s *ExamineAttatchmentService) UpdateExamineAttatchment(ctx context.Context, a *domain.ExamineAttatchment) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineAttatchmentService.UpdateExamineAttatchment")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +59,11 @@ func (s *ExamineAttatchmentService) UpdateExamineAttatchment(ctx context.Context
 		return nil, err
 	}
 
-	if err := s.ExamineAttatchmentRepository.UpdateExamineAttathcment(ctx, a); err != nil {
+	err = s.ExamineAttatchmentRepository.UpdateExamineAttathcment(ctx, a)
+	if errors.Is(err, domain.ErrExamineAttatchmentNotFound) {
+		err = response.NewNotFound(nil, "can not find examine attatchment with id %q", a.ID)
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -55,7 +71,10 @@ func (s *ExamineAttatchmentService) UpdateExamineAttatchment(ctx context.Context
 }
 
 func (s *ExamineAttatchmentService) GetExamineAttatchment(ctx context.Context, id raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineAttatchmentService.GetExamineAttatchment")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead)
 	if err != nil {
 		return nil, err
 	}
@@ -72,12 +91,18 @@ func (s *ExamineAttatchmentService) GetExamineAttatchment(ctx context.Context, i
 }
 
 func (s *ExamineAttatchmentService) DeleteExamineAttatchment(ctx context.Context, id raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineAttatchmentService.DeleteExamineAttatchment")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
 
 	err = s.ExamineAttatchmentRepository.DeleteExamineAttathcment(ctx, id)
+	if errors.Is(err, domain.ErrExamineAttatchmentNotFound) {
+		err = response.NewNotFound(nil, "can not find examine attatchment with id %q", id)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -5,9 +5,11 @@ import (
 	"errors"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.ExamineQuestionRepository = new(ExamineQuestionRepositoryGorm)
@@ -16,12 +18,21 @@ type ExamineQuestionRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+func (r *ExamineQuestionRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "examination_id", "examinations")
+}
+
 func (r *ExamineQuestionRepositoryGorm) CreateExamineQuestion(ctx context.Context, examineQuestion *domain.ExamineQuestion) error {
+	ok, err := tenant.Owns(ctx, r.DB, "examinations", examineQuestion.ExaminationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrExaminationNotFound
+	}
 	return r.DB.
 		WithContext(ctx).
-		Omit("Examination").
-		Omit("ExamineAnswer").
-		Omit("ExamineAttatchments").
+		Omit("Examination", "ExamineAnswers", "ExamineAttatchment").
 		Create(examineQuestion).
 		Error
 }
@@ -30,9 +41,10 @@ func (r *ExamineQuestionRepositoryGorm) GetExamineQuestion(ctx context.Context,
 	q := &domain.ExamineQuestion{}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		Preload("Examination").
-		Preload("ExamineAnswer").
-		Preload("ExamineAttatchments").
+		Preload("ExamineAnswers").
+		Preload("ExamineAttatchment").
 		First(q, "id = ?", examineQuestionID.String()).
 		Error
 	if err != nil {
@@ -48,12 +60,21 @@ func (r *ExamineQuestionRepositoryGorm) GetExamineQuestion(ctx context.Context,
 func (r *ExamineQuestionRepositoryGorm) ListExamineQuestion(ctx context.Context, o *domain.ListExamineQuestionOptions) ([]*domain.ExamineQuestion, error) {
 	qs := make([]*domain.ExamineQuestion, 0)
 
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
-		Find(qs).
-		Where(o).
-		Limit(o.Count).
+		Model(&domain.ExamineQuestion{}).
+		Scopes(r.scope(ctx))
+	if !o.ExaminationID.IsNil() {
+		db = db.Where("examination_id = ?", o.ExaminationID.String())
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).
+		Order("id").
 		Offset(o.Offset).
+		Find(&qs).
 		Error
 	if err != nil {
 		qs = nil
@@ -63,15 +84,24 @@ func (r *ExamineQuestionRepositoryGorm) ListExamineQuestion(ctx context.Context,
 }
 
 func (r *ExamineQuestionRepositoryGorm) DeleteExamineQuestion(ctx context.Context, examineQuestionID raid.Raid) error {
-	return r.DB.
+	res := r.DB.
 		WithContext(ctx).
-		Delete(&domain.ExamineQuestion{}, "id = ?", examineQuestionID.String()).
-		Error
+		Scopes(r.scope(ctx)).
+		Delete(&domain.ExamineQuestion{}, "id = ?", examineQuestionID.String())
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineQuestionNotFound
+	}
+	return res.Error
 }
 
 func (r *ExamineQuestionRepositoryGorm) UpdateExamineQuestion(ctx context.Context, examineQuestion *domain.ExamineQuestion) error {
-	return r.DB.
+	res := r.DB.
 		WithContext(ctx).
-		Updates(examineQuestion).
-		Error
+		Scopes(r.scope(ctx)).
+		Omit("ExaminationID", "Examination", "ExamineAnswers", "ExamineAttatchment").
+		Updates(examineQuestion)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineQuestionNotFound
+	}
+	return res.Error
 }
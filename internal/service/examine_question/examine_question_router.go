@@ -22,6 +22,7 @@ func (q *ExamineQuestionRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.NoCache)
 		r.Use(q.Auth.VerifyMiddleware)
+		r.Use(q.Auth.RequirePermission(domain.PermissionExaminationRead))
 	})
 }
 
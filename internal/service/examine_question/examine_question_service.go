@@ -8,8 +8,10 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 )
 
@@ -20,11 +22,16 @@ type ExamineQuestionService struct {
 	ExamineAnswerRepository      domain.ExamineAnswerRepositoryWrite
 	ExamineAttatchmentRepository domain.ExamineAttatchmentRepositoryWrite
 	Auth                         *auth.Auth
+	Tracing                      *tracing.Tracing
+	Audit                        *audit.Recorder
 	Logger                       zerolog.Logger
 }
 
 func (s *ExamineQuestionService) CreateExamineQuestion(ctx context.Context, q *domain.ExamineQuestion) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineQuestionService.CreateExamineQuestion")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -34,27 +41,49 @@ func (s *ExamineQuestionService) CreateExamineQuestion(ctx context.Context, q *d
 	}
 
 	q.ID = ExamineQuestionIDFactory.WithRandom().WithTimestampNow()
-	if err := s.ExamineQuestionRepository.CreateExamineQuestion(ctx, q); err != nil {
+	err = s.ExamineQuestionRepository.CreateExamineQuestion(ctx, q)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", q.ExaminationID)
+	}
+	if err != nil {
 		return nil, err
 	}
-
-	q.ExamineAttatchment.ID = raid.NewRaid().WithPrefix(domain.ExamineAttatchmentIDPrefix)
-	if err := s.ExamineAttatchmentRepository.CreateExamineAttathcment(ctx, q.ExamineAttatchment); err != nil {
+	if err := s.Audit.Record(ctx, domain.AuditExamineQuestionCreate, q.ID, nil, q); err != nil {
 		return nil, err
 	}
 
+	if q.ExamineAttatchment != nil {
+		q.ExamineAttatchment.ID = raid.NewRaid().WithPrefix(domain.ExamineAttatchmentIDPrefix).WithRandom().WithTimestampNow()
+		q.ExamineAttatchment.ExamineQuestionID = q.ID
+		if err := s.ExamineAttatchmentRepository.CreateExamineAttathcment(ctx, q.ExamineAttatchment); err != nil {
+			return nil, err
+		}
+	}
+
 	for _, a := range q.ExamineAnswers {
-		a.ID = raid.NewRaid().WithPrefix(domain.ExamineAnswerIDPrefix)
+		a.ID = raid.NewRaid().WithPrefix(domain.ExamineAnswerIDPrefix).WithRandom().WithTimestampNow()
+		a.ExaminationID = q.ExaminationID
+		a.ExamineQuestionID = q.ID
 	}
-	if err := s.ExamineAnswerRepository.BatchCreateExamineAnswer(ctx, q.ExamineAnswers); err != nil {
-		return nil, err
+	if len(q.ExamineAnswers) > 0 {
+		if err := s.ExamineAnswerRepository.BatchCreateExamineAnswer(ctx, q.ExamineAnswers); err != nil {
+			return nil, err
+		}
+		for _, a := range q.ExamineAnswers {
+			if err := s.Audit.Record(ctx, domain.AuditExamineAnswerCreate, a.ID, nil, a); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return response.NewOK(q), nil
 }
 
 func (s *ExamineQuestionService) UpdateExamineQuestion(ctx context.Context, q *domain.ExamineQuestion) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineQuestionService.UpdateExamineQuestion")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +92,16 @@ func (s *ExamineQuestionService) UpdateExamineQuestion(ctx context.Context, q *d
 		return nil, err
 	}
 
-	if err := s.ExamineQuestionRepository.UpdateExamineQuestion(ctx, q); err != nil {
+	before, _ := s.ExamineQuestionRepository.GetExamineQuestion(ctx, q.ID)
+	err = s.ExamineQuestionRepository.UpdateExamineQuestion(ctx, q)
+	if errors.Is(err, domain.ErrExamineQuestionNotFound) {
+		err = response.NewNotFound(nil, "can not find examine question with id %q", q.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	after, _ := s.ExamineQuestionRepository.GetExamineQuestion(ctx, q.ID)
+	if err := s.Audit.Record(ctx, domain.AuditExamineQuestionUpdate, q.ID, before, after); err != nil {
 		return nil, err
 	}
 
@@ -71,14 +109,17 @@ func (s *ExamineQuestionService) UpdateExamineQuestion(ctx context.Context, q *d
 }
 
 func (s *ExamineQuestionService) GetExamineQuestion(ctx context.Context, id raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineQuestionService.GetExamineQuestion")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead)
 	if err != nil {
 		return nil, err
 	}
 
 	q, err := s.ExamineQuestionRepository.GetExamineQuestion(ctx, id)
 	if errors.Is(err, domain.ErrExamineQuestionNotFound) {
-		err = response.NewBadRequest(nil, "can not find examine question with id %q", id)
+		err = response.NewNotFound(nil, "can not find examine question with id %q", id)
 	}
 	if err != nil {
 		return nil, err
@@ -88,7 +129,10 @@ func (s *ExamineQuestionService) GetExamineQuestion(ctx context.Context, id raid
 }
 
 func (s *ExamineQuestionService) ListExamineQuestion(ctx context.Context, o *domain.ListExamineQuestionOptions) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineQuestionService.ListExamineQuestion")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationRead)
 	if err != nil {
 		return nil, err
 	}
@@ -106,12 +150,23 @@ func (s *ExamineQuestionService) ListExamineQuestion(ctx context.Context, o *dom
 }
 
 func (s *ExamineQuestionService) DeleteExamineQuestion(ctx context.Context, id raid.Raid) (response.Response, error) {
-	_, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "ExamineQuestionService.DeleteExamineQuestion")
+	defer span.End()
+
+	_, err := s.Auth.Authorize(ctx, domain.PermissionExaminationWrite)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.ExamineQuestionRepository.DeleteExamineQuestion(ctx, id); err != nil {
+	before, _ := s.ExamineQuestionRepository.GetExamineQuestion(ctx, id)
+	err = s.ExamineQuestionRepository.DeleteExamineQuestion(ctx, id)
+	if errors.Is(err, domain.ErrExamineQuestionNotFound) {
+		err = response.NewNotFound(nil, "can not find examine question with id %q", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Audit.Record(ctx, domain.AuditExamineQuestionDelete, id, before, nil); err != nil {
 		return nil, err
 	}
 
@@ -2,26 +2,219 @@ package examinestudent
 
 import (
 	"context"
+	"time"
 
+	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 	"gorm.io/gorm"
 )
 
+var _ domain.ExamineStudentRepository = new(ExamineStudetnRepositoryGorm)
+
 type ExamineStudetnRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+func (r *ExamineStudetnRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "student_id", "students")
+}
+
 func (r *ExamineStudetnRepositoryGorm) ListExamineStudent(ctx context.Context, o *domain.ListExamineStudentOptions) ([]*domain.ExamineStudent, error) {
 	ess := make([]*domain.ExamineStudent, 0)
-	err := r.DB.WithContext(ctx).
+	db := r.DB.WithContext(ctx).
 		Model(&domain.ExamineStudent{}).
-		Where(o).
-		Order("ID").
+		Scopes(r.scope(ctx))
+	if !o.StudentID.IsNil() {
+		db = db.Where("student_id = ?", o.StudentID.String())
+	}
+	if !o.EnteranceTokenID.IsNil() {
+		db = db.Where("enterance_token_id = ?", o.EnteranceTokenID.String())
+	}
+	if o.WithStudent {
+		db = db.Preload("Student")
+	}
+	if o.Count > 0 {
+		db = db.Limit(o.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(o.Offset).
-		Where("studentID = ?", o.StudentID.String()).
-		Where("enteranceTokenID = ?", o.EnteranceTokenID.String()).
-		Limit(o.Count).
-		Find(ess).
+		Find(&ess).
 		Error
 	return ess, err
 }
+
+func (r *ExamineStudetnRepositoryGorm) CountActiveExamineStudent(ctx context.Context, at time.Time) (int64, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).
+		Model(&domain.ExamineStudent{}).
+		Scopes(r.scope(ctx)).
+		Joins("JOIN enterance_tokens ON enterance_tokens.id = examine_students.enterance_token_id AND enterance_tokens.deleted_at IS NULL").
+		Where("enterance_tokens.enterance_from <= ? AND enterance_tokens.enterance_until > ?", at, at).
+		Count(&count).
+		Error
+	return count, err
+}
+
+func (r *ExamineStudetnRepositoryGorm) CreateExamineStudent(ctx context.Context, es *domain.ExamineStudent) error {
+	ok, err := tenant.Owns(ctx, r.DB, "students", es.StudentID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrStudentNotFound
+	}
+	return r.DB.
+		WithContext(ctx).
+		Omit("EnteranceToken", "Student").
+		Create(es).
+		Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) DeleteExamineStudent(ctx context.Context, tokenID, studentID raid.Raid) error {
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(r.scope(ctx)).
+		Where("enterance_token_id = ?", tokenID.String()).
+		Where("student_id = ?", studentID.String()).
+		Delete(&domain.ExamineStudent{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrExamineStudentNotFound
+	}
+	return res.Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) AssignExamineStudent(ctx context.Context, ess []*domain.ExamineStudent) error {
+	if len(ess) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(ess))
+	for _, es := range ess {
+		ids = append(ids, es.StudentID.String())
+	}
+	var count int64
+	err := r.DB.
+		WithContext(ctx).
+		Model(&domain.Student{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id IN ?", ids).
+		Distinct("id").
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+	if int(count) != len(ess) {
+		return domain.ErrStudentNotFound
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, es := range ess {
+			// row of unassigned student is restored, so its attempt is kept
+			res := tx.
+				Unscoped().
+				Model(&domain.ExamineStudent{}).
+				Where("enterance_token_id = ?", es.EnteranceTokenID.String()).
+				Where("student_id = ?", es.StudentID.String()).
+				Updates(map[string]any{
+					"due_date":   es.DueDate,
+					"deleted_at": nil,
+					"updated_at": time.Now(),
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				continue
+			}
+			if err := tx.Omit("EnteranceToken", "Student").Create(es).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *ExamineStudetnRepositoryGorm) UnassignExamineStudent(ctx context.Context, tokenID raid.Raid, studentIDs []raid.Raid) (int64, error) {
+	if len(studentIDs) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, 0, len(studentIDs))
+	for _, id := range studentIDs {
+		ids = append(ids, id.String())
+	}
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(r.scope(ctx)).
+		Where("enterance_token_id = ?", tokenID.String()).
+		Where("student_id IN ?", ids).
+		Delete(&domain.ExamineStudent{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) StartExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, at time.Time) error {
+	return r.DB.
+		WithContext(ctx).
+		Model(&domain.ExamineStudent{}).
+		Scopes(r.scope(ctx)).
+		Where("enterance_token_id = ?", tokenID.String()).
+		Where("student_id = ?", studentID.String()).
+		Where("started_at IS NULL").
+		Update("started_at", at).
+		Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) SubmitExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, at time.Time) error {
+	return r.DB.
+		WithContext(ctx).
+		Model(&domain.ExamineStudent{}).
+		Scopes(r.scope(ctx)).
+		Where("enterance_token_id = ?", tokenID.String()).
+		Where("student_id = ?", studentID.String()).
+		Where("submitted_at IS NULL").
+		Update("submitted_at", at).
+		Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) AckExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, seq uint64) error {
+	return r.DB.
+		WithContext(ctx).
+		Model(&domain.ExamineStudent{}).
+		Scopes(r.scope(ctx)).
+		Where("enterance_token_id = ?", tokenID.String()).
+		Where("student_id = ?", studentID.String()).
+		Where("sync_seq < ?", seq).
+		Update("sync_seq", seq).
+		Error
+}
+
+func (r *ExamineStudetnRepositoryGorm) GradeExamineStudent(ctx context.Context, at time.Time) (int64, error) {
+	score := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Table("student_answers").
+		Select("COUNT(*)").
+		Joins("JOIN examine_answers ON examine_answers.id = student_answers.examine_answer_id").
+		Where("student_answers.student_id = examine_students.student_id").
+		Where("student_answers.enterance_token_id = examine_students.enterance_token_id").
+		Where("student_answers.deleted_at IS NULL").
+		Where("examine_answers.correct = ?", true)
+	closed := r.DB.
+		Session(&gorm.Session{NewDB: true}).
+		Table("enterance_tokens").
+		Select("id").
+		Where("enterance_until < ?", at)
+	// grading is run by worker for every organization, so it is not scoped
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.ExamineStudent{}).
+		Where("graded_at IS NULL").
+		Where("enterance_token_id IN (?)", closed).
+		// due date is zero time when it is not overridden
+		Where("due_date < ?", at).
+		Updates(map[string]any{
+			"score":     score,
+			"graded_at": at,
+		})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,98 @@
+package examinestudent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+)
+
+func TestGradeExamineStudent(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:examine_student_grade?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.EnteranceToken{}, &domain.ExamineAnswer{}, &domain.StudentAnswer{}, &domain.ExamineStudent{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+
+	now := time.Now()
+	examID, questionID := newID(domain.ExaminationIDPrefix), newID(domain.ExamineQuestionIDPrefix)
+	closed := &domain.EnteranceToken{ExaminationID: examID, EnteranceFrom: now.Add(-2 * time.Hour), EnteranceUntil: now.Add(-time.Hour)}
+	closed.ID = newID(domain.EnteranceTokenIDPrefix)
+	open := &domain.EnteranceToken{ExaminationID: examID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(time.Hour)}
+	open.ID = newID(domain.EnteranceTokenIDPrefix)
+	if err := db.Create([]*domain.EnteranceToken{closed, open}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	correct := &domain.ExamineAnswer{ExaminationID: examID, ExamineQuestionID: questionID, Correct: true}
+	correct.ID = newID(domain.ExamineAnswerIDPrefix)
+	wrong := &domain.ExamineAnswer{ExaminationID: examID, ExamineQuestionID: questionID}
+	wrong.ID = newID(domain.ExamineAnswerIDPrefix)
+	unselected := &domain.ExamineAnswer{ExaminationID: examID, ExamineQuestionID: questionID, Correct: true}
+	unselected.ID = newID(domain.ExamineAnswerIDPrefix)
+	if err := db.Create([]*domain.ExamineAnswer{correct, wrong, unselected}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	graded, extended, running := newID(domain.StudentIDPrefix), newID(domain.StudentIDPrefix), newID(domain.StudentIDPrefix)
+	ess := []*domain.ExamineStudent{
+		{EnteranceTokenID: closed.ID, StudentID: graded},
+		{EnteranceTokenID: closed.ID, StudentID: extended, DueDate: now.Add(time.Hour)},
+		{EnteranceTokenID: open.ID, StudentID: running},
+	}
+	if err := db.Create(ess).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, ea := range []*domain.ExamineAnswer{correct, wrong, unselected} {
+		sa := &domain.StudentAnswer{ExamineAnswerID: ea.ID, StudentID: graded, EnteranceTokenID: closed.ID}
+		sa.ID = newID(domain.StudentAnswerIDPrefix)
+		if err := db.Create(sa).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		if ea == unselected {
+			if err := db.Delete(sa).Error; err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+	}
+
+	repo := &ExamineStudetnRepositoryGorm{DB: db}
+	n, err := repo.GradeExamineStudent(context.Background(), now)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 1 {
+		t.Errorf("expected only attempt of closed token to be graded, got %d", n)
+	}
+	if n, _ := repo.GradeExamineStudent(context.Background(), now); n != 0 {
+		t.Errorf("expected graded attempt to not be graded again, got %d", n)
+	}
+
+	got, err := repo.ListExamineStudent(context.Background(), &domain.ListExamineStudentOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, es := range got {
+		switch es.StudentID {
+		case graded:
+			if es.Score == nil || *es.Score != 1 || es.GradedAt == nil {
+				t.Errorf("expected score of 1 correct selected answer, got %v", es.Score)
+			}
+		default:
+			if es.GradedAt != nil {
+				t.Errorf("expected attempt of %q which is still open to not be graded", es.StudentID)
+			}
+		}
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
 type FileRouter struct {
 	FileService *FileService
 	Auth        *auth.Auth
+	Idempotency *idempotency.Idempotency
 	Logger      zerolog.Logger
 }
 
@@ -23,7 +25,7 @@ func (f *FileRouter) Route(r chi.Router) {
 		r.Use(f.Auth.VerifyMiddleware)
 		r.Get("/{slug}", f.GetFile)
 		r.Delete("/{slug}", f.DeleteFile)
-		r.Post("/create", f.CreateFile)
+		r.With(f.Idempotency.Middleware).Post("/create", f.CreateFile)
 	})
 }
 
@@ -15,16 +15,21 @@ import (
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 )
 
 type FileService struct {
 	Storage storage.Storage
 	Auth    *auth.Auth
+	Tracing *tracing.Tracing
 	Logger  zerolog.Logger
 }
 
 func (s *FileService) CreateFile(ctx context.Context, f multipart.File, h *multipart.FileHeader) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "FileService.CreateFile")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionFileWrite); err != nil {
 		return nil, err
 	}
 
@@ -39,7 +44,7 @@ func (s *FileService) CreateFile(ctx context.Context, f multipart.File, h *multi
 		return nil, err
 	}
 
-	if err := s.Storage.Set(slug, b, 0); err != nil {
+	if err := tracing.Bind(ctx, s.Storage).Set(slug, b, 0); err != nil {
 		return nil, err
 	}
 
@@ -47,13 +52,16 @@ func (s *FileService) CreateFile(ctx context.Context, f multipart.File, h *multi
 }
 
 func (s *FileService) GetFile(ctx context.Context, slug string) ([]byte, string, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "FileService.GetFile")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionFileRead); err != nil {
 		return nil, "", err
 	}
 
 	m := mime.TypeByExtension(filepath.Ext(slug))
 
-	b, err := s.Storage.Get(slug)
+	b, err := tracing.Bind(ctx, s.Storage).Get(slug)
 	if err != nil {
 		return nil, m, nil
 	}
@@ -62,9 +70,12 @@ func (s *FileService) GetFile(ctx context.Context, slug string) ([]byte, string,
 }
 
 func (s *FileService) DeleteFile(ctx context.Context, slug string) (response.Response, error) {
-	if _, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix); err != nil {
+	ctx, span := s.Tracing.Start(ctx, "FileService.DeleteFile")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionFileWrite); err != nil {
 		return nil, err
 	}
 
-	return response.NewNoContent(), s.Storage.Delete(slug)
+	return response.NewNoContent(), tracing.Bind(ctx, s.Storage).Delete(slug)
 }
@@ -0,0 +1,56 @@
+package organization
+
+import (
+	"context"
+	"errors"
+
+	"github.com/falentio/raid-go"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+)
+
+var OrganizationIDFactory = raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix)
+var _ domain.OrganizationRepository = new(OrganizationRepositoryGorm)
+
+type OrganizationRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+func (r *OrganizationRepositoryGorm) CreateOrganization(ctx context.Context, organization *domain.Organization) error {
+	return r.DB.
+		WithContext(ctx).
+		Create(organization).
+		Error
+}
+
+func (r *OrganizationRepositoryGorm) GetOrganization(ctx context.Context, organizationID raid.Raid) (*domain.Organization, error) {
+	o := &domain.Organization{}
+	err := r.DB.
+		WithContext(ctx).
+		First(o, "id = ?", organizationID.String()).
+		Error
+	if err != nil {
+		o = nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domain.ErrOrganizationNotFound
+	}
+	return o, err
+}
+
+func (r *OrganizationRepositoryGorm) GetOrganizationByName(ctx context.Context, name string) (*domain.Organization, error) {
+	o := &domain.Organization{}
+	err := r.DB.
+		WithContext(ctx).
+		Order("id").
+		First(o, "name = ?", name).
+		Error
+	if err != nil {
+		o = nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domain.ErrOrganizationNotFound
+	}
+	return o, err
+}
@@ -0,0 +1,189 @@
+package student
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/validator"
+)
+
+// authenticate returns student whose credentials are sent, local password is
+// checked first then s.Providers. failed reports whether credentials of
+// existing student were wrong, failures of unknown usernames are not counted.
+func (s *StudentService) authenticate(ctx context.Context, student *domain.Student) (stored *domain.Student, failed bool, err error) {
+	if student.Username != "" {
+		stored, err = s.StudentRepository.GetStudentByUsername(ctx, student.Username)
+		if err != nil && !errors.Is(err, domain.ErrStudentNotFound) {
+			return nil, false, err
+		}
+	}
+	if stored != nil && student.Provider == "" && student.Code == "" &&
+		bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(student.Password)) == nil {
+		return stored, false, nil
+	}
+
+	if len(s.Providers) == 0 {
+		if stored == nil {
+			return nil, false, response.NewBadRequest(nil, "can not find student with username %q", student.Username)
+		}
+		return nil, true, response.NewBadRequest(nil, "password invalid")
+	}
+
+	p, id, err := identity.Authenticate(ctx, s.Providers, student.Provider, &identity.Credentials{
+		Username:    student.Username,
+		Password:    student.Password,
+		Code:        student.Code,
+		State:       student.State,
+		RedirectURI: student.RedirectURI,
+	})
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		return nil, false, response.NewBadRequest(map[string]string{"provider": "unknown"}, "unknown identity provider %q", student.Provider)
+	}
+	if errors.Is(err, identity.ErrInvalidCredentials) {
+		return nil, stored != nil, response.NewBadRequest(nil, "password invalid")
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("provider", student.Provider).Msg("failed to authenticate student with identity provider")
+		return nil, false, response.NewError(nil, "identity provider is unavailable", http.StatusBadGateway)
+	}
+
+	// provider of organization only logs in students of its organization
+	if !p.Organization.IsNil() {
+		ctx = tenant.WithOrganization(ctx, p.Organization)
+	}
+	stored, err = s.provision(ctx, p, id)
+	return stored, false, err
+}
+
+// provision returns student linked to identity verified by p, student is
+// created on first login when p provisions students, name, class and grade of
+// existing student are kept in sync with provider.
+func (s *StudentService) provision(ctx context.Context, p *identity.Provider, id *identity.Identity) (*domain.Student, error) {
+	if id.Subject == "" {
+		return nil, response.NewBadRequest(nil, "identity provider %q did not return subject", p.Name())
+	}
+	// students are matched by subject, username of provider may be changed
+	// and then taken by other account
+	stored, err := s.StudentRepository.GetStudentByIdentity(ctx, p.Name(), id.Subject)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		stored, err = s.link(ctx, p, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// provider must not log in students of other organization
+	if !p.Organization.IsNil() && stored.OrganizationID != p.Organization {
+		return nil, response.NewForbidden(nil, "student %q does not belong to identity provider %q", id.Username, p.Name())
+	}
+
+	update := &domain.Student{}
+	update.ID = stored.ID
+	changed := false
+	for _, f := range []struct {
+		src       string
+		dst, prev *string
+	}{
+		{id.Name, &update.Name, &stored.Name},
+		{id.Class, &update.Class, &stored.Class},
+		{id.Grade, &update.Grade, &stored.Grade},
+	} {
+		if f.src != "" && f.src != *f.prev {
+			*f.dst, *f.prev = f.src, f.src
+			changed = true
+		}
+	}
+	if changed {
+		if err := s.StudentRepository.UpdateStudent(ctx, update); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// link links existing student with username of identity on its first login
+// with p, only students not linked yet are linked, otherwise student is
+// created when p provisions students.
+func (s *StudentService) link(ctx context.Context, p *identity.Provider, id *identity.Identity) (*domain.Student, error) {
+	if id.Username == "" {
+		return nil, response.NewBadRequest(nil, "identity provider %q did not return username", p.Name())
+	}
+	stored, err := s.StudentRepository.GetStudentByUsername(ctx, id.Username)
+	if err != nil && !errors.Is(err, domain.ErrStudentNotFound) {
+		return nil, err
+	}
+
+	if stored == nil {
+		if !p.Provisions() {
+			return nil, response.NewBadRequest(nil, "can not find student with username %q", id.Username)
+		}
+		provider, subject := p.Name(), id.Subject
+		student := &domain.Student{
+			OrganizationID:   p.Organization,
+			AdminID:          p.Admin,
+			Name:             id.Name,
+			Username:         id.Username,
+			Class:            id.Class,
+			Grade:            id.Grade,
+			IdentityProvider: &provider,
+			IdentitySubject:  &subject,
+		}
+		student.ID = StudentIDFactory.WithRandom().WithTimestampNow()
+		if err := validator.Struct(student); err != nil {
+			return nil, err
+		}
+		if err := s.StudentRepository.CreateStudent(ctx, student); err != nil {
+			return nil, err
+		}
+		logging.Ctx(ctx, s.Logger).Info().
+			Str("provider", p.Name()).
+			Str("student", student.ID.String()).
+			Msg("provisioned student from identity provider")
+		return student, nil
+	}
+
+	if stored.IdentitySubject != nil {
+		return nil, response.NewForbidden(nil, "student %q is linked to other account of identity provider", id.Username)
+	}
+	if err := s.StudentRepository.LinkStudentIdentity(ctx, stored.ID, p.Name(), id.Subject); err != nil {
+		return nil, err
+	}
+	logging.Ctx(ctx, s.Logger).Info().
+		Str("provider", p.Name()).
+		Str("student", stored.ID.String()).
+		Msg("linked student to identity provider")
+	return stored, nil
+}
+
+// AuthorizeStudent starts log in of student with OIDC provider, student is
+// redirected to returned url and client sends back its code and state.
+func (s *StudentService) AuthorizeStudent(ctx context.Context, provider, redirectURI string) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.AuthorizeStudent")
+	defer span.End()
+
+	if redirectURI == "" {
+		err = response.NewBadRequest(map[string]string{"redirectURI": "required"}, "redirect uri is required")
+		return
+	}
+	a, err := identity.Authorize(ctx, s.Providers, provider, redirectURI)
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		err = response.NewBadRequest(map[string]string{"provider": "unknown"}, "unknown identity provider %q", provider)
+		return
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("provider", provider).Msg("failed to authorize student with identity provider")
+		err = response.NewError(nil, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	res = response.NewOK(a)
+	return
+}
@@ -0,0 +1,106 @@
+package student
+
+import (
+	"context"
+	"testing"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+// fakeAuthenticator accepts password "secret" of every username, subject of
+// username is read from subjects and defaults to username.
+type fakeAuthenticator struct {
+	class    string
+	subjects map[string]string
+}
+
+func (a *fakeAuthenticator) Name() string {
+	return "directory"
+}
+
+func (a *fakeAuthenticator) Authenticate(ctx context.Context, c *identity.Credentials) (*identity.Identity, error) {
+	if c.Password != "secret" {
+		return nil, identity.ErrInvalidCredentials
+	}
+	subject, ok := a.subjects[c.Username]
+	if !ok {
+		subject = c.Username
+	}
+	return &identity.Identity{Provider: a.Name(), Subject: subject, Username: c.Username, Name: "Student " + c.Username, Class: a.class, Grade: "10"}, nil
+}
+
+func TestProvisionStudent(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_identity?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Student{}, &domain.EnteranceToken{}, &domain.ExamineAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	directory := &fakeAuthenticator{class: "X-1"}
+	provider := &identity.Provider{
+		Authenticator: directory,
+		Organization:  raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom(),
+		Admin:         raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom(),
+	}
+	repo := &StudentRepositoryGorm{db}
+	s := &StudentService{
+		StudentRepository: repo,
+		Auth:              &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")},
+		Providers:         []*identity.Provider{provider},
+	}
+	ctx := context.Background()
+	// students are read back within organization of provider
+	scoped := tenant.WithOrganization(ctx, provider.Organization)
+
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani", Password: "wrong"}); err == nil {
+		t.Error("student rejected by provider must not log in")
+	}
+	if _, err := repo.GetStudentByUsername(scoped, "ani"); err != domain.ErrStudentNotFound {
+		t.Errorf("student rejected by provider must not be provisioned, got %v", err)
+	}
+
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani", Password: "secret"}); err != nil {
+		t.Fatal("failed to log in with provider", err)
+	}
+	stored, err := repo.GetStudentByUsername(scoped, "ani")
+	if err != nil {
+		t.Fatal("student must be provisioned on first login", err)
+	}
+	if stored.Class != "X-1" || stored.Grade != "10" || stored.OrganizationID != provider.Organization || stored.AdminID != provider.Admin {
+		t.Errorf("provisioned student does not match identity and provider, got %+v", stored)
+	}
+
+	directory.class = "X-2"
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani", Password: "secret"}); err != nil {
+		t.Fatal("failed to log in with provider", err)
+	}
+	if again, _ := repo.GetStudentByUsername(scoped, "ani"); again.ID != stored.ID || again.Class != "X-2" {
+		t.Errorf("class of provisioned student must follow provider, got %+v", again)
+	}
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani", Password: "secret", Provider: "ldap"}); err == nil {
+		t.Error("unknown provider must be rejected")
+	}
+
+	// ani was renamed in provider and other account took her username
+	directory.subjects = map[string]string{"ani-renamed": "ani", "ani": "eve"}
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani", Password: "secret"}); err == nil {
+		t.Error("other account of provider must not log in to linked student by username")
+	}
+	if _, err := s.LoginStudent(ctx, &domain.Student{Username: "ani-renamed", Password: "secret"}); err != nil {
+		t.Fatal("linked student must log in after username was changed in provider", err)
+	}
+	if _, err := repo.GetStudentByUsername(scoped, "ani-renamed"); err != domain.ErrStudentNotFound {
+		t.Errorf("renamed account must log in to linked student instead of provisioning other, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package student
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+func TestChangeStudentPassword(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_password?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Student{}, &domain.EnteranceToken{}, &domain.ExamineAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	orgID := raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("generated"), bcrypt.MinCost)
+	student := &domain.Student{Username: "ani", PasswordHash: string(hash), MustChangePassword: true, OrganizationID: orgID}
+	student.ID = StudentIDFactory.WithRandom().WithTimestampNow()
+	student.AdminID = raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom()
+	if err := db.Create(student).Error; err != nil {
+		t.Fatal("failed to create student", err)
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret"), Lifetime: time.Hour, Storage: memory.New()}
+	repo := &StudentRepositoryGorm{db}
+	router := &StudentRouter{Auth: a, StudentService: &StudentService{StudentRepository: repo, Auth: a}}
+	r := chi.NewRouter()
+	r.Use(a.VerifyMiddleware)
+	r.Put("/student/password", router.ChangeStudentPassword)
+	r.Put("/student/info", router.UpdateStudent)
+
+	sign := func(subject string, role domain.Role, mustChange bool) *http.Cookie {
+		c, err := a.Sign(auth.Claims{
+			RegisteredClaims:   jwt.RegisteredClaims{Subject: subject},
+			Role:               role,
+			Organization:       orgID.String(),
+			MustChangePassword: mustChange,
+		})
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		return c
+	}
+	do := func(method, url string, session *http.Cookie, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	mustChange := func() bool {
+		stored := &domain.Student{}
+		if err := db.First(stored, "id = ?", student.ID.String()).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		return stored.MustChangePassword
+	}
+
+	current, other := sign(student.ID.String(), domain.RoleStudent, true), sign(student.ID.String(), domain.RoleStudent, true)
+	w := do(http.MethodPut, "/student/password", current, &domain.ChangePassword{OldPassword: "generated", NewPassword: "changed-password"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("failed to change password, status %d: %s", w.Code, w.Body.String())
+	}
+	if mustChange() {
+		t.Error("must change flag must be cleared after password was changed")
+	}
+	var renewed *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			renewed = c
+		}
+	}
+	if renewed == nil {
+		t.Fatal("renewed session must be issued")
+	}
+	if _, err := a.Verify(renewed.Value); err != nil {
+		t.Errorf("renewed session must stay valid, got %v", err)
+	}
+	if _, err := a.Verify(other.Value); err != auth.ErrRevoked {
+		t.Errorf("other session must be revoked after password was changed, got %v", err)
+	}
+
+	if err := db.Model(&domain.Student{}).Where("id = ?", student.ID.String()).Update("must_change_password", true).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+	teacher := sign(raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().String(), domain.RoleTeacher, false)
+	w = do(http.MethodPut, "/student/info", teacher, map[string]any{"id": student.ID, "password": "set-by-teacher"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to update student, status %d: %s", w.Code, w.Body.String())
+	}
+	if mustChange() {
+		t.Error("must change flag must be cleared when password is set")
+	}
+	if _, err := a.Verify(renewed.Value); err != auth.ErrRevoked {
+		t.Errorf("session of student must be revoked after password was set, got %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 var _ domain.StudentRepository = new(StudentRepositoryGorm)
@@ -18,6 +19,7 @@ type StudentRepositoryGorm struct {
 }
 
 func (r *StudentRepositoryGorm) CreateStudent(ctx context.Context, student *domain.Student) error {
+	tenant.Assign(ctx, &student.OrganizationID)
 	err := r.DB.WithContext(ctx).Create(student).Error
 	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
 		return domain.ErrStudentConflict
@@ -26,6 +28,9 @@ func (r *StudentRepositoryGorm) CreateStudent(ctx context.Context, student *doma
 }
 
 func (r *StudentRepositoryGorm) BatchCreateStudent(ctx context.Context, students []*domain.Student) error {
+	for _, student := range students {
+		tenant.Assign(ctx, &student.OrganizationID)
+	}
 	err := r.DB.WithContext(ctx).Create(students).Error
 	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
 		return domain.ErrStudentConflict
@@ -37,6 +42,7 @@ func (r *StudentRepositoryGorm) GetStudent(ctx context.Context, studentID raid.R
 	student := &domain.Student{Model: domain.Model{ID: studentID}}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
 		Preload("Admin").
 		Preload("ExamineAnswer", func(db *gorm.DB) *gorm.DB {
 			return db.Limit(10)
@@ -59,6 +65,7 @@ func (r *StudentRepositoryGorm) GetStudentByUsername(ctx context.Context, userna
 	student := &domain.Student{Username: username}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
 		Preload("Admin").
 		Preload("ExamineAnswer", func(db *gorm.DB) *gorm.DB {
 			return db.Limit(10)
@@ -77,28 +84,116 @@ func (r *StudentRepositoryGorm) GetStudentByUsername(ctx context.Context, userna
 	return student, err
 }
 
+func (r *StudentRepositoryGorm) GetStudentByIdentity(ctx context.Context, provider, subject string) (*domain.Student, error) {
+	student := &domain.Student{}
+	err := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		First(student, "identity_provider = ? AND identity_subject = ?", provider, subject).
+		Error
+	if err != nil {
+		student = nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domain.ErrStudentNotFound
+	}
+	return student, err
+}
+
 func (r *StudentRepositoryGorm) ListStudent(ctx context.Context, opts *domain.ListStudentOptions) ([]*domain.Student, error) {
 	students := make([]*domain.Student, 0)
-	err := r.DB.WithContext(ctx).
+	db := r.DB.WithContext(ctx).
 		Model(&domain.Student{}).
-		Where(opts).
-		Order("ID").
+		Scopes(tenant.Scope(ctx))
+	if !opts.AdminID.IsNil() {
+		db = db.Where("admin_id = ?", opts.AdminID.String())
+	}
+	if opts.Name != "" {
+		db = db.Where("name = ?", opts.Name)
+	}
+	if opts.Class != "" {
+		db = db.Where("class = ?", opts.Class)
+	}
+	if opts.Grade != "" {
+		db = db.Where("grade = ?", opts.Grade)
+	}
+	if opts.PresenceNumber != 0 {
+		db = db.Where("presence_number = ?", opts.PresenceNumber)
+	}
+	if opts.Count > 0 {
+		db = db.Limit(opts.Count)
+	}
+	err := db.
+		Order("id").
 		Offset(opts.Offset).
-		Limit(opts.Count).
-		Find(students).
+		Find(&students).
 		Error
+	if err != nil {
+		students = nil
+	}
 	return students, err
 }
 
 func (r *StudentRepositoryGorm) DeleteStudent(ctx context.Context, studentID raid.Raid) error {
-	err := r.DB.WithContext(ctx).Delete(&domain.Student{Model: domain.Model{ID: studentID}}).Error
-	return err
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		Delete(&domain.Student{Model: domain.Model{ID: studentID}})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrStudentNotFound
+	}
+	return res.Error
 }
 
 func (r *StudentRepositoryGorm) UpdateStudent(ctx context.Context, student *domain.Student) error {
-	err := r.DB.WithContext(ctx).Updates(student).Error
+	res := r.DB.
+		WithContext(ctx).
+		Scopes(tenant.Scope(ctx)).
+		// identity is only linked by LinkStudentIdentity
+		Omit("OrganizationID", "IdentityProvider", "IdentitySubject").
+		Updates(student)
+	err := res.Error
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
+		return domain.ErrStudentConflict
+	}
+	if err == nil && res.RowsAffected == 0 {
+		return domain.ErrStudentNotFound
+	}
+	return err
+}
+
+func (r *StudentRepositoryGorm) UpdateStudentPassword(ctx context.Context, studentID raid.Raid, passwordHash string, mustChange bool) error {
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.Student{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id = ?", studentID.String()).
+		Updates(map[string]any{
+			"password_hash":        passwordHash,
+			"must_change_password": mustChange,
+		})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return domain.ErrStudentNotFound
+	}
+	return res.Error
+}
+
+func (r *StudentRepositoryGorm) LinkStudentIdentity(ctx context.Context, studentID raid.Raid, provider, subject string) error {
+	res := r.DB.
+		WithContext(ctx).
+		Model(&domain.Student{}).
+		Scopes(tenant.Scope(ctx)).
+		Where("id = ?", studentID.String()).
+		Updates(map[string]any{
+			"identity_provider": provider,
+			"identity_subject":  subject,
+		})
+	err := res.Error
 	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
 		return domain.ErrStudentConflict
 	}
+	if err == nil && res.RowsAffected == 0 {
+		return domain.ErrStudentNotFound
+	}
 	return err
 }
@@ -9,38 +9,46 @@ import (
 	"github.com/falentio/raid-go"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
+	"github.com/falentio/skul/internal/pkg/loginguard"
 	"github.com/falentio/skul/internal/pkg/response"
 )
 
 type StudentRouter struct {
 	StudentService domain.StudentService
 	Auth           *auth.Auth
+	Idempotency    *idempotency.Idempotency
+	Guard          *loginguard.Guard
 }
 
 func (s *StudentRouter) Route(r chi.Router) {
 	r.Group(func(r chi.Router) {
-		r.Use(httprate.LimitByIP(5, time.Minute))
+		r.Use(s.Guard.Limit(5, time.Minute))
 		r.Post("/login", s.LoginStudent)
+		r.Get("/login/{provider}", s.AuthorizeStudent)
+		r.Post("/password/reset", s.RedeemStudentPassword)
 	})
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.NoCache)
 		r.Use(s.Auth.VerifyMiddleware)
-		r.Post("/create", s.CreateStudent)
-		r.Post("/create-batch", s.BatchCreateStudent)
+		r.With(s.Idempotency.Redact("password")).Post("/create", s.CreateStudent)
+		r.With(s.Idempotency.Redact("password")).Post("/create-batch", s.BatchCreateStudent)
 		r.Get("/list", s.ListSutdent)
 		r.Get("/{studentID}", s.GetStudent)
 		r.Delete("/{studentID}", s.DeleteStudent)
+		r.Post("/{studentID}/logout", s.LogoutStudent)
+		r.Post("/{studentID}/release", s.ReleaseStudent)
 		r.Put("/info", s.UpdateStudent)
-		r.Put("/info", s.UpdateStudent)
+		r.Put("/password", s.ChangeStudentPassword)
+		r.Post("/{studentID}/password/reset", s.ResetStudentPassword)
 	})
 }
 
 func (s *StudentRouter) CreateStudent(w http.ResponseWriter, r *http.Request) {
-	adminID, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	adminID, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentWrite)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -64,7 +72,7 @@ func (s *StudentRouter) CreateStudent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *StudentRouter) BatchCreateStudent(w http.ResponseWriter, r *http.Request) {
-	_, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentWrite)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -96,6 +104,10 @@ func (s *StudentRouter) LoginStudent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c, err := r.Cookie(DeviceCookie); err == nil {
+		student.Device = c.Value
+	}
+
 	res, err := s.StudentService.LoginStudent(r.Context(), student)
 	if err != nil {
 		response.HandleError(w, r, err)
@@ -105,8 +117,21 @@ func (s *StudentRouter) LoginStudent(w http.ResponseWriter, r *http.Request) {
 	res.ServeHTTP(w, r)
 }
 
+func (s *StudentRouter) AuthorizeStudent(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	redirectURI := r.URL.Query().Get("redirectURI")
+
+	res, err := s.StudentService.AuthorizeStudent(r.Context(), provider, redirectURI)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
 func (s *StudentRouter) GetStudent(w http.ResponseWriter, r *http.Request) {
-	_, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentRead)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -146,7 +171,7 @@ func (s *StudentRouter) GetStudentByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *StudentRouter) ListSutdent(w http.ResponseWriter, r *http.Request) {
-	_, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentRead)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -183,10 +208,12 @@ func (s *StudentRouter) ListSutdent(w http.ResponseWriter, r *http.Request) {
 		response.HandleError(w, r, err)
 		return
 	}
-	if l.AdminID, err = raid.RaidFromString(adminID); err != nil {
-		err = response.NewBadRequest(map[string]string{"adminID": "invalid"}, "invalid query param adminID, got %q", adminID)
-		response.HandleError(w, r, err)
-		return
+	if adminID != "" {
+		if l.AdminID, err = raid.RaidFromString(adminID); err != nil {
+			err = response.NewBadRequest(map[string]string{"adminID": "invalid"}, "invalid query param adminID, got %q", adminID)
+			response.HandleError(w, r, err)
+			return
+		}
 	}
 	l.Class = q.Get("class")
 	l.Grade = q.Get("grade")
@@ -202,7 +229,7 @@ func (s *StudentRouter) ListSutdent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *StudentRouter) DeleteStudent(w http.ResponseWriter, r *http.Request) {
-	_, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentWrite)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -225,8 +252,56 @@ func (s *StudentRouter) DeleteStudent(w http.ResponseWriter, r *http.Request) {
 	res.ServeHTTP(w, r)
 }
 
+func (s *StudentRouter) LogoutStudent(w http.ResponseWriter, r *http.Request) {
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentReset)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	studentIDStr := chi.URLParam(r, "studentID")
+	studentID, err := raid.RaidFromString(studentIDStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid student id, received: %q", studentIDStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentService.LogoutStudent(r.Context(), studentID)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentRouter) ReleaseStudent(w http.ResponseWriter, r *http.Request) {
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentReset)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	studentIDStr := chi.URLParam(r, "studentID")
+	studentID, err := raid.RaidFromString(studentIDStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid student id, received: %q", studentIDStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentService.ReleaseStudent(r.Context(), studentID)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
 func (s *StudentRouter) UpdateStudent(w http.ResponseWriter, r *http.Request) {
-	_, err := s.Auth.GetSubjectRaid(r.Context(), domain.AdminIDPrefix)
+	_, err := s.Auth.Authorize(r.Context(), domain.PermissionStudentWrite)
 	if err != nil {
 		response.HandleError(w, r, err)
 		return
@@ -247,3 +322,55 @@ func (s *StudentRouter) UpdateStudent(w http.ResponseWriter, r *http.Request) {
 
 	res.ServeHTTP(w, r)
 }
+
+func (s *StudentRouter) ChangeStudentPassword(w http.ResponseWriter, r *http.Request) {
+	c := &domain.ChangePassword{}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentService.ChangeStudentPassword(r.Context(), c)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentRouter) ResetStudentPassword(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "studentID")
+	id, err := raid.RaidFromString(idStr)
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid student id, received: %q", idStr)
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentService.ResetStudentPassword(r.Context(), id)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentRouter) RedeemStudentPassword(w http.ResponseWriter, r *http.Request) {
+	reset := &domain.ResetPassword{}
+	if err := json.NewDecoder(r.Body).Decode(reset); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentService.RedeemStudentPassword(r.Context(), reset)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
@@ -0,0 +1,73 @@
+package student
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+func TestListStudent(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_list?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.Admin{}, &domain.Student{}, &domain.EnteranceToken{}, &domain.ExamineAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	orgID := raid.NewRaid().WithPrefix(domain.OrganizationIDPrefix).WithRandom()
+	adminID := raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom().WithTimestampNow()
+	for _, s := range []struct{ username, class string }{{"ani", "A"}, {"budi", "A"}, {"cici", "B"}} {
+		student := &domain.Student{Username: s.username, Class: s.class, OrganizationID: orgID, AdminID: adminID}
+		student.ID = StudentIDFactory.WithRandom().WithTimestampNow()
+		if err := db.Create(student).Error; err != nil {
+			t.Fatal("failed to create student", err)
+		}
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	router := &StudentRouter{Auth: a, StudentService: &StudentService{StudentRepository: &StudentRepositoryGorm{db}, Auth: a}}
+	r := chi.NewRouter()
+	r.Route("/student", router.Route)
+
+	session, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: adminID.String()},
+		Role:             domain.RoleTeacher,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	list := func(query string) (int, []*domain.Student) {
+		req := httptest.NewRequest(http.MethodGet, "/student/list"+query, nil)
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := &struct {
+			Data []*domain.Student `json:"data"`
+		}{}
+		_ = json.NewDecoder(w.Body).Decode(res)
+		return w.Code, res.Data
+	}
+
+	if code, students := list(""); code != http.StatusOK || len(students) != 3 {
+		t.Errorf("expected every student to be listed, got %d with %d students", code, len(students))
+	}
+	if code, students := list("?class=A&count=1"); code != http.StatusOK || len(students) != 1 || students[0].Class != "A" {
+		t.Errorf("expected single student of class to be listed, got %d %+v", code, students)
+	}
+	if code, _ := list("?count=many"); code != http.StatusBadRequest {
+		t.Errorf("expected invalid count to be refused, got %d", code)
+	}
+}
@@ -3,15 +3,24 @@ package student
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/audit"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/identity"
+	"github.com/falentio/skul/internal/pkg/logging"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/password"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tenant"
+	"github.com/falentio/skul/internal/pkg/tracing"
 	"github.com/falentio/skul/internal/pkg/validator"
 	"github.com/falentio/skul/internal/pkg/xrand"
 )
@@ -20,13 +29,55 @@ var StudentIDFactory = raid.NewRaid().WithPrefix("stu")
 var _ domain.StudentService = new(StudentService)
 
 type StudentService struct {
-	StudentRepository domain.StudentRepository
-	Auth              *auth.Auth
-	Logger            zerolog.Logger
+	StudentRepository        domain.StudentRepository
+	ExamineStudentRepository domain.ExamineStudentRepositoryRead
+	EnteranceTokenRepository domain.EnteranceTokenRepositoryRead
+	Auth                     *auth.Auth
+	Tracing                  *tracing.Tracing
+	Logger                   zerolog.Logger
+
+	// Storage keeps device lock of students, see SessionPolicy.
+	Storage       storage.Storage
+	SessionPolicy SessionPolicy
+	sessionMu     sync.Mutex
+
+	PasswordPolicy password.Policy
+	Resetter       *password.Resetter
+	Guard          *loginguard.Guard
+	Audit          *audit.Recorder
+	// Providers verify students without matching local password, in order.
+	Providers []*identity.Provider
+	// Organization is organization of students logging in without sending
+	// their organization.
+	Organization raid.Raid
+}
+
+// setPassword hashes password of student, password is generated when empty
+// and must be changed on first login.
+func (s *StudentService) setPassword(student *domain.Student) error {
+	student.MustChangePassword = student.Password == ""
+	if student.MustChangePassword {
+		student.Password = xrand.Smol.GeneratePassword(10)
+	} else if err := s.PasswordPolicy.Validate(student.Password); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(student.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	student.PasswordHash = string(hash)
+	if !student.MustChangePassword {
+		student.Password = ""
+	}
+	return nil
 }
 
 func (s *StudentService) CreateStudent(ctx context.Context, student *domain.Student) (res response.Response, err error) {
-	adminID, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "StudentService.CreateStudent")
+	defer span.End()
+
+	adminID, err := s.Auth.Authorize(ctx, domain.PermissionStudentWrite)
 	if err != nil {
 		return
 	}
@@ -41,12 +92,9 @@ func (s *StudentService) CreateStudent(ctx context.Context, student *domain.Stud
 	if err != nil {
 		return
 	}
-
-	hash, err := bcrypt.GenerateFromPassword([]byte(student.Password), bcrypt.DefaultCost)
-	if err != nil {
+	if err = s.setPassword(student); err != nil {
 		return
 	}
-	student.PasswordHash = string(hash)
 
 	err = s.StudentRepository.CreateStudent(ctx, student)
 	if err == domain.ErrStudentConflict {
@@ -55,13 +103,19 @@ func (s *StudentService) CreateStudent(ctx context.Context, student *domain.Stud
 	if err != nil {
 		return
 	}
+	if err = s.Audit.Record(ctx, domain.AuditStudentCreate, student.ID, nil, student); err != nil {
+		return
+	}
 
 	res = response.NewCreated(student)
 	return res, nil
 }
 
 func (s *StudentService) BatchCreateStudent(ctx context.Context, students []*domain.Student) (res response.Response, err error) {
-	adminID, err := s.Auth.GetSubjectRaid(ctx, domain.AdminIDPrefix)
+	ctx, span := s.Tracing.Start(ctx, "StudentService.BatchCreateStudent")
+	defer span.End()
+
+	adminID, err := s.Auth.Authorize(ctx, domain.PermissionStudentWrite)
 	if err != nil {
 		return
 	}
@@ -76,16 +130,9 @@ func (s *StudentService) BatchCreateStudent(ctx context.Context, students []*dom
 		if err != nil {
 			return
 		}
-		if student.Password == "" {
-			student.Password = xrand.Smol.GeneratePassword(10)
-		}
-
-		var hash []byte
-		hash, err = bcrypt.GenerateFromPassword([]byte(student.Password), bcrypt.DefaultCost)
-		if err != nil {
+		if err = s.setPassword(student); err != nil {
 			return
 		}
-		student.PasswordHash = string(hash)
 	}
 
 	err = s.StudentRepository.BatchCreateStudent(ctx, students)
@@ -95,13 +142,24 @@ func (s *StudentService) BatchCreateStudent(ctx context.Context, students []*dom
 	if err != nil {
 		return
 	}
+	for _, student := range students {
+		if err = s.Audit.Record(ctx, domain.AuditStudentCreate, student.ID, nil, student); err != nil {
+			return
+		}
+	}
 
 	res = response.NewCreated(students)
 	return res, nil
 }
 
 func (s *StudentService) GetStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.GetStudent")
+	defer span.End()
+
 	student, err := s.StudentRepository.GetStudent(ctx, studentID)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
 	if err != nil {
 		return
 	}
@@ -111,29 +169,116 @@ func (s *StudentService) GetStudent(ctx context.Context, studentID raid.Raid) (r
 }
 
 func (s *StudentService) LoginStudent(ctx context.Context, student *domain.Student) (res response.Response, err error) {
-	stored, err := s.StudentRepository.GetStudentByUsername(ctx, student.Username)
-	if errors.Is(err, domain.ErrStudentNotFound) {
-		err = response.NewBadRequest(nil, "can not find student with username %q", student.Username)
+	ctx, span := s.Tracing.Start(ctx, "StudentService.LoginStudent")
+	defer span.End()
+
+	// authorization code logins have no username to count failures of, codes
+	// are not guessable anyway
+	account := ""
+	if student.Username != "" {
+		account = loginguard.Account("student", student.Username)
+	}
+	ctx = tenant.WithOrganizationOr(ctx, student.OrganizationID, s.Organization)
+	if err = s.Guard.Check(ctx, account); err != nil {
+		return
+	}
+
+	stored, failed, err := s.authenticate(ctx, student)
+	if failed {
+		s.fail(ctx, account)
 	}
 	if err != nil {
 		return
 	}
+	// code login is checked against account it resolved to, so locked
+	// student can not log in with code instead
+	if account == "" {
+		ctx = tenant.WithOrganization(ctx, stored.OrganizationID)
+		account = loginguard.Account("student", stored.Username)
+		if err = s.Guard.Check(ctx, account); err != nil {
+			return
+		}
+	}
+	if err = s.Guard.Succeed(ctx, account); err != nil {
+		return
+	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(student.Password)); err != nil {
-		err = response.NewBadRequest(nil, "password invalid")
+	// device id is issued by server, unlike user agent it can not be copied
+	// by other device
+	device := student.Device
+	if device == "" {
+		device = DeviceIDFactory.WithRandom().WithTimestampNow().String()
+	}
+	id := auth.NewSessionID()
+	if err = s.lockSession(ctx, stored.ID, id, device); err != nil {
 		return
 	}
 
-	c, err := s.Auth.Sign(jwt.RegisteredClaims{
-		Subject: stored.ID.String(),
+	c, err := s.Auth.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      id,
+			Subject: stored.ID.String(),
+		},
+		Role:               domain.RoleStudent,
+		Organization:       stored.OrganizationID.String(),
+		MustChangePassword: stored.MustChangePassword,
+		Device:             device,
 	})
+	if err != nil {
+		return
+	}
 
 	r := response.NewNoContent()
-	r.Cookies = append(r.Cookies, c)
+	r.Cookies = append(r.Cookies, c, s.deviceCookie(device))
 	return r, nil
 }
 
+func (s *StudentService) fail(ctx context.Context, account string) {
+	if account == "" {
+		return
+	}
+	if err := s.Guard.Fail(ctx, account); err != nil {
+		logging.Ctx(ctx, s.Logger).Error().Err(err).Str("account", account).Msg("failed to record failed login")
+	}
+}
+
+// LogoutStudent revokes every session of student, e.g. when student device
+// was lost or used by someone else.
+func (s *StudentService) LogoutStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.LogoutStudent")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentReset); err != nil {
+		return
+	}
+
+	_, err = s.StudentRepository.GetStudent(ctx, studentID)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
+	if err != nil {
+		return
+	}
+
+	if err = s.Auth.RevokeSubject(ctx, studentID.String()); err != nil {
+		return
+	}
+	if err = s.Audit.Record(ctx, domain.AuditStudentLogout, studentID, nil, nil); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return res, nil
+}
+
 func (s *StudentService) ListStudent(ctx context.Context, opts *domain.ListStudentOptions) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.ListStudent")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentRead); err != nil {
+		return
+	}
+
 	students, err := s.StudentRepository.ListStudent(ctx, opts)
 	if err != nil {
 		return
@@ -143,20 +288,41 @@ func (s *StudentService) ListStudent(ctx context.Context, opts *domain.ListStude
 		Count:  opts.Count,
 		Offset: opts.Offset,
 	})
-	return nil, nil
+	return
 }
 
 func (s *StudentService) DeleteStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.DeleteStudent")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentWrite); err != nil {
+		return
+	}
+
+	before, _ := s.StudentRepository.GetStudent(ctx, studentID)
 	err = s.StudentRepository.DeleteStudent(ctx, studentID)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
 	if err != nil {
 		return
 	}
+	if err = s.Audit.Record(ctx, domain.AuditStudentDelete, studentID, before, nil); err != nil {
+		return
+	}
 
 	res = response.NewNoContent()
 	return res, nil
 }
 
 func (s *StudentService) UpdateStudent(ctx context.Context, student *domain.Student) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.UpdateStudent")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentWrite); err != nil {
+		return
+	}
+
 	student.EnteranceTokens = nil
 	student.ExamineAnswer = nil
 	student.Admin = nil
@@ -165,20 +331,169 @@ func (s *StudentService) UpdateStudent(ctx context.Context, student *domain.Stud
 		return
 	}
 
+	student.MustChangePassword = false
+	var hash []byte
 	if student.Password != "" {
-		var hash []byte
+		if err = s.PasswordPolicy.Validate(student.Password); err != nil {
+			return
+		}
 		hash, err = bcrypt.GenerateFromPassword([]byte(student.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return
 		}
-		student.Password = string(hash)
+		student.Password = ""
 	}
 
+	before, _ := s.StudentRepository.GetStudent(ctx, student.ID)
 	err = s.StudentRepository.UpdateStudent(ctx, student)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", student.ID)
+	}
 	if err != nil {
 		return
 	}
+	// password is written with must change flag cleared, struct updates skip
+	// false, and sessions using old password are revoked
+	if hash != nil {
+		if err = s.StudentRepository.UpdateStudentPassword(ctx, student.ID, string(hash), false); err != nil {
+			return
+		}
+		if err = s.Auth.RevokeSubject(ctx, student.ID.String()); err != nil {
+			return
+		}
+	}
+	after, _ := s.StudentRepository.GetStudent(ctx, student.ID)
+	if err = s.Audit.Record(ctx, domain.AuditStudentUpdate, student.ID, before, after); err != nil {
+		return
+	}
 
 	res = response.NewOK(student)
 	return res, nil
 }
+
+// ChangeStudentPassword changes password of current student and clears the
+// must change password flag of its session.
+func (s *StudentService) ChangeStudentPassword(ctx context.Context, c *domain.ChangePassword) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.ChangeStudentPassword")
+	defer span.End()
+
+	id, err := s.Auth.GetSubjectRaid(ctx, domain.StudentIDPrefix)
+	if err != nil {
+		return
+	}
+	claims, err := s.Auth.GetClaims(ctx)
+	if err != nil {
+		return
+	}
+
+	stored, err := s.StudentRepository.GetStudent(ctx, id)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", id)
+	}
+	if err != nil {
+		return
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(c.OldPassword)); err != nil {
+		err = response.NewBadRequest(map[string]string{"oldPassword": "not match"}, "old password does not match")
+		return
+	}
+	if c.NewPassword == c.OldPassword {
+		err = response.NewBadRequest(map[string]string{"newPassword": "unchanged"}, "new password must differ from old password")
+		return
+	}
+	if err = s.PasswordPolicy.Validate(c.NewPassword); err != nil {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	err = s.StudentRepository.UpdateStudentPassword(ctx, id, string(hash), false)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", id)
+	}
+	if err != nil {
+		return
+	}
+
+	renewed := *claims
+	renewed.MustChangePassword = false
+	cookie, err := s.Auth.Sign(renewed)
+	if err != nil {
+		return
+	}
+	// other sessions may be of whoever knew old password, renewed session
+	// keeps id of current one
+	if err = s.Auth.RevokeSubject(ctx, id.String(), claims.ID); err != nil {
+		return
+	}
+	r := response.NewNoContent()
+	r.Cookies = append(r.Cookies, cookie)
+	return r, nil
+}
+
+// ResetStudentPassword issues one time code which student uses to set new password.
+func (s *StudentService) ResetStudentPassword(ctx context.Context, studentID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.ResetStudentPassword")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentReset); err != nil {
+		return
+	}
+
+	_, err = s.StudentRepository.GetStudent(ctx, studentID)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
+	if err != nil {
+		return
+	}
+
+	code, expiresAt, err := s.Resetter.Issue(studentID.String())
+	if err != nil {
+		return
+	}
+	if err = s.Audit.Record(ctx, domain.AuditStudentPasswordReset, studentID, nil, nil); err != nil {
+		return
+	}
+
+	res = response.NewCreated(&domain.PasswordResetCode{Code: code, ExpiresAt: expiresAt})
+	return res, nil
+}
+
+// RedeemStudentPassword sets new password with reset code and logs out every
+// session of the student.
+func (s *StudentService) RedeemStudentPassword(ctx context.Context, r *domain.ResetPassword) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.RedeemStudentPassword")
+	defer span.End()
+
+	ctx = tenant.WithOrganizationOr(ctx, r.OrganizationID, s.Organization)
+	stored, err := s.StudentRepository.GetStudentByUsername(ctx, r.Username)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = password.ErrInvalidCode
+	}
+	if err != nil {
+		return
+	}
+	if err = s.PasswordPolicy.Validate(r.NewPassword); err != nil {
+		return
+	}
+	if err = s.Resetter.Redeem(stored.ID.String(), r.Code); err != nil {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(r.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	if err = s.StudentRepository.UpdateStudentPassword(ctx, stored.ID, string(hash), false); err != nil {
+		return
+	}
+	if err = s.Auth.RevokeSubject(ctx, stored.ID.String()); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return res, nil
+}
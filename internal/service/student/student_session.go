@@ -0,0 +1,173 @@
+package student
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/loginguard"
+	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
+)
+
+// SessionPolicy decides what happens when student logs in from another
+// device while one of its enterance token windows is open.
+type SessionPolicy string
+
+const (
+	// SessionPolicyNone allows any number of sessions.
+	SessionPolicyNone SessionPolicy = ""
+	// SessionPolicyKick revokes the older session.
+	SessionPolicyKick SessionPolicy = "kick"
+	// SessionPolicyRefuse refuses the new login until proctor releases the lock.
+	SessionPolicyRefuse SessionPolicy = "refuse"
+)
+
+const sessionLockPrefix = "student:session:"
+
+// DeviceCookie keeps server issued id of device student logged in from.
+const DeviceCookie = "device"
+
+var DeviceIDFactory = raid.NewRaid().WithPrefix("dev")
+
+// deviceCookie returns cookie keeping device id for as long as a year, so
+// device is recognized on next login.
+func (s *StudentService) deviceCookie(device string) *http.Cookie {
+	return &http.Cookie{
+		Name:     DeviceCookie,
+		Value:    device,
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   s.Auth.Secure,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(365 * 24 * time.Hour / time.Second),
+	}
+}
+
+type sessionLock struct {
+	ID     string `json:"id"`
+	Device string `json:"device"`
+}
+
+func fingerprint(device string) string {
+	h := sha256.Sum256([]byte(device))
+	return hex.EncodeToString(h[:])
+}
+
+// activeWindowEnd returns the latest end of enterance token windows of student
+// which are open now, ok is false when there is none.
+func (s *StudentService) activeWindowEnd(ctx context.Context, studentID raid.Raid) (until time.Time, ok bool, err error) {
+	ess, err := s.ExamineStudentRepository.ListExamineStudent(ctx, &domain.ListExamineStudentOptions{
+		StudentID: studentID,
+	})
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, es := range ess {
+		token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, es.EnteranceTokenID)
+		if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+			continue
+		}
+		if err != nil {
+			return until, false, err
+		}
+		token = token.WindowFor(es)
+		if now.Before(token.EnteranceFrom) || now.After(token.EnteranceUntil) {
+			continue
+		}
+		if token.EnteranceUntil.After(until) {
+			until, ok = token.EnteranceUntil, true
+		}
+	}
+	return until, ok, nil
+}
+
+// lockSession binds student to session id and device for the active enterance
+// token window, older session on other device is kicked or the login refused
+// depending on s.SessionPolicy. Lock is checked and set under s.sessionMu,
+// storage is local to the process so concurrent logins can not both win.
+func (s *StudentService) lockSession(ctx context.Context, studentID raid.Raid, id, device string) error {
+	if s.SessionPolicy == SessionPolicyNone || s.Storage == nil {
+		return nil
+	}
+
+	until, ok, err := s.activeWindowEnd(ctx, studentID)
+	if err != nil || !ok {
+		return err
+	}
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	key := sessionLockPrefix + studentID.String()
+	device = fingerprint(device)
+	b, err := tracing.Bind(ctx, s.Storage).Get(key)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		old := &sessionLock{}
+		if err := json.Unmarshal(b, old); err != nil {
+			return err
+		}
+		if old.Device != device && s.SessionPolicy == SessionPolicyRefuse {
+			return response.NewConflict(nil, "student with id %q already logged in on other device, ask proctor to release it", studentID)
+		}
+		if err := s.Auth.Revoke(ctx, &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: old.ID}}); err != nil {
+			return err
+		}
+	}
+
+	b, err = json.Marshal(&sessionLock{ID: id, Device: device})
+	if err != nil {
+		return err
+	}
+	return tracing.Bind(ctx, s.Storage).Set(key, b, time.Until(until))
+}
+
+// ReleaseStudent removes device lock and login lockout of student, so student
+// can log in from other device.
+func (s *StudentService) ReleaseStudent(ctx context.Context, studentID raid.Raid) (res response.Response, err error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentService.ReleaseStudent")
+	defer span.End()
+
+	if _, err = s.Auth.Authorize(ctx, domain.PermissionStudentReset); err != nil {
+		return
+	}
+
+	student, err := s.StudentRepository.GetStudent(ctx, studentID)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
+	if err != nil {
+		return
+	}
+
+	if err = s.Guard.Reset(ctx, loginguard.Account("student", student.Username)); err != nil {
+		return
+	}
+	if s.Storage != nil {
+		s.sessionMu.Lock()
+		defer s.sessionMu.Unlock()
+		if err = tracing.Bind(ctx, s.Storage).Delete(sessionLockPrefix + studentID.String()); err != nil {
+			return
+		}
+	}
+	if err = s.Audit.Record(ctx, domain.AuditStudentRelease, studentID, nil, nil); err != nil {
+		return
+	}
+
+	res = response.NewNoContent()
+	return res, nil
+}
@@ -0,0 +1,166 @@
+package student
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/gofiber/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+type fakeExamineStudentRepository []*domain.ExamineStudent
+
+func (r fakeExamineStudentRepository) ListExamineStudent(ctx context.Context, o *domain.ListExamineStudentOptions) ([]*domain.ExamineStudent, error) {
+	return r, nil
+}
+
+func (r fakeExamineStudentRepository) CountActiveExamineStudent(ctx context.Context, at time.Time) (int64, error) {
+	return int64(len(r)), nil
+}
+
+type fakeEnteranceTokenRepository map[raid.Raid]*domain.EnteranceToken
+
+func (r fakeEnteranceTokenRepository) GetEnteranceToken(ctx context.Context, tokenID raid.Raid) (*domain.EnteranceToken, error) {
+	if t, ok := r[tokenID]; ok {
+		return t, nil
+	}
+	return nil, domain.ErrEnteranceTokenNotFound
+}
+
+func (r fakeEnteranceTokenRepository) GetEnteranceTokenByCode(ctx context.Context, code string) (*domain.EnteranceToken, error) {
+	for _, t := range r {
+		if t.Code == code {
+			return t, nil
+		}
+	}
+	return nil, domain.ErrEnteranceTokenNotFound
+}
+
+func (r fakeEnteranceTokenRepository) ListEnteranceToken(ctx context.Context, o *domain.ListEnteranceTokenOptions) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListSchedule(ctx context.Context, o *domain.ScheduleOptions) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListConflictingEnteranceToken(ctx context.Context, token *domain.EnteranceToken) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListConflictingEnteranceTokenOfStudents(ctx context.Context, token *domain.EnteranceToken, studentIDs []raid.Raid) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func newTestSessionService(policy SessionPolicy, from, until time.Time) *StudentService {
+	tokenID := raid.NewRaid().WithPrefix(domain.EnteranceTokenIDPrefix).WithRandom().WithTimestampNow()
+	token := &domain.EnteranceToken{EnteranceFrom: from, EnteranceUntil: until}
+	token.ID = tokenID
+	store := memory.New()
+	return &StudentService{
+		ExamineStudentRepository: fakeExamineStudentRepository{{EnteranceTokenID: tokenID}},
+		EnteranceTokenRepository: fakeEnteranceTokenRepository{tokenID: token},
+		Auth: &auth.Auth{
+			Name:          "session",
+			SigningMethod: jwt.SigningMethodHS512,
+			Secret:        []byte("secret"),
+			Lifetime:      time.Hour,
+			Storage:       store,
+		},
+		Storage:       store,
+		SessionPolicy: policy,
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	studentID := StudentIDFactory.WithRandom().WithTimestampNow()
+	now := time.Now()
+
+	verify := func(t *testing.T, s *StudentService, id string) error {
+		c, err := s.Auth.Sign(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: id, Subject: studentID.String()}})
+		if err != nil {
+			t.Fatal("failed to sign claims", err)
+		}
+		_, err = s.Auth.Verify(c.Value)
+		return err
+	}
+
+	t.Run("kick", func(t *testing.T) {
+		s := newTestSessionService(SessionPolicyKick, now.Add(-time.Minute), now.Add(time.Hour))
+		first, second := auth.NewSessionID(), auth.NewSessionID()
+		if err := s.lockSession(ctx, studentID, first, "phone"); err != nil {
+			t.Fatal("failed to lock session", err)
+		}
+		if err := s.lockSession(ctx, studentID, second, "laptop"); err != nil {
+			t.Fatal("login from other device must kick older session", err)
+		}
+		if err := verify(t, s, first); err != auth.ErrRevoked {
+			t.Errorf("older session must be revoked, got %v", err)
+		}
+		if err := verify(t, s, second); err != nil {
+			t.Errorf("newer session must stay valid, got %v", err)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		s := newTestSessionService(SessionPolicyRefuse, now.Add(-time.Minute), now.Add(time.Hour))
+		first := auth.NewSessionID()
+		if err := s.lockSession(ctx, studentID, first, "phone"); err != nil {
+			t.Fatal("failed to lock session", err)
+		}
+		var resErr response.ResponseError
+		if err := s.lockSession(ctx, studentID, auth.NewSessionID(), "laptop"); !errors.As(err, &resErr) {
+			t.Errorf("login from other device must be refused, got %v", err)
+		}
+		if err := s.lockSession(ctx, studentID, auth.NewSessionID(), "phone"); err != nil {
+			t.Errorf("login from same device must be allowed, got %v", err)
+		}
+
+		if err := s.Storage.Delete(sessionLockPrefix + studentID.String()); err != nil {
+			t.Fatal("failed to release lock", err)
+		}
+		if err := s.lockSession(ctx, studentID, auth.NewSessionID(), "laptop"); err != nil {
+			t.Errorf("login from other device must be allowed after release, got %v", err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		s := newTestSessionService(SessionPolicyRefuse, now.Add(-time.Minute), now.Add(time.Hour))
+		var wg sync.WaitGroup
+		var locked int32
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(device string) {
+				defer wg.Done()
+				if err := s.lockSession(ctx, studentID, auth.NewSessionID(), device); err == nil {
+					atomic.AddInt32(&locked, 1)
+				}
+			}(DeviceIDFactory.WithRandom().String())
+		}
+		wg.Wait()
+		if locked != 1 {
+			t.Errorf("only one of concurrent logins from different devices must win, got %d", locked)
+		}
+	})
+
+	t.Run("outside window", func(t *testing.T) {
+		s := newTestSessionService(SessionPolicyRefuse, now.Add(time.Hour), now.Add(2*time.Hour))
+		if err := s.lockSession(ctx, studentID, auth.NewSessionID(), "phone"); err != nil {
+			t.Fatal("failed to lock session", err)
+		}
+		if err := s.lockSession(ctx, studentID, auth.NewSessionID(), "laptop"); err != nil {
+			t.Errorf("device must not be locked outside enterance window, got %v", err)
+		}
+	})
+}
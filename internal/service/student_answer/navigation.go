@@ -0,0 +1,137 @@
+package studentanswer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/falentio/raid-go"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/response"
+)
+
+// navigation enforces navigation restrictions of examination on answer
+// writes within single attempt. Sections are timed from the start of attempt
+// of student, so questions of sections can not be answered before student
+// opened examination, and in linear examination questions before the
+// furthest question answered by student are read-only.
+type navigation struct {
+	linear   bool
+	started  bool
+	position map[string]int
+	windows  map[string][2]time.Time
+	furthest int
+}
+
+func (s *StudentAnswerService) navigation(ctx context.Context, es *domain.ExamineStudent, token *domain.EnteranceToken) (*navigation, error) {
+	ex, err := s.ExaminationRepository.GetExamination(ctx, token.ExaminationID)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", token.ExaminationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := &navigation{
+		linear:   ex.Linear,
+		started:  es.StartedAt != nil,
+		position: make(map[string]int),
+		windows:  make(map[string][2]time.Time),
+		furthest: -1,
+	}
+	// sections are not open at all before attempt is started
+	start := time.Time{}
+	if n.started {
+		start = *es.StartedAt
+	}
+	windows := ex.SectionWindows(start)
+	for i, q := range ex.OrderedQuestions() {
+		n.position[q.ID.String()] = i
+		if w, ok := windows[q.ExaminationSectionID.String()]; ok && !q.ExaminationSectionID.IsNil() {
+			n.windows[q.ID.String()] = w
+		}
+	}
+	if !n.linear {
+		return n, nil
+	}
+
+	// unselected answers count too, student can not go back by unselecting
+	// answer of later question
+	as, err := s.StudentAnswerRepository.ListStudentAnswer(ctx, &domain.ListStudentAnswerOptions{
+		StudentID:         es.StudentID,
+		EnteranceTokenID:  token.ID,
+		IncludeUnselected: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range as {
+		if a.ExamineAnswer != nil {
+			n.visit(a.ExamineAnswer.ExamineQuestionID)
+		}
+	}
+	return n, nil
+}
+
+// check returns reason why question can not be answered at at, or empty
+// string when it can.
+func (n *navigation) check(questionID raid.Raid, at time.Time) string {
+	if w, ok := n.windows[questionID.String()]; ok && !n.started {
+		return "examination must be opened before answering examine question of section"
+	} else if ok && (at.Before(w[0]) || !at.Before(w[1])) {
+		return "section of examine question is not open"
+	}
+	if p, ok := n.position[questionID.String()]; ok && n.linear && p < n.furthest {
+		return "examine question is read-only after later question was answered"
+	}
+	return ""
+}
+
+// visit records that student answered question.
+func (n *navigation) visit(questionID raid.Raid) {
+	if p, ok := n.position[questionID.String()]; ok && p > n.furthest {
+		n.furthest = p
+	}
+}
+
+// checkNavigation refuses write of answer a made now when student is not
+// assigned to its enterance token, window of the token is not open or student
+// has submitted the attempt, answer is not
+// part of examination of the token, or navigation of examination does not
+// allow it.
+func (s *StudentAnswerService) checkNavigation(ctx context.Context, a *domain.StudentAnswer) error {
+	token, es, err := s.attempt(ctx, a.StudentID, a.EnteranceTokenID)
+	if err != nil {
+		return err
+	}
+	if es.SubmittedAt != nil {
+		return response.NewForbidden(nil, "attempt was submitted")
+	}
+	switch err := token.CheckEntry(time.Now(), s.EntryGrace, true); {
+	case errors.Is(err, domain.ErrEnteranceTokenNotOpen):
+		return response.NewForbidden(map[string]string{"enteranceToken": "not_open"}, "enterance token with id %q is not open yet, it opens at %s", token.ID, token.EnteranceFrom.Format(time.RFC3339))
+	case errors.Is(err, domain.ErrEnteranceTokenClosed):
+		return response.NewForbidden(map[string]string{"enteranceToken": "closed"}, "enterance token with id %q is closed since %s", token.ID, token.EnteranceUntil.Format(time.RFC3339))
+	case err != nil:
+		return err
+	}
+	ea, err := s.ExamineAnswerRepository.GetExamineAnswer(ctx, a.ExamineAnswerID)
+	if errors.Is(err, domain.ErrExamineAnswerNotFound) {
+		err = response.NewNotFound(nil, "can not find examine answer with id %q", a.ExamineAnswerID)
+	}
+	if err != nil {
+		return err
+	}
+	if ea.ExaminationID.String() != token.ExaminationID.String() {
+		return response.NewNotFound(nil, "examine answer with id %q is not part of examination of enterance token", a.ExamineAnswerID)
+	}
+	n, err := s.navigation(ctx, es, token)
+	if err != nil {
+		return err
+	}
+	if reason := n.check(ea.ExamineQuestionID, time.Now()); reason != "" {
+		return response.NewForbidden(nil, "%s", reason)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package studentanswer
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+type QuestionFlagRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+func (r *QuestionFlagRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "student_id", "students")
+}
+
+func (r *QuestionFlagRepositoryGorm) ListQuestionFlag(ctx context.Context, o *domain.ListQuestionFlagOptions) ([]*domain.QuestionFlag, error) {
+	fs := make([]*domain.QuestionFlag, 0)
+	db := r.DB.
+		WithContext(ctx).
+		Model(&domain.QuestionFlag{}).
+		Scopes(r.scope(ctx))
+	if !o.StudentID.IsNil() {
+		db = db.Where("student_id = ?", o.StudentID.String())
+	}
+	if !o.EnteranceTokenID.IsNil() {
+		db = db.Where("enterance_token_id = ?", o.EnteranceTokenID.String())
+	}
+	err := db.
+		Find(&fs).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (r *QuestionFlagRepositoryGorm) SetQuestionFlag(ctx context.Context, f *domain.QuestionFlag) error {
+	ok, err := tenant.Owns(ctx, r.DB, "students", f.StudentID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrStudentNotFound
+	}
+	return r.DB.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "student_id"},
+				{Name: "enterance_token_id"},
+				{Name: "examine_question_id"},
+			},
+			DoUpdates: clause.AssignmentColumns([]string{"flagged", "updated_at"}),
+		}).
+		Create(f).
+		Error
+}
@@ -3,27 +3,46 @@ package studentanswer
 import (
 	"context"
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
 )
 
 type StudentAnswerRepositoryGorm struct {
 	DB *gorm.DB
 }
 
+func (r *StudentAnswerRepositoryGorm) scope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	return tenant.ScopeParent(ctx, "student_id", "students")
+}
+
 func (r *StudentAnswerRepositoryGorm) ListStudentAnswer(ctx context.Context, o *domain.ListStudentAnswerOptions) ([]*domain.StudentAnswer, error) {
 	a := make([]*domain.StudentAnswer, 0)
-	err := r.DB.
+	db := r.DB.
 		WithContext(ctx).
 		Model(&domain.StudentAnswer{}).
-		Preload("Examination").
+		Scopes(r.scope(ctx)).
+		Preload("ExamineAnswer").
 		Preload("EnteranceToken").
-		Preload("Student").
-		Where(o).
-		Find(a).
+		Preload("Student")
+	if !o.ExamineAnswerID.IsNil() {
+		db = db.Where("examine_answer_id = ?", o.ExamineAnswerID.String())
+	}
+	if !o.StudentID.IsNil() {
+		db = db.Where("student_id = ?", o.StudentID.String())
+	}
+	if !o.EnteranceTokenID.IsNil() {
+		db = db.Where("enterance_token_id = ?", o.EnteranceTokenID.String())
+	}
+	if o.IncludeUnselected {
+		db = db.Unscoped()
+	}
+	err := db.
+		Find(&a).
 		Error
 	if err != nil {
 		return nil, err
@@ -31,10 +50,35 @@ func (r *StudentAnswerRepositoryGorm) ListStudentAnswer(ctx context.Context, o *
 	return a, nil
 }
 
+func (r *StudentAnswerRepositoryGorm) CountOpenStudentAnswer(ctx context.Context, at time.Time) (map[string]int64, error) {
+	rows := make([]struct {
+		EnteranceTokenID string
+		Count            int64
+	}, 0)
+	err := r.DB.WithContext(ctx).
+		Model(&domain.StudentAnswer{}).
+		Scopes(r.scope(ctx)).
+		Select("student_answers.enterance_token_id, COUNT(*) AS count").
+		Joins("JOIN enterance_tokens ON enterance_tokens.id = student_answers.enterance_token_id AND enterance_tokens.deleted_at IS NULL").
+		Where("enterance_tokens.enterance_from <= ? AND enterance_tokens.enterance_until > ?", at, at).
+		Group("student_answers.enterance_token_id").
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	count := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		count[row.EnteranceTokenID] = row.Count
+	}
+	return count, nil
+}
+
 func (r *StudentAnswerRepositoryGorm) GetStudentAnswer(ctx context.Context, id raid.Raid) (*domain.StudentAnswer, error) {
 	a := &domain.StudentAnswer{}
 	err := r.DB.
 		WithContext(ctx).
+		Scopes(r.scope(ctx)).
 		First(a, "id = ?", id.String()).
 		Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -46,19 +90,54 @@ func (r *StudentAnswerRepositoryGorm) GetStudentAnswer(ctx context.Context, id r
 	return a, nil
 }
 
-func (r *StudentAnswerRepositoryGorm) CreateStudentAnswer(ctx context.Context, a *domain.StudentAnswer) error {
-	return r.DB.
-		WithContext(ctx).
-		Omit("Examination").
-		Omit("EnteranceToken").
-		Omit("Student").
-		Create(a).
-		Error
-}
+func (r *StudentAnswerRepositoryGorm) ApplyStudentAnswer(ctx context.Context, a *domain.StudentAnswer, selected bool) (bool, error) {
+	ok, err := tenant.Owns(ctx, r.DB, "students", a.StudentID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, domain.ErrStudentNotFound
+	}
 
-func (r *StudentAnswerRepositoryGorm) DeleteStudentAnswer(ctx context.Context, id raid.Raid) error {
-	return r.DB.
-		WithContext(ctx).
-		Delete(&domain.StudentAnswer{}, "id = ?", id.String()).
-		Error
+	// unselected answer is kept soft deleted, so older select arriving later
+	// does not bring it back
+	deletedAt := gorm.DeletedAt{}
+	if !selected {
+		deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	}
+	applied := false
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		db := tx.
+			Unscoped().
+			Model(&domain.StudentAnswer{}).
+			Where(
+				"student_id = ? AND enterance_token_id = ? AND examine_answer_id = ?",
+				a.StudentID.String(), a.EnteranceTokenID.String(), a.ExamineAnswerID.String(),
+			).
+			Session(&gorm.Session{})
+		latest := &domain.StudentAnswer{}
+		err := db.Order("answered_at DESC").First(latest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			applied = true
+			a.DeletedAt = deletedAt
+			return tx.Omit("ExamineAnswer", "EnteranceToken", "Student").Create(a).Error
+		}
+		if err != nil {
+			return err
+		}
+		if latest.AnsweredAt.After(a.AnsweredAt) {
+			return nil
+		}
+
+		applied = true
+		answeredAt := a.AnsweredAt
+		*a = *latest
+		a.AnsweredAt = answeredAt
+		a.DeletedAt = deletedAt
+		return db.Updates(map[string]any{
+			"answered_at": a.AnsweredAt,
+			"deleted_at":  deletedAt,
+		}).Error
+	})
+	return applied, err
 }
@@ -0,0 +1,59 @@
+package studentanswer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/tenant"
+)
+
+func TestCountOpenStudentAnswer(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_answer_count?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.EnteranceToken{}, &domain.StudentAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+
+	now := time.Now()
+	examID := newID(domain.ExaminationIDPrefix)
+	closed := &domain.EnteranceToken{ExaminationID: examID, EnteranceFrom: now.Add(-2 * time.Hour), EnteranceUntil: now.Add(-time.Hour)}
+	closed.ID = newID(domain.EnteranceTokenIDPrefix)
+	open := &domain.EnteranceToken{ExaminationID: examID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(time.Hour)}
+	open.ID = newID(domain.EnteranceTokenIDPrefix)
+	if err := db.Create([]*domain.EnteranceToken{closed, open}).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i, tokenID := range []raid.Raid{open.ID, open.ID, open.ID, closed.ID} {
+		sa := &domain.StudentAnswer{ExamineAnswerID: newID(domain.ExamineAnswerIDPrefix), StudentID: newID(domain.StudentIDPrefix), EnteranceTokenID: tokenID}
+		sa.ID = newID(domain.StudentAnswerIDPrefix)
+		if err := db.Create(sa).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		if i == 2 {
+			if err := db.Delete(sa).Error; err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+	}
+
+	count, err := (&StudentAnswerRepositoryGorm{db}).CountOpenStudentAnswer(tenant.Unscoped(context.Background()), now)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(count) != 1 || count[open.ID.String()] != 2 {
+		t.Errorf("expected selected answers of open token only, got %v", count)
+	}
+}
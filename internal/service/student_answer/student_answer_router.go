@@ -10,6 +10,7 @@ import (
 	"github.com/falentio/raid-go"
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/idempotency"
 	"github.com/falentio/skul/internal/pkg/response"
 	"github.com/falentio/skul/internal/pkg/validator"
 )
@@ -17,6 +18,7 @@ import (
 type StudentAnswerRouter struct {
 	StudentAnswerService *StudentAnswerService
 	Auth                 *auth.Auth
+	Idempotency          *idempotency.Idempotency
 }
 
 func (s *StudentAnswerRouter) Route(r chi.Router) {
@@ -24,7 +26,11 @@ func (s *StudentAnswerRouter) Route(r chi.Router) {
 		r.Use(middleware.NoCache)
 		r.Use(s.Auth.VerifyMiddleware)
 		r.Get("/list", s.ListStudentAnswer)
-		r.Post("/create", s.CreateStudentAnswer)
+		r.With(s.Idempotency.Middleware).Post("/create", s.CreateStudentAnswer)
+		r.Post("/sync", s.SyncStudentAnswer)
+		r.Put("/flag", s.FlagQuestion)
+		r.Get("/summary", s.GetAnswerSummary)
+		r.Post("/submit", s.SubmitStudentAnswer)
 		r.Delete("/{studentAnswerID}", s.DeleteStudentAnswer)
 	})
 }
@@ -110,3 +116,89 @@ func (s *StudentAnswerRouter) CreateStudentAnswer(w http.ResponseWriter, r *http
 
 	res.ServeHTTP(w, r)
 }
+
+func (s *StudentAnswerRouter) SyncStudentAnswer(w http.ResponseWriter, r *http.Request) {
+	sync := &domain.AnswerSync{}
+	if err := json.NewDecoder(r.Body).Decode(sync); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	if err := validator.Struct(sync); err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentAnswerService.SyncStudentAnswer(r.Context(), sync)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentAnswerRouter) FlagQuestion(w http.ResponseWriter, r *http.Request) {
+	f := &domain.QuestionFlag{}
+	if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentAnswerService.FlagQuestion(r.Context(), f)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentAnswerRouter) GetAnswerSummary(w http.ResponseWriter, r *http.Request) {
+	o := &domain.AnswerSummaryOptions{}
+	q := r.URL.Query()
+	id, err := raid.RaidFromString(q.Get("enteranceTokenID"))
+	if err != nil {
+		err = response.NewBadRequest(nil, "invalid value for query enteranceTokenID")
+		response.HandleError(w, r, err)
+		return
+	}
+	o.EnteranceTokenID = id
+
+	if q.Has("studentID") {
+		id, err := raid.RaidFromString(q.Get("studentID"))
+		if err != nil {
+			err = response.NewBadRequest(nil, "invalid value for query studentID")
+			response.HandleError(w, r, err)
+			return
+		}
+		o.StudentID = id
+	}
+
+	res, err := s.StudentAnswerService.GetAnswerSummary(r.Context(), o)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
+
+func (s *StudentAnswerRouter) SubmitStudentAnswer(w http.ResponseWriter, r *http.Request) {
+	submit := &domain.AnswerSubmit{}
+	if err := json.NewDecoder(r.Body).Decode(submit); err != nil {
+		err = response.NewBadRequest(nil, "failed to decode body")
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res, err := s.StudentAnswerService.SubmitStudentAnswer(r.Context(), submit)
+	if err != nil {
+		response.HandleError(w, r, err)
+		return
+	}
+
+	res.ServeHTTP(w, r)
+}
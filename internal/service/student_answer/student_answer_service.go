@@ -3,26 +3,50 @@ package studentanswer
 import (
 	"context"
 	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/falentio/raid-go"
 
 	"github.com/falentio/skul/internal/domain"
 	"github.com/falentio/skul/internal/pkg/auth"
+	"github.com/falentio/skul/internal/pkg/metrics"
 	"github.com/falentio/skul/internal/pkg/response"
+	"github.com/falentio/skul/internal/pkg/tracing"
 )
 
 type StudentAnswerService struct {
-	StudentAnswerRepository domain.StudentAnswerRepository
-	Auth                    *auth.Auth
+	StudentAnswerRepository   domain.StudentAnswerRepository
+	QuestionFlagRepository    domain.QuestionFlagRepository
+	ExaminationRepository     domain.ExaminationRepositoryRead
+	EnteranceTokenRepository  domain.EnteranceTokenRepositoryRead
+	ExamineAnswerRepository   domain.ExamineAnswerRepositoryRead
+	ExamineQuestionRepository domain.ExamineQuestionRepositoryRead
+	ExamineStudentRepository  domain.ExamineStudentRepository
+	Auth                      *auth.Auth
+	Tracing                   *tracing.Tracing
+	Metrics                   *metrics.Metrics
+
+	// EntryGrace tolerates clock skew of client on both ends of window of
+	// enterance token, it must match grace used to enter enterance token.
+	EntryGrace time.Duration
+	// SyncGrace is how long after window of enterance token closes answers
+	// made offline within the window are still accepted by
+	// SyncStudentAnswer.
+	SyncGrace time.Duration
 }
 
 func (s *StudentAnswerService) ListStudentAnswer(ctx context.Context, o *domain.ListStudentAnswerOptions) (response.Response, error) {
-	id, err := s.Auth.GetSubjectRaid(ctx, "")
-	if err != nil {
-		return nil, err
-	}
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.ListStudentAnswer")
+	defer span.End()
 
-	if id.Prefix() != domain.AdminIDPrefix {
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionStudentRead); err != nil {
+		id, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
+		if err != nil {
+			return nil, err
+		}
 		o.StudentID = id
 	}
 
@@ -35,25 +59,38 @@ func (s *StudentAnswerService) ListStudentAnswer(ctx context.Context, o *domain.
 }
 
 func (s *StudentAnswerService) CreateStudentAnswer(ctx context.Context, a *domain.StudentAnswer) (response.Response, error) {
-	id, err := s.Auth.GetSubjectRaid(ctx, "")
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.CreateStudentAnswer")
+	defer span.End()
+
+	id, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
 	if err != nil {
 		return nil, err
 	}
 
-	if id.Prefix() != domain.AdminIDPrefix {
-		a.StudentID = id
+	a.StudentID = id
+	if err := s.checkNavigation(ctx, a); err != nil {
+		return nil, err
 	}
 
-	a.ID = raid.NewRaid().WithPrefix(domain.StudentAnswerIDPrefix)
-	if err := s.StudentAnswerRepository.CreateStudentAnswer(ctx, a); err != nil {
+	a.ID = raid.NewRaid().WithPrefix(domain.StudentAnswerIDPrefix).WithRandom().WithTimestampNow()
+	a.AnsweredAt = time.Now()
+	_, err = s.StudentAnswerRepository.ApplyStudentAnswer(ctx, a, true)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", a.StudentID)
+	}
+	if err != nil {
 		return nil, err
 	}
+	s.Metrics.AnswerSubmitted()
 
 	return response.NewOK(a), nil
 }
 
 func (s *StudentAnswerService) DeleteStudentAnswer(ctx context.Context, answerID raid.Raid) (response.Response, error) {
-	id, err := s.Auth.GetSubjectRaid(ctx, "")
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.DeleteStudentAnswer")
+	defer span.End()
+
+	id, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
 	if err != nil {
 		return nil, err
 	}
@@ -69,10 +106,340 @@ func (s *StudentAnswerService) DeleteStudentAnswer(ctx context.Context, answerID
 	if a.StudentID.String() != id.String() {
 		return nil, response.NewForbidden(nil, "can not delete others student answer")
 	}
+	if err := s.checkNavigation(ctx, a); err != nil {
+		return nil, err
+	}
 
-	if err := s.StudentAnswerRepository.DeleteStudentAnswer(ctx, answerID); err != nil {
+	a.AnsweredAt = time.Now()
+	if _, err := s.StudentAnswerRepository.ApplyStudentAnswer(ctx, a, false); err != nil {
 		return nil, err
 	}
 
 	return response.NewNoContent(), nil
 }
+
+// attempt returns enterance token tokenID as seen by student and the
+// assignment of student to it, student must be assigned to it.
+func (s *StudentAnswerService) attempt(ctx context.Context, studentID, tokenID raid.Raid) (*domain.EnteranceToken, *domain.ExamineStudent, error) {
+	token, err := s.EnteranceTokenRepository.GetEnteranceToken(ctx, tokenID)
+	if errors.Is(err, domain.ErrEnteranceTokenNotFound) {
+		err = response.NewNotFound(nil, "can not find enterance token with id %q", tokenID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ess, err := s.ExamineStudentRepository.ListExamineStudent(ctx, &domain.ListExamineStudentOptions{
+		StudentID:        studentID,
+		EnteranceTokenID: token.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ess) == 0 {
+		return nil, nil, response.NewForbidden(nil, "student is not assigned to enterance token with id %q", token.ID)
+	}
+	return token.WindowFor(ess[0]), ess[0], nil
+}
+
+// SyncStudentAnswer applies changes made by student while offline in order of
+// their sequence. Time of change is clamped between start of window of
+// enterance token and the earlier of now and end of the window, and change
+// older than latest change of the same answer loses. Student reconnecting
+// after window closes keeps answers made within it until SyncGrace passes.
+// Changes are acknowledged even when rejected, so client drops them, and
+// changes acknowledged before are skipped.
+func (s *StudentAnswerService) SyncStudentAnswer(ctx context.Context, sync *domain.AnswerSync) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.SyncStudentAnswer")
+	defer span.End()
+
+	studentID, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
+	if err != nil {
+		return nil, err
+	}
+
+	token, es, err := s.attempt(ctx, studentID, sync.EnteranceTokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := append([]*domain.AnswerChange(nil), sync.Changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Seq < changes[j].Seq
+	})
+	for i := 1; i < len(changes); i++ {
+		if changes[i].Seq == changes[i-1].Seq {
+			return nil, response.NewBadRequest(nil, "duplicate change with seq %d", changes[i].Seq)
+		}
+	}
+
+	result := &domain.AnswerSyncResult{
+		Ack:      es.SyncSeq,
+		Rejected: make([]*domain.RejectedAnswerChange, 0),
+	}
+	now := time.Now()
+	until := token.EnteranceUntil.Add(s.EntryGrace)
+	if now.Before(until) {
+		until = now
+	}
+	closed := errors.Is(token.CheckEntry(now, s.EntryGrace, true), domain.ErrEnteranceTokenNotOpen) ||
+		now.After(token.EnteranceUntil.Add(s.EntryGrace+s.SyncGrace)) ||
+		es.SubmittedAt != nil
+	nav, err := s.navigation(ctx, es, token)
+	if err != nil {
+		return nil, err
+	}
+	// examine answers are looked up once per sync, client usually changes
+	// the same answer many times
+	examineAnswers := make(map[string]*domain.ExamineAnswer)
+	for _, c := range changes {
+		if c.Seq <= es.SyncSeq {
+			continue
+		}
+		result.Ack = c.Seq
+		reject := func(reason string) {
+			result.Rejected = append(result.Rejected, &domain.RejectedAnswerChange{Seq: c.Seq, Reason: reason})
+		}
+
+		if closed {
+			reject("enterance token window is closed or attempt was submitted")
+			continue
+		}
+		at := c.At
+		if at.Before(token.EnteranceFrom) {
+			at = token.EnteranceFrom
+		}
+		if at.After(until) {
+			at = until
+		}
+		ea, seen := examineAnswers[c.ExamineAnswerID.String()]
+		if !seen {
+			ea, err = s.ExamineAnswerRepository.GetExamineAnswer(ctx, c.ExamineAnswerID)
+			if err != nil && !errors.Is(err, domain.ErrExamineAnswerNotFound) {
+				return nil, err
+			}
+			if err != nil || ea.ExaminationID.String() != token.ExaminationID.String() {
+				ea = nil
+			}
+			examineAnswers[c.ExamineAnswerID.String()] = ea
+		}
+		if ea == nil {
+			reject("examine answer is not part of examination of enterance token")
+			continue
+		}
+		if reason := nav.check(ea.ExamineQuestionID, at); reason != "" {
+			reject(reason)
+			continue
+		}
+
+		a := &domain.StudentAnswer{
+			ExamineAnswerID:  c.ExamineAnswerID,
+			StudentID:        studentID,
+			EnteranceTokenID: token.ID,
+			AnsweredAt:       at,
+		}
+		a.ID = raid.NewRaid().WithPrefix(domain.StudentAnswerIDPrefix).WithRandom().WithTimestampNow()
+		applied, err := s.StudentAnswerRepository.ApplyStudentAnswer(ctx, a, c.Selected)
+		if errors.Is(err, domain.ErrStudentNotFound) {
+			err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			nav.visit(ea.ExamineQuestionID)
+		}
+		if applied && c.Selected {
+			s.Metrics.AnswerSubmitted()
+		}
+	}
+	if result.Ack > es.SyncSeq {
+		if err := s.ExamineStudentRepository.AckExamineStudent(ctx, token.ID, studentID, result.Ack); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Answers, err = s.StudentAnswerRepository.ListStudentAnswer(ctx, &domain.ListStudentAnswerOptions{
+		StudentID:        studentID,
+		EnteranceTokenID: token.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(result), nil
+}
+
+// FlagQuestion marks question of f as doubtful for student, or clears the
+// mark when f.Flagged is false.
+func (s *StudentAnswerService) FlagQuestion(ctx context.Context, f *domain.QuestionFlag) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.FlagQuestion")
+	defer span.End()
+
+	studentID, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
+	if err != nil {
+		return nil, err
+	}
+
+	token, es, err := s.attempt(ctx, studentID, f.EnteranceTokenID)
+	if err != nil {
+		return nil, err
+	}
+	if es.SubmittedAt != nil {
+		return nil, response.NewForbidden(nil, "attempt was submitted")
+	}
+	q, err := s.ExamineQuestionRepository.GetExamineQuestion(ctx, f.ExamineQuestionID)
+	if err != nil && !errors.Is(err, domain.ErrExamineQuestionNotFound) {
+		return nil, err
+	}
+	if err != nil || q.ExaminationID.String() != token.ExaminationID.String() {
+		return nil, response.NewNotFound(nil, "can not find examine question with id %q in examination of enterance token", f.ExamineQuestionID)
+	}
+
+	f.ID = raid.NewRaid().WithPrefix(domain.QuestionFlagIDPrefix).WithRandom().WithTimestampNow()
+	f.StudentID = studentID
+	err = s.QuestionFlagRepository.SetQuestionFlag(ctx, f)
+	if errors.Is(err, domain.ErrStudentNotFound) {
+		err = response.NewNotFound(nil, "can not find student with id %q", studentID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(f), nil
+}
+
+// GetAnswerSummary returns state of every question of attempt in order they
+// are numbered, staff who can read students may read summary of any student.
+func (s *StudentAnswerService) GetAnswerSummary(ctx context.Context, o *domain.AnswerSummaryOptions) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.GetAnswerSummary")
+	defer span.End()
+
+	if _, err := s.Auth.Authorize(ctx, domain.PermissionStudentRead); err != nil || o.StudentID.IsNil() {
+		id, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
+		if err != nil {
+			return nil, err
+		}
+		o.StudentID = id
+	}
+
+	token, _, err := s.attempt(ctx, o.StudentID, o.EnteranceTokenID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.summary(ctx, o.StudentID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(summary), nil
+}
+
+// summary returns state of every question of attempt of student on token.
+func (s *StudentAnswerService) summary(ctx context.Context, studentID raid.Raid, token *domain.EnteranceToken) (*domain.AnswerSummary, error) {
+	ex, err := s.ExaminationRepository.GetExamination(ctx, token.ExaminationID)
+	if errors.Is(err, domain.ErrExaminationNotFound) {
+		err = response.NewNotFound(nil, "can not find examination with id %q", token.ExaminationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	qs := ex.OrderedQuestions()
+	as, err := s.StudentAnswerRepository.ListStudentAnswer(ctx, &domain.ListStudentAnswerOptions{
+		StudentID:        studentID,
+		EnteranceTokenID: token.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs, err := s.QuestionFlagRepository.ListQuestionFlag(ctx, &domain.ListQuestionFlagOptions{
+		StudentID:        studentID,
+		EnteranceTokenID: token.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	answered := make(map[string]bool)
+	for _, a := range as {
+		if a.ExamineAnswer != nil {
+			answered[a.ExamineAnswer.ExamineQuestionID.String()] = true
+		}
+	}
+	flagged := make(map[string]bool)
+	for _, f := range fs {
+		flagged[f.ExamineQuestionID.String()] = f.Flagged
+	}
+
+	summary := &domain.AnswerSummary{
+		EnteranceTokenID: token.ID,
+		StudentID:        studentID,
+		Questions:        make([]*domain.QuestionState, 0, len(qs)),
+		Flagged:          make([]int, 0),
+		Unanswered:       make([]int, 0),
+	}
+	for i, q := range qs {
+		state := &domain.QuestionState{
+			Number:            i + 1,
+			ExamineQuestionID: q.ID,
+			Status:            domain.QuestionUnanswered,
+			Answered:          answered[q.ID.String()],
+			Flagged:           flagged[q.ID.String()],
+		}
+		if state.Answered {
+			state.Status = domain.QuestionAnswered
+		} else {
+			summary.Unanswered = append(summary.Unanswered, state.Number)
+		}
+		if state.Flagged {
+			state.Status = domain.QuestionFlagged
+			summary.Flagged = append(summary.Flagged, state.Number)
+		}
+		summary.Questions = append(summary.Questions, state)
+	}
+
+	return summary, nil
+}
+
+// SubmitStudentAnswer submits attempt of student, it is refused with flagged
+// and unanswered questions listed unless student confirms the submission.
+func (s *StudentAnswerService) SubmitStudentAnswer(ctx context.Context, submit *domain.AnswerSubmit) (response.Response, error) {
+	ctx, span := s.Tracing.Start(ctx, "StudentAnswerService.SubmitStudentAnswer")
+	defer span.End()
+
+	studentID, err := s.Auth.Authorize(ctx, domain.PermissionExamTake)
+	if err != nil {
+		return nil, err
+	}
+
+	token, es, err := s.attempt(ctx, studentID, submit.EnteranceTokenID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.summary(ctx, studentID, token)
+	if err != nil {
+		return nil, err
+	}
+	if es.SubmittedAt != nil {
+		return response.NewOK(summary), nil
+	}
+	if !submit.Confirm && (len(summary.Flagged) > 0 || len(summary.Unanswered) > 0) {
+		return nil, response.NewConflict(map[string]string{
+			"flagged":    numbers(summary.Flagged),
+			"unanswered": numbers(summary.Unanswered),
+		}, "attempt has flagged or unanswered questions, confirm to submit anyway")
+	}
+
+	if err := s.ExamineStudentRepository.SubmitExamineStudent(ctx, token.ID, studentID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return response.NewOK(summary), nil
+}
+
+// numbers joins question numbers ns by comma.
+func numbers(ns []int) string {
+	ss := make([]string, 0, len(ns))
+	for _, n := range ns {
+		ss = append(ss, strconv.Itoa(n))
+	}
+	return strings.Join(ss, ",")
+}
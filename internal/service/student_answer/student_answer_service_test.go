@@ -0,0 +1,705 @@
+package studentanswer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/falentio/raid-go"
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/falentio/skul/internal/domain"
+	"github.com/falentio/skul/internal/pkg/auth"
+)
+
+type fakeExamineStudentRepository struct {
+	domain.ExamineStudentRepositoryWrite
+
+	ess []*domain.ExamineStudent
+}
+
+func (r *fakeExamineStudentRepository) ListExamineStudent(ctx context.Context, o *domain.ListExamineStudentOptions) ([]*domain.ExamineStudent, error) {
+	ess := make([]*domain.ExamineStudent, 0)
+	for _, es := range r.ess {
+		if es.StudentID == o.StudentID && es.EnteranceTokenID == o.EnteranceTokenID {
+			ess = append(ess, es)
+		}
+	}
+	return ess, nil
+}
+
+func (r *fakeExamineStudentRepository) CountActiveExamineStudent(ctx context.Context, at time.Time) (int64, error) {
+	return int64(len(r.ess)), nil
+}
+
+func (r *fakeExamineStudentRepository) SubmitExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, at time.Time) error {
+	for _, es := range r.ess {
+		if es.StudentID == studentID && es.EnteranceTokenID == tokenID && es.SubmittedAt == nil {
+			es.SubmittedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *fakeExamineStudentRepository) AckExamineStudent(ctx context.Context, tokenID, studentID raid.Raid, seq uint64) error {
+	for _, es := range r.ess {
+		if es.StudentID == studentID && es.EnteranceTokenID == tokenID && es.SyncSeq < seq {
+			es.SyncSeq = seq
+		}
+	}
+	return nil
+}
+
+type fakeEnteranceTokenRepository map[raid.Raid]*domain.EnteranceToken
+
+func (r fakeEnteranceTokenRepository) GetEnteranceToken(ctx context.Context, tokenID raid.Raid) (*domain.EnteranceToken, error) {
+	if t, ok := r[tokenID]; ok {
+		return t, nil
+	}
+	return nil, domain.ErrEnteranceTokenNotFound
+}
+
+func (r fakeEnteranceTokenRepository) GetEnteranceTokenByCode(ctx context.Context, code string) (*domain.EnteranceToken, error) {
+	for _, t := range r {
+		if t.Code == code {
+			return t, nil
+		}
+	}
+	return nil, domain.ErrEnteranceTokenNotFound
+}
+
+func (r fakeEnteranceTokenRepository) ListEnteranceToken(ctx context.Context, o *domain.ListEnteranceTokenOptions) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListSchedule(ctx context.Context, o *domain.ScheduleOptions) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListConflictingEnteranceToken(ctx context.Context, token *domain.EnteranceToken) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+func (r fakeEnteranceTokenRepository) ListConflictingEnteranceTokenOfStudents(ctx context.Context, token *domain.EnteranceToken, studentIDs []raid.Raid) ([]*domain.EnteranceToken, error) {
+	return nil, nil
+}
+
+type fakeExamineAnswerRepository map[raid.Raid]*domain.ExamineAnswer
+
+func (r fakeExamineAnswerRepository) GetExamineAnswer(ctx context.Context, examineAnswerID raid.Raid) (*domain.ExamineAnswer, error) {
+	if a, ok := r[examineAnswerID]; ok {
+		return a, nil
+	}
+	return nil, domain.ErrExamineAnswerNotFound
+}
+
+func (r fakeExamineAnswerRepository) ListExamineAnswer(ctx context.Context, o *domain.ListExamineAnswerOptions) ([]*domain.ExamineAnswer, error) {
+	return nil, nil
+}
+
+type fakeExaminationRepository map[raid.Raid]*domain.Examination
+
+func (r fakeExaminationRepository) GetExamination(ctx context.Context, examinationID raid.Raid) (*domain.Examination, error) {
+	if ex, ok := r[examinationID]; ok {
+		return ex, nil
+	}
+	return nil, domain.ErrExaminationNotFound
+}
+
+func (r fakeExaminationRepository) ListExamination(ctx context.Context, o *domain.ListExaminationOptions) ([]*domain.Examination, error) {
+	return nil, nil
+}
+
+// createStudent creates student studentID of organization orgID, answers are
+// only written for students of organization of session.
+func createStudent(t *testing.T, db *gorm.DB, studentID, orgID raid.Raid) {
+	t.Helper()
+	if err := db.AutoMigrate(&domain.Student{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	s := &domain.Student{OrganizationID: orgID, AdminID: raid.NewRaid().WithPrefix(domain.AdminIDPrefix).WithRandom(), Username: studentID.String()}
+	s.ID = studentID
+	if err := db.Create(s).Error; err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestSyncStudentAnswer(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_answer_sync?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.StudentAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	now := time.Now()
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	examinationID, studentID, orgID := newID(domain.ExaminationIDPrefix), newID(domain.StudentIDPrefix), newID(domain.OrganizationIDPrefix)
+	createStudent(t, db, studentID, orgID)
+	token := &domain.EnteranceToken{ExaminationID: examinationID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(time.Hour)}
+	token.ID = newID(domain.EnteranceTokenIDPrefix)
+	otherToken := &domain.EnteranceToken{ExaminationID: examinationID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(time.Hour)}
+	otherToken.ID = newID(domain.EnteranceTokenIDPrefix)
+	closedToken := &domain.EnteranceToken{ExaminationID: examinationID, EnteranceFrom: now.Add(-2 * time.Hour), EnteranceUntil: now.Add(-time.Hour)}
+	closedToken.ID = newID(domain.EnteranceTokenIDPrefix)
+	lateToken := &domain.EnteranceToken{ExaminationID: examinationID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(-time.Minute)}
+	lateToken.ID = newID(domain.EnteranceTokenIDPrefix)
+	answers := fakeExamineAnswerRepository{}
+	newAnswer := func(examinationID raid.Raid) raid.Raid {
+		a := &domain.ExamineAnswer{ExaminationID: examinationID}
+		a.ID = newID(domain.ExamineAnswerIDPrefix)
+		answers[a.ID] = a
+		return a.ID
+	}
+	first, second, foreign := newAnswer(examinationID), newAnswer(examinationID), newAnswer(newID(domain.ExaminationIDPrefix))
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	r := chi.NewRouter()
+	r.Route("/student-answer", (&StudentAnswerRouter{
+		Auth: a,
+		StudentAnswerService: &StudentAnswerService{
+			StudentAnswerRepository:  &StudentAnswerRepositoryGorm{db},
+			ExaminationRepository:    fakeExaminationRepository{examinationID: {}},
+			EnteranceTokenRepository: fakeEnteranceTokenRepository{token.ID: token, otherToken.ID: otherToken, closedToken.ID: closedToken, lateToken.ID: lateToken},
+			ExamineAnswerRepository:  answers,
+			ExamineStudentRepository: &fakeExamineStudentRepository{ess: []*domain.ExamineStudent{
+				{StudentID: studentID, EnteranceTokenID: token.ID},
+				{StudentID: studentID, EnteranceTokenID: closedToken.ID},
+				{StudentID: studentID, EnteranceTokenID: lateToken.ID},
+			}},
+			Auth:      a,
+			SyncGrace: 5 * time.Minute,
+		},
+	}).Route)
+
+	sign := func(subject raid.Raid, role domain.Role) *http.Cookie {
+		c, err := a.Sign(auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: subject.String()},
+			Role:             role,
+			Organization:     orgID.String(),
+		})
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		return c
+	}
+	student := sign(studentID, domain.RoleStudent)
+	sync := func(session *http.Cookie, s *domain.AnswerSync) (int, *domain.AnswerSyncResult) {
+		b, _ := json.Marshal(s)
+		req := httptest.NewRequest(http.MethodPost, "/student-answer/sync", bytes.NewReader(b))
+		req.AddCookie(session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := &struct {
+			Data *domain.AnswerSyncResult `json:"data"`
+		}{}
+		_ = json.NewDecoder(w.Body).Decode(res)
+		return w.Code, res.Data
+	}
+	selected := func(res *domain.AnswerSyncResult) []raid.Raid {
+		ids := make([]raid.Raid, 0)
+		for _, a := range res.Answers {
+			ids = append(ids, a.ExamineAnswerID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+		return ids
+	}
+	expectSelected := func(t *testing.T, res *domain.AnswerSyncResult, want ...raid.Raid) {
+		sort.Slice(want, func(i, j int) bool { return want[i].String() < want[j].String() })
+		got := selected(res)
+		if len(got) != len(want) {
+			t.Fatalf("expected %d selected answers, got %v", len(want), got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("expected selected answers %v, got %v", want, got)
+				return
+			}
+		}
+	}
+
+	batch := &domain.AnswerSync{
+		EnteranceTokenID: token.ID,
+		Changes: []*domain.AnswerChange{
+			{Seq: 2, ExamineAnswerID: first, Selected: false, At: now.Add(-9 * time.Minute)},
+			{Seq: 1, ExamineAnswerID: first, Selected: true, At: now.Add(-10 * time.Minute)},
+			{Seq: 3, ExamineAnswerID: second, Selected: true, At: now.Add(-8 * time.Minute)},
+			{Seq: 4, ExamineAnswerID: foreign, Selected: true, At: now.Add(-7 * time.Minute)},
+		},
+	}
+	code, res := sync(student, batch)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if res.Ack != 4 {
+		t.Errorf("expected every change to be acknowledged, got ack %d", res.Ack)
+	}
+	if len(res.Rejected) != 1 || res.Rejected[0].Seq != 4 {
+		t.Errorf("expected foreign answer to be rejected, got %+v", res.Rejected)
+	}
+	expectSelected(t, res, second)
+
+	t.Run("acknowledged changes are skipped", func(t *testing.T) {
+		_, res := sync(student, &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+			{Seq: 5, ExamineAnswerID: first, Selected: true, At: now.Add(-5 * time.Minute)},
+		}})
+		expectSelected(t, res, first, second)
+
+		_, res = sync(student, batch)
+		if res.Ack != 5 || len(res.Rejected) != 0 {
+			t.Errorf("expected resent batch to be skipped, got ack %d and rejected %+v", res.Ack, res.Rejected)
+		}
+		expectSelected(t, res, first, second)
+	})
+
+	t.Run("later change wins", func(t *testing.T) {
+		_, res := sync(student, &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+			{Seq: 6, ExamineAnswerID: first, Selected: false, At: now.Add(-3 * time.Minute)},
+		}})
+		expectSelected(t, res, second)
+
+		var rows int64
+		if err := db.Unscoped().Model(&domain.StudentAnswer{}).Where("examine_answer_id = ?", first.String()).Count(&rows).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		if rows != 1 {
+			t.Errorf("expected single row per examine answer of attempt, got %d", rows)
+		}
+
+		// made offline before the change above, but synced after it
+		_, res = sync(student, &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+			{Seq: 7, ExamineAnswerID: first, Selected: true, At: now.Add(-4 * time.Minute)},
+		}})
+		if res.Ack != 7 || len(res.Rejected) != 0 {
+			t.Errorf("expected older change to be acknowledged, got ack %d and rejected %+v", res.Ack, res.Rejected)
+		}
+		expectSelected(t, res, second)
+	})
+
+	t.Run("late reconnection", func(t *testing.T) {
+		_, res := sync(student, &domain.AnswerSync{EnteranceTokenID: lateToken.ID, Changes: []*domain.AnswerChange{
+			{Seq: 1, ExamineAnswerID: first, Selected: true, At: now.Add(-30 * time.Minute)},
+			{Seq: 2, ExamineAnswerID: second, Selected: true, At: now.Add(time.Hour)},
+		}})
+		if res.Ack != 2 || len(res.Rejected) != 0 {
+			t.Errorf("expected changes made within window to be accepted within sync grace, got ack %d and rejected %+v", res.Ack, res.Rejected)
+		}
+		expectSelected(t, res, first, second)
+		for _, a := range res.Answers {
+			if a.ExamineAnswerID == second && !a.AnsweredAt.Equal(lateToken.EnteranceUntil) {
+				t.Errorf("expected time of change to be clamped to end of window, got %s", a.AnsweredAt)
+			}
+		}
+	})
+
+	t.Run("closed window", func(t *testing.T) {
+		_, res := sync(student, &domain.AnswerSync{EnteranceTokenID: closedToken.ID, Changes: []*domain.AnswerChange{
+			{Seq: 1, ExamineAnswerID: first, Selected: true, At: now.Add(-90 * time.Minute)},
+		}})
+		if res.Ack != 1 || len(res.Rejected) != 1 {
+			t.Errorf("expected change received after window closed to be rejected, got ack %d and rejected %+v", res.Ack, res.Rejected)
+		}
+		expectSelected(t, res)
+
+		b, _ := json.Marshal(&domain.StudentAnswer{EnteranceTokenID: closedToken.ID, ExamineAnswerID: first})
+		req := httptest.NewRequest(http.MethodPost, "/student-answer/create", bytes.NewReader(b))
+		req.AddCookie(student)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected answer created after window closed to be refused, got %d", w.Code)
+		}
+	})
+
+	t.Run("invalid sync", func(t *testing.T) {
+		duplicate := &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+			{Seq: 8, ExamineAnswerID: first, At: now},
+			{Seq: 8, ExamineAnswerID: second, At: now},
+		}}
+		if code, _ := sync(student, duplicate); code != http.StatusBadRequest {
+			t.Errorf("expected duplicate seq to be refused, got %d", code)
+		}
+		if code, _ := sync(student, &domain.AnswerSync{EnteranceTokenID: otherToken.ID}); code != http.StatusForbidden {
+			t.Errorf("expected sync of unassigned enterance token to be refused, got %d", code)
+		}
+		if code, _ := sync(sign(newID(domain.AdminIDPrefix), domain.RoleTeacher), batch); code != http.StatusForbidden {
+			t.Errorf("expected sync by staff to be refused, got %d", code)
+		}
+	})
+}
+
+type fakeExamineQuestionRepository []*domain.ExamineQuestion
+
+func (r fakeExamineQuestionRepository) GetExamineQuestion(ctx context.Context, examineQuestionID raid.Raid) (*domain.ExamineQuestion, error) {
+	for _, q := range r {
+		if q.ID == examineQuestionID {
+			return q, nil
+		}
+	}
+	return nil, domain.ErrExamineQuestionNotFound
+}
+
+func (r fakeExamineQuestionRepository) ListExamineQuestion(ctx context.Context, o *domain.ListExamineQuestionOptions) ([]*domain.ExamineQuestion, error) {
+	qs := make([]*domain.ExamineQuestion, 0)
+	for _, q := range r {
+		if q.ExaminationID == o.ExaminationID {
+			qs = append(qs, q)
+		}
+	}
+	return qs, nil
+}
+
+func TestAnswerSummary(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_answer_summary?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.ExamineAnswer{}, &domain.StudentAnswer{}, &domain.QuestionFlag{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	now := time.Now()
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	examinationID, studentID, orgID := newID(domain.ExaminationIDPrefix), newID(domain.StudentIDPrefix), newID(domain.OrganizationIDPrefix)
+	createStudent(t, db, studentID, orgID)
+	token := &domain.EnteranceToken{ExaminationID: examinationID, EnteranceFrom: now.Add(-time.Hour), EnteranceUntil: now.Add(time.Hour)}
+	token.ID = newID(domain.EnteranceTokenIDPrefix)
+	questions := fakeExamineQuestionRepository{}
+	answers := fakeExamineAnswerRepository{}
+	for i := 0; i < 4; i++ {
+		q := &domain.ExamineQuestion{ExaminationID: examinationID}
+		q.ID = newID(domain.ExamineQuestionIDPrefix)
+		questions = append(questions, q)
+		a := &domain.ExamineAnswer{ExaminationID: examinationID, ExamineQuestionID: q.ID}
+		a.ID = newID(domain.ExamineAnswerIDPrefix)
+		answers[a.ID] = a
+		if err := db.Create(a).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	sort.Slice(questions, func(i, j int) bool { return questions[i].ID.String() < questions[j].ID.String() })
+	examination := &domain.Examination{ExamineQuestions: questions}
+	examination.ID = examinationID
+	answerOf := func(q *domain.ExamineQuestion) raid.Raid {
+		for id, a := range answers {
+			if a.ExamineQuestionID == q.ID {
+				return id
+			}
+		}
+		return raid.Raid{}
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	r := chi.NewRouter()
+	r.Route("/student-answer", (&StudentAnswerRouter{
+		Auth: a,
+		StudentAnswerService: &StudentAnswerService{
+			StudentAnswerRepository:   &StudentAnswerRepositoryGorm{db},
+			QuestionFlagRepository:    &QuestionFlagRepositoryGorm{db},
+			ExaminationRepository:     fakeExaminationRepository{examinationID: examination},
+			EnteranceTokenRepository:  fakeEnteranceTokenRepository{token.ID: token},
+			ExamineAnswerRepository:   answers,
+			ExamineQuestionRepository: questions,
+			ExamineStudentRepository:  &fakeExamineStudentRepository{ess: []*domain.ExamineStudent{{StudentID: studentID, EnteranceTokenID: token.ID}}},
+			Auth:                      a,
+		},
+	}).Route)
+
+	c, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: studentID.String()},
+		Role:             domain.RoleStudent,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	do := func(method, url string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.AddCookie(c)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// first and second question answered, second and third flagged, then
+	// flag of third question cleared and fourth flagged
+	do(http.MethodPost, "/student-answer/sync", &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+		{Seq: 1, ExamineAnswerID: answerOf(questions[0]), Selected: true, At: time.Now()},
+		{Seq: 2, ExamineAnswerID: answerOf(questions[1]), Selected: true, At: time.Now()},
+	}})
+	for _, f := range []*domain.QuestionFlag{
+		{EnteranceTokenID: token.ID, ExamineQuestionID: questions[1].ID, Flagged: true},
+		{EnteranceTokenID: token.ID, ExamineQuestionID: questions[2].ID, Flagged: true},
+		{EnteranceTokenID: token.ID, ExamineQuestionID: questions[2].ID, Flagged: false},
+		{EnteranceTokenID: token.ID, ExamineQuestionID: questions[3].ID, Flagged: true},
+	} {
+		if w := do(http.MethodPut, "/student-answer/flag", f); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+	}
+	if w := do(http.MethodPut, "/student-answer/flag", &domain.QuestionFlag{EnteranceTokenID: token.ID, ExamineQuestionID: newID(domain.ExamineQuestionIDPrefix), Flagged: true}); w.Code != http.StatusNotFound {
+		t.Errorf("expected flag of question outside examination to be refused, got %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/student-answer/summary?enteranceTokenID="+token.ID.String(), nil)
+	res := &struct {
+		Data *domain.AnswerSummary `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil || res.Data == nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	want := []domain.QuestionStatus{domain.QuestionAnswered, domain.QuestionFlagged, domain.QuestionUnanswered, domain.QuestionFlagged}
+	if len(res.Data.Questions) != len(want) {
+		t.Fatalf("expected %d questions, got %d", len(want), len(res.Data.Questions))
+	}
+	for i, q := range res.Data.Questions {
+		if q.Number != i+1 || q.Status != want[i] {
+			t.Errorf("expected question %d to be %s, got %d %s", i+1, want[i], q.Number, q.Status)
+		}
+	}
+	if !res.Data.Questions[1].Answered {
+		t.Error("expected flagged question to stay answered")
+	}
+	if got := fmt.Sprint(res.Data.Flagged, res.Data.Unanswered); got != "[2 4] [3 4]" {
+		t.Errorf("expected flagged [2 4] and unanswered [3 4], got %s", got)
+	}
+
+	summaryURL := "/student-answer/summary?enteranceTokenID=" + token.ID.String() + "&studentID=" + studentID.String()
+	for name, tc := range map[string]struct {
+		claims auth.Claims
+		code   int
+	}{
+		"proctor":          {auth.Claims{Role: domain.RoleProctor}, http.StatusOK},
+		"scoped api token": {auth.Claims{Role: domain.RoleSuperAdmin, Scopes: domain.Permissions{domain.PermissionEnteranceTokenRead}}, http.StatusForbidden},
+		"teacher":          {auth.Claims{Role: domain.RoleTeacher}, http.StatusOK},
+	} {
+		tc.claims.Subject = newID(domain.AdminIDPrefix).String()
+		tc.claims.Organization = orgID.String()
+		staff, err := a.Sign(tc.claims)
+		if err != nil {
+			t.Fatal("failed to sign session", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, summaryURL, nil)
+		req.AddCookie(staff)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: expected summary of student to be %d, got %d", name, tc.code, w.Code)
+		}
+
+		b, _ := json.Marshal(&domain.StudentAnswer{ExamineAnswerID: answerOf(questions[2]), EnteranceTokenID: token.ID, StudentID: studentID})
+		req = httptest.NewRequest(http.MethodPost, "/student-answer/create", bytes.NewReader(b))
+		req.AddCookie(staff)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected answer on behalf of student to be refused, got %d", name, w.Code)
+		}
+	}
+
+	// answers are only written by student assigned to token, for answers of
+	// examination of the token
+	otherID := newID(domain.StudentIDPrefix)
+	createStudent(t, db, otherID, orgID)
+	other, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: otherID.String()},
+		Role:             domain.RoleStudent,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	foreign := &domain.ExamineAnswer{ExaminationID: newID(domain.ExaminationIDPrefix), ExamineQuestionID: newID(domain.ExamineQuestionIDPrefix)}
+	foreign.ID = newID(domain.ExamineAnswerIDPrefix)
+	answers[foreign.ID] = foreign
+	for name, tc := range map[string]struct {
+		session  *http.Cookie
+		answerID raid.Raid
+		code     int
+	}{
+		"unassigned student": {other, answerOf(questions[2]), http.StatusForbidden},
+		"foreign answer":     {c, foreign.ID, http.StatusNotFound},
+	} {
+		b, _ := json.Marshal(&domain.StudentAnswer{ExamineAnswerID: tc.answerID, EnteranceTokenID: token.ID})
+		req := httptest.NewRequest(http.MethodPost, "/student-answer/create", bytes.NewReader(b))
+		req.AddCookie(tc.session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: expected answer to be refused with %d, got %d", name, tc.code, w.Code)
+		}
+	}
+
+	submit := func(confirm bool) (int, map[string]string) {
+		w := do(http.MethodPost, "/student-answer/submit", &domain.AnswerSubmit{EnteranceTokenID: token.ID, Confirm: confirm})
+		res := &struct {
+			Errors map[string]string `json:"errors"`
+		}{}
+		_ = json.NewDecoder(w.Body).Decode(res)
+		return w.Code, res.Errors
+	}
+	if code, errs := submit(false); code != http.StatusConflict || errs["flagged"] != "2,4" || errs["unanswered"] != "3,4" {
+		t.Errorf("expected submit to warn about flagged and unanswered questions, got %d %v", code, errs)
+	}
+	if code, _ := submit(true); code != http.StatusOK {
+		t.Errorf("expected confirmed submit to succeed, got %d", code)
+	}
+	if code, _ := submit(false); code != http.StatusOK {
+		t.Errorf("expected submit of submitted attempt to succeed, got %d", code)
+	}
+	if w := do(http.MethodPut, "/student-answer/flag", &domain.QuestionFlag{EnteranceTokenID: token.ID, ExamineQuestionID: questions[0].ID, Flagged: true}); w.Code != http.StatusForbidden {
+		t.Errorf("expected flag after submit to be refused, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/student-answer/create", &domain.StudentAnswer{ExamineAnswerID: answerOf(questions[2]), EnteranceTokenID: token.ID}); w.Code != http.StatusForbidden {
+		t.Errorf("expected answer after submit to be refused, got %d", w.Code)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open("file:student_answer_navigation?mode=memory&cache=shared"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := db.AutoMigrate(&domain.ExamineAnswer{}, &domain.StudentAnswer{}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	now := time.Now()
+	newID := func(prefix string) raid.Raid {
+		return raid.NewRaid().WithPrefix(prefix).WithRandom().WithTimestampNow()
+	}
+	studentID, orgID := newID(domain.StudentIDPrefix), newID(domain.OrganizationIDPrefix)
+	createStudent(t, db, studentID, orgID)
+	// attempt started long after window opened, sections are timed from its
+	// start so first section is already closed and second section is open
+	examination := &domain.Examination{Linear: true}
+	examination.ID = newID(domain.ExaminationIDPrefix)
+	first := &domain.ExaminationSection{Order: 1, DurationMinutes: 20}
+	first.ID = newID(domain.ExaminationSectionIDPrefix)
+	second := &domain.ExaminationSection{Order: 2, DurationMinutes: 60}
+	second.ID = newID(domain.ExaminationSectionIDPrefix)
+	examination.Sections = []*domain.ExaminationSection{second, first}
+	token := &domain.EnteranceToken{ExaminationID: examination.ID, EnteranceFrom: now.Add(-2 * time.Hour), EnteranceUntil: now.Add(2 * time.Hour)}
+	token.ID = newID(domain.EnteranceTokenIDPrefix)
+	es := &domain.ExamineStudent{StudentID: studentID, EnteranceTokenID: token.ID}
+
+	answers := fakeExamineAnswerRepository{}
+	// answer of question i, questions are numbered in order of their section
+	// and the last question has no section
+	answerOf := make([]raid.Raid, 0)
+	questionIDs := []raid.Raid{newID(domain.ExamineQuestionIDPrefix), newID(domain.ExamineQuestionIDPrefix), newID(domain.ExamineQuestionIDPrefix), newID(domain.ExamineQuestionIDPrefix)}
+	sort.Slice(questionIDs, func(i, j int) bool { return questionIDs[i].String() < questionIDs[j].String() })
+	for i, section := range []*domain.ExaminationSection{first, second, second, nil} {
+		q := &domain.ExamineQuestion{ExaminationID: examination.ID}
+		q.ID = questionIDs[i]
+		if section != nil {
+			q.ExaminationSectionID = section.ID
+		}
+		examination.ExamineQuestions = append(examination.ExamineQuestions, q)
+		a := &domain.ExamineAnswer{ExaminationID: examination.ID, ExamineQuestionID: q.ID}
+		a.ID = newID(domain.ExamineAnswerIDPrefix)
+		answers[a.ID] = a
+		if err := db.Create(a).Error; err != nil {
+			t.Fatal(err.Error())
+		}
+		answerOf = append(answerOf, a.ID)
+	}
+
+	a := &auth.Auth{Name: "session", SigningMethod: jwt.SigningMethodHS512, Secret: []byte("secret")}
+	r := chi.NewRouter()
+	r.Route("/student-answer", (&StudentAnswerRouter{
+		Auth: a,
+		StudentAnswerService: &StudentAnswerService{
+			StudentAnswerRepository:  &StudentAnswerRepositoryGorm{db},
+			ExaminationRepository:    fakeExaminationRepository{examination.ID: examination},
+			EnteranceTokenRepository: fakeEnteranceTokenRepository{token.ID: token},
+			ExamineAnswerRepository:  answers,
+			ExamineStudentRepository: &fakeExamineStudentRepository{ess: []*domain.ExamineStudent{es}},
+			Auth:                     a,
+		},
+	}).Route)
+
+	c, err := a.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: studentID.String()},
+		Role:             domain.RoleStudent,
+		Organization:     orgID.String(),
+	})
+	if err != nil {
+		t.Fatal("failed to sign session", err)
+	}
+	do := func(method, url string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.AddCookie(c)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	create := func(examineAnswerID raid.Raid) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/student-answer/create", &domain.StudentAnswer{ExamineAnswerID: examineAnswerID, EnteranceTokenID: token.ID})
+	}
+	if w := create(answerOf[2]); w.Code != http.StatusForbidden {
+		t.Errorf("expected question of section to be read-only before attempt started, got %d", w.Code)
+	}
+	started := now.Add(-25 * time.Minute)
+	es.StartedAt = &started
+
+	w := do(http.MethodPost, "/student-answer/sync", &domain.AnswerSync{EnteranceTokenID: token.ID, Changes: []*domain.AnswerChange{
+		{Seq: 1, ExamineAnswerID: answerOf[0], Selected: true, At: now},
+		{Seq: 2, ExamineAnswerID: answerOf[2], Selected: true, At: now},
+		{Seq: 3, ExamineAnswerID: answerOf[1], Selected: true, At: now},
+		{Seq: 4, ExamineAnswerID: answerOf[2], Selected: false, At: now},
+	}})
+	res := &struct {
+		Data *domain.AnswerSyncResult `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil || res.Data == nil {
+		t.Fatalf("failed to decode sync result: %v", err)
+	}
+	if len(res.Data.Rejected) != 2 || res.Data.Rejected[0].Seq != 1 || res.Data.Rejected[1].Seq != 3 {
+		t.Errorf("expected answer of closed section and earlier question to be rejected, got %+v", res.Data.Rejected)
+	}
+	if len(res.Data.Answers) != 0 {
+		t.Errorf("expected unselected answer to still be unselected, got %d answers", len(res.Data.Answers))
+	}
+
+	if w := create(answerOf[1]); w.Code != http.StatusForbidden {
+		t.Errorf("expected question before unselected later question to stay read-only, got %d", w.Code)
+	}
+	if w := create(answerOf[2]); w.Code != http.StatusOK {
+		t.Fatalf("expected furthest question to stay writable, got %d: %s", w.Code, w.Body)
+	}
+	created := &struct {
+		Data *domain.StudentAnswer `json:"data"`
+	}{}
+	if w := create(answerOf[3]); w.Code != http.StatusOK {
+		t.Fatalf("expected later question to be writable, got %d: %s", w.Code, w.Body)
+	} else if err := json.NewDecoder(w.Body).Decode(created); err != nil {
+		t.Fatal(err.Error())
+	}
+	if w := create(answerOf[2]); w.Code != http.StatusForbidden {
+		t.Errorf("expected question to become read-only once student moved on, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/student-answer/"+created.Data.ID.String(), nil); w.Code != http.StatusNoContent {
+		t.Errorf("expected answer of furthest question to be deletable, got %d", w.Code)
+	}
+}
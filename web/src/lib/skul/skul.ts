@@ -25,6 +25,34 @@ export interface Examination {
 	admin: UserInfo
 }
 
+export interface Page {
+	count: number
+	offset: number
+	page: number
+}
+
+// Paginated is body of list endpoints, data holds items of page.
+export interface Paginated<T> {
+	data: T[]
+	page: Page
+}
+
+// csrfToken is the latest csrf token sent by server, it is echoed on every
+// request which is not GET, see internal/pkg/csrf.
+let csrfToken: string | undefined
+
+function readCsrfToken(): string | undefined {
+	if (typeof document !== "undefined") {
+		for (const c of document.cookie.split(";")) {
+			const [k, v] = c.trim().split("=")
+			if (k === "csrf" && v) {
+				return decodeURIComponent(v)
+			}
+		}
+	}
+	return csrfToken
+}
+
 export abstract class Client {
 	#baseUrl?: URL
 	constructor(baseUrl: URL) {
@@ -36,6 +64,24 @@ export abstract class Client {
 		method: string = "GET",
 		body?: any,
 	): Promise<T> {
+		const resBody = await this.request(path, method, body)
+		return resBody?.data
+	}
+
+	async fetchPage<T>(
+		path: string,
+		method: string = "GET",
+		body?: any,
+	): Promise<Paginated<T>> {
+		const resBody = await this.request(path, method, body)
+		return { data: resBody.data ?? [], page: resBody.page }
+	}
+
+	private async request(
+		path: string,
+		method: string,
+		body?: any,
+	): Promise<any> {
 		if (!this.#baseUrl) {
 			throw new SkulError("baseUrl not set")
 		}
@@ -47,6 +93,12 @@ export abstract class Client {
 			method,
 			headers,
 		}
+		if (method !== "GET") {
+			const token = readCsrfToken()
+			if (token) {
+				headers.set("x-csrf-token", token)
+			}
+		}
 		if (body) {
 			if (method !== "GET") {
 				init.body = JSON.stringify(body)
@@ -59,6 +111,7 @@ export abstract class Client {
 		}
 		const req = new Request(url, init)
 		const res = await fetch(req)
+		csrfToken = res.headers.get("x-csrf-token") ?? csrfToken
 		if (res.status === 429) {
 			throw new SkulError("Too many request", res)
 		}
@@ -70,7 +123,7 @@ export abstract class Client {
 			throw new SkulError(resBody.message, res, resBody)
 		}
 
-		return resBody.data
+		return resBody
 	}
 
 	websocket(path: string): Websocket {
@@ -126,7 +179,7 @@ export class ExaminationClient extends Client {
 	}
 
 	list(page: number = 1) {
-		return this.fetch("list", "GET", {
+		return this.fetchPage<Examination>("list", "GET", {
 			page,
 		})
 	}